@@ -0,0 +1,30 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/lileye/backend/internal/client"
+)
+
+// newClient creates a client of the server at rawURL. caFile, if set, is
+// the PEM CA the server's certificate is checked against, such as the
+// self-signed CA from /api/v1/tls/ca.pem.
+func newClient(rawURL, key, caFile string) (*client.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s holds no PEM certificate", caFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	return client.New(rawURL, client.WithKey(key), client.WithHTTPClient(&http.Client{Transport: transport}))
+}
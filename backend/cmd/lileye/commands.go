@@ -0,0 +1,334 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/lileye/backend/internal/client"
+	"github.com/lileye/backend/internal/models"
+)
+
+// commands are the subcommands of the CLI, in the order they are listed
+var commands = []command{
+	{name: "users list", help: "list the users", setup: noFlags(usersList)},
+	{name: "users add", args: []string{"<name>"}, help: "add a user", setup: noFlags(usersAdd)},
+	{name: "users remove", args: []string{"<name>"}, help: "remove a user and revoke their keys", setup: usersRemove},
+	{name: "keys list", help: "list the admin keys", setup: noFlags(keysList)},
+	{name: "keys create", args: []string{"<user>"}, help: "create an admin key for a user", setup: keysCreate},
+	{name: "keys revoke", args: []string{"<id>"}, help: "revoke an admin key", setup: noFlags(keysRevoke)},
+	{name: "devices list", help: "list the devices with their notification counts", setup: noFlags(devicesList)},
+	{name: "devices purge", args: []string{"<device id>"}, help: "delete every notification of a device", setup: devicesPurge},
+	{name: "retention show", help: "show the retention policy and what it would delete now", setup: noFlags(retentionShow)},
+	{name: "retention run", help: "delete the notifications past the retention period now", setup: noFlags(retentionRun)},
+	{name: "purge", help: "delete the notifications of a device or app, or before a time", setup: purge},
+	{name: "stats", help: "summarise what the server stores", setup: noFlags(stats)},
+	{name: "export", help: "export notifications as CSV, NDJSON or HTML", setup: export},
+	{name: "backup list", help: "list the backups", setup: noFlags(backupList)},
+	{name: "backup create", help: "take a backup now", setup: noFlags(backupCreate)},
+	{name: "backup download", args: []string{"<file>"}, help: "download a backup", setup: backupDownload},
+}
+
+// noFlags sets up a command without flags of its own
+func noFlags(run func(c *cli, args []string) error) func(*flag.FlagSet) func(*cli, []string) error {
+	return func(*flag.FlagSet) func(*cli, []string) error {
+		return run
+	}
+}
+
+func usersList(c *cli, _ []string) error {
+	users, err := c.client.ListUsers(c.ctx)
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, len(users))
+	for i, u := range users {
+		rows[i] = []string{u.Name, formatTime(u.CreatedAt)}
+	}
+	return c.print(users, []string{"NAME", "CREATED"}, rows)
+}
+
+func usersAdd(c *cli, args []string) error {
+	user, err := c.client.CreateUser(c.ctx, &models.CreateUserRequest{Name: args[0]})
+	if err != nil {
+		return err
+	}
+	return c.print(user, []string{"NAME", "CREATED"}, [][]string{{user.Name, formatTime(user.CreatedAt)}})
+}
+
+func usersRemove(fs *flag.FlagSet) func(*cli, []string) error {
+	yes := fs.Bool("yes", false, "do not ask for confirmation")
+	return func(c *cli, args []string) error {
+		if !*yes {
+			if err := c.confirm(fmt.Sprintf("Remove user %s and revoke their keys?", args[0])); err != nil {
+				return err
+			}
+		}
+		_, err := c.client.DeleteUser(c.ctx, args[0])
+		return err
+	}
+}
+
+func keysList(c *cli, _ []string) error {
+	keys, err := c.client.ListKeys(c.ctx)
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, len(keys))
+	for i, k := range keys {
+		rows[i] = []string{strconv.FormatUint(uint64(k.ID), 10), k.User, k.Name, k.Prefix + "…",
+			formatTime(k.CreatedAt), formatTimePtr(k.LastUsedAt), formatTimePtr(k.RevokedAt)}
+	}
+	return c.print(keys, []string{"ID", "USER", "NAME", "PREFIX", "CREATED", "LAST USED", "REVOKED"}, rows)
+}
+
+func keysCreate(fs *flag.FlagSet) func(*cli, []string) error {
+	name := fs.String("name", "", "name of the key, such as the machine it is used on")
+	return func(c *cli, args []string) error {
+		key, err := c.client.CreateKey(c.ctx, &models.CreateKeyRequest{User: args[0], Name: *name})
+		if err != nil {
+			return err
+		}
+		if c.json {
+			return c.print(key, nil, nil)
+		}
+		fmt.Fprintf(c.out, "Created key %d for %s. It is shown once:\n%s\n", key.ID, key.User, key.Key)
+		return nil
+	}
+}
+
+func keysRevoke(c *cli, args []string) error {
+	id, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid key ID %q", args[0])
+	}
+	_, err = c.client.RevokeKey(c.ctx, uint(id))
+	return err
+}
+
+func devicesList(c *cli, _ []string) error {
+	devices, err := c.client.ListDeviceStats(c.ctx)
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, len(devices))
+	for i, d := range devices {
+		rows[i] = []string{d.DeviceID, d.DeviceName, strconv.FormatInt(d.Notifications, 10), formatTime(d.LastSeen)}
+	}
+	return c.print(devices, []string{"DEVICE", "NAME", "NOTIFICATIONS", "LAST SEEN"}, rows)
+}
+
+func devicesPurge(fs *flag.FlagSet) func(*cli, []string) error {
+	yes := fs.Bool("yes", false, "do not ask for confirmation")
+	return func(c *cli, args []string) error {
+		return c.purge(client.PurgeNotificationsParams{DeviceID: args[0]}, *yes)
+	}
+}
+
+func retentionShow(c *cli, _ []string) error {
+	status, err := c.client.GetRetention(c.ctx)
+	if err != nil {
+		return err
+	}
+	maxAge := "forever"
+	if status.MaxAge > 0 {
+		maxAge = time.Duration(status.MaxAge).String()
+	}
+	rows := [][]string{
+		{"Keep notifications for", maxAge},
+		{"Interval", time.Duration(status.Interval).String()},
+		{"Cutoff", formatTimePtr(status.Cutoff)},
+		{"Eligible for deletion", strconv.FormatInt(status.Eligible, 10)},
+	}
+	if status.LastRun != nil {
+		rows = append(rows,
+			[]string{"Last run", formatTime(status.LastRun.Time)},
+			[]string{"Deleted by last run", strconv.FormatInt(status.LastRun.Deleted, 10)})
+	}
+	return c.print(status, nil, rows)
+}
+
+func retentionRun(c *cli, _ []string) error {
+	run, err := c.client.RunRetention(c.ctx)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.print(run, nil, nil)
+	}
+	fmt.Fprintf(c.out, "Deleted %d notifications from before %s\n", run.Deleted, formatTime(run.Cutoff))
+	return nil
+}
+
+func purge(fs *flag.FlagSet) func(*cli, []string) error {
+	device := fs.String("device", "", "device ID of the notifications")
+	pkg := fs.String("package", "", "package name of the notifications")
+	before := fs.String("before", "", "delete notifications posted before this RFC 3339 time")
+	all := fs.Bool("all", false, "delete every notification")
+	yes := fs.Bool("yes", false, "do not ask for confirmation")
+	return func(c *cli, _ []string) error {
+		params := client.PurgeNotificationsParams{DeviceID: *device, Package: *pkg, All: *all}
+		var err error
+		if params.Before, err = parseTime("before", *before); err != nil {
+			return err
+		}
+		if params == (client.PurgeNotificationsParams{}) {
+			return errors.New("set -device, -package, -before or -all")
+		}
+		return c.purge(params, *yes)
+	}
+}
+
+// purge deletes the notifications selected by params after confirming how
+// many they are
+func (c *cli) purge(params client.PurgeNotificationsParams, yes bool) error {
+	if !yes {
+		dryRun := params
+		dryRun.DryRun = true
+		result, err := c.client.PurgeNotifications(c.ctx, &dryRun)
+		if err != nil {
+			return err
+		}
+		if err := c.confirm(fmt.Sprintf("Permanently delete %d notifications?", result.Notifications)); err != nil {
+			return err
+		}
+	}
+	result, err := c.client.PurgeNotifications(c.ctx, &params)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.print(result, nil, nil)
+	}
+	fmt.Fprintf(c.out, "Deleted %d notifications\n", result.Notifications)
+	return nil
+}
+
+func stats(c *cli, _ []string) error {
+	s, err := c.client.GetStats(c.ctx)
+	if err != nil {
+		return err
+	}
+	return c.print(s, nil, [][]string{
+		{"Notifications", strconv.FormatInt(s.Notifications, 10)},
+		{"Devices", strconv.FormatInt(s.Devices, 10)},
+		{"Apps", strconv.FormatInt(s.Apps, 10)},
+		{"Senders", strconv.FormatInt(s.Senders, 10)},
+		{"Attachments", strconv.FormatInt(s.Attachments, 10)},
+		{"Open alerts", strconv.FormatInt(s.OpenAlerts, 10)},
+		{"Oldest", formatTimePtr(s.Oldest)},
+		{"Newest", formatTimePtr(s.Newest)},
+		{"Database bytes", strconv.FormatInt(s.DatabaseBytes, 10)},
+		{"Schema version", strconv.Itoa(s.SchemaVersion)},
+	})
+}
+
+func export(fs *flag.FlagSet) func(*cli, []string) error {
+	format := fs.String("format", "csv", "csv, ndjson or html")
+	device := fs.String("device", "", "device ID of the notifications")
+	pkg := fs.String("package", "", "package name of the notifications")
+	start := fs.String("start", "", "RFC 3339 time of the oldest notification")
+	end := fs.String("end", "", "RFC 3339 time of the newest notification")
+	q := fs.String("q", "", "text the notifications contain")
+	out := fs.String("o", "", "file written to; - or empty writes to standard output")
+	return func(c *cli, _ []string) error {
+		params := client.ExportParams{Format: *format, DeviceID: *device, Package: *pkg, Q: *q}
+		var err error
+		if params.Start, err = parseTime("start", *start); err != nil {
+			return err
+		}
+		if params.End, err = parseTime("end", *end); err != nil {
+			return err
+		}
+		return c.save(*out, func(w io.Writer) error {
+			return c.client.Export(c.ctx, &params, w)
+		})
+	}
+}
+
+func backupList(c *cli, _ []string) error {
+	manifests, err := c.client.ListBackups(c.ctx)
+	if err != nil {
+		return err
+	}
+	return c.printManifests(manifests, manifests)
+}
+
+func backupCreate(c *cli, _ []string) error {
+	manifest, err := c.client.CreateBackup(c.ctx)
+	if err != nil {
+		return err
+	}
+	return c.printManifests(manifest, []models.BackupManifest{*manifest})
+}
+
+func (c *cli) printManifests(v any, manifests []models.BackupManifest) error {
+	rows := make([][]string, len(manifests))
+	for i, m := range manifests {
+		rows[i] = []string{m.File, formatTime(m.CreatedAt), strconv.FormatInt(m.Size, 10),
+			strconv.FormatInt(m.Notifications, 10), strconv.Itoa(m.SchemaVersion), m.AppVersion}
+	}
+	return c.print(v, []string{"FILE", "CREATED", "BYTES", "NOTIFICATIONS", "SCHEMA", "VERSION"}, rows)
+}
+
+func backupDownload(fs *flag.FlagSet) func(*cli, []string) error {
+	out := fs.String("o", "", "file written to; defaults to the backup's name in the current directory, - writes to standard output")
+	return func(c *cli, args []string) error {
+		path := *out
+		if path == "" {
+			path = filepath.Base(args[0])
+		}
+		return c.save(path, func(w io.Writer) error {
+			return c.client.DownloadBackup(c.ctx, args[0], w)
+		})
+	}
+}
+
+// save writes what write produces to the file at path, or to the output
+// for - and "". A file is only left behind when write succeeds.
+func (c *cli) save(path string, write func(w io.Writer) error) error {
+	if path == "" || path == "-" {
+		return write(c.out)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+// parseTime parses the RFC 3339 value of a flag, which may be empty
+func parseTime(flag, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid -%s time %q, use RFC 3339 such as 2024-06-01T12:00:00Z", flag, value)
+	}
+	return t, nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format(time.RFC3339)
+}
+
+func formatTimePtr(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return formatTime(*t)
+}
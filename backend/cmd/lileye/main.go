@@ -0,0 +1,178 @@
+// Command lileye operates a running server through its admin API: users
+// and their admin keys, devices, retention, purges, statistics, exports and
+// backups.
+//
+//	lileye [-url URL] [-key KEY] [-output table|json] <command> [flags] [args]
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lileye/backend/internal/client"
+)
+
+// Environment variables holding the defaults of the global flags
+const (
+	envURL = "LILEYE_URL"
+	envKey = "LILEYE_ADMIN_KEY"
+	envCA  = "LILEYE_CA"
+)
+
+// errCancelled is returned when a destructive command is not confirmed
+var errCancelled = errors.New("cancelled")
+
+// cli is one run of the CLI
+type cli struct {
+	ctx    context.Context
+	client *client.Client
+	json   bool
+	in     *bufio.Reader
+	out    io.Writer
+	// prompt receives questions, keeping them out of the output
+	prompt io.Writer
+}
+
+// command is a subcommand such as "keys create"
+type command struct {
+	name string
+	// args names the arguments taken after the flags
+	args []string
+	help string
+	// setup registers the command's flags and returns the function that
+	// runs it
+	setup func(fs *flag.FlagSet) func(c *cli, args []string) error
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr, os.LookupEnv))
+}
+
+// run runs the CLI with the given arguments and returns the exit code
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer, lookupEnv func(string) (string, bool)) int {
+	env := func(name, fallback string) string {
+		if v, ok := lookupEnv(name); ok {
+			return v
+		}
+		return fallback
+	}
+
+	fs := flag.NewFlagSet("lileye", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	serverURL := fs.String("url", env(envURL, "http://localhost:8080"), "URL of the server (env "+envURL+")")
+	key := fs.String("key", env(envKey, ""), "admin key (env "+envKey+")")
+	caFile := fs.String("ca", env(envCA, ""), "PEM file of the CA that signed the server's certificate (env "+envCA+")")
+	output := fs.String("output", "table", "output format: table or json")
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: lileye [flags] <command> [command flags] [args]\n\ncommands:\n")
+		tw := tabwriter.NewWriter(stderr, 0, 0, 2, ' ', 0)
+		for _, cmd := range commands {
+			fmt.Fprintf(tw, "  %s %s\t%s\n", cmd.name, strings.Join(cmd.args, " "), cmd.help)
+		}
+		tw.Flush()
+		fmt.Fprintf(stderr, "\nflags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if *output != "table" && *output != "json" {
+		fmt.Fprintf(stderr, "lileye: invalid -output %q, use table or json\n", *output)
+		return 2
+	}
+
+	cmd, rest, ok := findCommand(fs.Args())
+	if !ok {
+		if fs.NArg() > 0 {
+			fmt.Fprintf(stderr, "lileye: unknown command %q\n", strings.Join(fs.Args(), " "))
+		}
+		fs.Usage()
+		return 2
+	}
+	cmdFlags := flag.NewFlagSet("lileye "+cmd.name, flag.ContinueOnError)
+	cmdFlags.SetOutput(stderr)
+	runCmd := cmd.setup(cmdFlags)
+	if err := cmdFlags.Parse(rest); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if cmdFlags.NArg() != len(cmd.args) {
+		fmt.Fprintf(stderr, "usage: lileye %s [flags] %s\n", cmd.name, strings.Join(cmd.args, " "))
+		return 2
+	}
+
+	api, err := newClient(*serverURL, *key, *caFile)
+	if err != nil {
+		fmt.Fprintln(stderr, "lileye:", err)
+		return 2
+	}
+	c := &cli{ctx: context.Background(), client: api, json: *output == "json", in: bufio.NewReader(stdin), out: stdout, prompt: stderr}
+	if err := runCmd(c, cmdFlags.Args()); err != nil {
+		var apiErr *client.Error
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnauthorized && *key == "" {
+			err = fmt.Errorf("%w (set -key or %s)", err, envKey)
+		}
+		fmt.Fprintln(stderr, "lileye:", err)
+		return 1
+	}
+	return 0
+}
+
+// findCommand returns the command named by the first words of args and
+// the arguments after its name
+func findCommand(args []string) (command, []string, bool) {
+	for _, cmd := range commands {
+		words := strings.Fields(cmd.name)
+		if len(args) < len(words) {
+			continue
+		}
+		if strings.Join(args[:len(words)], " ") == cmd.name {
+			return cmd, args[len(words):], true
+		}
+	}
+	return command{}, nil, false
+}
+
+// print writes v as indented JSON, or as a table with a header row
+func (c *cli) print(v any, header []string, rows [][]string) error {
+	if c.json {
+		enc := json.NewEncoder(c.out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	tw := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	if header != nil {
+		fmt.Fprintln(tw, strings.Join(header, "\t"))
+	}
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// confirm asks for yes before a destructive command
+func (c *cli) confirm(question string) error {
+	fmt.Fprintf(c.prompt, "%s Type yes to continue: ", question)
+	answer, err := c.in.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	if strings.TrimSpace(answer) != "yes" {
+		return errCancelled
+	}
+	return nil
+}
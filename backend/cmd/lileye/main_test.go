@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lileye/backend/internal/api"
+	"github.com/lileye/backend/internal/config"
+	"github.com/lileye/backend/internal/models"
+	"github.com/lileye/backend/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// testServer runs the API in-process and returns its URL and an admin key
+func testServer(t *testing.T) (string, string, *gorm.DB) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(dir, "lileye.db")), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, storage.Migrate(db))
+
+	cfg := config.Default()
+	cfg.Attachments.Dir = filepath.Join(dir, "blobs")
+	cfg.Backup.Dir = filepath.Join(dir, "backups")
+	cfg.Audit.KeyFile = filepath.Join(dir, "audit.key")
+	cfg.Retention.MaxAge = config.Duration(30 * 24 * time.Hour)
+	a, err := api.New(db, &cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), nil)
+	assert.NoError(t, err)
+	srv := httptest.NewServer(a.Router)
+	t.Cleanup(srv.Close)
+
+	admins := storage.NewAdminStorage(db)
+	_, err = admins.CreateUser(context.Background(), "alice")
+	assert.NoError(t, err)
+	key, err := admins.CreateKey(context.Background(), "alice", "test")
+	assert.NoError(t, err)
+
+	notifications := storage.NewNotificationStorage(db)
+	for i, age := range []time.Duration{time.Hour, 2 * time.Hour, 60 * 24 * time.Hour} {
+		device := "device1"
+		if i == 1 {
+			device = "device2"
+		}
+		assert.NoError(t, notifications.Create(context.Background(), &models.Notification{
+			Title: "Alice", Message: "Hi", From: "Alice", DeviceID: device, DeviceName: "Pixel",
+			PackageName: "com.whatsapp", Timestamp: time.Now().Add(-age),
+		}))
+	}
+	return srv.URL, key.Key, db
+}
+
+// lileye runs the CLI against url with key and returns its exit code and
+// output
+func lileye(t *testing.T, url, key, stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	env := map[string]string{envURL: url, envKey: key}
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr, func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	})
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRequiresKey(t *testing.T) {
+	url, _, _ := testServer(t)
+
+	code, _, stderr := lileye(t, url, "", "", "stats")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "401 Unauthorized: an admin key is required (set -key or LILEYE_ADMIN_KEY)")
+
+	code, _, stderr = lileye(t, url, "lek_wrong", "", "stats")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "invalid admin key")
+}
+
+func TestUsage(t *testing.T) {
+	code, _, stderr := lileye(t, "http://localhost:1", "", "", "users", "frobnicate")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, `unknown command "users frobnicate"`)
+	assert.Contains(t, stderr, "keys create <user>")
+
+	code, _, stderr = lileye(t, "http://localhost:1", "", "", "keys", "create")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "usage: lileye keys create [flags] <user>")
+}
+
+func TestUsersAndKeys(t *testing.T) {
+	url, key, _ := testServer(t)
+
+	code, stdout, stderr := lileye(t, url, key, "", "users", "add", "bob")
+	assert.Equal(t, 0, code, stderr)
+	assert.Contains(t, stdout, "bob")
+	code, _, stderr = lileye(t, url, key, "", "users", "add", "bob")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "409 Conflict: user already exists")
+
+	code, stdout, _ = lileye(t, url, key, "", "-output", "json", "keys", "create", "-name", "laptop", "bob")
+	assert.Equal(t, 0, code)
+	var created models.CreatedAdminKey
+	assert.NoError(t, json.Unmarshal([]byte(stdout), &created))
+	assert.Equal(t, "bob", created.User)
+	assert.True(t, strings.HasPrefix(created.Key, created.Prefix))
+
+	// The new key works and is listed without its secret
+	code, stdout, _ = lileye(t, url, created.Key, "", "keys", "list")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, "laptop")
+	assert.NotContains(t, stdout, created.Key)
+
+	// Removing bob revokes his key once confirmed
+	code, _, _ = lileye(t, url, key, "no\n", "users", "remove", "bob")
+	assert.Equal(t, 1, code)
+	code, _, _ = lileye(t, url, key, "yes\n", "users", "remove", "bob")
+	assert.Equal(t, 0, code)
+	code, _, stderr = lileye(t, url, created.Key, "", "users", "list")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "invalid admin key")
+
+	code, stdout, _ = lileye(t, url, key, "", "-output", "json", "users", "list")
+	assert.Equal(t, 0, code)
+	var users []models.User
+	assert.NoError(t, json.Unmarshal([]byte(stdout), &users))
+	assert.Len(t, users, 1)
+	assert.Equal(t, "alice", users[0].Name)
+}
+
+func TestStatsAndDevices(t *testing.T) {
+	url, key, _ := testServer(t)
+
+	code, stdout, _ := lileye(t, url, key, "", "-output", "json", "stats")
+	assert.Equal(t, 0, code)
+	var stats models.Stats
+	assert.NoError(t, json.Unmarshal([]byte(stdout), &stats))
+	assert.Equal(t, int64(3), stats.Notifications)
+	assert.Equal(t, int64(2), stats.Devices)
+	assert.Equal(t, storage.SchemaVersion, stats.SchemaVersion)
+
+	code, stdout, _ = lileye(t, url, key, "", "devices", "list")
+	assert.Equal(t, 0, code)
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	assert.Len(t, lines, 3)
+	assert.Regexp(t, `^DEVICE\s+NAME\s+NOTIFICATIONS\s+LAST SEEN$`, lines[0])
+	assert.Regexp(t, `^device1\s+Pixel\s+2\s`, lines[1])
+}
+
+func TestPurgeAndRetention(t *testing.T) {
+	url, key, _ := testServer(t)
+
+	code, _, stderr := lileye(t, url, key, "", "purge")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "set -device, -package, -before or -all")
+
+	code, stdout, _ := lileye(t, url, key, "", "retention", "show")
+	assert.Equal(t, 0, code)
+	assert.Regexp(t, `Keep notifications for\s+720h0m0s`, stdout)
+	assert.Regexp(t, `Eligible for deletion\s+1`, stdout)
+	code, stdout, _ = lileye(t, url, key, "", "retention", "run")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, "Deleted 1 notifications")
+
+	code, _, stderr = lileye(t, url, key, "\n", "devices", "purge", "device2")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "Permanently delete 1 notifications? Type yes to continue: ")
+	assert.Contains(t, stderr, "cancelled")
+	code, stdout, _ = lileye(t, url, key, "", "purge", "-all", "-yes")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "Deleted 2 notifications\n", stdout)
+}
+
+func TestExportAndBackup(t *testing.T) {
+	url, key, _ := testServer(t)
+
+	code, stdout, _ := lileye(t, url, key, "", "export", "-format", "ndjson", "-device", "device1")
+	assert.Equal(t, 0, code)
+	assert.Len(t, strings.Split(strings.TrimSpace(stdout), "\n"), 2)
+
+	code, stdout, _ = lileye(t, url, key, "", "-output", "json", "backup", "create")
+	assert.Equal(t, 0, code)
+	var manifest struct {
+		File string `json:"file"`
+		Size int64  `json:"size"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(stdout), &manifest))
+
+	code, stdout, _ = lileye(t, url, key, "", "backup", "list")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, manifest.File)
+
+	path := filepath.Join(t.TempDir(), "copy.db")
+	code, _, _ = lileye(t, url, key, "", "backup", "download", "-o", path, manifest.File)
+	assert.Equal(t, 0, code)
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, manifest.Size, info.Size())
+
+	// An existing file is not overwritten
+	code, _, stderr := lileye(t, url, key, "", "backup", "download", "-o", path, manifest.File)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "file exists")
+}
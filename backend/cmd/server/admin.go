@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+
+	"github.com/lileye/backend/internal/config"
+	"github.com/lileye/backend/internal/storage"
+)
+
+// keyName is the name given to the key by create-key
+var keyName string
+
+func createKeyFlags(fs *flag.FlagSet) {
+	fs.StringVar(&keyName, "name", "", "name of the key, such as the machine it is used on")
+}
+
+// createKey creates an admin key for a user, adding the user if needed,
+// and prints it. It gives the first admin access to the admin API, which
+// can create every further key. The server may be running.
+func createKey(cfg *config.Config, args []string) {
+	db := openDatabase(cfg)
+	sqlDB, err := db.DB()
+	if err != nil {
+		fatal("Failed to access database pool", err)
+	}
+	defer sqlDB.Close()
+
+	admins := storage.NewAdminStorage(db)
+	if _, err := admins.CreateUser(context.Background(), args[0]); err == nil {
+		slog.Info("Added user", "user", args[0])
+	} else if !errors.Is(err, storage.ErrUserExists) {
+		fatal("Failed to add user", err)
+	}
+	key, err := admins.CreateKey(context.Background(), args[0], keyName)
+	if err != nil {
+		fatal("Failed to create admin key", err)
+	}
+	slog.Info("Created admin key; it is shown once", "user", key.User, "id", key.ID, "prefix", key.Prefix)
+	fmt.Println(key.Key)
+}
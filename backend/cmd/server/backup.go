@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/lileye/backend/internal/backup"
+	"github.com/lileye/backend/internal/config"
+	"github.com/lileye/backend/internal/health"
+)
+
+// runBackup takes a backup of the database. The server may be running.
+func runBackup(cfg *config.Config, _ []string) {
+	db := openDatabase(cfg)
+	sqlDB, err := db.DB()
+	if err != nil {
+		fatal("Failed to access database pool", err)
+	}
+	defer sqlDB.Close()
+
+	manifest, err := backup.NewManager(db, cfg.Backup.Dir, cfg.Backup.Keep).Create()
+	if err != nil {
+		fatal("Failed to back up database", err)
+	}
+	slog.Info("Backed up database", "dir", cfg.Backup.Dir, "file", manifest.File,
+		"size", manifest.Size, "sha256", manifest.SHA256, "notifications", manifest.Notifications)
+}
+
+// runRestore replaces the database with a backup after checking it. The
+// server must be stopped.
+func runRestore(cfg *config.Config, args []string) {
+	manifest, kept, err := backup.Restore(args[0], cfg.Database.Path)
+	if err != nil {
+		fatal("Failed to restore database", err)
+	}
+	if kept != "" {
+		slog.Info("Kept the replaced database", "path", kept)
+	}
+	slog.Info("Restored database", "path", cfg.Database.Path, "backup", args[0],
+		"created_at", manifest.CreatedAt, "schema_version", manifest.SchemaVersion,
+		"notifications", manifest.Notifications)
+}
+
+// scheduleBackups takes a backup every interval until ctx is done. The
+// first one is due an interval after the newest existing backup, so
+// restarts do not postpone backups.
+func scheduleBackups(ctx context.Context, backups *backup.Manager, worker *health.Worker, interval time.Duration) {
+	defer worker.Stopped()
+
+	wait := interval
+	if manifests, err := backups.List(); err == nil {
+		wait = 0
+		if len(manifests) > 0 {
+			wait = time.Until(manifests[0].CreatedAt.Add(interval))
+		}
+	}
+
+	for {
+		timer := time.NewTimer(max(wait, 0))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		manifest, err := backups.Create()
+		worker.Ran(err)
+		if err != nil {
+			slog.Error("Failed to back up database", "error", err)
+		} else {
+			slog.Info("Backed up database", "file", manifest.File, "size", manifest.Size)
+		}
+		wait = interval
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/lileye/backend/internal/config"
+	"github.com/lileye/backend/internal/fixtures"
+	"github.com/lileye/backend/internal/storage"
+)
+
+// demoOptions are the flags of the demo command
+var demoOptions struct {
+	seed    int64
+	days    int
+	perDay  int
+	devices string
+}
+
+func demoFlags(fs *flag.FlagSet) {
+	fs.Int64Var(&demoOptions.seed, "seed", 1, "seed of the generated notifications; the same seed writes the same notifications")
+	fs.IntVar(&demoOptions.days, "days", 14, "number of days of notifications, ending now")
+	fs.IntVar(&demoOptions.perDay, "per-day", 40, "mean number of notifications a device receives a day")
+	fs.StringVar(&demoOptions.devices, "devices", "phone1,phone2,tablet1", "comma-separated device IDs")
+}
+
+// runDemo writes a new database filled with generated notifications, to
+// try the server out or to demonstrate it
+func runDemo(cfg *config.Config, args []string) {
+	if demoOptions.days < 1 || demoOptions.perDay < 1 {
+		fatal("Failed to write demo database", errors.New("-days and -per-day must be positive"))
+	}
+	var ids []string
+	for _, id := range strings.Split(demoOptions.devices, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		fatal("Failed to write demo database", errors.New("-devices is empty"))
+	}
+	if _, err := os.Stat(args[0]); !errors.Is(err, os.ErrNotExist) {
+		fatal("Failed to write demo database", fmt.Errorf("%s already exists", args[0]))
+	}
+
+	cfg.Database.Path = args[0]
+	db := openDatabase(cfg)
+	sqlDB, err := db.DB()
+	if err != nil {
+		fatal("Failed to access database pool", err)
+	}
+	defer sqlDB.Close()
+
+	ds := fixtures.Generate(fixtures.Options{
+		Seed:    demoOptions.seed,
+		Devices: fixtures.Devices(ids...),
+		Days:    demoOptions.days,
+		PerDay:  demoOptions.perDay,
+	})
+	notifications := storage.NewNotificationStorage(db)
+	for start := 0; start < len(ds.Notifications); start += 500 {
+		end := min(start+500, len(ds.Notifications))
+		if err := notifications.Import(context.Background(), ds.Notifications[start:end]); err != nil {
+			fatal("Failed to write demo database", err)
+		}
+	}
+	if err := storage.NewSenderStorage(db).Backfill(context.Background()); err != nil {
+		fatal("Failed to record senders", err)
+	}
+	slog.Info("Wrote demo database", "path", args[0], "notifications", len(ds.Notifications),
+		"devices", len(ids), "conversations", len(ds.Conversations))
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lileye/backend/internal/config"
+	"github.com/lileye/backend/internal/importer"
+)
+
+// importOptions are the flags of the import command
+var importOptions struct {
+	format     string
+	deviceID   string
+	deviceName string
+	columns    string
+	timeFormat string
+	dryRun     bool
+}
+
+// maxLoggedInvalid is the number of invalid records logged one by one
+const maxLoggedInvalid = 20
+
+func importFlags(fs *flag.FlagSet) {
+	fs.StringVar(&importOptions.format, "format", "", "format of the file, one of "+strings.Join(importer.Names(), ", ")+" (default by extension)")
+	fs.StringVar(&importOptions.deviceID, "device", "", "device ID of notifications that name none; required for dumpsys")
+	fs.StringVar(&importOptions.deviceName, "device-name", "", "device name of notifications that name no device")
+	fs.StringVar(&importOptions.columns, "columns", "", "CSV column of each field, such as title=Subject,message=Body; fields: "+strings.Join(importer.CSVFields(), ", "))
+	fs.StringVar(&importOptions.timeFormat, "time-format", "", "layout of CSV timestamps in Go syntax, or unix or unixms (default RFC 3339)")
+	fs.BoolVar(&importOptions.dryRun, "dry-run", false, "report what would be imported without storing anything")
+}
+
+// runImport imports the notifications in a file, skipping those already
+// stored. The server may be running.
+func runImport(cfg *config.Config, args []string) {
+	path := args[0]
+	format, ok := importer.Lookup(importOptions.format)
+	if importOptions.format == "" {
+		format, ok = importer.Detect(path)
+	}
+	if !ok {
+		fatal("Failed to import", fmt.Errorf("unknown format of %s, set -format to one of %s", path, strings.Join(importer.Names(), ", ")))
+	}
+	if format.Name == "dumpsys" && importOptions.deviceID == "" {
+		fatal("Failed to import", fmt.Errorf("dumpsys output does not name the device, set -device"))
+	}
+	columns, err := importer.ParseColumns(importOptions.columns)
+	if err != nil {
+		fatal("Failed to import", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		fatal("Failed to import", err)
+	}
+	defer f.Close()
+	var size int64
+	if info, err := f.Stat(); err == nil {
+		size = info.Size()
+	}
+	counter := &countingReader{r: f}
+
+	parser, err := format.NewParser(counter, importer.Options{
+		DeviceID:   importOptions.deviceID,
+		DeviceName: importOptions.deviceName,
+		Columns:    columns,
+		TimeFormat: importOptions.timeFormat,
+	})
+	if err != nil {
+		fatal("Failed to import", err)
+	}
+
+	db := openDatabase(cfg)
+	sqlDB, err := db.DB()
+	if err != nil {
+		fatal("Failed to access database pool", err)
+	}
+	defer sqlDB.Close()
+
+	im := importer.New(db)
+	im.DryRun = importOptions.dryRun
+	invalid := 0
+	im.Invalid = func(err *importer.ParseError) {
+		invalid++
+		if invalid <= maxLoggedInvalid {
+			slog.Warn("Skipped invalid record", "file", path, "line", err.Line, "error", err.Err)
+		}
+		if invalid == maxLoggedInvalid {
+			slog.Warn("Further invalid records are counted but not logged")
+		}
+	}
+	var logged time.Time
+	im.Progress = func(s importer.Summary) {
+		if time.Since(logged) < 2*time.Second {
+			return
+		}
+		logged = time.Now()
+		attrs := []any{"read", s.Read, "imported", s.Imported, "duplicates", s.Duplicates, "invalid", s.Invalid}
+		if size > 0 {
+			attrs = append(attrs, "percent", 100*counter.n/size)
+		}
+		slog.Info("Importing", attrs...)
+	}
+
+	slog.Info("Importing notifications", "file", path, "format", format.Name, "dry_run", im.DryRun)
+	summary, err := im.Run(context.Background(), parser)
+	logSummary(summary, im.DryRun)
+	if err != nil {
+		fatal("Failed to import", err)
+	}
+}
+
+// logSummary logs the outcome of an import and the number of notifications
+// of every app, most first
+func logSummary(s importer.Summary, dryRun bool) {
+	message := "Imported notifications"
+	if dryRun {
+		message = "Dry run, nothing was stored"
+	}
+	attrs := []any{"read", s.Read, "imported", s.Imported, "duplicates", s.Duplicates, "invalid", s.Invalid}
+	if s.Imported > 0 {
+		attrs = append(attrs, "first", s.First, "last", s.Last)
+	}
+	slog.Info(message, attrs...)
+
+	packages := make([]string, 0, len(s.Packages))
+	for pkg := range s.Packages {
+		packages = append(packages, pkg)
+	}
+	sort.Slice(packages, func(i, j int) bool {
+		if s.Packages[packages[i]] != s.Packages[packages[j]] {
+			return s.Packages[packages[i]] > s.Packages[packages[j]]
+		}
+		return packages[i] < packages[j]
+	})
+	for _, pkg := range packages {
+		slog.Info("Imported app", "package_name", pkg, "notifications", s.Packages[pkg])
+	}
+}
+
+// countingReader counts the bytes read through it, for reporting progress
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
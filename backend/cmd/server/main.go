@@ -1,49 +1,344 @@
 package main
 
 import (
-	"log"
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/lileye/backend/internal/handlers"
+	"github.com/lileye/backend/internal/api"
+	"github.com/lileye/backend/internal/certs"
+	"github.com/lileye/backend/internal/config"
+	"github.com/lileye/backend/internal/fieldcrypt"
+	"github.com/lileye/backend/internal/health"
+	"github.com/lileye/backend/internal/logging"
+	"github.com/lileye/backend/internal/metrics"
 	"github.com/lileye/backend/internal/models"
+	"github.com/lileye/backend/internal/retention"
+	"github.com/lileye/backend/internal/server"
 	"github.com/lileye/backend/internal/storage"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
+// command is a subcommand of the server
+type command struct {
+	run func(cfg *config.Config, args []string)
+	// args names the arguments the command takes after its flags
+	args []string
+	// flags registers the command's own flags, if it has any
+	flags func(fs *flag.FlagSet)
+}
+
+// commands are the subcommands of the server, selected by the first
+// argument; serve is the default
+var commands = map[string]command{
+	"serve":      {run: serve},
+	"reencrypt":  {run: reencrypt},
+	"backup":     {run: runBackup},
+	"restore":    {run: runRestore, args: []string{"<backup file>"}},
+	"import":     {run: runImport, args: []string{"<file>"}, flags: importFlags},
+	"create-key": {run: createKey, args: []string{"<user>"}, flags: createKeyFlags},
+	"demo":       {run: runDemo, args: []string{"<file>"}, flags: demoFlags},
+}
+
 func main() {
-	// Initialize database
-	db, err := gorm.Open(sqlite.Open("notifications.db"), &gorm.Config{})
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(os.Stderr, "unknown command %q, use one of %s\n", name, strings.Join(names, ", "))
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet(os.Args[0]+" "+name, flag.ContinueOnError)
+	if cmd.flags != nil {
+		cmd.flags(fs)
+	}
+	cfg, opts, err := config.LoadFlags(fs, args, os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if len(opts.Args) != len(cmd.args) {
+		fmt.Fprintf(os.Stderr, "usage: %s %s [flags] %s\n", os.Args[0], name, strings.Join(cmd.args, " "))
+		os.Exit(2)
+	}
+	if opts.PrintConfig {
+		if err := config.Print(os.Stdout, cfg); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+	if opts.PrintConfig {
+		return
+	}
+
+	// Initialize logging
+	level, _ := logging.ParseLevel(cfg.Log.Level)
+	slog.SetDefault(logging.New(os.Stdout, level))
+	if opts.File != "" {
+		slog.Info("Loaded configuration", "file", opts.File)
+	}
+
+	cmd.run(cfg, opts.Args)
+}
+
+// openDatabase opens and migrates the database with the configured
+// encryption keys installed
+func openDatabase(cfg *config.Config) *gorm.DB {
+	keyring, err := cfg.Encryption.Keyring()
+	if err != nil {
+		fatal("Failed to load encryption keys", err)
+	}
+	fieldcrypt.Use(keyring)
+	if keyring != nil {
+		slog.Info("Encrypting notification content", "active_key", keyring.Active())
+	}
+
+	// WAL lets long reads such as exports run alongside writes
+	dsn := cfg.Database.Path
+	if strings.Contains(dsn, "?") {
+		dsn += "&"
+	} else {
+		dsn += "?"
+	}
+	db, err := gorm.Open(sqlite.Open(dsn+"_journal_mode=WAL&_busy_timeout=5000"), &gorm.Config{
+		Logger: logging.NewGormLogger(slog.Default()),
+	})
+	if err != nil {
+		fatal("Failed to connect to database", err)
 	}
 
 	// Auto migrate the schema
-	if err := db.AutoMigrate(&models.Notification{}); err != nil {
-		log.Fatal("Failed to migrate database:", err)
+	if err := storage.Migrate(db); err != nil {
+		fatal("Failed to migrate database", err)
 	}
+	return db
+}
+
+// serve runs the server until SIGINT or SIGTERM
+func serve(cfg *config.Config, _ []string) {
+	logger := slog.Default()
+	db := openDatabase(cfg)
 
-	// Initialize storage and handlers
-	notificationStorage := storage.NewNotificationStorage(db)
-	notificationHandler := handlers.NewNotificationHandler(notificationStorage)
+	sqlDB, err := db.DB()
+	if err != nil {
+		fatal("Failed to access database pool", err)
+	}
+	if err := metrics.RegisterDB(sqlDB); err != nil {
+		fatal("Failed to register database metrics", err)
+	}
+
+	// Load or create the TLS certificates
+	tlsConfig, ca, err := loadTLS(cfg.TLS)
+	if err != nil {
+		fatal("Failed to load TLS certificates", err)
+	}
+	if ca != nil {
+		slog.Info("Using self-signed CA", "dir", cfg.TLS.Dir, "fingerprint_sha256", ca.Fingerprint, "spki_sha256", ca.SPKIPin)
+	}
 
 	// Initialize Gin router
-	r := gin.Default()
+	if os.Getenv(gin.EnvGinMode) == "" {
+		gin.SetMode(gin.ReleaseMode)
+	}
+	a, err := api.New(db, cfg, logger, ca)
+	if err != nil {
+		fatal("Failed to set up API", err)
+	}
+	r, checker := a.Router, a.Checker
 
 	// Serve static files
-	r.Static("/static", "./web/static")
-	r.LoadHTMLGlob("./web/templates/*")
-
-	// Register API routes
-	notificationHandler.RegisterRoutes(r)
+	r.Static("/static", cfg.Web.StaticDir)
+	r.LoadHTMLGlob(filepath.Join(cfg.Web.TemplatesDir, "*"))
 
 	// Serve index page
 	r.GET("/", func(c *gin.Context) {
 		c.HTML(200, "index.html", nil)
 	})
 
-	// Start server
-	if err := r.Run(":8080"); err != nil {
-		log.Fatal("Failed to start server:", err)
+	srv := server.New(r, server.Config{
+		Addr:              cfg.Server.Addr,
+		ReadHeaderTimeout: time.Duration(cfg.Server.ReadHeaderTimeout),
+		ReadTimeout:       time.Duration(cfg.Server.ReadTimeout),
+		WriteTimeout:      time.Duration(cfg.Server.WriteTimeout),
+		IdleTimeout:       time.Duration(cfg.Server.IdleTimeout),
+		TLSConfig:         tlsConfig,
+		ShutdownTimeout:   time.Duration(cfg.Server.ShutdownTimeout),
+	})
+	srv.OnDrain(checker.Drain)
+	srv.OnDrain(a.Notifications.Drain)
+	srv.OnClose(func(ctx context.Context) error {
+		slog.Info("Closing database")
+		return sqlDB.Close()
+	})
+	// Streams are not drained by the HTTP server, so the database waits for
+	// them
+	srv.OnClose(a.Notifications.Close)
+
+	// Serve metrics on their own listener so they can be kept off the
+	// public interface
+	if cfg.Metrics.Addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		metricsServer, err := listen("metrics", cfg.Metrics.Addr, mux, time.Duration(cfg.Server.ReadHeaderTimeout))
+		if err != nil {
+			fatal("Failed to start metrics server", err)
+		}
+		srv.OnClose(metricsServer.Shutdown)
+	}
+
+	// Redirect plain HTTP to HTTPS
+	if cfg.TLS.RedirectAddr != "" {
+		redirectServer, err := listen("redirect", cfg.TLS.RedirectAddr, server.RedirectToHTTPS(cfg.Server.Addr), time.Duration(cfg.Server.ReadHeaderTimeout))
+		if err != nil {
+			fatal("Failed to start redirect server", err)
+		}
+		srv.OnClose(redirectServer.Shutdown)
+	}
+
+	cleanup := checker.Worker("attachment_cleanup")
+	srv.Go(func(ctx context.Context) {
+		cleanupOrphanedAttachments(ctx, a.Attachments, cleanup, time.Duration(cfg.Attachments.CleanupInterval))
+	})
+	if cfg.Backup.Interval > 0 {
+		backupWorker := checker.Worker("backup")
+		srv.Go(func(ctx context.Context) {
+			scheduleBackups(ctx, a.Backups, backupWorker, time.Duration(cfg.Backup.Interval))
+		})
+	}
+	if a.Retention.Enabled() {
+		retentionWorker := checker.Worker("retention")
+		srv.Go(func(ctx context.Context) {
+			scheduleRetention(ctx, a.Retention, retentionWorker)
+		})
+	}
+
+	// Start server; SIGINT or SIGTERM drains it and closes the database
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	slog.Info("Starting server", "addr", cfg.Server.Addr, "tls", cfg.TLS.Mode)
+	if err := srv.ListenAndServe(ctx); err != nil {
+		fatal("Server stopped with errors", err)
+	}
+	slog.Info("Server stopped")
+}
+
+// fatal logs an error that prevents the server from running and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// cleanupOrphanedAttachments periodically removes attachments whose
+// notification has been deleted along with blobs no attachment refers to,
+// until ctx is done
+func cleanupOrphanedAttachments(ctx context.Context, attachments *storage.AttachmentStorage, worker *health.Worker, interval time.Duration) {
+	defer worker.Stopped()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		removed, blobs, err := attachments.DeleteOrphans(ctx)
+		worker.Ran(err)
+		if err != nil {
+			metrics.PurgeRuns.WithLabelValues("error").Inc()
+			slog.Error("Failed to clean up orphaned attachments", "error", err)
+			continue
+		}
+		metrics.PurgeRuns.WithLabelValues("success").Inc()
+		metrics.PurgeRemoved.WithLabelValues("attachments").Add(float64(removed))
+		metrics.PurgeRemoved.WithLabelValues("blobs").Add(float64(blobs))
+		if removed > 0 || blobs > 0 {
+			slog.Info("Removed orphaned attachments", "attachments", removed, "blobs", blobs)
+		}
+	}
+}
+
+// scheduleRetention deletes notifications past the retention period every
+// interval until ctx is done
+func scheduleRetention(ctx context.Context, policy *retention.Policy, worker *health.Worker) {
+	defer worker.Stopped()
+	ticker := time.NewTicker(policy.Interval())
+	defer ticker.Stop()
+
+	for {
+		run, err := policy.Apply(ctx)
+		worker.Ran(err)
+		if err != nil {
+			slog.Error("Failed to delete old notifications", "error", err)
+		} else if run.Deleted > 0 {
+			slog.Info("Deleted old notifications", "before", run.Cutoff, "notifications", run.Deleted)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// loadTLS returns the TLS configuration of the API listener, or nil when TLS
+// is off. The CA is returned in self-signed mode.
+func loadTLS(cfg config.TLS) (*tls.Config, *models.CAInfo, error) {
+	switch cfg.Mode {
+	case config.TLSFiles:
+		tlsConfig, err := certs.Load(cfg.CertFile, cfg.KeyFile)
+		return tlsConfig, nil, err
+	case config.TLSSelfSigned:
+		return certs.SelfSigned(cfg.Dir, cfg.Hosts)
+	}
+	return nil, nil, nil
+}
+
+// listen serves handler on addr in the background
+func listen(name, addr string, handler http.Handler, readHeaderTimeout time.Duration) (*http.Server, error) {
+	srv := &http.Server{Handler: handler, ReadHeaderTimeout: readHeaderTimeout}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
 	}
-} 
\ No newline at end of file
+	slog.Info("Starting "+name+" server", "addr", addr)
+	go func() {
+		if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Server stopped", "server", name, "error", err)
+		}
+	}()
+	return srv, nil
+}
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/lileye/backend/internal/config"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -29,4 +30,14 @@ func TestHealthEndpoint(t *testing.T) {
 	// Assert the response
 	assert.Equal(t, 200, w.Code)
 	assert.Contains(t, w.Body.String(), "ok")
-} 
\ No newline at end of file
+} 
+
+func TestExampleConfig(t *testing.T) {
+	// The example config documents the defaults and must stay in sync
+	cfg, _, err := config.Load("server", []string{"-config", "../../config.example.yaml"}, func(string) (string, bool) {
+		return "", false
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, cfg.Validate())
+	assert.Equal(t, config.Default(), *cfg)
+}
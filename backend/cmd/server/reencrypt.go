@@ -0,0 +1,29 @@
+package main
+
+import (
+	"log/slog"
+
+	"github.com/lileye/backend/internal/config"
+	"github.com/lileye/backend/internal/storage"
+)
+
+// reencrypt rewrites every stored row with the active encryption key. It
+// encrypts existing rows after encryption is turned on and, after a key
+// rotation, lets the previous key be removed from the configuration. The
+// server must not be running.
+func reencrypt(cfg *config.Config, _ []string) {
+	db := openDatabase(cfg)
+	sqlDB, err := db.DB()
+	if err != nil {
+		fatal("Failed to access database pool", err)
+	}
+	defer sqlDB.Close()
+
+	rewritten, err := storage.Reencrypt(db, func(table string, done int64) {
+		slog.Info("Reencrypting", "table", table, "rows", done)
+	})
+	if err != nil {
+		fatal("Failed to reencrypt", err)
+	}
+	slog.Info("Reencrypted database", "rows", rewritten)
+}
@@ -0,0 +1,139 @@
+// Package api assembles the storage, handlers and middleware of the HTTP
+// API. The server binary serves it, and tests run it in-process.
+package api
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lileye/backend/internal/apierror"
+	"github.com/lileye/backend/internal/backup"
+	"github.com/lileye/backend/internal/config"
+	"github.com/lileye/backend/internal/handlers"
+	"github.com/lileye/backend/internal/health"
+	"github.com/lileye/backend/internal/middleware"
+	"github.com/lileye/backend/internal/models"
+	"github.com/lileye/backend/internal/retention"
+	"github.com/lileye/backend/internal/storage"
+	"github.com/lileye/backend/internal/throttle"
+	"github.com/lileye/backend/internal/validation"
+	"gorm.io/gorm"
+)
+
+// API is the router of the server together with what its background
+// workers need
+type API struct {
+	Router  *gin.Engine
+	Checker *health.Checker
+	// Notifications holds the WebSocket streams to drain on shutdown
+	Notifications *handlers.NotificationHandler
+	Attachments   *storage.AttachmentStorage
+	Backups       *backup.Manager
+	Retention     *retention.Policy
+}
+
+// New sets up the API on a migrated database. ca is the self-signed CA,
+// or nil when the server does not use one. The web interface is left to the
+// caller.
+func New(db *gorm.DB, cfg *config.Config, logger *slog.Logger, ca *models.CAInfo) (*API, error) {
+	// Record senders of notifications stored before sender tracking
+	senderStorage := storage.NewSenderStorage(db)
+	if err := senderStorage.Backfill(context.Background()); err != nil {
+		return nil, fmt.Errorf("backfill senders: %w", err)
+	}
+
+	// Initialize storage and handlers
+	checker := health.NewChecker(db)
+	healthHandler := handlers.NewHealthHandler(checker)
+	notificationStorage := storage.NewNotificationStorage(db)
+	var dedup *throttle.Dedup
+	if cfg.RateLimit.DuplicateWindow > 0 {
+		dedup = throttle.NewDedup(time.Duration(cfg.RateLimit.DuplicateWindow))
+	}
+	notificationHandler := handlers.NewNotificationHandler(notificationStorage, validation.New(cfg.Validation), dedup)
+	conversationHandler := handlers.NewConversationHandler(storage.NewConversationStorage(db))
+	eventHandler := handlers.NewEventHandler(storage.NewEventStorage(db))
+
+	blobStore, err := storage.NewBlobStore(cfg.Attachments.Dir, cfg.Attachments.MaxSize)
+	if err != nil {
+		return nil, fmt.Errorf("open blob store: %w", err)
+	}
+	attachmentStorage := storage.NewAttachmentStorage(db, blobStore)
+	attachmentHandler := handlers.NewAttachmentHandler(attachmentStorage, notificationStorage, cfg.Attachments.MaxSize)
+
+	appStorage := storage.NewAppStorage(db, blobStore)
+	if err := appStorage.Seed(context.Background(), models.DefaultApps); err != nil {
+		return nil, fmt.Errorf("seed app catalog: %w", err)
+	}
+	appHandler := handlers.NewAppHandler(appStorage, cfg.Attachments.MaxSize)
+	contactHandler := handlers.NewContactHandler(storage.NewContactStorage(db))
+	alertHandler := handlers.NewAlertHandler(storage.NewAlertStorage(db), senderStorage)
+	auditKey, err := storage.LoadAuditKey(cfg.Audit.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load audit key: %w", err)
+	}
+	auditStorage := storage.NewAuditStorage(db, auditKey)
+	auditHandler := handlers.NewAuditHandler(auditStorage)
+	exportHandler := handlers.NewExportHandler(notificationStorage)
+	backups := backup.NewManager(db, cfg.Backup.Dir, cfg.Backup.Keep)
+	backupHandler := handlers.NewBackupHandler(backups)
+	adminStorage := storage.NewAdminStorage(db)
+	policy := retention.New(notificationStorage, cfg.Retention)
+	adminHandler := handlers.NewAdminHandler(adminStorage, notificationStorage, storage.NewStatsStorage(db), policy)
+
+	rules, err := throttle.ParseRules(cfg.RateLimit.Rules)
+	if err != nil {
+		return nil, fmt.Errorf("parse rate limits: %w", err)
+	}
+
+	r := gin.New()
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("set trusted proxies: %w", err)
+	}
+	// Rate limits come before the middleware that queries the database, so
+	// that refused requests cost as little as possible
+	r.Use(middleware.RequestID(), middleware.Logger(logger), middleware.Metrics(), middleware.Recovery(logger),
+		middleware.RateLimit(rules), middleware.Audit(auditStorage, logger), middleware.Authenticate(adminStorage))
+
+	// Register the probes, then the API under its version prefix and, for
+	// clients written before it was versioned, under the legacy prefix
+	healthHandler.RegisterRoutes(r)
+	routes := []interface{ RegisterRoutes(gin.IRouter) }{
+		handlers.NewOpenAPIHandler(),
+		notificationHandler,
+		conversationHandler,
+		eventHandler,
+		attachmentHandler,
+		appHandler,
+		contactHandler,
+		alertHandler,
+		auditHandler,
+		exportHandler,
+		backupHandler,
+		adminHandler,
+	}
+	if ca != nil {
+		routes = append(routes, handlers.NewTLSHandler(ca))
+	}
+	for _, group := range []*gin.RouterGroup{
+		r.Group(middleware.APIPrefix),
+		r.Group(middleware.LegacyPrefix, middleware.Deprecated()),
+	} {
+		for _, h := range routes {
+			h.RegisterRoutes(group)
+		}
+	}
+	r.NoRoute(apierror.NoRoute)
+
+	return &API{
+		Router:        r,
+		Checker:       checker,
+		Notifications: notificationHandler,
+		Attachments:   attachmentStorage,
+		Backups:       backups,
+		Retention:     policy,
+	}, nil
+}
@@ -0,0 +1,198 @@
+// Package apierror writes the error responses of the API. Every error has
+// the same envelope, models.ErrorResponse, with a code for clients to act
+// on, a message, the request ID and the invalid fields, if any. The causes
+// of internal errors are logged rather than sent, since they can reveal the
+// database schema or paths on the server.
+package apierror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/lileye/backend/internal/logging"
+	"github.com/lileye/backend/internal/models"
+)
+
+func init() {
+	// Name fields in validation errors as clients send them
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(jsonName)
+	}
+}
+
+// Abort responds with status and an error of the code matching it, and
+// stops the handler chain
+func Abort(c *gin.Context, status int, message string, fields ...models.FieldError) {
+	c.AbortWithStatusJSON(status, models.ErrorResponse{Error: New(c.Request.Context(), status, message, fields...)})
+}
+
+// New returns the error Abort would respond with, for errors sent
+// otherwise, such as on a WebSocket stream
+func New(ctx context.Context, status int, message string, fields ...models.FieldError) models.APIError {
+	return models.APIError{
+		Code:      Code(status),
+		Message:   message,
+		RequestID: logging.RequestID(ctx),
+		Fields:    fields,
+	}
+}
+
+// Code returns the error code of a response status
+func Code(status int) string {
+	switch status {
+	case http.StatusUnauthorized:
+		return models.CodeUnauthorized
+	case http.StatusNotFound:
+		return models.CodeNotFound
+	case http.StatusConflict:
+		return models.CodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return models.CodePayloadTooLarge
+	case http.StatusUnsupportedMediaType:
+		return models.CodeUnsupportedMediaType
+	case http.StatusTooManyRequests:
+		return models.CodeRateLimited
+	}
+	if status >= http.StatusInternalServerError {
+		return models.CodeInternal
+	}
+	return models.CodeInvalidRequest
+}
+
+// Invalid responds with 400 to a request with an invalid field or
+// parameter
+func Invalid(c *gin.Context, field, message string) {
+	Abort(c, http.StatusBadRequest, message, models.FieldError{Field: field, Message: message})
+}
+
+// NotFound responds with 404
+func NotFound(c *gin.Context, message string) {
+	Abort(c, http.StatusNotFound, message)
+}
+
+// Internal logs an unexpected error, usually from storage, and responds
+// with 500. The request ID is included in both so that a failed response
+// can be matched to its log line.
+func Internal(c *gin.Context, err error) {
+	c.AbortWithStatusJSON(http.StatusInternalServerError,
+		models.ErrorResponse{Error: InternalError(c.Request.Context(), c.FullPath(), err)})
+}
+
+// InternalError logs an unexpected error as Internal does and returns the
+// error it would respond with
+func InternalError(ctx context.Context, route string, err error) models.APIError {
+	slog.ErrorContext(ctx, "request failed", "error", err, "route", route)
+	return New(ctx, http.StatusInternalServerError, "internal server error")
+}
+
+// NoRoute responds to requests that match no route
+func NoRoute(c *gin.Context) {
+	NotFound(c, "no such route")
+}
+
+// Binding responds with 400 to a request whose JSON body could not be
+// bound, listing the invalid fields when they are known, or with 413 when
+// the body is over the limit set with http.MaxBytesReader
+func Binding(c *gin.Context, err error) {
+	status, message, fields := bindingError(err)
+	Abort(c, status, message, fields...)
+}
+
+// BindingError returns the error Binding would respond with and its status
+func BindingError(ctx context.Context, err error) (int, models.APIError) {
+	status, message, fields := bindingError(err)
+	return status, New(ctx, status, message, fields...)
+}
+
+func bindingError(err error) (int, string, []models.FieldError) {
+	var (
+		validation validator.ValidationErrors
+		typeErr    *json.UnmarshalTypeError
+		syntaxErr  *json.SyntaxError
+		tooLarge   *http.MaxBytesError
+	)
+	switch {
+	case errors.As(err, &tooLarge):
+		return http.StatusRequestEntityTooLarge, fmt.Sprintf("request body must be at most %d bytes", tooLarge.Limit), nil
+	case errors.As(err, &validation):
+		fields := make([]models.FieldError, 0, len(validation))
+		for _, fe := range validation {
+			fields = append(fields, models.FieldError{Field: fieldPath(fe), Message: validationMessage(fe)})
+		}
+		return http.StatusBadRequest, "invalid request body", fields
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		return http.StatusBadRequest, "invalid request body", []models.FieldError{{
+			Field:   typeErr.Field,
+			Message: "must be " + jsonType(typeErr.Type),
+		}}
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return http.StatusBadRequest, "request body is not valid JSON", nil
+	case errors.Is(err, io.EOF):
+		return http.StatusBadRequest, "request body is empty", nil
+	default:
+		return http.StatusBadRequest, "invalid request body: " + err.Error(), nil
+	}
+}
+
+// fieldPath returns the path of the field of a validation error below the
+// bound struct, such as "contact_ids"
+func fieldPath(fe validator.FieldError) string {
+	_, path, _ := strings.Cut(fe.Namespace(), ".")
+	if path == "" {
+		return fe.Field()
+	}
+	return path
+}
+
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "oneof":
+		return "must be one of " + strings.Join(strings.Fields(fe.Param()), ", ")
+	}
+	if fe.Param() != "" {
+		return fmt.Sprintf("must satisfy %s=%s", fe.Tag(), fe.Param())
+	}
+	return "must satisfy " + fe.Tag()
+}
+
+// jsonType describes the JSON value a Go type is decoded from
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	}
+	return "an object"
+}
+
+// jsonName names a struct field by its JSON key
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return f.Name
+	}
+	return name
+}
@@ -0,0 +1,54 @@
+package apierror
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lileye/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCode(t *testing.T) {
+	assert.Equal(t, models.CodeNotFound, Code(http.StatusNotFound))
+	assert.Equal(t, models.CodeInvalidRequest, Code(http.StatusBadRequest))
+	assert.Equal(t, models.CodeInvalidRequest, Code(http.StatusUnprocessableEntity))
+	assert.Equal(t, models.CodeRateLimited, Code(http.StatusTooManyRequests))
+	assert.Equal(t, models.CodeInternal, Code(http.StatusServiceUnavailable))
+}
+
+func TestBinding(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/merge", func(c *gin.Context) {
+		var req struct {
+			ContactIDs []uint `json:"contact_ids" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			Binding(c, err)
+		}
+	})
+
+	send := func(body string) models.APIError {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/merge", bytes.NewBufferString(body))
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		var response models.ErrorResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Error
+	}
+
+	err := send(`{}`)
+	assert.Equal(t, models.CodeInvalidRequest, err.Code)
+	assert.Equal(t, []models.FieldError{{Field: "contact_ids", Message: "is required"}}, err.Fields)
+	err = send(`{"contact_ids": "1"}`)
+	assert.Equal(t, []models.FieldError{{Field: "contact_ids", Message: "must be an array"}}, err.Fields)
+	err = send(`{"contact_ids": [`)
+	assert.Equal(t, "request body is not valid JSON", err.Message)
+	err = send(``)
+	assert.Equal(t, "request body is empty", err.Message)
+}
@@ -0,0 +1,340 @@
+// Package backup takes consistent snapshots of the database while the
+// server runs and restores them while it is stopped.
+//
+// A backup is a pair of files in the backup directory: the SQLite snapshot
+// lileye-<time>.db, written with VACUUM INTO, and its manifest
+// lileye-<time>.json, which records the checksum, size and schema version
+// of the snapshot.
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lileye/backend/internal/metrics"
+	"github.com/lileye/backend/internal/models"
+	"github.com/lileye/backend/internal/storage"
+	"github.com/lileye/backend/internal/version"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// timeFormat is the time in backup file names, in UTC
+const timeFormat = "20060102T150405Z"
+
+// validName matches the file names of backups
+var validName = regexp.MustCompile(`^lileye-\d{8}T\d{6}Z\.db$`)
+
+// ErrNotFound is returned for a backup that does not exist
+var ErrNotFound = errors.New("backup not found")
+
+// Manager takes, lists and rotates the backups of a database
+type Manager struct {
+	db   *gorm.DB
+	dir  string
+	keep int
+	now  func() time.Time
+	// mu serializes backups so that rotation sees every finished one
+	mu sync.Mutex
+}
+
+// NewManager creates a Manager writing backups of db to dir. After each
+// backup all but the newest keep backups are deleted; 0 keeps every backup.
+func NewManager(db *gorm.DB, dir string, keep int) *Manager {
+	return &Manager{db: db, dir: dir, keep: keep, now: time.Now}
+}
+
+// Create takes a backup, checks it and rotates older ones
+func (m *Manager) Create() (manifest *models.BackupManifest, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer func() {
+		if err != nil {
+			metrics.BackupRuns.WithLabelValues("error").Inc()
+			return
+		}
+		metrics.BackupRuns.WithLabelValues("success").Inc()
+		metrics.BackupLastSuccess.SetToCurrentTime()
+	}()
+
+	if err := os.MkdirAll(m.dir, 0o700); err != nil {
+		return nil, err
+	}
+	now := m.now().UTC().Truncate(time.Second)
+	name := "lileye-" + now.Format(timeFormat) + ".db"
+	path := filepath.Join(m.dir, name)
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("backup %s already exists", name)
+	}
+
+	partial := path + ".partial"
+	os.Remove(partial)
+	if err := m.db.Exec("VACUUM INTO ?", partial).Error; err != nil {
+		return nil, fmt.Errorf("snapshot database: %w", err)
+	}
+	manifest, err = inspect(partial)
+	if err != nil {
+		os.Remove(partial)
+		return nil, err
+	}
+	manifest.File = name
+	manifest.CreatedAt = now
+	manifest.AppVersion = version.Get().Version
+
+	if err := os.Rename(partial, path); err != nil {
+		os.Remove(partial)
+		return nil, err
+	}
+	if err := writeManifest(manifestPath(path), manifest); err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	if err := m.rotate(); err != nil {
+		return manifest, fmt.Errorf("rotate backups: %w", err)
+	}
+	return manifest, nil
+}
+
+// List returns the manifests of the backups, newest first
+func (m *Manager) List() ([]models.BackupManifest, error) {
+	entries, err := os.ReadDir(m.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []models.BackupManifest{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	manifests := []models.BackupManifest{}
+	for _, entry := range entries {
+		if !validName.MatchString(entry.Name()) {
+			continue
+		}
+		// A snapshot without a manifest was cut short and is not listed
+		manifest, err := ReadManifest(filepath.Join(m.dir, entry.Name()))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, *manifest)
+	}
+	sort.Slice(manifests, func(i, j int) bool {
+		return manifests[i].File > manifests[j].File
+	})
+	return manifests, nil
+}
+
+// Path returns the path of the backup with the given file name
+func (m *Manager) Path(name string) (string, error) {
+	if !validName.MatchString(name) {
+		return "", ErrNotFound
+	}
+	path := filepath.Join(m.dir, name)
+	if _, err := os.Stat(path); err != nil {
+		return "", ErrNotFound
+	}
+	return path, nil
+}
+
+// rotate deletes all but the newest keep backups
+func (m *Manager) rotate() error {
+	if m.keep <= 0 {
+		return nil
+	}
+	manifests, err := m.List()
+	if err != nil || len(manifests) <= m.keep {
+		return err
+	}
+	for _, old := range manifests[m.keep:] {
+		path := filepath.Join(m.dir, old.File)
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if err := os.Remove(manifestPath(path)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadManifest reads the manifest of the backup at path
+func ReadManifest(path string) (*models.BackupManifest, error) {
+	data, err := os.ReadFile(manifestPath(path))
+	if err != nil {
+		return nil, err
+	}
+	var manifest models.BackupManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("manifest of %s: %w", filepath.Base(path), err)
+	}
+	return &manifest, nil
+}
+
+// Verify checks the backup at path against its manifest and checks the
+// integrity and schema version of the database in it. It returns the
+// manifest, or one describing the file when the backup has none.
+func Verify(path string) (*models.BackupManifest, error) {
+	manifest, err := ReadManifest(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	inspected, err := inspect(path)
+	if err != nil {
+		return nil, err
+	}
+	if manifest == nil {
+		inspected.File = filepath.Base(path)
+		return inspected, nil
+	}
+	if inspected.Size != manifest.Size || inspected.SHA256 != manifest.SHA256 {
+		return nil, fmt.Errorf("%s does not match the checksum in its manifest", filepath.Base(path))
+	}
+	return manifest, nil
+}
+
+// Restore replaces the database at dbPath with the backup at path after
+// verifying it, and returns the backup's manifest. The replaced database is
+// kept next to it with the suffix .pre-restore-<time>; its path is
+// returned too. The server must be stopped.
+func Restore(path, dbPath string) (*models.BackupManifest, string, error) {
+	manifest, err := Verify(path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	restoring := dbPath + ".restoring"
+	if err := copyFile(path, restoring); err != nil {
+		os.Remove(restoring)
+		return nil, "", err
+	}
+
+	// The write-ahead log and shared memory files belong to the replaced
+	// database and move with it
+	var kept string
+	if _, err := os.Stat(dbPath); err == nil {
+		kept = dbPath + ".pre-restore-" + time.Now().UTC().Format(timeFormat)
+		for _, suffix := range []string{"", "-wal", "-shm"} {
+			err := os.Rename(dbPath+suffix, kept+suffix)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				os.Remove(restoring)
+				return nil, "", err
+			}
+		}
+	}
+	return manifest, kept, os.Rename(restoring, dbPath)
+}
+
+// inspect checks the integrity and schema version of the database at path
+// and describes it
+func inspect(path string) (*models.BackupManifest, error) {
+	db, err := gorm.Open(sqlite.Open(readOnly(path)), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a readable database: %w", filepath.Base(path), err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	defer sqlDB.Close()
+
+	var problems []string
+	if err := db.Raw("PRAGMA integrity_check").Scan(&problems).Error; err != nil {
+		return nil, fmt.Errorf("%s is not a readable database: %w", filepath.Base(path), err)
+	}
+	if len(problems) != 1 || problems[0] != "ok" {
+		return nil, fmt.Errorf("%s failed the integrity check: %s", filepath.Base(path), strings.Join(problems, "; "))
+	}
+
+	manifest := &models.BackupManifest{}
+	if manifest.SchemaVersion, err = storage.GetSchemaVersion(db); err != nil {
+		return nil, err
+	}
+	if manifest.SchemaVersion > storage.SchemaVersion {
+		return nil, fmt.Errorf("%s has schema version %d, newer than the %d this release supports",
+			filepath.Base(path), manifest.SchemaVersion, storage.SchemaVersion)
+	}
+	if manifest.SchemaVersion == storage.SchemaVersion {
+		if err := storage.CheckSchema(db); err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+	}
+	if err := db.Model(&models.Notification{}).Unscoped().Count(&manifest.Notifications).Error; err != nil {
+		return nil, err
+	}
+	sqlDB.Close()
+
+	manifest.Size, manifest.SHA256, err = checksum(path)
+	return manifest, err
+}
+
+// readOnly returns the SQLite URI opening path read-only
+func readOnly(path string) string {
+	return "file:" + (&url.URL{Path: path}).EscapedPath() + "?mode=ro"
+}
+
+func manifestPath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".json"
+}
+
+func writeManifest(path string, manifest *models.BackupManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	partial := path + ".partial"
+	if err := os.WriteFile(partial, append(data, '\n'), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(partial, path)
+}
+
+func checksum(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	return size, hex.EncodeToString(h.Sum(nil)), err
+}
+
+// copyFile copies src to dst and syncs dst to disk
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
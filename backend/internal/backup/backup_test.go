@@ -0,0 +1,146 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lileye/backend/internal/models"
+	"github.com/lileye/backend/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func openDB(t *testing.T, path string) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, storage.Migrate(db))
+	t.Cleanup(func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	})
+	return db
+}
+
+func addNotification(t *testing.T, db *gorm.DB, title string) {
+	err := storage.NewNotificationStorage(db).Create(context.Background(), &models.Notification{
+		Title:       title,
+		Message:     "Hello",
+		Timestamp:   time.Now(),
+		PackageName: "com.whatsapp",
+		DeviceID:    "device1",
+	})
+	assert.NoError(t, err)
+}
+
+// newManager returns a manager whose clock moves a minute per backup
+func newManager(db *gorm.DB, dir string, keep int) *Manager {
+	m := NewManager(db, dir, keep)
+	clock := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	m.now = func() time.Time {
+		clock = clock.Add(time.Minute)
+		return clock
+	}
+	return m
+}
+
+func TestCreateAndRotate(t *testing.T) {
+	db := openDB(t, filepath.Join(t.TempDir(), "notifications.db"))
+	addNotification(t, db, "First")
+	dir := filepath.Join(t.TempDir(), "backups")
+	m := newManager(db, dir, 2)
+
+	manifest, err := m.Create()
+	assert.NoError(t, err)
+	assert.Equal(t, "lileye-20261019T120100Z.db", manifest.File)
+	assert.Equal(t, int64(1), manifest.Notifications)
+	assert.Equal(t, storage.SchemaVersion, manifest.SchemaVersion)
+	assert.Len(t, manifest.SHA256, 64)
+
+	verified, err := Verify(filepath.Join(dir, manifest.File))
+	assert.NoError(t, err)
+	assert.Equal(t, manifest, verified)
+
+	addNotification(t, db, "Second")
+	_, err = m.Create()
+	assert.NoError(t, err)
+	newest, err := m.Create()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), newest.Notifications)
+
+	manifests, err := m.List()
+	assert.NoError(t, err)
+	assert.Len(t, manifests, 2)
+	assert.Equal(t, newest.File, manifests[0].File)
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	assert.Len(t, files, 4)
+
+	_, err = m.Path("../notifications.db")
+	assert.ErrorIs(t, err, ErrNotFound)
+	path, err := m.Path(newest.File)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, newest.File), path)
+}
+
+func TestRestore(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "notifications.db")
+	db := openDB(t, dbPath)
+	addNotification(t, db, "Backed up")
+	manifest, err := newManager(db, filepath.Join(dir, "backups"), 0).Create()
+	assert.NoError(t, err)
+	backupPath := filepath.Join(dir, "backups", manifest.File)
+
+	addNotification(t, db, "After the backup")
+	sqlDB, _ := db.DB()
+	sqlDB.Close()
+
+	restoredFrom, kept, err := Restore(backupPath, dbPath)
+	assert.NoError(t, err)
+	assert.Equal(t, manifest, restoredFrom)
+	assert.FileExists(t, kept)
+
+	restored := openDB(t, dbPath)
+	var titles []string
+	restored.Model(&models.Notification{}).Pluck("title", &titles)
+	assert.Equal(t, []string{"Backed up"}, titles)
+	previous := openDB(t, kept)
+	previous.Model(&models.Notification{}).Pluck("title", &titles)
+	assert.Equal(t, []string{"Backed up", "After the backup"}, titles)
+}
+
+func TestRestoreRejectsBadBackups(t *testing.T) {
+	dir := t.TempDir()
+	db := openDB(t, filepath.Join(dir, "notifications.db"))
+	addNotification(t, db, "Backed up")
+	m := newManager(db, filepath.Join(dir, "backups"), 0)
+	target := filepath.Join(dir, "restored.db")
+
+	// Altered after the manifest was written
+	manifest, err := m.Create()
+	assert.NoError(t, err)
+	path := filepath.Join(dir, "backups", manifest.File)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	assert.NoError(t, err)
+	f.Write([]byte("tampered"))
+	f.Close()
+	_, _, err = Restore(path, target)
+	assert.ErrorContains(t, err, "does not match the checksum")
+
+	// Not a database
+	garbage := filepath.Join(dir, "garbage.db")
+	assert.NoError(t, os.WriteFile(garbage, []byte("not a database"), 0o600))
+	_, _, err = Restore(garbage, target)
+	assert.ErrorContains(t, err, "garbage.db")
+
+	// From a newer release
+	assert.NoError(t, db.Exec("PRAGMA user_version = 99").Error)
+	manifest, err = m.Create()
+	assert.Nil(t, manifest)
+	assert.ErrorContains(t, err, "schema version 99")
+
+	assert.NoFileExists(t, target)
+}
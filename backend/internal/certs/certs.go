@@ -0,0 +1,254 @@
+// Package certs creates and loads the certificates the server uses for TLS.
+// In self-signed mode it keeps a private CA in a directory and issues the
+// server certificate from it, so clients can pin the CA while the server
+// certificate is reissued as the host names or addresses change.
+package certs
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lileye/backend/internal/models"
+)
+
+// Files in the self-signed certificate directory
+const (
+	CAFile         = "ca.pem"
+	CAKeyFile      = "ca-key.pem"
+	ServerFile     = "server.pem"
+	ServerKeyFile  = "server-key.pem"
+	caValidity     = 10 * 365 * 24 * time.Hour
+	serverValidity = 397 * 24 * time.Hour
+	// renewBefore is how long before expiry the server certificate is
+	// reissued
+	renewBefore = 30 * 24 * time.Hour
+)
+
+// Load reads a certificate and key pair from PEM files
+func Load(certFile, keyFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil
+}
+
+// SelfSigned loads the CA and server certificate from dir, creating the CA
+// on first use. The server certificate is reissued when it is missing, due
+// to expire or does not cover hosts. Empty hosts means localhost and the
+// addresses of the network interfaces.
+func SelfSigned(dir string, hosts []string) (*tls.Config, *models.CAInfo, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, nil, err
+	}
+	if len(hosts) == 0 {
+		var err error
+		if hosts, err = localHosts(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	ca, caKey, err := loadOrCreateCA(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cert, err := tls.LoadX509KeyPair(filepath.Join(dir, ServerFile), filepath.Join(dir, ServerKeyFile))
+	if err != nil || !valid(cert, ca, hosts) {
+		if cert, err = issueServer(dir, ca, caKey, hosts); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	config := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	return config, Info(ca), nil
+}
+
+// Info returns the pinning information of a CA certificate
+func Info(ca *x509.Certificate) *models.CAInfo {
+	sum := sha256.Sum256(ca.Raw)
+	spki := sha256.Sum256(ca.RawSubjectPublicKeyInfo)
+	return &models.CAInfo{
+		Fingerprint: fingerprint(sum[:]),
+		SPKIPin:     base64.StdEncoding.EncodeToString(spki[:]),
+		NotAfter:    ca.NotAfter,
+		PEM:         string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})),
+	}
+}
+
+func loadOrCreateCA(dir string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	certPath, keyPath := filepath.Join(dir, CAFile), filepath.Join(dir, CAKeyFile)
+	pair, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err == nil {
+		key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, nil, fmt.Errorf("%s: unsupported key type", keyPath)
+		}
+		ca, err := x509.ParseCertificate(pair.Certificate[0])
+		return ca, key, err
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf("load CA: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "Lileye Local CA", Organization: []string{"Lileye"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := writePair(certPath, keyPath, der, key); err != nil {
+		return nil, nil, err
+	}
+	ca, err := x509.ParseCertificate(der)
+	return ca, key, err
+}
+
+func issueServer(dir string, ca *x509.Certificate, caKey *ecdsa.PrivateKey, hosts []string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: hosts[0], Organization: []string{"Lileye"}},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(serverValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	certPath, keyPath := filepath.Join(dir, ServerFile), filepath.Join(dir, ServerKeyFile)
+	if err := writePair(certPath, keyPath, der, key, ca.Raw); err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.LoadX509KeyPair(certPath, keyPath)
+}
+
+// valid reports whether cert was issued by ca for exactly hosts and is not
+// due for renewal
+func valid(cert tls.Certificate, ca *x509.Certificate, hosts []string) bool {
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil || leaf.CheckSignatureFrom(ca) != nil {
+		return false
+	}
+	if time.Until(leaf.NotAfter) < renewBefore {
+		return false
+	}
+
+	var covered []string
+	covered = append(covered, leaf.DNSNames...)
+	for _, ip := range leaf.IPAddresses {
+		covered = append(covered, ip.String())
+	}
+	want := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			host = ip.String()
+		}
+		want = append(want, host)
+	}
+	sort.Strings(covered)
+	sort.Strings(want)
+	return strings.Join(covered, ",") == strings.Join(want, ",")
+}
+
+// writePair writes a certificate chain and its key, which only the owner may
+// read
+func writePair(certPath, keyPath string, der []byte, key *ecdsa.PrivateKey, chain ...[]byte) error {
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		return err
+	}
+
+	var certPEM bytes.Buffer
+	for _, block := range append([][]byte{der}, chain...) {
+		if err := pem.Encode(&certPEM, &pem.Block{Type: "CERTIFICATE", Bytes: block}); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(certPath, certPEM.Bytes(), 0o644)
+}
+
+// localHosts returns localhost and the unicast addresses of the network
+// interfaces
+func localHosts() ([]string, error) {
+	hosts := []string{"localhost"}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if ok && (ipnet.IP.IsGlobalUnicast() || ipnet.IP.IsLoopback()) {
+			hosts = append(hosts, ipnet.IP.String())
+		}
+	}
+	return hosts, nil
+}
+
+func serialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+func fingerprint(sum []byte) string {
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = strings.ToUpper(hex.EncodeToString([]byte{b}))
+	}
+	return strings.Join(parts, ":")
+}
@@ -0,0 +1,86 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelfSigned(t *testing.T) {
+	dir := t.TempDir()
+
+	config, info, err := SelfSigned(dir, []string{"lileye.local", "192.168.1.20"})
+	assert.NoError(t, err)
+	assert.Len(t, config.Certificates, 1)
+	assert.Len(t, info.Fingerprint, 95)
+	assert.NotEmpty(t, info.SPKIPin)
+
+	stat, err := os.Stat(filepath.Join(dir, CAKeyFile))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), stat.Mode().Perm())
+
+	// The server certificate verifies against the pinned CA for each host
+	pool := x509.NewCertPool()
+	assert.True(t, pool.AppendCertsFromPEM([]byte(info.PEM)))
+	leaf, err := x509.ParseCertificate(config.Certificates[0].Certificate[0])
+	assert.NoError(t, err)
+	for _, host := range []string{"lileye.local", "192.168.1.20"} {
+		_, err = leaf.Verify(x509.VerifyOptions{DNSName: host, Roots: pool})
+		assert.NoError(t, err, host)
+	}
+	_, err = leaf.Verify(x509.VerifyOptions{DNSName: "example.com", Roots: pool})
+	assert.Error(t, err)
+
+	// Restarting reuses both certificates
+	again, againInfo, err := SelfSigned(dir, []string{"192.168.1.20", "lileye.local"})
+	assert.NoError(t, err)
+	assert.Equal(t, info.Fingerprint, againInfo.Fingerprint)
+	assert.Equal(t, config.Certificates[0].Certificate[0], again.Certificates[0].Certificate[0])
+
+	// A new address reissues the server certificate from the same CA
+	moved, movedInfo, err := SelfSigned(dir, []string{"lileye.local", "192.168.1.21"})
+	assert.NoError(t, err)
+	assert.Equal(t, info.Fingerprint, movedInfo.Fingerprint)
+	assert.NotEqual(t, config.Certificates[0].Certificate[0], moved.Certificates[0].Certificate[0])
+}
+
+func TestSelfSignedHandshake(t *testing.T) {
+	config, info, err := SelfSigned(t.TempDir(), []string{"127.0.0.1"})
+	assert.NoError(t, err)
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	assert.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM([]byte(info.PEM))
+	conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{RootCAs: pool})
+	assert.NoError(t, err)
+	if conn != nil {
+		conn.Close()
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	_, _, err := SelfSigned(dir, []string{"localhost"})
+	assert.NoError(t, err)
+
+	config, err := Load(filepath.Join(dir, ServerFile), filepath.Join(dir, ServerKeyFile))
+	assert.NoError(t, err)
+	assert.Len(t, config.Certificates, 1)
+
+	_, err = Load(filepath.Join(dir, "missing.pem"), filepath.Join(dir, ServerKeyFile))
+	assert.Error(t, err)
+}
@@ -0,0 +1,179 @@
+// Package client calls the lileye API. Its methods are generated from the
+// operations in internal/openapi, so they follow the handlers; run go
+// generate in this directory after changing them.
+package client
+
+//go:generate go run ../openapi/genclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lileye/backend/internal/models"
+)
+
+// Client calls the API of a running server
+type Client struct {
+	base *url.URL
+	key  string
+	http *http.Client
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithKey sends key as the admin key of every request
+func WithKey(key string) Option {
+	return func(c *Client) { c.key = key }
+}
+
+// WithHTTPClient sends requests with hc rather than http.DefaultClient
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.http = hc }
+}
+
+// New creates a client of the server at baseURL, such as
+// https://lileye.local:8080
+func New(baseURL string, opts ...Option) (*Client, error) {
+	base, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("invalid server URL %q", baseURL)
+	}
+	c := &Client{base: base, http: http.DefaultClient}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// Error is an error response of the server
+type Error struct {
+	Method     string
+	Path       string
+	StatusCode int
+	// Status is the status line, such as "404 Not Found"
+	Status string
+	// RetryAfter is how long to wait before retrying a request refused by a
+	// rate limit, or 0
+	RetryAfter time.Duration
+	models.APIError
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%s %s: %s: %s", e.Method, e.Path, e.Status, e.Message)
+	for _, f := range e.Fields {
+		msg += fmt.Sprintf("; %s %s", f.Field, f.Message)
+	}
+	return msg
+}
+
+// do sends a request with body encoded as JSON, if not nil, and decodes the
+// JSON response into out
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	resp, err := c.send(ctx, method, path, query, "application/json", reader)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// upload sends file as the "file" field of a multipart form, next to the
+// form fields, and decodes the JSON response into out
+func (c *Client) upload(ctx context.Context, method, path string, fields url.Values, filename string, file io.Reader, out any) error {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for name, values := range fields {
+		for _, v := range values {
+			if err := w.WriteField(name, v); err != nil {
+				return err
+			}
+		}
+	}
+	part, err := w.CreateFormFile("file", filename)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	resp, err := c.send(ctx, method, path, nil, w.FormDataContentType(), &body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// download copies the body of the response to a GET request to w
+func (c *Client) download(ctx context.Context, path string, query url.Values, w io.Writer) error {
+	resp, err := c.send(ctx, http.MethodGet, path, query, "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// send sends a request and returns the response if it succeeded. Error
+// responses are returned as *Error.
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, contentType string, body io.Reader) (*http.Response, error) {
+	u := *c.base
+	u.Path += path
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.key != "" {
+		req.Header.Set("Authorization", "Bearer "+c.key)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	e := &Error{Method: method, Path: path, StatusCode: resp.StatusCode, Status: resp.Status}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		e.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	var envelope models.ErrorResponse
+	if json.Unmarshal(data, &envelope) == nil && envelope.Error.Code != "" {
+		e.APIError = envelope.Error
+	} else {
+		// Not from the API, such as the error page of a proxy
+		e.Message = strings.TrimSpace(string(data))
+	}
+	return nil, e
+}
@@ -0,0 +1,1027 @@
+// Code generated by go run ./internal/openapi/genclient; DO NOT EDIT.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/lileye/backend/internal/models"
+	"github.com/lileye/backend/internal/version"
+)
+
+// Healthz calls GET /healthz to report that the process is up
+func (c *Client) Healthz(ctx context.Context) (*models.HealthStatus, error) {
+	var out models.HealthStatus
+	if err := c.do(ctx, "GET", "/healthz", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Readyz calls GET /readyz to report whether the server can take traffic
+func (c *Client) Readyz(ctx context.Context) (*models.HealthReport, error) {
+	var out models.HealthReport
+	if err := c.do(ctx, "GET", "/readyz", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetVersion calls GET /version to get the build information of the server
+func (c *Client) GetVersion(ctx context.Context) (*version.Info, error) {
+	var out version.Info
+	if err := c.do(ctx, "GET", "/version", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetOpenAPI calls GET /api/v1/openapi.json to get the OpenAPI document of the API
+func (c *Client) GetOpenAPI(ctx context.Context) (map[string]any, error) {
+	var out map[string]any
+	if err := c.do(ctx, "GET", "/api/v1/openapi.json", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CreateNotification calls POST /api/v1/notifications to store a notification, or return the one it repeats
+func (c *Client) CreateNotification(ctx context.Context, body *models.Notification) (*models.Notification, error) {
+	var out models.Notification
+	if err := c.do(ctx, "POST", "/api/v1/notifications", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateNotifications calls POST /api/v1/notifications/batch to store up to 500 notifications at once
+func (c *Client) CreateNotifications(ctx context.Context, body []models.Notification) ([]models.Notification, error) {
+	var out []models.Notification
+	if err := c.do(ctx, "POST", "/api/v1/notifications/batch", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetNotification calls GET /api/v1/notifications/{id} to get a notification
+func (c *Client) GetNotification(ctx context.Context, id uint) (*models.Notification, error) {
+	var out models.Notification
+	if err := c.do(ctx, "GET", fmt.Sprintf("/api/v1/notifications/%d", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListNotificationsParams are the query parameters of ListNotifications
+type ListNotificationsParams struct {
+	// Only apps of this category
+	AppCategory string
+	// Only this Android notification category
+	Category string
+	// Only this notification channel
+	ChannelID string
+	// Only this sub text
+	SubText string
+	// Only this conversation
+	ConversationTitle string
+	// Only notifications involving this person, by exact name
+	Person string
+}
+
+func (p *ListNotificationsParams) values() url.Values {
+	v := url.Values{}
+	if p == nil {
+		return v
+	}
+	if p.AppCategory != "" {
+		v.Set("app_category", p.AppCategory)
+	}
+	if p.Category != "" {
+		v.Set("category", p.Category)
+	}
+	if p.ChannelID != "" {
+		v.Set("channel_id", p.ChannelID)
+	}
+	if p.SubText != "" {
+		v.Set("sub_text", p.SubText)
+	}
+	if p.ConversationTitle != "" {
+		v.Set("conversation_title", p.ConversationTitle)
+	}
+	if p.Person != "" {
+		v.Set("person", p.Person)
+	}
+	return v
+}
+
+// ListNotifications calls GET /api/v1/notifications/device/{deviceID} to list the notifications of a device
+func (c *Client) ListNotifications(ctx context.Context, deviceID string, params *ListNotificationsParams) ([]models.Notification, error) {
+	var out []models.Notification
+	if err := c.do(ctx, "GET", fmt.Sprintf("/api/v1/notifications/device/%s", url.PathEscape(deviceID)), params.values(), nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListNotificationsInRangeParams are the query parameters of ListNotificationsInRange
+type ListNotificationsInRangeParams struct {
+	// Required
+	Start time.Time
+	// Required
+	End time.Time
+	// Only apps of this category
+	AppCategory string
+	// Only this Android notification category
+	Category string
+	// Only this notification channel
+	ChannelID string
+	// Only this sub text
+	SubText string
+	// Only this conversation
+	ConversationTitle string
+	// Only notifications involving this person, by exact name
+	Person string
+}
+
+func (p *ListNotificationsInRangeParams) values() url.Values {
+	v := url.Values{}
+	if p == nil {
+		return v
+	}
+	if !p.Start.IsZero() {
+		v.Set("start", p.Start.Format(time.RFC3339))
+	}
+	if !p.End.IsZero() {
+		v.Set("end", p.End.Format(time.RFC3339))
+	}
+	if p.AppCategory != "" {
+		v.Set("app_category", p.AppCategory)
+	}
+	if p.Category != "" {
+		v.Set("category", p.Category)
+	}
+	if p.ChannelID != "" {
+		v.Set("channel_id", p.ChannelID)
+	}
+	if p.SubText != "" {
+		v.Set("sub_text", p.SubText)
+	}
+	if p.ConversationTitle != "" {
+		v.Set("conversation_title", p.ConversationTitle)
+	}
+	if p.Person != "" {
+		v.Set("person", p.Person)
+	}
+	return v
+}
+
+// ListNotificationsInRange calls GET /api/v1/notifications/device/{deviceID}/range to list the notifications a device received in a period
+func (c *Client) ListNotificationsInRange(ctx context.Context, deviceID string, params *ListNotificationsInRangeParams) ([]models.Notification, error) {
+	var out []models.Notification
+	if err := c.do(ctx, "GET", fmt.Sprintf("/api/v1/notifications/device/%s/range", url.PathEscape(deviceID)), params.values(), nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SearchNotificationsParams are the query parameters of SearchNotifications
+type SearchNotificationsParams struct {
+	// Text to search for; required
+	Q string
+	// Only apps of this category
+	AppCategory string
+	// Only this Android notification category
+	Category string
+	// Only this notification channel
+	ChannelID string
+	// Only this sub text
+	SubText string
+	// Only this conversation
+	ConversationTitle string
+	// Only notifications involving this person, by exact name
+	Person string
+}
+
+func (p *SearchNotificationsParams) values() url.Values {
+	v := url.Values{}
+	if p == nil {
+		return v
+	}
+	if p.Q != "" {
+		v.Set("q", p.Q)
+	}
+	if p.AppCategory != "" {
+		v.Set("app_category", p.AppCategory)
+	}
+	if p.Category != "" {
+		v.Set("category", p.Category)
+	}
+	if p.ChannelID != "" {
+		v.Set("channel_id", p.ChannelID)
+	}
+	if p.SubText != "" {
+		v.Set("sub_text", p.SubText)
+	}
+	if p.ConversationTitle != "" {
+		v.Set("conversation_title", p.ConversationTitle)
+	}
+	if p.Person != "" {
+		v.Set("person", p.Person)
+	}
+	return v
+}
+
+// SearchNotifications calls GET /api/v1/notifications/device/{deviceID}/search to search the notifications of a device
+func (c *Client) SearchNotifications(ctx context.Context, deviceID string, params *SearchNotificationsParams) ([]models.Notification, error) {
+	var out []models.Notification
+	if err := c.do(ctx, "GET", fmt.Sprintf("/api/v1/notifications/device/%s/search", url.PathEscape(deviceID)), params.values(), nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListDevices calls GET /api/v1/devices to list the IDs of the devices that sent notifications
+func (c *Client) ListDevices(ctx context.Context) ([]string, error) {
+	var out []string
+	if err := c.do(ctx, "GET", "/api/v1/devices", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DeleteAllNotifications calls DELETE /api/v1/notifications/all to delete every notification
+func (c *Client) DeleteAllNotifications(ctx context.Context) (*models.Message, error) {
+	var out models.Message
+	if err := c.do(ctx, "DELETE", "/api/v1/notifications/all", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListConversationsParams are the query parameters of ListConversations
+type ListConversationsParams struct {
+	// Only apps of this category
+	AppCategory string
+}
+
+func (p *ListConversationsParams) values() url.Values {
+	v := url.Values{}
+	if p == nil {
+		return v
+	}
+	if p.AppCategory != "" {
+		v.Set("app_category", p.AppCategory)
+	}
+	return v
+}
+
+// ListConversations calls GET /api/v1/conversations/device/{deviceID} to list the conversations of a device
+func (c *Client) ListConversations(ctx context.Context, deviceID string, params *ListConversationsParams) ([]models.Conversation, error) {
+	var out []models.Conversation
+	if err := c.do(ctx, "GET", fmt.Sprintf("/api/v1/conversations/device/%s", url.PathEscape(deviceID)), params.values(), nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetThreadParams are the query parameters of GetThread
+type GetThreadParams struct {
+	// Package name of the app; required
+	Package string
+	// Sender, or conversation title of a group chat
+	From string
+	// Page size, 50 by default and at most 500
+	Limit int
+	// Number of results to skip
+	Offset int
+}
+
+func (p *GetThreadParams) values() url.Values {
+	v := url.Values{}
+	if p == nil {
+		return v
+	}
+	if p.Package != "" {
+		v.Set("package", p.Package)
+	}
+	if p.From != "" {
+		v.Set("from", p.From)
+	}
+	if p.Limit != 0 {
+		v.Set("limit", strconv.Itoa(p.Limit))
+	}
+	if p.Offset != 0 {
+		v.Set("offset", strconv.Itoa(p.Offset))
+	}
+	return v
+}
+
+// GetThread calls GET /api/v1/conversations/device/{deviceID}/thread to get a page of the messages of a conversation
+func (c *Client) GetThread(ctx context.Context, deviceID string, params *GetThreadParams) (*models.NotificationPage, error) {
+	var out models.NotificationPage
+	if err := c.do(ctx, "GET", fmt.Sprintf("/api/v1/conversations/device/%s/thread", url.PathEscape(deviceID)), params.values(), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// MarkThreadReadParams are the query parameters of MarkThreadRead
+type MarkThreadReadParams struct {
+	// Package name of the app; required
+	Package string
+	// Sender, or conversation title of a group chat
+	From string
+}
+
+func (p *MarkThreadReadParams) values() url.Values {
+	v := url.Values{}
+	if p == nil {
+		return v
+	}
+	if p.Package != "" {
+		v.Set("package", p.Package)
+	}
+	if p.From != "" {
+		v.Set("from", p.From)
+	}
+	return v
+}
+
+// MarkThreadRead calls POST /api/v1/conversations/device/{deviceID}/thread/read to mark the messages of a conversation as read
+func (c *Client) MarkThreadRead(ctx context.Context, deviceID string, params *MarkThreadReadParams) (*models.Updated, error) {
+	var out models.Updated
+	if err := c.do(ctx, "POST", fmt.Sprintf("/api/v1/conversations/device/%s/thread/read", url.PathEscape(deviceID)), params.values(), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateEvent calls POST /api/v1/events to record that a notification was posted, updated or removed
+func (c *Client) CreateEvent(ctx context.Context, body *models.NotificationEvent) (*models.NotificationEvent, error) {
+	var out models.NotificationEvent
+	if err := c.do(ctx, "POST", "/api/v1/events", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListDeviceEventsParams are the query parameters of ListDeviceEvents
+type ListDeviceEventsParams struct {
+	// Only events of this notification key
+	Key string
+}
+
+func (p *ListDeviceEventsParams) values() url.Values {
+	v := url.Values{}
+	if p == nil {
+		return v
+	}
+	if p.Key != "" {
+		v.Set("key", p.Key)
+	}
+	return v
+}
+
+// ListDeviceEvents calls GET /api/v1/events/device/{deviceID} to list the lifecycle events of a device
+func (c *Client) ListDeviceEvents(ctx context.Context, deviceID string, params *ListDeviceEventsParams) ([]models.NotificationEvent, error) {
+	var out []models.NotificationEvent
+	if err := c.do(ctx, "GET", fmt.Sprintf("/api/v1/events/device/%s", url.PathEscape(deviceID)), params.values(), nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListNotificationEvents calls GET /api/v1/notifications/{id}/events to list the lifecycle events of a notification
+func (c *Client) ListNotificationEvents(ctx context.Context, id uint) ([]models.NotificationEvent, error) {
+	var out []models.NotificationEvent
+	if err := c.do(ctx, "GET", fmt.Sprintf("/api/v1/notifications/%d/events", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UploadAttachmentParams are the form parameters of UploadAttachment
+type UploadAttachmentParams struct {
+	// icon, image or avatar; image by default
+	Kind string
+}
+
+func (p *UploadAttachmentParams) values() url.Values {
+	v := url.Values{}
+	if p == nil {
+		return v
+	}
+	if p.Kind != "" {
+		v.Set("kind", p.Kind)
+	}
+	return v
+}
+
+// UploadAttachment calls POST /api/v1/notifications/{id}/attachments to upload an image of a notification
+func (c *Client) UploadAttachment(ctx context.Context, id uint, params *UploadAttachmentParams, filename string, file io.Reader) (*models.Attachment, error) {
+	var out models.Attachment
+	if err := c.upload(ctx, "POST", fmt.Sprintf("/api/v1/notifications/%d/attachments", id), params.values(), filename, file, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListAttachments calls GET /api/v1/notifications/{id}/attachments to list the attachments of a notification
+func (c *Client) ListAttachments(ctx context.Context, id uint) ([]models.Attachment, error) {
+	var out []models.Attachment
+	if err := c.do(ctx, "GET", fmt.Sprintf("/api/v1/notifications/%d/attachments", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DownloadAttachment calls GET /api/v1/notifications/{id}/attachments/{attachmentID} to download an attachment
+func (c *Client) DownloadAttachment(ctx context.Context, id uint, attachmentID uint, w io.Writer) error {
+	return c.download(ctx, fmt.Sprintf("/api/v1/notifications/%d/attachments/%d", id, attachmentID), nil, w)
+}
+
+// ListAppsParams are the query parameters of ListApps
+type ListAppsParams struct {
+	// Only apps of this category
+	Category string
+}
+
+func (p *ListAppsParams) values() url.Values {
+	v := url.Values{}
+	if p == nil {
+		return v
+	}
+	if p.Category != "" {
+		v.Set("category", p.Category)
+	}
+	return v
+}
+
+// ListApps calls GET /api/v1/apps to list the app catalog
+func (c *Client) ListApps(ctx context.Context, params *ListAppsParams) ([]models.App, error) {
+	var out []models.App
+	if err := c.do(ctx, "GET", "/api/v1/apps", params.values(), nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ReportApps calls POST /api/v1/apps to report the apps installed on a device
+func (c *Client) ReportApps(ctx context.Context, body []models.App) (*models.Updated, error) {
+	var out models.Updated
+	if err := c.do(ctx, "POST", "/api/v1/apps", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetApp calls GET /api/v1/apps/{package} to get an app
+func (c *Client) GetApp(ctx context.Context, packageName string) (*models.App, error) {
+	var out models.App
+	if err := c.do(ctx, "GET", fmt.Sprintf("/api/v1/apps/%s", url.PathEscape(packageName)), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SetAppCategory calls PUT /api/v1/apps/{package}/category to set the category of an app
+func (c *Client) SetAppCategory(ctx context.Context, packageName string, body *models.SetCategoryRequest) (*models.App, error) {
+	var out models.App
+	if err := c.do(ctx, "PUT", fmt.Sprintf("/api/v1/apps/%s/category", url.PathEscape(packageName)), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SetAppWatched calls PUT /api/v1/apps/{package}/watch to turn new contact alerts for an app on or off
+func (c *Client) SetAppWatched(ctx context.Context, packageName string, body *models.SetWatchedRequest) (*models.App, error) {
+	var out models.App
+	if err := c.do(ctx, "PUT", fmt.Sprintf("/api/v1/apps/%s/watch", url.PathEscape(packageName)), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UploadAppIcon calls PUT /api/v1/apps/{package}/icon to upload the icon of an app
+func (c *Client) UploadAppIcon(ctx context.Context, packageName string, filename string, file io.Reader) (*models.App, error) {
+	var out models.App
+	if err := c.upload(ctx, "PUT", fmt.Sprintf("/api/v1/apps/%s/icon", url.PathEscape(packageName)), nil, filename, file, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DownloadAppIcon calls GET /api/v1/apps/{package}/icon to download the icon of an app
+func (c *Client) DownloadAppIcon(ctx context.Context, packageName string, w io.Writer) error {
+	return c.download(ctx, fmt.Sprintf("/api/v1/apps/%s/icon", url.PathEscape(packageName)), nil, w)
+}
+
+// ListContactsParams are the query parameters of ListContacts
+type ListContactsParams struct {
+	// unknown, trusted or blocked
+	Status string
+}
+
+func (p *ListContactsParams) values() url.Values {
+	v := url.Values{}
+	if p == nil {
+		return v
+	}
+	if p.Status != "" {
+		v.Set("status", p.Status)
+	}
+	return v
+}
+
+// ListContacts calls GET /api/v1/contacts to list contacts
+func (c *Client) ListContacts(ctx context.Context, params *ListContactsParams) ([]models.Contact, error) {
+	var out []models.Contact
+	if err := c.do(ctx, "GET", "/api/v1/contacts", params.values(), nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetContact calls GET /api/v1/contacts/{id} to get a contact and its aliases
+func (c *Client) GetContact(ctx context.Context, id uint) (*models.Contact, error) {
+	var out models.Contact
+	if err := c.do(ctx, "GET", fmt.Sprintf("/api/v1/contacts/%d", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateContact calls PUT /api/v1/contacts/{id} to rename a contact or change its status
+func (c *Client) UpdateContact(ctx context.Context, id uint, body *models.UpdateContactRequest) (*models.Contact, error) {
+	var out models.Contact
+	if err := c.do(ctx, "PUT", fmt.Sprintf("/api/v1/contacts/%d", id), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// MergeContacts calls POST /api/v1/contacts/{id}/merge to merge contacts into this one
+func (c *Client) MergeContacts(ctx context.Context, id uint, body *models.MergeContactsRequest) (*models.Contact, error) {
+	var out models.Contact
+	if err := c.do(ctx, "POST", fmt.Sprintf("/api/v1/contacts/%d/merge", id), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetContactActivity calls GET /api/v1/contacts/{id}/activity to get the activity of a contact per device and app
+func (c *Client) GetContactActivity(ctx context.Context, id uint) ([]models.ContactActivity, error) {
+	var out []models.ContactActivity
+	if err := c.do(ctx, "GET", fmt.Sprintf("/api/v1/contacts/%d/activity", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListContactNotificationsParams are the query parameters of ListContactNotifications
+type ListContactNotificationsParams struct {
+	// Page size, 50 by default and at most 500
+	Limit int
+	// Number of results to skip
+	Offset int
+}
+
+func (p *ListContactNotificationsParams) values() url.Values {
+	v := url.Values{}
+	if p == nil {
+		return v
+	}
+	if p.Limit != 0 {
+		v.Set("limit", strconv.Itoa(p.Limit))
+	}
+	if p.Offset != 0 {
+		v.Set("offset", strconv.Itoa(p.Offset))
+	}
+	return v
+}
+
+// ListContactNotifications calls GET /api/v1/contacts/{id}/notifications to get a page of the notifications of a contact
+func (c *Client) ListContactNotifications(ctx context.Context, id uint, params *ListContactNotificationsParams) (*models.NotificationPage, error) {
+	var out models.NotificationPage
+	if err := c.do(ctx, "GET", fmt.Sprintf("/api/v1/contacts/%d/notifications", id), params.values(), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListNewSendersParams are the query parameters of ListNewSenders
+type ListNewSendersParams struct {
+	// How far back to look, 7 days by default
+	Days int
+	// Only this device
+	DeviceID string
+}
+
+func (p *ListNewSendersParams) values() url.Values {
+	v := url.Values{}
+	if p == nil {
+		return v
+	}
+	if p.Days != 0 {
+		v.Set("days", strconv.Itoa(p.Days))
+	}
+	if p.DeviceID != "" {
+		v.Set("device_id", p.DeviceID)
+	}
+	return v
+}
+
+// ListNewSenders calls GET /api/v1/senders/new to list the senders first seen recently
+func (c *Client) ListNewSenders(ctx context.Context, params *ListNewSendersParams) ([]models.Sender, error) {
+	var out []models.Sender
+	if err := c.do(ctx, "GET", "/api/v1/senders/new", params.values(), nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListAlertsParams are the query parameters of ListAlerts
+type ListAlertsParams struct {
+	// Only this device
+	DeviceID string
+	// Only alerts not acknowledged yet
+	Unacknowledged bool
+}
+
+func (p *ListAlertsParams) values() url.Values {
+	v := url.Values{}
+	if p == nil {
+		return v
+	}
+	if p.DeviceID != "" {
+		v.Set("device_id", p.DeviceID)
+	}
+	if p.Unacknowledged {
+		v.Set("unacknowledged", "true")
+	}
+	return v
+}
+
+// ListAlerts calls GET /api/v1/alerts to list new contact alerts
+func (c *Client) ListAlerts(ctx context.Context, params *ListAlertsParams) ([]models.Alert, error) {
+	var out []models.Alert
+	if err := c.do(ctx, "GET", "/api/v1/alerts", params.values(), nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AcknowledgeAlert calls POST /api/v1/alerts/{id}/ack to acknowledge an alert
+func (c *Client) AcknowledgeAlert(ctx context.Context, id uint) (*models.Message, error) {
+	var out models.Message
+	if err := c.do(ctx, "POST", fmt.Sprintf("/api/v1/alerts/%d/ack", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListAllowlist calls GET /api/v1/allowlist to list the senders that never raise alerts
+func (c *Client) ListAllowlist(ctx context.Context) ([]models.AllowlistEntry, error) {
+	var out []models.AllowlistEntry
+	if err := c.do(ctx, "GET", "/api/v1/allowlist", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AddAllowlistEntry calls POST /api/v1/allowlist to stop a sender from raising alerts
+func (c *Client) AddAllowlistEntry(ctx context.Context, body *models.AllowlistEntry) (*models.AllowlistEntry, error) {
+	var out models.AllowlistEntry
+	if err := c.do(ctx, "POST", "/api/v1/allowlist", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteAllowlistEntry calls DELETE /api/v1/allowlist/{id} to remove a sender from the allowlist
+func (c *Client) DeleteAllowlistEntry(ctx context.Context, id uint) (*models.Message, error) {
+	var out models.Message
+	if err := c.do(ctx, "DELETE", fmt.Sprintf("/api/v1/allowlist/%d", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListAuditLogParams are the query parameters of ListAuditLog
+type ListAuditLogParams struct {
+	Actor string
+	// Such as notification.read
+	Action string
+	// Only this device
+	DeviceID       string
+	NotificationID int
+	Since          time.Time
+	Until          time.Time
+	// Page size, 50 by default and at most 500
+	Limit int
+	// Number of results to skip
+	Offset int
+}
+
+func (p *ListAuditLogParams) values() url.Values {
+	v := url.Values{}
+	if p == nil {
+		return v
+	}
+	if p.Actor != "" {
+		v.Set("actor", p.Actor)
+	}
+	if p.Action != "" {
+		v.Set("action", p.Action)
+	}
+	if p.DeviceID != "" {
+		v.Set("device_id", p.DeviceID)
+	}
+	if p.NotificationID != 0 {
+		v.Set("notification_id", strconv.Itoa(p.NotificationID))
+	}
+	if !p.Since.IsZero() {
+		v.Set("since", p.Since.Format(time.RFC3339))
+	}
+	if !p.Until.IsZero() {
+		v.Set("until", p.Until.Format(time.RFC3339))
+	}
+	if p.Limit != 0 {
+		v.Set("limit", strconv.Itoa(p.Limit))
+	}
+	if p.Offset != 0 {
+		v.Set("offset", strconv.Itoa(p.Offset))
+	}
+	return v
+}
+
+// ListAuditLog calls GET /api/v1/audit to get a page of the audit log, newest first
+func (c *Client) ListAuditLog(ctx context.Context, params *ListAuditLogParams) (*models.AuditPage, error) {
+	var out models.AuditPage
+	if err := c.do(ctx, "GET", "/api/v1/audit", params.values(), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// VerifyAuditLog calls GET /api/v1/audit/verify to check the hash chain of the audit log
+func (c *Client) VerifyAuditLog(ctx context.Context) (*models.AuditVerification, error) {
+	var out models.AuditVerification
+	if err := c.do(ctx, "GET", "/api/v1/audit/verify", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ExportParams are the query parameters of Export
+type ExportParams struct {
+	// csv, ndjson or html; csv by default
+	Format string
+	// Only this device
+	DeviceID string
+	// Only this app
+	Package string
+	// Text to search for
+	Q     string
+	Start time.Time
+	End   time.Time
+	// Only apps of this category
+	AppCategory string
+	// Only this Android notification category
+	Category string
+	// Only this notification channel
+	ChannelID string
+	// Only this sub text
+	SubText string
+	// Only this conversation
+	ConversationTitle string
+	// Only notifications involving this person, by exact name
+	Person string
+}
+
+func (p *ExportParams) values() url.Values {
+	v := url.Values{}
+	if p == nil {
+		return v
+	}
+	if p.Format != "" {
+		v.Set("format", p.Format)
+	}
+	if p.DeviceID != "" {
+		v.Set("device_id", p.DeviceID)
+	}
+	if p.Package != "" {
+		v.Set("package", p.Package)
+	}
+	if p.Q != "" {
+		v.Set("q", p.Q)
+	}
+	if !p.Start.IsZero() {
+		v.Set("start", p.Start.Format(time.RFC3339))
+	}
+	if !p.End.IsZero() {
+		v.Set("end", p.End.Format(time.RFC3339))
+	}
+	if p.AppCategory != "" {
+		v.Set("app_category", p.AppCategory)
+	}
+	if p.Category != "" {
+		v.Set("category", p.Category)
+	}
+	if p.ChannelID != "" {
+		v.Set("channel_id", p.ChannelID)
+	}
+	if p.SubText != "" {
+		v.Set("sub_text", p.SubText)
+	}
+	if p.ConversationTitle != "" {
+		v.Set("conversation_title", p.ConversationTitle)
+	}
+	if p.Person != "" {
+		v.Set("person", p.Person)
+	}
+	return v
+}
+
+// Export calls GET /api/v1/export to export notifications as CSV, NDJSON or an HTML report
+func (c *Client) Export(ctx context.Context, params *ExportParams, w io.Writer) error {
+	return c.download(ctx, "/api/v1/export", params.values(), w)
+}
+
+// ListBackups calls GET /api/v1/admin/backups to list the backups, newest first
+func (c *Client) ListBackups(ctx context.Context) ([]models.BackupManifest, error) {
+	var out []models.BackupManifest
+	if err := c.do(ctx, "GET", "/api/v1/admin/backups", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CreateBackup calls POST /api/v1/admin/backups to take a backup
+func (c *Client) CreateBackup(ctx context.Context) (*models.BackupManifest, error) {
+	var out models.BackupManifest
+	if err := c.do(ctx, "POST", "/api/v1/admin/backups", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DownloadBackup calls GET /api/v1/admin/backups/{name} to download a backup
+func (c *Client) DownloadBackup(ctx context.Context, name string, w io.Writer) error {
+	return c.download(ctx, fmt.Sprintf("/api/v1/admin/backups/%s", url.PathEscape(name)), nil, w)
+}
+
+// ListUsers calls GET /api/v1/admin/users to list the users
+func (c *Client) ListUsers(ctx context.Context) ([]models.User, error) {
+	var out []models.User
+	if err := c.do(ctx, "GET", "/api/v1/admin/users", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CreateUser calls POST /api/v1/admin/users to add a user
+func (c *Client) CreateUser(ctx context.Context, body *models.CreateUserRequest) (*models.User, error) {
+	var out models.User
+	if err := c.do(ctx, "POST", "/api/v1/admin/users", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteUser calls DELETE /api/v1/admin/users/{name} to remove a user and revoke their keys
+func (c *Client) DeleteUser(ctx context.Context, name string) (*models.Message, error) {
+	var out models.Message
+	if err := c.do(ctx, "DELETE", fmt.Sprintf("/api/v1/admin/users/%s", url.PathEscape(name)), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListKeys calls GET /api/v1/admin/keys to list the admin keys without their secret
+func (c *Client) ListKeys(ctx context.Context) ([]models.AdminKey, error) {
+	var out []models.AdminKey
+	if err := c.do(ctx, "GET", "/api/v1/admin/keys", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CreateKey calls POST /api/v1/admin/keys to create an admin key; the response is the only time it is shown
+func (c *Client) CreateKey(ctx context.Context, body *models.CreateKeyRequest) (*models.CreatedAdminKey, error) {
+	var out models.CreatedAdminKey
+	if err := c.do(ctx, "POST", "/api/v1/admin/keys", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RevokeKey calls DELETE /api/v1/admin/keys/{id} to revoke an admin key
+func (c *Client) RevokeKey(ctx context.Context, id uint) (*models.Message, error) {
+	var out models.Message
+	if err := c.do(ctx, "DELETE", fmt.Sprintf("/api/v1/admin/keys/%d", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetStats calls GET /api/v1/admin/stats to get the size of the database
+func (c *Client) GetStats(ctx context.Context) (*models.Stats, error) {
+	var out models.Stats
+	if err := c.do(ctx, "GET", "/api/v1/admin/stats", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListDeviceStats calls GET /api/v1/admin/devices to list the devices with their number of notifications
+func (c *Client) ListDeviceStats(ctx context.Context) ([]models.DeviceStats, error) {
+	var out []models.DeviceStats
+	if err := c.do(ctx, "GET", "/api/v1/admin/devices", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PurgeNotificationsParams are the query parameters of PurgeNotifications
+type PurgeNotificationsParams struct {
+	// Only this device
+	DeviceID string
+	// Only this app
+	Package string
+	// Only notifications received before
+	Before time.Time
+	// Delete every notification
+	All bool
+	// Count the notifications without deleting them
+	DryRun bool
+}
+
+func (p *PurgeNotificationsParams) values() url.Values {
+	v := url.Values{}
+	if p == nil {
+		return v
+	}
+	if p.DeviceID != "" {
+		v.Set("device_id", p.DeviceID)
+	}
+	if p.Package != "" {
+		v.Set("package", p.Package)
+	}
+	if !p.Before.IsZero() {
+		v.Set("before", p.Before.Format(time.RFC3339))
+	}
+	if p.All {
+		v.Set("all", "true")
+	}
+	if p.DryRun {
+		v.Set("dry_run", "true")
+	}
+	return v
+}
+
+// PurgeNotifications calls DELETE /api/v1/admin/notifications to delete notifications permanently; at least one filter or all is required
+func (c *Client) PurgeNotifications(ctx context.Context, params *PurgeNotificationsParams) (*models.PurgeResult, error) {
+	var out models.PurgeResult
+	if err := c.do(ctx, "DELETE", "/api/v1/admin/notifications", params.values(), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetRetention calls GET /api/v1/admin/retention to get the retention policy and its last run
+func (c *Client) GetRetention(ctx context.Context) (*models.RetentionStatus, error) {
+	var out models.RetentionStatus
+	if err := c.do(ctx, "GET", "/api/v1/admin/retention", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RunRetention calls POST /api/v1/admin/retention/run to delete the notifications older than the retention period now
+func (c *Client) RunRetention(ctx context.Context) (*models.RetentionRun, error) {
+	var out models.RetentionRun
+	if err := c.do(ctx, "POST", "/api/v1/admin/retention/run", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetCA calls GET /api/v1/tls/ca to get the fingerprints of the self-signed CA
+func (c *Client) GetCA(ctx context.Context) (*models.CAInfo, error) {
+	var out models.CAInfo
+	if err := c.do(ctx, "GET", "/api/v1/tls/ca", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetCAPEM calls GET /api/v1/tls/ca.pem to download the self-signed CA certificate
+func (c *Client) GetCAPEM(ctx context.Context, w io.Writer) error {
+	return c.download(ctx, "/api/v1/tls/ca.pem", nil, w)
+}
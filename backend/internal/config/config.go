@@ -0,0 +1,358 @@
+// Package config loads the server configuration. Every setting has a
+// default that can be overridden by a YAML or TOML file, then by an
+// environment variable, then by a command-line flag.
+//
+// Settings are addressed by the dotted path of their yaml tags. The
+// environment variable of a setting is that path in upper case with dots
+// replaced by underscores and prefixed with LILEYE_, and its flag is the path
+// itself: server.addr is LILEYE_SERVER_ADDR and -server.addr.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/lileye/backend/internal/fieldcrypt"
+	"github.com/lileye/backend/internal/logging"
+	"github.com/lileye/backend/internal/models"
+	"github.com/lileye/backend/internal/throttle"
+)
+
+// Config is the complete server configuration
+type Config struct {
+	Server      Server      `yaml:"server" toml:"server"`
+	TLS         TLS         `yaml:"tls" toml:"tls"`
+	Metrics     Metrics     `yaml:"metrics" toml:"metrics"`
+	Database    Database    `yaml:"database" toml:"database"`
+	Encryption  Encryption  `yaml:"encryption" toml:"encryption"`
+	Audit       Audit       `yaml:"audit" toml:"audit"`
+	Backup      Backup      `yaml:"backup" toml:"backup"`
+	Retention   Retention   `yaml:"retention" toml:"retention"`
+	Web         Web         `yaml:"web" toml:"web"`
+	Attachments Attachments `yaml:"attachments" toml:"attachments"`
+	Validation  Validation  `yaml:"validation" toml:"validation"`
+	RateLimit   RateLimit   `yaml:"rate_limit" toml:"rate_limit"`
+	Log         Log         `yaml:"log" toml:"log"`
+}
+
+// Server configures the API listener
+type Server struct {
+	Addr              string   `yaml:"addr" toml:"addr" help:"address the API listens on"`
+	ReadHeaderTimeout Duration `yaml:"read_header_timeout" toml:"read_header_timeout" help:"time allowed to read request headers"`
+	ReadTimeout       Duration `yaml:"read_timeout" toml:"read_timeout" help:"time allowed to read a whole request"`
+	WriteTimeout      Duration `yaml:"write_timeout" toml:"write_timeout" help:"time allowed to write a response"`
+	IdleTimeout       Duration `yaml:"idle_timeout" toml:"idle_timeout" help:"how long idle keep-alive connections are kept"`
+	ShutdownTimeout   Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" help:"time allowed to drain requests and stop workers on shutdown"`
+	TrustedProxies    []string `yaml:"trusted_proxies,omitempty" toml:"trusted_proxies,omitempty" help:"comma-separated addresses or CIDRs of reverse proxies trusted to report the client address in X-Forwarded-For; empty trusts none"`
+}
+
+// TLS modes
+const (
+	TLSOff        = "off"
+	TLSFiles      = "files"
+	TLSSelfSigned = "self_signed"
+)
+
+// TLS configures HTTPS on the API listener
+type TLS struct {
+	Mode         string   `yaml:"mode" toml:"mode" help:"off, files or self_signed"`
+	CertFile     string   `yaml:"cert_file" toml:"cert_file" help:"PEM certificate chain used in files mode"`
+	KeyFile      string   `yaml:"key_file" toml:"key_file" help:"PEM private key used in files mode"`
+	Dir          string   `yaml:"dir" toml:"dir" help:"directory of the CA and server certificate in self_signed mode"`
+	Hosts        []string `yaml:"hosts,omitempty" toml:"hosts,omitempty" help:"comma-separated names and addresses of the self-signed certificate; empty uses localhost and the interface addresses"`
+	RedirectAddr string   `yaml:"redirect_addr" toml:"redirect_addr" help:"address of a plain HTTP listener that redirects to HTTPS; empty disables it"`
+}
+
+// Metrics configures the Prometheus listener
+type Metrics struct {
+	Addr string `yaml:"addr" toml:"addr" help:"address /metrics is served on; empty disables it"`
+}
+
+// Database configures the SQLite database
+type Database struct {
+	Path string `yaml:"path" toml:"path" help:"path of the SQLite database file"`
+}
+
+// Encryption configures encryption of notification content at rest
+type Encryption struct {
+	Keys      []string `yaml:"keys,omitempty" toml:"keys,omitempty" secret:"true" help:"comma-separated encryption keys written as <id>:<base64 of 32 bytes>; empty disables encryption"`
+	ActiveKey string   `yaml:"active_key" toml:"active_key" help:"ID of the key new values are encrypted with"`
+	IndexKey  string   `yaml:"index_key" toml:"index_key" secret:"true" help:"base64 of the 32-byte key of the sender blind index; never changes once set"`
+}
+
+// Keyring returns the keyring described by the encryption settings, or nil
+// when encryption is disabled
+func (e Encryption) Keyring() (*fieldcrypt.Keyring, error) {
+	if len(e.Keys) == 0 {
+		if e.ActiveKey != "" || e.IndexKey != "" {
+			return nil, errors.New("active_key and index_key require keys")
+		}
+		return nil, nil
+	}
+	keys, err := fieldcrypt.ParseKeys(e.Keys)
+	if err != nil {
+		return nil, err
+	}
+	if e.IndexKey == "" {
+		return nil, errors.New("index_key is required with keys")
+	}
+	indexKey, err := fieldcrypt.ParseKey(e.IndexKey)
+	if err != nil {
+		return nil, fmt.Errorf("index_key: %w", err)
+	}
+	return fieldcrypt.NewKeyring(keys, e.ActiveKey, indexKey)
+}
+
+// Audit configures the audit log
+type Audit struct {
+	KeyFile string `yaml:"key_file" toml:"key_file" help:"file of the key the audit log is chained with, created when missing; keep it apart from the database and its backups"`
+}
+
+// Backup configures database backups
+type Backup struct {
+	Dir      string   `yaml:"dir" toml:"dir" help:"directory backups are written to"`
+	Interval Duration `yaml:"interval" toml:"interval" help:"time between scheduled backups; 0 disables them"`
+	Keep     int      `yaml:"keep" toml:"keep" help:"number of backups kept, older ones are deleted; 0 keeps all"`
+}
+
+// Retention configures how long notifications are kept
+type Retention struct {
+	MaxAge   Duration `yaml:"max_age" toml:"max_age" help:"age after which notifications are deleted; 0 keeps them forever"`
+	Interval Duration `yaml:"interval" toml:"interval" help:"how often notifications past max_age are deleted"`
+}
+
+// Web configures the web interface
+type Web struct {
+	StaticDir    string `yaml:"static_dir" toml:"static_dir" help:"directory served under /static"`
+	TemplatesDir string `yaml:"templates_dir" toml:"templates_dir" help:"directory of the HTML templates"`
+}
+
+// Attachments configures attachment storage
+type Attachments struct {
+	Dir             string   `yaml:"dir" toml:"dir" help:"directory of the blob store"`
+	MaxSize         int64    `yaml:"max_size" toml:"max_size" help:"largest attachment in bytes a device may upload"`
+	CleanupInterval Duration `yaml:"cleanup_interval" toml:"cleanup_interval" help:"how often orphaned attachments are removed"`
+}
+
+// Validation configures the checks of the notifications devices send.
+// Lengths count characters after Unicode normalization.
+type Validation struct {
+	MaxTitle      int      `yaml:"max_title" toml:"max_title" help:"longest notification title"`
+	MaxMessage    int      `yaml:"max_message" toml:"max_message" help:"longest notification message and big text"`
+	MaxField      int      `yaml:"max_field" toml:"max_field" help:"longest value of the other text fields, such as from and device_id"`
+	MaxExtras     int      `yaml:"max_extras" toml:"max_extras" help:"largest number of extras of a notification"`
+	MaxExtraValue int      `yaml:"max_extra_value" toml:"max_extra_value" help:"longest value of an extra"`
+	MaxFuture     Duration `yaml:"max_future" toml:"max_future" help:"how far past the server time a timestamp may be"`
+	MaxPast       Duration `yaml:"max_past" toml:"max_past" help:"how far before the server time a timestamp may be; 0 allows any age"`
+	MaxBody       int64    `yaml:"max_body" toml:"max_body" help:"largest request body in bytes a notification or a batch may be sent in"`
+}
+
+// RateLimit configures the protection from clients that send too much,
+// such as a device caught in a notification storm
+type RateLimit struct {
+	Rules           []string `yaml:"rules,omitempty" toml:"rules,omitempty" help:"comma-separated rate limits written as <method> <route> ip=<rate> device=<rate>, where a rate is <count>/<s|m|h>:<burst>; the first rule matching a route applies, and empty disables rate limiting"`
+	DuplicateWindow Duration `yaml:"duplicate_window" toml:"duplicate_window" help:"how long a notification repeated by the same device and app is not stored again; 0 stores every repeat"`
+}
+
+// Log configures logging
+type Log struct {
+	Level string `yaml:"level" toml:"level" help:"log level: debug, info, warn or error"`
+}
+
+// Default returns the configuration used when nothing is overridden
+func Default() Config {
+	return Config{
+		Server: Server{
+			Addr:              ":8080",
+			ReadHeaderTimeout: Duration(10 * time.Second),
+			ReadTimeout:       Duration(60 * time.Second),
+			WriteTimeout:      Duration(60 * time.Second),
+			IdleTimeout:       Duration(120 * time.Second),
+			ShutdownTimeout:   Duration(30 * time.Second),
+		},
+		TLS: TLS{
+			Mode: TLSOff,
+			Dir:  "certs",
+		},
+		Metrics:  Metrics{Addr: "127.0.0.1:9090"},
+		Database: Database{Path: "notifications.db"},
+		Audit:    Audit{KeyFile: "audit.key"},
+		Backup: Backup{
+			Dir:      "backups",
+			Interval: Duration(24 * time.Hour),
+			Keep:     7,
+		},
+		Retention: Retention{Interval: Duration(time.Hour)},
+		Web: Web{
+			StaticDir:    "./web/static",
+			TemplatesDir: "./web/templates",
+		},
+		Attachments: Attachments{
+			Dir:             "blobs",
+			MaxSize:         10 << 20,
+			CleanupInterval: Duration(time.Hour),
+		},
+		Validation: Validation{
+			MaxTitle:      1000,
+			MaxMessage:    20000,
+			MaxField:      500,
+			MaxExtras:     100,
+			MaxExtraValue: 20000,
+			MaxFuture:     Duration(10 * time.Minute),
+			MaxBody:       4 << 20,
+		},
+		RateLimit: RateLimit{
+			Rules: []string{
+				"POST /api/v1/notifications ip=20/s:100 device=10/s:100",
+				"POST /api/v1/notifications/batch ip=2/s:20 device=200/s:2000",
+				"GET /api/v1/notifications/stream ip=2/s:20 device=10/s:100",
+				"* /api/v1/* ip=50/s:200",
+			},
+			DuplicateWindow: Duration(30 * time.Second),
+		},
+		Log: Log{Level: "info"},
+	}
+}
+
+// Validate checks that the configuration is usable and returns every
+// problem found
+func (c *Config) Validate() error {
+	var errs []error
+	invalid := func(key, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+
+	if _, _, err := net.SplitHostPort(c.Server.Addr); err != nil {
+		invalid("server.addr", "%v", err)
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				invalid("server.trusted_proxies", "%q is not an address or CIDR", proxy)
+			}
+		}
+	}
+	durations := []struct {
+		key   string
+		value Duration
+	}{
+		{"server.read_header_timeout", c.Server.ReadHeaderTimeout},
+		{"server.read_timeout", c.Server.ReadTimeout},
+		{"server.write_timeout", c.Server.WriteTimeout},
+		{"server.idle_timeout", c.Server.IdleTimeout},
+		{"server.shutdown_timeout", c.Server.ShutdownTimeout},
+		{"attachments.cleanup_interval", c.Attachments.CleanupInterval},
+		{"retention.interval", c.Retention.Interval},
+	}
+	for _, d := range durations {
+		if d.value <= 0 {
+			invalid(d.key, "must be positive")
+		}
+	}
+	switch c.TLS.Mode {
+	case TLSOff, TLSSelfSigned:
+	case TLSFiles:
+		if c.TLS.CertFile == "" {
+			invalid("tls.cert_file", "is required in files mode")
+		}
+		if c.TLS.KeyFile == "" {
+			invalid("tls.key_file", "is required in files mode")
+		}
+	default:
+		invalid("tls.mode", "must be %s, %s or %s", TLSOff, TLSFiles, TLSSelfSigned)
+	}
+	if c.TLS.Mode == TLSSelfSigned && c.TLS.Dir == "" {
+		invalid("tls.dir", "is required in self_signed mode")
+	}
+	if c.TLS.RedirectAddr != "" {
+		if c.TLS.Mode == TLSOff {
+			invalid("tls.redirect_addr", "requires tls.mode to be %s or %s", TLSFiles, TLSSelfSigned)
+		}
+		if _, _, err := net.SplitHostPort(c.TLS.RedirectAddr); err != nil {
+			invalid("tls.redirect_addr", "%v", err)
+		} else if c.TLS.RedirectAddr == c.Server.Addr || c.TLS.RedirectAddr == c.Metrics.Addr {
+			invalid("tls.redirect_addr", "must differ from server.addr and metrics.addr")
+		}
+	}
+	if c.Metrics.Addr != "" {
+		if _, _, err := net.SplitHostPort(c.Metrics.Addr); err != nil {
+			invalid("metrics.addr", "%v", err)
+		} else if c.Metrics.Addr == c.Server.Addr {
+			invalid("metrics.addr", "must differ from server.addr")
+		}
+	}
+	if c.Database.Path == "" {
+		invalid("database.path", "is required")
+	}
+	if _, err := c.Encryption.Keyring(); err != nil {
+		invalid("encryption", "%v", err)
+	}
+	if c.Backup.Dir == "" {
+		invalid("backup.dir", "is required")
+	}
+	if c.Backup.Interval < 0 {
+		invalid("backup.interval", "must not be negative")
+	}
+	if c.Backup.Keep < 0 {
+		invalid("backup.keep", "must not be negative")
+	}
+	if c.Retention.MaxAge < 0 {
+		invalid("retention.max_age", "must not be negative")
+	}
+	if c.Web.StaticDir == "" {
+		invalid("web.static_dir", "is required")
+	}
+	if c.Web.TemplatesDir == "" {
+		invalid("web.templates_dir", "is required")
+	}
+	if c.Audit.KeyFile == "" {
+		invalid("audit.key_file", "is required")
+	}
+	if c.Attachments.Dir == "" {
+		invalid("attachments.dir", "is required")
+	}
+	if c.Attachments.MaxSize <= 0 {
+		invalid("attachments.max_size", "must be positive")
+	}
+	limits := []struct {
+		key   string
+		value int
+	}{
+		{"validation.max_title", c.Validation.MaxTitle},
+		{"validation.max_message", c.Validation.MaxMessage},
+		{"validation.max_field", c.Validation.MaxField},
+		{"validation.max_extras", c.Validation.MaxExtras},
+		{"validation.max_extra_value", c.Validation.MaxExtraValue},
+	}
+	for _, l := range limits {
+		if l.value <= 0 {
+			invalid(l.key, "must be positive")
+		}
+	}
+	if c.Validation.MaxFuture < 0 {
+		invalid("validation.max_future", "must not be negative")
+	}
+	if c.Validation.MaxPast < 0 {
+		invalid("validation.max_past", "must not be negative")
+	}
+	if c.Validation.MaxBody <= 0 {
+		invalid("validation.max_body", "must be positive")
+	}
+	if _, err := throttle.ParseRules(c.RateLimit.Rules); err != nil {
+		invalid("rate_limit.rules", "%v", err)
+	}
+	if c.RateLimit.DuplicateWindow < 0 {
+		invalid("rate_limit.duplicate_window", "must not be negative")
+	}
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		invalid("log.level", "%v", err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// Duration is a time.Duration written as a string such as "30s" or "1h".
+// It is defined with the API types, which report configured durations.
+type Duration = models.Duration
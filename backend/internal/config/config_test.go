@@ -0,0 +1,226 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := vars[key]
+		return v, ok
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(path, []byte(content), 0o600)
+	assert.NoError(t, err)
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, opts, err := Load("server", nil, env(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, Default(), *cfg)
+	assert.False(t, opts.PrintConfig)
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, "lileye.yaml", `
+server:
+  addr: ":8000"
+  shutdown_timeout: 10s
+database:
+  path: /var/lib/lileye/notifications.db
+log:
+  level: debug
+`)
+
+	cfg, opts, err := Load("server", []string{"-config", path, "-log.level", "warn"}, env(map[string]string{
+		"LILEYE_SERVER_ADDR":          ":8001",
+		"LILEYE_ATTACHMENTS_MAX_SIZE": "1024",
+		"LILEYE_LOG_LEVEL":            "error",
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, path, opts.File)
+	assert.Equal(t, ":8001", cfg.Server.Addr)
+	assert.Equal(t, Duration(10*time.Second), cfg.Server.ShutdownTimeout)
+	assert.Equal(t, "/var/lib/lileye/notifications.db", cfg.Database.Path)
+	assert.Equal(t, int64(1024), cfg.Attachments.MaxSize)
+	assert.Equal(t, "warn", cfg.Log.Level)
+	assert.Equal(t, Duration(60*time.Second), cfg.Server.ReadTimeout)
+}
+
+func TestLoadTOML(t *testing.T) {
+	path := writeFile(t, "lileye.toml", `
+[server]
+addr = "127.0.0.1:8080"
+idle_timeout = "5m"
+
+[metrics]
+addr = ""
+`)
+
+	cfg, _, err := Load("server", nil, env(map[string]string{"LILEYE_CONFIG": path}))
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:8080", cfg.Server.Addr)
+	assert.Equal(t, Duration(5*time.Minute), cfg.Server.IdleTimeout)
+	assert.Equal(t, "", cfg.Metrics.Addr)
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestLoadErrors(t *testing.T) {
+	_, _, err := Load("server", []string{"-config", writeFile(t, "bad.yaml", "server:\n  adress: \":80\"\n")}, env(nil))
+	assert.ErrorContains(t, err, "adress")
+
+	_, _, err = Load("server", []string{"-config", writeFile(t, "bad.json", "{}")}, env(nil))
+	assert.ErrorContains(t, err, "unsupported format")
+
+	_, _, err = Load("server", nil, env(map[string]string{"LILEYE_SERVER_READ_TIMEOUT": "soon"}))
+	assert.ErrorContains(t, err, "LILEYE_SERVER_READ_TIMEOUT")
+
+	_, _, err = Load("server", []string{"-attachments.max_size", "big"}, env(nil))
+	assert.ErrorContains(t, err, "-attachments.max_size")
+
+	_, _, err = Load("server", []string{"-no-such-flag"}, env(nil))
+	assert.Error(t, err)
+}
+
+func TestLoadArgs(t *testing.T) {
+	cfg, opts, err := Load("server", []string{"-backup.interval", "0", "backups/lileye.db"}, env(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"backups/lileye.db"}, opts.Args)
+	assert.Equal(t, Duration(0), cfg.Backup.Interval)
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestLoadTLS(t *testing.T) {
+	path := writeFile(t, "lileye.yaml", `
+tls:
+  mode: self_signed
+  hosts: [lileye.local, 192.168.1.20]
+`)
+
+	cfg, _, err := Load("server", []string{"-config", path}, env(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"lileye.local", "192.168.1.20"}, cfg.TLS.Hosts)
+
+	cfg, _, err = Load("server", []string{"-config", path, "-tls.redirect_addr", ":8081"},
+		env(map[string]string{"LILEYE_TLS_HOSTS": "lileye.local, 10.0.0.2,"}))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"lileye.local", "10.0.0.2"}, cfg.TLS.Hosts)
+	assert.NoError(t, cfg.Validate())
+
+	invalid := Default()
+	invalid.TLS.Mode = TLSFiles
+	invalid.TLS.RedirectAddr = invalid.Server.Addr
+	err = invalid.Validate()
+	assert.ErrorContains(t, err, "tls.cert_file: is required in files mode")
+	assert.ErrorContains(t, err, "tls.key_file: is required in files mode")
+	assert.ErrorContains(t, err, "tls.redirect_addr: must differ")
+
+	invalid = Default()
+	invalid.TLS.RedirectAddr = ":8081"
+	assert.EqualError(t, invalid.Validate(), "tls.redirect_addr: requires tls.mode to be files or self_signed")
+
+	invalid.TLS.Mode = "on"
+	assert.ErrorContains(t, invalid.Validate(), "tls.mode: must be off, files or self_signed")
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Default()
+	cfg.Server.Addr = "8080"
+	cfg.Server.WriteTimeout = 0
+	cfg.Metrics.Addr = cfg.Server.Addr
+	cfg.Database.Path = ""
+	cfg.Log.Level = "loud"
+	cfg.Server.TrustedProxies = []string{"10.0.0.0/8", "proxy.local"}
+	cfg.Backup.Interval = Duration(-time.Hour)
+	cfg.Validation.MaxTitle = 0
+	cfg.Validation.MaxPast = Duration(-time.Hour)
+	cfg.Validation.MaxBody = 0
+	cfg.RateLimit.Rules = []string{"POST /api/v1/notifications ip=20/day"}
+	cfg.RateLimit.DuplicateWindow = Duration(-time.Second)
+
+	err := cfg.Validate()
+	assert.ErrorContains(t, err, "server.addr")
+	assert.ErrorContains(t, err, "server.write_timeout: must be positive")
+	assert.ErrorContains(t, err, "metrics.addr")
+	assert.ErrorContains(t, err, "database.path: is required")
+	assert.ErrorContains(t, err, "log.level")
+	assert.ErrorContains(t, err, `server.trusted_proxies: "proxy.local" is not an address or CIDR`)
+	assert.ErrorContains(t, err, "backup.interval: must not be negative")
+	assert.ErrorContains(t, err, "validation.max_title: must be positive")
+	assert.ErrorContains(t, err, "validation.max_past: must not be negative")
+	assert.ErrorContains(t, err, "validation.max_body: must be positive")
+	assert.ErrorContains(t, err, "rate_limit.rules: rule")
+	assert.ErrorContains(t, err, "rate_limit.duplicate_window: must not be negative")
+
+	cfg = Default()
+	cfg.Metrics.Addr = cfg.Server.Addr
+	assert.EqualError(t, cfg.Validate(), "metrics.addr: must differ from server.addr")
+}
+
+func TestPrint(t *testing.T) {
+	cfg, opts, err := Load("server", []string{"--print-config", "-database.path", "test.db"}, env(nil))
+	assert.NoError(t, err)
+	assert.True(t, opts.PrintConfig)
+
+	var buf bytes.Buffer
+	err = Print(&buf, cfg)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "path: test.db")
+	assert.Contains(t, buf.String(), "shutdown_timeout: 30s")
+
+	printed, _, err := Load("server", []string{"-config", writeFile(t, "printed.yaml", buf.String())}, env(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, cfg, printed)
+}
+
+func TestEncryption(t *testing.T) {
+	key := "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+
+	cfg, _, err := Load("server", []string{"-encryption.active_key", "2"}, env(map[string]string{
+		"LILEYE_ENCRYPTION_KEYS":      "1:" + key + ",2:" + key,
+		"LILEYE_ENCRYPTION_INDEX_KEY": key,
+	}))
+	assert.NoError(t, err)
+	assert.NoError(t, cfg.Validate())
+	keyring, err := cfg.Encryption.Keyring()
+	assert.NoError(t, err)
+	assert.Equal(t, "2", keyring.Active())
+
+	keyring, err = Default().Encryption.Keyring()
+	assert.NoError(t, err)
+	assert.Nil(t, keyring)
+
+	invalid := *cfg
+	invalid.Encryption.ActiveKey = "3"
+	assert.ErrorContains(t, invalid.Validate(), `encryption: active key "3" is not in the keyring`)
+	invalid.Encryption.IndexKey = "c2hvcnQ="
+	assert.ErrorContains(t, invalid.Validate(), "encryption: index_key: key must be 32 bytes")
+	invalid = Default()
+	invalid.Encryption.IndexKey = key
+	assert.EqualError(t, invalid.Validate(), "encryption: active_key and index_key require keys")
+}
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	cfg := Default()
+	cfg.Encryption.Keys = []string{"1:secret", "2:secret"}
+	cfg.Encryption.ActiveKey = "2"
+	cfg.Encryption.IndexKey = "secret"
+
+	var buf bytes.Buffer
+	assert.NoError(t, Print(&buf, &cfg))
+	assert.NotContains(t, buf.String(), "secret")
+	assert.Contains(t, buf.String(), "active_key: \"2\"")
+	assert.Contains(t, buf.String(), "- REDACTED")
+	assert.Equal(t, []string{"1:secret", "2:secret"}, cfg.Encryption.Keys)
+}
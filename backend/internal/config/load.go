@@ -0,0 +1,247 @@
+package config
+
+import (
+	"bytes"
+	"encoding"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix starts the name of every environment variable read by Load
+const envPrefix = "LILEYE_"
+
+// redacted replaces the value of secret settings in printed configurations
+const redacted = "REDACTED"
+
+// Options are the command-line flags that control loading rather than
+// setting a value
+type Options struct {
+	// File is the config file given by -config or LILEYE_CONFIG
+	File string
+	// PrintConfig is set by -print-config
+	PrintConfig bool
+	// Args are the arguments after the flags
+	Args []string
+}
+
+// setting is one leaf of the Config struct
+type setting struct {
+	key   string
+	help  string
+	value reflect.Value
+	field reflect.StructField
+}
+
+// Load builds the configuration from the defaults, the config file, the
+// environment and args, in increasing order of precedence. lookupEnv is
+// usually os.LookupEnv. The result is not validated.
+func Load(name string, args []string, lookupEnv func(string) (string, bool)) (*Config, Options, error) {
+	return LoadFlags(flag.NewFlagSet(name, flag.ContinueOnError), args, lookupEnv)
+}
+
+// LoadFlags is Load parsing args with fs, which can hold flags of its own
+// such as those of a subcommand. fs must use flag.ContinueOnError.
+func LoadFlags(fs *flag.FlagSet, args []string, lookupEnv func(string) (string, bool)) (*Config, Options, error) {
+	cfg := Default()
+	settings := settingsOf(&cfg)
+
+	var opts Options
+	fs.StringVar(&opts.File, "config", "", "path of a YAML or TOML config file (env "+envPrefix+"CONFIG)")
+	fs.BoolVar(&opts.PrintConfig, "print-config", false, "print the effective configuration with secrets redacted and exit")
+	values := make(map[string]*string, len(settings))
+	for _, s := range settings {
+		values[s.key] = fs.String(s.key, "", fmt.Sprintf("%s (env %s, default %q)", s.help, envName(s.key), format(s.value)))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, opts, err
+	}
+	opts.Args = fs.Args()
+
+	if opts.File == "" {
+		opts.File, _ = lookupEnv(envPrefix + "CONFIG")
+	}
+	if opts.File != "" {
+		if err := loadFile(&cfg, opts.File); err != nil {
+			return nil, opts, err
+		}
+	}
+
+	for _, s := range settings {
+		if v, ok := lookupEnv(envName(s.key)); ok {
+			if err := parse(s.value, v); err != nil {
+				return nil, opts, fmt.Errorf("%s: %w", envName(s.key), err)
+			}
+		}
+	}
+
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		s, ok := find(settings, f.Name)
+		if !ok || err != nil {
+			return
+		}
+		if perr := parse(s.value, *values[f.Name]); perr != nil {
+			err = fmt.Errorf("-%s: %w", f.Name, perr)
+		}
+	})
+	if err != nil {
+		return nil, opts, err
+	}
+
+	return &cfg, opts, nil
+}
+
+// Print writes the configuration as YAML, replacing the value of every
+// setting tagged secret:"true" so that the output can be shared
+func Print(w io.Writer, cfg *Config) error {
+	printed := *cfg
+	for _, s := range settingsOf(&printed) {
+		if s.field.Tag.Get("secret") != "true" || s.value.IsZero() {
+			continue
+		}
+		// Slices are replaced rather than changed in place, as they share
+		// their backing array with cfg
+		if items, ok := s.value.Interface().([]string); ok {
+			hidden := make([]string, len(items))
+			for i := range hidden {
+				hidden[i] = redacted
+			}
+			s.value.Set(reflect.ValueOf(hidden))
+			continue
+		}
+		s.value.SetString(redacted)
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&printed); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// loadFile decodes a YAML or TOML file over cfg. Unknown keys are rejected
+// so that typos do not go unnoticed.
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(cfg)
+		if err == io.EOF {
+			err = nil
+		}
+	case ".toml":
+		dec := toml.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(cfg)
+	default:
+		return fmt.Errorf("config file %s: unsupported format, use .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// settingsOf lists the leaves of cfg keyed by the dotted path of their yaml
+// tags. Values are addressable so they can be set in place.
+func settingsOf(cfg *Config) []setting {
+	var settings []setting
+	var walk func(prefix string, v reflect.Value)
+	walk = func(prefix string, v reflect.Value) {
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			key := prefix + strings.Split(field.Tag.Get("yaml"), ",")[0]
+			if field.Type.Kind() == reflect.Struct {
+				walk(key+".", v.Field(i))
+				continue
+			}
+			settings = append(settings, setting{
+				key:   key,
+				help:  field.Tag.Get("help"),
+				value: v.Field(i),
+				field: field,
+			})
+		}
+	}
+	walk("", reflect.ValueOf(cfg).Elem())
+	return settings
+}
+
+func find(settings []setting, key string) (setting, bool) {
+	for _, s := range settings {
+		if s.key == key {
+			return s, true
+		}
+	}
+	return setting{}, false
+}
+
+// envName returns the environment variable of a setting
+func envName(key string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// parse sets v from its string form
+func parse(v reflect.Value, s string) error {
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported setting type %s", v.Type())
+		}
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
+
+// format returns the string form of v as accepted by parse
+func format(v reflect.Value) string {
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		text, _ := m.MarshalText()
+		return string(text)
+	}
+	if items, ok := v.Interface().([]string); ok {
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(v.Interface())
+}
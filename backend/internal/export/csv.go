@@ -0,0 +1,85 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lileye/backend/internal/models"
+)
+
+// csvHeader names the columns of CSV exports
+var csvHeader = []string{
+	"id", "timestamp", "device_id", "device_name", "package_name", "app_name",
+	"from", "title", "message", "big_text", "sub_text", "conversation_title",
+	"category", "channel_id", "state", "removed_at", "removal_reason", "read",
+}
+
+type csvWriter struct {
+	buf *bufio.Writer
+	csv *csv.Writer
+}
+
+func newCSVWriter(w *bufio.Writer, _ Report) (Writer, error) {
+	cw := &csvWriter{buf: w, csv: csv.NewWriter(w)}
+	return cw, cw.csv.Write(csvHeader)
+}
+
+func (w *csvWriter) Write(n *models.Notification) error {
+	removedAt := ""
+	if n.RemovedAt != nil {
+		removedAt = n.RemovedAt.Format(time.RFC3339)
+	}
+	return w.csv.Write([]string{
+		strconv.FormatUint(uint64(n.ID), 10),
+		n.Timestamp.Format(time.RFC3339),
+		cell(n.DeviceID),
+		cell(n.DeviceName),
+		cell(n.PackageName),
+		cell(n.AppName),
+		cell(n.From),
+		cell(n.Title),
+		cell(n.Message),
+		cell(n.BigText),
+		cell(n.SubText),
+		cell(n.ConversationTitle),
+		cell(n.Category),
+		cell(n.ChannelID),
+		n.State,
+		removedAt,
+		cell(n.RemovalReason),
+		strconv.FormatBool(n.Read),
+	})
+}
+
+func (w *csvWriter) Flush() error {
+	w.csv.Flush()
+	if err := w.csv.Error(); err != nil {
+		return err
+	}
+	return w.buf.Flush()
+}
+
+func (w *csvWriter) Close() error {
+	return w.Flush()
+}
+
+// cell guards a text value against being run as a formula by spreadsheets.
+// Notification text is written by whoever messaged the child, so a value
+// starting with a formula character is prefixed with a quote.
+func cell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// UnquoteCell reverses cell, so that exported CSV can be imported again
+func UnquoteCell(value string) string {
+	if len(value) > 1 && value[0] == '\'' && strings.ContainsRune("=+-@\t\r", rune(value[1])) {
+		return value[1:]
+	}
+	return value
+}
@@ -0,0 +1,74 @@
+// Package export writes notifications as CSV, newline-delimited JSON or a
+// self-contained HTML report. Notifications are written one at a time, so
+// exports of any size are never held in memory.
+package export
+
+import (
+	"bufio"
+	"io"
+	"time"
+
+	"github.com/lileye/backend/internal/models"
+)
+
+// Writer writes notifications in one format
+type Writer interface {
+	// Write writes one notification
+	Write(n *models.Notification) error
+	// Flush sends buffered output to the underlying writer
+	Flush() error
+	// Close writes whatever follows the last notification and flushes
+	Close() error
+}
+
+// Report describes an export. It is shown at the top of HTML reports.
+type Report struct {
+	Generated time.Time
+	// Filters lists the filters the notifications were selected by, in
+	// the order they are shown
+	Filters []Filter
+}
+
+// Filter is one filter of an export, such as the device or the time range
+type Filter struct {
+	Name  string
+	Value string
+}
+
+// Format is an export format
+type Format struct {
+	Name        string
+	ContentType string
+	Extension   string
+	newWriter   func(w *bufio.Writer, report Report) (Writer, error)
+}
+
+var formats = []Format{
+	{Name: "csv", ContentType: "text/csv; charset=utf-8", Extension: "csv", newWriter: newCSVWriter},
+	{Name: "ndjson", ContentType: "application/x-ndjson", Extension: "ndjson", newWriter: newNDJSONWriter},
+	{Name: "html", ContentType: "text/html; charset=utf-8", Extension: "html", newWriter: newHTMLWriter},
+}
+
+// Lookup returns the format with the given name
+func Lookup(name string) (Format, bool) {
+	for _, f := range formats {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Format{}, false
+}
+
+// Names returns the names of every format
+func Names() []string {
+	names := make([]string, len(formats))
+	for i, f := range formats {
+		names[i] = f.Name
+	}
+	return names
+}
+
+// NewWriter starts an export to w
+func (f Format) NewWriter(w io.Writer, report Report) (Writer, error) {
+	return f.newWriter(bufio.NewWriter(w), report)
+}
@@ -0,0 +1,72 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lileye/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func write(t *testing.T, format string, notifications ...models.Notification) string {
+	f, ok := Lookup(format)
+	assert.True(t, ok)
+
+	var buf bytes.Buffer
+	w, err := f.NewWriter(&buf, Report{
+		Generated: time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC),
+		Filters:   []Filter{{Name: "Device", Value: "device1"}},
+	})
+	assert.NoError(t, err)
+	for i := range notifications {
+		assert.NoError(t, w.Write(&notifications[i]))
+	}
+	assert.NoError(t, w.Close())
+	return buf.String()
+}
+
+var exported = []models.Notification{
+	{Title: "Alice", Message: "Meet at the park, ok?", From: "Alice", DeviceID: "device1",
+		PackageName: "com.whatsapp", AppName: "WhatsApp", Timestamp: time.Date(2026, 10, 19, 9, 30, 0, 0, time.UTC)},
+	{Title: "=HYPERLINK(\"http://evil\")", Message: "<script>alert(1)</script>", DeviceID: "device1",
+		PackageName: "com.example.chat", Timestamp: time.Date(2026, 10, 19, 9, 31, 0, 0, time.UTC)},
+}
+
+func TestCSV(t *testing.T) {
+	records, err := csv.NewReader(strings.NewReader(write(t, "csv", exported...))).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, records, 3)
+	assert.Equal(t, csvHeader, records[0])
+	assert.Equal(t, "2026-10-19T09:30:00Z", records[1][1])
+	assert.Equal(t, "Meet at the park, ok?", records[1][8])
+	assert.Equal(t, "'=HYPERLINK(\"http://evil\")", records[2][7])
+}
+
+func TestNDJSON(t *testing.T) {
+	lines := strings.Split(strings.TrimSpace(write(t, "ndjson", exported...)), "\n")
+	assert.Len(t, lines, 2)
+	var n models.Notification
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &n))
+	assert.Equal(t, exported[1].Title, n.Title)
+}
+
+func TestHTML(t *testing.T) {
+	report := write(t, "html", exported...)
+	assert.Contains(t, report, "<dt>Device</dt><dd>device1</dd>")
+	assert.Contains(t, report, "WhatsApp")
+	assert.Contains(t, report, "&lt;script&gt;alert(1)&lt;/script&gt;")
+	assert.NotContains(t, report, "<script>")
+	assert.Contains(t, report, "2 notifications. End of report.")
+
+	assert.Contains(t, write(t, "html"), "0 notifications. End of report.")
+}
+
+func TestLookup(t *testing.T) {
+	_, ok := Lookup("xlsx")
+	assert.False(t, ok)
+	assert.Equal(t, []string{"csv", "ndjson", "html"}, Names())
+}
@@ -0,0 +1,42 @@
+package export
+
+import (
+	"bufio"
+	_ "embed"
+	"html/template"
+
+	"github.com/lileye/backend/internal/models"
+)
+
+//go:embed report.html
+var reportTemplate string
+
+// report defines the header, row and footer templates of HTML reports
+var report = template.Must(template.New("report").Parse(reportTemplate))
+
+// htmlWriter writes a printable HTML report that needs no other files. The
+// footer with the number of notifications marks a complete report.
+type htmlWriter struct {
+	buf   *bufio.Writer
+	count int
+}
+
+func newHTMLWriter(w *bufio.Writer, r Report) (Writer, error) {
+	return &htmlWriter{buf: w}, report.ExecuteTemplate(w, "header", r)
+}
+
+func (w *htmlWriter) Write(n *models.Notification) error {
+	w.count++
+	return report.ExecuteTemplate(w.buf, "row", n)
+}
+
+func (w *htmlWriter) Flush() error {
+	return w.buf.Flush()
+}
+
+func (w *htmlWriter) Close() error {
+	if err := report.ExecuteTemplate(w.buf, "footer", w.count); err != nil {
+		return err
+	}
+	return w.Flush()
+}
@@ -0,0 +1,31 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+
+	"github.com/lileye/backend/internal/models"
+)
+
+// ndjsonWriter writes one JSON notification per line, as returned by the
+// API
+type ndjsonWriter struct {
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+func newNDJSONWriter(w *bufio.Writer, _ Report) (Writer, error) {
+	return &ndjsonWriter{buf: w, enc: json.NewEncoder(w)}, nil
+}
+
+func (w *ndjsonWriter) Write(n *models.Notification) error {
+	return w.enc.Encode(n)
+}
+
+func (w *ndjsonWriter) Flush() error {
+	return w.buf.Flush()
+}
+
+func (w *ndjsonWriter) Close() error {
+	return w.Flush()
+}
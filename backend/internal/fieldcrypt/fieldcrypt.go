@@ -0,0 +1,197 @@
+// Package fieldcrypt encrypts individual database columns with AES-256-GCM.
+//
+// Columns tagged `gorm:"serializer:encrypted"` are encrypted with the active
+// key of the keyring installed by Use and stored as
+//
+//	enc:v1:<key id>:<base64 of nonce and ciphertext>
+//
+// with the column name as additional data, so a value cannot be moved to
+// another column undetected. Values without that prefix are read as
+// plaintext, which lets existing rows be encrypted in place later. When no
+// keyring is installed values are written in plaintext.
+//
+// Encrypted values cannot be compared in SQL. Columns that are matched on
+// store a blind index next to them: an HMAC of the value under a separate
+// key that stays the same across key rotations.
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	prefix = "enc:v1:"
+	// KeySize is the length in bytes of encryption and index keys
+	KeySize = 32
+)
+
+// ErrNoKeyring is returned when an encrypted value is read without a keyring
+var ErrNoKeyring = errors.New("value is encrypted but no encryption keys are configured")
+
+// Keyring holds the encryption keys by ID, the ID of the key used for new
+// values and the key of the blind index
+type Keyring struct {
+	keys     map[string]cipher.AEAD
+	active   string
+	indexKey []byte
+}
+
+// NewKeyring creates a keyring. Every key and the index key must be
+// KeySize bytes long and active must be one of the key IDs.
+func NewKeyring(keys map[string][]byte, active string, indexKey []byte) (*Keyring, error) {
+	if _, ok := keys[active]; !ok {
+		return nil, fmt.Errorf("active key %q is not in the keyring", active)
+	}
+	if len(indexKey) != KeySize {
+		return nil, fmt.Errorf("index key must be %d bytes", KeySize)
+	}
+
+	k := &Keyring{keys: make(map[string]cipher.AEAD, len(keys)), active: active, indexKey: indexKey}
+	for id, key := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("key id %q must be non-empty and contain no colon", id)
+		}
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("key %q must be %d bytes", id, KeySize)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		if k.keys[id], err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// ParseKey decodes a base64 key
+func ParseKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("key is not valid base64: %w", err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("key must be %d bytes, got %d", KeySize, len(key))
+	}
+	return key, nil
+}
+
+// ParseKeys decodes keys written as "<id>:<base64 key>"
+func ParseKeys(specs []string) (map[string][]byte, error) {
+	keys := make(map[string][]byte, len(specs))
+	for _, spec := range specs {
+		id, encoded, ok := strings.Cut(spec, ":")
+		if !ok || id == "" {
+			return nil, errors.New(`keys must be written as "<id>:<base64 key>"`)
+		}
+		if _, dup := keys[id]; dup {
+			return nil, fmt.Errorf("key %q is listed twice", id)
+		}
+		key, err := ParseKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+		keys[id] = key
+	}
+	return keys, nil
+}
+
+// Active returns the ID of the key used for new values
+func (k *Keyring) Active() string {
+	return k.active
+}
+
+// Encrypt encrypts plaintext with the active key. column is bound to the
+// result and must be given again to decrypt it.
+func (k *Keyring) Encrypt(plaintext, column string) (string, error) {
+	aead := k.keys[k.active]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(column))
+	return prefix + k.active + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts a value produced by Encrypt
+func (k *Keyring) Decrypt(value, column string) (string, error) {
+	id, encoded, ok := strings.Cut(strings.TrimPrefix(value, prefix), ":")
+	if !ok {
+		return "", errors.New("malformed encrypted value")
+	}
+	aead, ok := k.keys[id]
+	if !ok {
+		return "", fmt.Errorf("value is encrypted with unknown key %q", id)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", errors.New("malformed encrypted value")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(column))
+	if err != nil {
+		return "", fmt.Errorf("decrypt %s with key %q: %w", column, id, err)
+	}
+	return string(plaintext), nil
+}
+
+// BlindIndex returns a keyed hash of value for equality matching
+func (k *Keyring) BlindIndex(value string) string {
+	mac := hmac.New(sha256.New, k.indexKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// IsEncrypted reports whether value was produced by Encrypt
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// KeyID returns the ID of the key value was encrypted with, or "" for
+// plaintext
+func KeyID(value string) string {
+	if !IsEncrypted(value) {
+		return ""
+	}
+	id, _, _ := strings.Cut(strings.TrimPrefix(value, prefix), ":")
+	return id
+}
+
+var current atomic.Pointer[Keyring]
+
+// Use installs the keyring used by the encrypted serializer and BlindIndex.
+// A nil keyring turns encryption off for new values.
+func Use(k *Keyring) {
+	current.Store(k)
+}
+
+// Current returns the installed keyring, or nil
+func Current() *Keyring {
+	return current.Load()
+}
+
+// Enabled reports whether new values are encrypted
+func Enabled() bool {
+	return current.Load() != nil
+}
+
+// BlindIndex returns the blind index of value under the installed keyring.
+// Without a keyring values are not encrypted and the index is the value
+// itself. Empty values index as empty.
+func BlindIndex(value string) string {
+	k := current.Load()
+	if k == nil || value == "" {
+		return value
+	}
+	return k.BlindIndex(value)
+}
@@ -0,0 +1,86 @@
+package fieldcrypt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testKeyring(t *testing.T, active string) *Keyring {
+	k, err := NewKeyring(map[string][]byte{
+		"1": bytes.Repeat([]byte{1}, KeySize),
+		"2": bytes.Repeat([]byte{2}, KeySize),
+	}, active, bytes.Repeat([]byte{9}, KeySize))
+	assert.NoError(t, err)
+	return k
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	k := testKeyring(t, "1")
+
+	value, err := k.Encrypt("See you at 5", "message")
+	assert.NoError(t, err)
+	assert.True(t, IsEncrypted(value))
+	assert.Equal(t, "1", KeyID(value))
+	assert.NotContains(t, value, "See you")
+
+	again, err := k.Encrypt("See you at 5", "message")
+	assert.NoError(t, err)
+	assert.NotEqual(t, value, again)
+
+	plaintext, err := k.Decrypt(value, "message")
+	assert.NoError(t, err)
+	assert.Equal(t, "See you at 5", plaintext)
+
+	// Values are bound to their column
+	_, err = k.Decrypt(value, "title")
+	assert.Error(t, err)
+
+	// Old values stay readable after rotation
+	rotated := testKeyring(t, "2")
+	plaintext, err = rotated.Decrypt(value, "message")
+	assert.NoError(t, err)
+	assert.Equal(t, "See you at 5", plaintext)
+
+	_, err = rotated.Decrypt("enc:v1:3:AAAA", "message")
+	assert.ErrorContains(t, err, `unknown key "3"`)
+	assert.Equal(t, "", KeyID("plain"))
+}
+
+func TestBlindIndex(t *testing.T) {
+	defer Use(nil)
+
+	assert.Equal(t, "Alice", BlindIndex("Alice"))
+
+	Use(testKeyring(t, "1"))
+	index := BlindIndex("Alice")
+	assert.Len(t, index, 32)
+	assert.NotEqual(t, index, BlindIndex("alice"))
+	assert.Equal(t, "", BlindIndex(""))
+
+	// The index does not depend on the active key
+	Use(testKeyring(t, "2"))
+	assert.Equal(t, index, BlindIndex("Alice"))
+}
+
+func TestParseKeys(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, KeySize))
+
+	keys, err := ParseKeys([]string{"2024:" + key})
+	assert.NoError(t, err)
+	assert.Len(t, keys["2024"], KeySize)
+
+	_, err = ParseKeys([]string{key})
+	assert.Error(t, err)
+	_, err = ParseKeys([]string{"a:" + key, "a:" + key})
+	assert.ErrorContains(t, err, "twice")
+	_, err = ParseKeys([]string{"a:c2hvcnQ="})
+	assert.ErrorContains(t, err, "32 bytes")
+
+	_, err = NewKeyring(keys, "2025", bytes.Repeat([]byte{1}, KeySize))
+	assert.ErrorContains(t, err, "not in the keyring")
+	_, err = NewKeyring(keys, "2024", []byte("short"))
+	assert.ErrorContains(t, err, "index key")
+}
@@ -0,0 +1,77 @@
+package fieldcrypt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm/schema"
+)
+
+func init() {
+	schema.RegisterSerializer("encrypted", Serializer{})
+}
+
+// Serializer is the gorm serializer of encrypted columns. String fields are
+// encrypted as they are; other fields are encoded as JSON first. Empty
+// strings are stored as is so that emptiness checks keep working in SQL.
+type Serializer struct{}
+
+// Scan implements schema.SerializerInterface
+func (Serializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var value string
+	switch v := dbValue.(type) {
+	case nil:
+	case string:
+		value = v
+	case []byte:
+		value = string(v)
+	default:
+		return fmt.Errorf("unsupported type %T for encrypted column %s", dbValue, field.DBName)
+	}
+
+	if IsEncrypted(value) {
+		k := current.Load()
+		if k == nil {
+			return fmt.Errorf("%s: %w", field.DBName, ErrNoKeyring)
+		}
+		var err error
+		if value, err = k.Decrypt(value, field.DBName); err != nil {
+			return err
+		}
+	}
+
+	fieldValue := reflect.New(field.FieldType)
+	if field.FieldType.Kind() == reflect.String {
+		fieldValue.Elem().SetString(value)
+	} else if value != "" {
+		if err := json.Unmarshal([]byte(value), fieldValue.Interface()); err != nil {
+			return err
+		}
+	}
+	field.ReflectValueOf(ctx, dst).Set(fieldValue.Elem())
+	return nil
+}
+
+// Value implements schema.SerializerValuerInterface
+func (Serializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	var value string
+	if s, ok := fieldValue.(string); ok {
+		value = s
+	} else {
+		encoded, err := json.Marshal(fieldValue)
+		if err != nil {
+			return nil, err
+		}
+		if string(encoded) != "null" {
+			value = string(encoded)
+		}
+	}
+
+	k := current.Load()
+	if k == nil || value == "" {
+		return value, nil
+	}
+	return k.Encrypt(value, field.DBName)
+}
@@ -0,0 +1,300 @@
+// Package fixtures generates seeded, realistic notifications for tests,
+// demos and load tests. Devices receive chat messages from direct and group
+// conversations in the messaging apps of the app catalog, in bursts, mixed
+// with email, system and entertainment notifications. The same seed always
+// generates the same notifications.
+package fixtures
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/lileye/backend/internal/models"
+)
+
+// Device is a device that receives notifications
+type Device struct {
+	ID   string
+	Name string
+}
+
+// DefaultDevices are the devices of a dataset unless others are given
+var DefaultDevices = []Device{
+	{ID: "phone1", Name: "Pixel 8"},
+	{ID: "phone2", Name: "Galaxy S23"},
+	{ID: "tablet1", Name: "Galaxy Tab S9"},
+}
+
+// Devices returns the devices with the given IDs, named as in
+// DefaultDevices when they are listed there
+func Devices(ids ...string) []Device {
+	devices := make([]Device, len(ids))
+	for i, id := range ids {
+		devices[i] = Device{ID: id, Name: id}
+		for _, d := range DefaultDevices {
+			if d.ID == id {
+				devices[i].Name = d.Name
+			}
+		}
+	}
+	return devices
+}
+
+// Conversation is a chat a device receives messages from
+type Conversation struct {
+	DeviceID    string
+	PackageName string
+	// Title is set for group chats
+	Title   string
+	Members []string
+}
+
+var (
+	senders      = []string{"John", "Alice", "Bob", "Charlie", "Diana", "Emma", "Farid", "Grace", "Hiro", "Ines"}
+	emailSenders = []string{"boss@company.com", "hr@company.com", "team@project.com", "support@service.com"}
+	groupTitles  = []string{"Family", "Weekend hike", "Project Falcon", "Flatmates", "Book club"}
+
+	chatMessages = []string{
+		"Hey, how are you?", "On my way", "Running 10 minutes late, sorry!", "Did you see this?",
+		"😂😂😂", "Sounds good", "Can you call me when you're free?", "Where are we meeting?",
+		"Thanks!", "ok", "What time works for you tomorrow?", "Just landed ✈️",
+		"Don't forget the keys", "Happy birthday!! 🎉", "lol", "I'll send the photos later",
+	}
+	emailSubjects = []string{
+		"Important update about the project", "Your weekly summary", "Meeting moved to 3pm",
+		"Invoice #4821", "Re: Quarterly planning", "Action required: confirm your details",
+	}
+)
+
+// Shape of the generated traffic
+const (
+	// conversationsPerDevice is the number of chats each device takes part in
+	conversationsPerDevice = 12
+	// groupsPerDevice of those chats are group chats
+	groupsPerDevice = 3
+	// meanBurst is the mean number of further messages a chat sends once it
+	// becomes active
+	meanBurst = 3.0
+	// backgroundShare is the share of notifications that come from email,
+	// system and entertainment apps rather than chats
+	backgroundShare = 0.2
+)
+
+// device generates the notifications of one device. Chats are picked by a
+// Zipf distribution, so a few chats send most messages, and an active chat
+// sends a burst of messages before another one takes over.
+type device struct {
+	Device
+	conversations []Conversation
+	popularity    *rand.Zipf
+	active        *Conversation
+	// last is the member of the active chat who sent the latest message
+	last int
+	// burst is the number of messages the active chat has still to send
+	burst int
+	seq   int
+}
+
+// Generator generates the notifications of a set of devices. It is driven
+// by a single seeded source, so a seed always produces the same
+// notifications in the same order.
+type Generator struct {
+	rnd     *rand.Rand
+	apps    map[string][]models.App
+	devices []*device
+}
+
+// NewGenerator creates a generator of notifications for devices
+func NewGenerator(seed int64, devices []Device) *Generator {
+	g := &Generator{rnd: rand.New(rand.NewSource(seed)), apps: map[string][]models.App{}}
+	for _, app := range models.DefaultApps {
+		g.apps[app.Category] = append(g.apps[app.Category], app)
+	}
+	for _, dev := range devices {
+		d := &device{Device: dev}
+		for i := 0; i < conversationsPerDevice; i++ {
+			c := Conversation{DeviceID: dev.ID, PackageName: g.app(models.AppCategoryMessaging).PackageName}
+			if i%(conversationsPerDevice/groupsPerDevice) == 1 {
+				c.Title = g.pick(groupTitles)
+				for _, p := range g.rnd.Perm(len(senders))[:3+g.rnd.Intn(3)] {
+					c.Members = append(c.Members, senders[p])
+				}
+			} else {
+				c.Members = []string{g.pick(senders)}
+			}
+			d.conversations = append(d.conversations, c)
+		}
+		d.popularity = rand.NewZipf(g.rnd, 1.2, 1, uint64(len(d.conversations)-1))
+		g.devices = append(g.devices, d)
+	}
+	return g
+}
+
+// Conversations returns the chats of every device
+func (g *Generator) Conversations() []Conversation {
+	var conversations []Conversation
+	for _, d := range g.devices {
+		conversations = append(conversations, d.conversations...)
+	}
+	return conversations
+}
+
+// Next returns the next notification of a random device, received at now
+func (g *Generator) Next(now time.Time) models.Notification {
+	return g.next(g.devices[g.rnd.Intn(len(g.devices))], now)
+}
+
+// next returns the next notification of d
+func (g *Generator) next(d *device, now time.Time) models.Notification {
+	d.seq++
+	n := models.Notification{Timestamp: now, DeviceID: d.ID, DeviceName: d.Name}
+
+	if d.burst == 0 {
+		if g.rnd.Float64() < backgroundShare {
+			g.background(&n)
+			n.Key = fmt.Sprintf("0|%s|%d|null|10001", n.PackageName, d.seq)
+			return n
+		}
+		d.active = &d.conversations[d.popularity.Uint64()]
+		d.last = 0
+		d.burst = 1 + int(g.rnd.ExpFloat64()*meanBurst)
+	}
+	d.burst--
+
+	c := d.active
+	// In group chats the same member often sends several messages in a row
+	if len(c.Members) > 1 && g.rnd.Float64() > 0.6 {
+		d.last = g.rnd.Intn(len(c.Members))
+	}
+	sender := c.Members[d.last]
+	n.PackageName, n.From, n.Title = c.PackageName, sender, sender
+	n.Message = g.pick(chatMessages)
+	n.Category = "msg"
+	tag := sender
+	if c.Title != "" {
+		n.Title, n.ConversationTitle, n.IsGroupConversation = c.Title, c.Title, true
+		tag = c.Title
+	}
+	// Android reposts a chat's notification under the same key
+	n.Key = fmt.Sprintf("0|%s|1|%s|10001", n.PackageName, tag)
+	return n
+}
+
+// background fills in a notification from an email, system or entertainment
+// app
+func (g *Generator) background(n *models.Notification) {
+	switch g.rnd.Intn(3) {
+	case 0:
+		sender := g.pick(emailSenders)
+		n.PackageName, n.From, n.Category = g.app(models.AppCategoryEmail).PackageName, sender, "email"
+		n.Title, n.Message = sender, g.pick(emailSubjects)
+	case 1:
+		n.PackageName, n.From, n.Category = g.app(models.AppCategorySystem).PackageName, "System", "sys"
+		n.Title, n.Message = "System Update Available", "A new system update is ready to install"
+	default:
+		app := g.app(models.AppCategoryEntertainment)
+		n.PackageName, n.From, n.Category = app.PackageName, app.Name, "recommendation"
+		n.Title, n.Message = "New content available", "Check out the latest releases"
+	}
+}
+
+func (g *Generator) app(category string) models.App {
+	apps := g.apps[category]
+	return apps[g.rnd.Intn(len(apps))]
+}
+
+func (g *Generator) pick(values []string) string {
+	return values[g.rnd.Intn(len(values))]
+}
+
+// Options describe a dataset
+type Options struct {
+	Seed int64
+	// Devices default to DefaultDevices
+	Devices []Device
+	// End is the end of the period the notifications were received in; it
+	// defaults to the current time
+	End time.Time
+	// Days is the length of the period, 14 by default
+	Days int
+	// PerDay is the mean number of notifications a device receives a day,
+	// 40 by default
+	PerDay int
+}
+
+// Dataset is a generated history of notifications
+type Dataset struct {
+	Devices       []Device
+	Conversations []Conversation
+	// Notifications are sorted oldest first
+	Notifications []models.Notification
+}
+
+// Quiet hours during which devices receive no notifications, in UTC
+const (
+	wakeHour  = 7
+	sleepHour = 23
+)
+
+// Generate generates the notifications received by the devices over a
+// period. Messages in a burst arrive seconds to minutes apart, and nothing
+// arrives at night. Notifications received over an hour before End have
+// been read.
+func Generate(opts Options) *Dataset {
+	if opts.Devices == nil {
+		opts.Devices = DefaultDevices
+	}
+	if opts.End.IsZero() {
+		opts.End = time.Now()
+	}
+	if opts.Days == 0 {
+		opts.Days = 14
+	}
+	if opts.PerDay == 0 {
+		opts.PerDay = 40
+	}
+	end := opts.End.UTC()
+	start := end.AddDate(0, 0, -opts.Days)
+
+	g := NewGenerator(opts.Seed, opts.Devices)
+	ds := &Dataset{Devices: opts.Devices, Conversations: g.Conversations()}
+	// The mean gap between bursts spreads PerDay notifications over the
+	// waking hours, given that most arrive within a burst
+	awake := time.Duration(sleepHour-wakeHour) * time.Hour
+	quiet := time.Duration(float64(awake) / float64(opts.PerDay) * (1 + meanBurst))
+	for _, d := range g.devices {
+		at := start
+		for {
+			gap := quiet
+			if d.burst > 0 {
+				gap = 40 * time.Second
+			}
+			at = g.skipNight(at.Add(time.Duration(g.rnd.ExpFloat64() * float64(gap))))
+			if !at.Before(end) {
+				break
+			}
+			n := g.next(d, at)
+			n.Read = at.Before(end.Add(-time.Hour))
+			ds.Notifications = append(ds.Notifications, n)
+		}
+	}
+	sort.SliceStable(ds.Notifications, func(i, j int) bool {
+		return ds.Notifications[i].Timestamp.Before(ds.Notifications[j].Timestamp)
+	})
+	return ds
+}
+
+// skipNight moves a time during the quiet hours to a random time in the
+// first hour of the next morning
+func (g *Generator) skipNight(t time.Time) time.Time {
+	if t.Hour() >= wakeHour && t.Hour() < sleepHour {
+		return t
+	}
+	morning := time.Date(t.Year(), t.Month(), t.Day(), wakeHour, 0, 0, 0, time.UTC)
+	if t.Hour() >= sleepHour {
+		morning = morning.AddDate(0, 0, 1)
+	}
+	return morning.Add(time.Duration(g.rnd.Int63n(int64(time.Hour))))
+}
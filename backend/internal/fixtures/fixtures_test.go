@@ -0,0 +1,66 @@
+package fixtures
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lileye/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerate(t *testing.T) {
+	end := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	opts := Options{Seed: 7, End: end, Days: 30, PerDay: 50}
+	ds := Generate(opts)
+	assert.Equal(t, ds, Generate(opts))
+	assert.NotEqual(t, ds.Notifications, Generate(Options{Seed: 8, End: end, Days: 30, PerDay: 50}).Notifications)
+	assert.Len(t, ds.Conversations, len(DefaultDevices)*conversationsPerDevice)
+
+	// About PerDay notifications a day for each device, none at night
+	perDevice := map[string]int{}
+	for i, n := range ds.Notifications {
+		perDevice[n.DeviceID]++
+		assert.True(t, n.Timestamp.Before(end) && !n.Timestamp.Before(end.AddDate(0, 0, -30)))
+		assert.GreaterOrEqual(t, n.Timestamp.Hour(), wakeHour)
+		assert.Less(t, n.Timestamp.Hour(), sleepHour)
+		if i > 0 {
+			assert.False(t, n.Timestamp.Before(ds.Notifications[i-1].Timestamp))
+		}
+		assert.Equal(t, n.Timestamp.Before(end.Add(-time.Hour)), n.Read)
+	}
+	for _, d := range DefaultDevices {
+		assert.InDelta(t, 30*50, perDevice[d.ID], 30*50*0.25, d.ID)
+	}
+}
+
+func TestGeneratorBursts(t *testing.T) {
+	g := NewGenerator(1, Devices("phone1", "other"))
+	assert.Equal(t, "Pixel 8", g.devices[0].Name)
+	assert.Equal(t, "other", g.devices[1].Name)
+
+	// A device's next chat message is often from the same conversation, and
+	// the apps come from the catalog
+	catalog := map[string]bool{}
+	for _, app := range models.DefaultApps {
+		catalog[app.PackageName] = true
+	}
+	last := map[string]string{}
+	repeats, chats, groups := 0, 0, 0
+	for i := 0; i < 500; i++ {
+		n := g.Next(time.Now())
+		assert.True(t, catalog[n.PackageName], n.PackageName)
+		if n.Category != "msg" {
+			continue
+		}
+		chats++
+		if n.IsGroupConversation {
+			groups++
+		}
+		if last[n.DeviceID] == n.Key {
+			repeats++
+		}
+		last[n.DeviceID] = n.Key
+	}
+	assert.Greater(t, repeats, chats/3)
+	assert.Positive(t, groups)
+}
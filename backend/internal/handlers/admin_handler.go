@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lileye/backend/internal/apierror"
+	"github.com/lileye/backend/internal/middleware"
+	"github.com/lileye/backend/internal/models"
+	"github.com/lileye/backend/internal/retention"
+	"github.com/lileye/backend/internal/storage"
+	"gorm.io/gorm"
+)
+
+// AdminHandler handles HTTP requests for operating the server: users and
+// their admin keys, statistics, purges and the retention policy
+type AdminHandler struct {
+	admins        *storage.AdminStorage
+	notifications *storage.NotificationStorage
+	stats         *storage.StatsStorage
+	retention     *retention.Policy
+}
+
+// NewAdminHandler creates a new AdminHandler instance
+func NewAdminHandler(admins *storage.AdminStorage, notifications *storage.NotificationStorage, stats *storage.StatsStorage, retention *retention.Policy) *AdminHandler {
+	return &AdminHandler{admins: admins, notifications: notifications, stats: stats, retention: retention}
+}
+
+// RegisterRoutes registers the admin routes with the API route group
+func (h *AdminHandler) RegisterRoutes(r gin.IRouter) {
+	r.GET("/admin/users", middleware.Audited("user.list"), h.GetUsers)
+	r.POST("/admin/users", middleware.Audited("user.create"), h.CreateUser)
+	r.DELETE("/admin/users/:name", middleware.Audited("user.delete"), h.DeleteUser)
+	r.GET("/admin/keys", middleware.Audited("key.list"), h.GetKeys)
+	r.POST("/admin/keys", middleware.Audited("key.create"), h.CreateKey)
+	r.DELETE("/admin/keys/:id", middleware.Audited("key.revoke"), h.RevokeKey)
+	r.GET("/admin/stats", middleware.Audited("stats.read"), h.GetStats)
+	r.GET("/admin/devices", middleware.Audited("device.list"), h.GetDevices)
+	r.DELETE("/admin/notifications", middleware.Audited("notification.purge"), h.PurgeNotifications)
+	r.GET("/admin/retention", middleware.Audited("retention.read"), h.GetRetention)
+	r.POST("/admin/retention/run", middleware.Audited("retention.run"), h.RunRetention)
+}
+
+// GetUsers handles listing the users
+func (h *AdminHandler) GetUsers(c *gin.Context) {
+	users, err := h.admins.ListUsers(c.Request.Context())
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+// CreateUser handles adding a user
+func (h *AdminHandler) CreateUser(c *gin.Context) {
+	var req struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		apierror.Invalid(c, "name", "name is required")
+		return
+	}
+
+	user, err := h.admins.CreateUser(c.Request.Context(), req.Name)
+	if errors.Is(err, storage.ErrUserExists) {
+		apierror.Abort(c, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, user)
+}
+
+// DeleteUser handles removing a user, which revokes their keys
+func (h *AdminHandler) DeleteUser(c *gin.Context) {
+	err := h.admins.DeleteUser(c.Request.Context(), c.Param("name"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		apierror.NotFound(c, "user not found")
+		return
+	}
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Message{Message: "User deleted"})
+}
+
+// GetKeys handles listing the admin keys without their secret values
+func (h *AdminHandler) GetKeys(c *gin.Context) {
+	keys, err := h.admins.ListKeys(c.Request.Context())
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// CreateKey handles creating an admin key for a user. The response holds
+// the key, which cannot be retrieved again.
+func (h *AdminHandler) CreateKey(c *gin.Context) {
+	var req struct {
+		User string `json:"user" binding:"required"`
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Invalid(c, "user", "user is required")
+		return
+	}
+
+	key, err := h.admins.CreateKey(c.Request.Context(), req.User, req.Name)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		apierror.NotFound(c, "user not found")
+		return
+	}
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, key)
+}
+
+// RevokeKey handles revoking an admin key
+func (h *AdminHandler) RevokeKey(c *gin.Context) {
+	var id uint
+	if _, err := fmt.Sscanf(c.Param("id"), "%d", &id); err != nil {
+		apierror.Invalid(c, "id", "invalid id format")
+		return
+	}
+
+	err := h.admins.RevokeKey(c.Request.Context(), id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		apierror.NotFound(c, "key not found or already revoked")
+		return
+	}
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Message{Message: "Key revoked"})
+}
+
+// GetStats handles summarising what the server stores
+func (h *AdminHandler) GetStats(c *gin.Context) {
+	stats, err := h.stats.Get(c.Request.Context())
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// GetDevices handles summarising the notifications of every device
+func (h *AdminHandler) GetDevices(c *gin.Context) {
+	devices, err := h.stats.Devices(c.Request.Context())
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, devices)
+}
+
+// PurgeNotifications handles permanently deleting the notifications of a
+// device or an app, or those posted before a time. Deleting everything
+// requires all=true. With dry_run=true the matching notifications are
+// counted instead.
+func (h *AdminHandler) PurgeNotifications(c *gin.Context) {
+	filter := storage.PurgeFilter{
+		DeviceID:    c.Query("device_id"),
+		PackageName: c.Query("package"),
+	}
+	if before := c.Query("before"); before != "" {
+		t, err := time.Parse(time.RFC3339, before)
+		if err != nil {
+			apierror.Invalid(c, "before", "invalid before time, use RFC 3339")
+			return
+		}
+		filter.Before = t
+	}
+	all, _ := strconv.ParseBool(c.Query("all"))
+	if filter == (storage.PurgeFilter{}) && !all {
+		apierror.Abort(c, http.StatusBadRequest, "set device_id, package or before, or all=true to purge every notification")
+		return
+	}
+
+	if dryRun, _ := strconv.ParseBool(c.Query("dry_run")); dryRun {
+		count, err := h.notifications.CountPurge(c.Request.Context(), filter)
+		if err != nil {
+			apierror.Internal(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, models.PurgeResult{Notifications: count, DryRun: true})
+		return
+	}
+
+	deleted, err := h.notifications.Purge(c.Request.Context(), filter)
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.PurgeResult{Notifications: deleted})
+}
+
+// GetRetention handles describing the retention policy and what it would
+// delete now
+func (h *AdminHandler) GetRetention(c *gin.Context) {
+	status, err := h.retention.Status(c.Request.Context())
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// RunRetention handles applying the retention policy now
+func (h *AdminHandler) RunRetention(c *gin.Context) {
+	run, err := h.retention.Apply(c.Request.Context())
+	if errors.Is(err, retention.ErrDisabled) {
+		apierror.Abort(c, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, run)
+}
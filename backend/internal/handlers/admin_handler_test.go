@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lileye/backend/internal/config"
+	"github.com/lileye/backend/internal/models"
+	"github.com/lileye/backend/internal/retention"
+	"github.com/lileye/backend/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupAdminTest(t *testing.T, cfg config.Retention) (*gin.Engine, *storage.NotificationStorage) {
+	r, db := setupTest(t)
+	notifications := storage.NewNotificationStorage(db)
+	NewAdminHandler(storage.NewAdminStorage(db), notifications, storage.NewStatsStorage(db),
+		retention.New(notifications, cfg)).RegisterRoutes(r.Group("/api/v1"))
+	return r, notifications
+}
+
+func adminRequest(r *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAdminUsersAndKeys(t *testing.T) {
+	r, _ := setupAdminTest(t, config.Retention{})
+
+	w := adminRequest(r, "POST", "/api/v1/admin/keys", `{"user":"alice"}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = adminRequest(r, "POST", "/api/v1/admin/users", `{"name":"alice"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	w = adminRequest(r, "POST", "/api/v1/admin/users", `{"name":"alice"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = adminRequest(r, "POST", "/api/v1/admin/users", `{"name":" "}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = adminRequest(r, "POST", "/api/v1/admin/keys", `{"user":"alice","name":"laptop"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var key models.CreatedAdminKey
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &key))
+	assert.NotEmpty(t, key.Key)
+
+	// Listed keys carry neither the key nor its hash
+	w = adminRequest(r, "GET", "/api/v1/admin/keys", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), key.Prefix)
+	assert.NotContains(t, w.Body.String(), key.Key)
+	assert.NotContains(t, w.Body.String(), `"hash"`)
+
+	w = adminRequest(r, "DELETE", "/api/v1/admin/keys/abc", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = adminRequest(r, "DELETE", "/api/v1/admin/keys/1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = adminRequest(r, "DELETE", "/api/v1/admin/keys/1", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = adminRequest(r, "DELETE", "/api/v1/admin/users/bob", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestAdminPurgeAndRetention(t *testing.T) {
+	r, notifications := setupAdminTest(t, config.Retention{MaxAge: config.Duration(24 * time.Hour), Interval: config.Duration(time.Hour)})
+	for _, n := range []models.Notification{
+		{DeviceID: "device1", PackageName: "com.whatsapp", Timestamp: time.Now().Add(-48 * time.Hour)},
+		{DeviceID: "device1", PackageName: "com.slack", Timestamp: time.Now()},
+		{DeviceID: "device2", PackageName: "com.whatsapp", Timestamp: time.Now()},
+	} {
+		assert.NoError(t, notifications.Create(context.Background(), &n))
+	}
+
+	w := adminRequest(r, "DELETE", "/api/v1/admin/notifications", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = adminRequest(r, "DELETE", "/api/v1/admin/notifications?before=yesterday", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = adminRequest(r, "DELETE", "/api/v1/admin/notifications?package=com.whatsapp&dry_run=true", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"notifications":2,"dry_run":true}`, w.Body.String())
+
+	w = adminRequest(r, "GET", "/api/v1/admin/retention", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var status models.RetentionStatus
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, int64(1), status.Eligible)
+	w = adminRequest(r, "POST", "/api/v1/admin/retention/run", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var run models.RetentionRun
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &run))
+	assert.Equal(t, int64(1), run.Deleted)
+
+	w = adminRequest(r, "DELETE", "/api/v1/admin/notifications?device_id=device2", "")
+	assert.JSONEq(t, `{"notifications":1,"dry_run":false}`, w.Body.String())
+	w = adminRequest(r, "GET", "/api/v1/admin/stats", "")
+	var stats models.Stats
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, int64(1), stats.Notifications)
+
+	disabled, _ := setupAdminTest(t, config.Retention{Interval: config.Duration(time.Hour)})
+	w = adminRequest(disabled, "POST", "/api/v1/admin/retention/run", "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
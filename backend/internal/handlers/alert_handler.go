@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lileye/backend/internal/apierror"
+	"github.com/lileye/backend/internal/middleware"
+	"github.com/lileye/backend/internal/models"
+	"github.com/lileye/backend/internal/storage"
+	"gorm.io/gorm"
+)
+
+// defaultNewContactDays is the window of the new contacts endpoint when no
+// days parameter is given
+const defaultNewContactDays = 7
+
+// AlertHandler handles HTTP requests for new contacts, alerts and the
+// allowlist
+type AlertHandler struct {
+	storage *storage.AlertStorage
+	senders *storage.SenderStorage
+}
+
+// NewAlertHandler creates a new AlertHandler instance
+func NewAlertHandler(storage *storage.AlertStorage, senders *storage.SenderStorage) *AlertHandler {
+	return &AlertHandler{storage: storage, senders: senders}
+}
+
+// RegisterRoutes registers the alert routes with the API route group
+func (h *AlertHandler) RegisterRoutes(r gin.IRouter) {
+	r.GET("/senders/new", middleware.Audited("sender.list"), h.GetNewSenders)
+	r.GET("/alerts", middleware.Audited("alert.list"), h.GetAlerts)
+	r.POST("/alerts/:id/ack", h.AcknowledgeAlert)
+	r.GET("/allowlist", middleware.Audited("allowlist.list"), h.GetAllowlist)
+	r.POST("/allowlist", h.AddAllowlist)
+	r.DELETE("/allowlist/:id", middleware.Audited("allowlist.delete"), h.DeleteAllowlist)
+}
+
+// GetNewSenders handles retrieving senders first seen in the last N days
+func (h *AlertHandler) GetNewSenders(c *gin.Context) {
+	days := defaultNewContactDays
+	if s := c.Query("days"); s != "" {
+		var err error
+		days, err = strconv.Atoi(s)
+		if err != nil || days < 1 {
+			apierror.Invalid(c, "days", "days must be a positive integer")
+			return
+		}
+	}
+
+	since := time.Now().AddDate(0, 0, -days)
+	senders, err := h.senders.GetNew(c.Request.Context(), since, c.Query("device_id"))
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, senders)
+}
+
+// GetAlerts handles retrieving alerts
+func (h *AlertHandler) GetAlerts(c *gin.Context) {
+	alerts, err := h.storage.List(c.Request.Context(), c.Query("device_id"), c.Query("unacknowledged") == "true")
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, alerts)
+}
+
+// AcknowledgeAlert handles marking an alert as acknowledged
+func (h *AlertHandler) AcknowledgeAlert(c *gin.Context) {
+	var id uint
+	if _, err := fmt.Sscanf(c.Param("id"), "%d", &id); err != nil {
+		apierror.Invalid(c, "id", "invalid id format")
+		return
+	}
+
+	err := h.storage.Acknowledge(c.Request.Context(), id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		apierror.NotFound(c, "alert not found")
+		return
+	}
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Message{Message: "Alert acknowledged"})
+}
+
+// GetAllowlist handles retrieving the allowlist
+func (h *AlertHandler) GetAllowlist(c *gin.Context) {
+	entries, err := h.storage.ListAllowlist(c.Request.Context())
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// AddAllowlist handles adding a sender to the allowlist
+func (h *AlertHandler) AddAllowlist(c *gin.Context) {
+	var entry models.AllowlistEntry
+	if err := c.ShouldBindJSON(&entry); err != nil {
+		apierror.Binding(c, err)
+		return
+	}
+	if models.NormalizeIdentity(entry.Identity) == "" {
+		apierror.Invalid(c, "identity", "identity is required")
+		return
+	}
+
+	if err := h.storage.AddAllowlist(c.Request.Context(), &entry); err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, entry)
+}
+
+// DeleteAllowlist handles removing an allowlist entry
+func (h *AlertHandler) DeleteAllowlist(c *gin.Context) {
+	var id uint
+	if _, err := fmt.Sscanf(c.Param("id"), "%d", &id); err != nil {
+		apierror.Invalid(c, "id", "invalid id format")
+		return
+	}
+
+	err := h.storage.DeleteAllowlist(c.Request.Context(), id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		apierror.NotFound(c, "allowlist entry not found")
+		return
+	}
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Message{Message: "Allowlist entry deleted"})
+}
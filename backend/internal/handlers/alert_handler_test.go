@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lileye/backend/internal/fixtures"
+	"github.com/lileye/backend/internal/models"
+	"github.com/lileye/backend/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func setupAlertHandler(t *testing.T) (*gin.Engine, *gorm.DB) {
+	r, db := setupTest(t)
+	blobs, err := storage.NewBlobStore(t.TempDir(), 1024)
+	assert.NoError(t, err)
+
+	NewAlertHandler(storage.NewAlertStorage(db), storage.NewSenderStorage(db)).RegisterRoutes(r.Group("/api/v1"))
+	NewAppHandler(storage.NewAppStorage(db, blobs), 1024).RegisterRoutes(r.Group("/api/v1"))
+
+	return r, db
+}
+
+func sendJSON(r *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestNewContactAlerts(t *testing.T) {
+	r, db := setupAlertHandler(t)
+
+	// Watch a chat app with several senders, allowlisting the first of them
+	opts := fixtures.Options{Seed: 1, Devices: fixtures.Devices("test123"), End: time.Now(), Days: 1, PerDay: 40}
+	senders := map[string][]string{}
+	for _, n := range fixtures.Generate(opts).Notifications {
+		if n.Category == "msg" && !slices.Contains(senders[n.PackageName], n.From) {
+			senders[n.PackageName] = append(senders[n.PackageName], n.From)
+		}
+	}
+	var watched string
+	for app, from := range senders {
+		if len(from) > len(senders[watched]) || len(from) == len(senders[watched]) && app < watched {
+			watched = app
+		}
+	}
+	if len(senders[watched]) < 2 {
+		t.Fatal("the fixtures have no chat app with several senders")
+	}
+	allowed := senders[watched][0]
+
+	w := sendJSON(r, "PUT", "/api/v1/apps/"+watched+"/watch", `{"watched": true}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = sendJSON(r, "POST", "/api/v1/allowlist", fmt.Sprintf(`{"identity": %q, "package_name": %q}`, allowed, watched))
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	ds := storeFixtures(t, db, opts)
+	expected := map[[2]string]bool{}
+	for _, n := range ds.Notifications {
+		expected[[2]string{n.PackageName, n.From}] = true
+	}
+
+	// Every sender is new within the last day or so
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/senders/new?days=2&device_id=test123", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var newSenders []models.Sender
+	err := json.Unmarshal(w.Body.Bytes(), &newSenders)
+	assert.NoError(t, err)
+	assert.Len(t, newSenders, len(expected))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/v1/alerts?unacknowledged=true", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var alerts []models.Alert
+	err = json.Unmarshal(w.Body.Bytes(), &alerts)
+	assert.NoError(t, err)
+	if !assert.Len(t, alerts, len(senders[watched])-1) {
+		return
+	}
+	for _, alert := range alerts {
+		assert.Equal(t, watched, alert.PackageName)
+		assert.NotEqual(t, allowed, alert.From)
+	}
+
+	w = sendJSON(r, "POST", fmt.Sprintf("/api/v1/alerts/%d/ack", alerts[0].ID), "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/v1/alerts?unacknowledged=true", nil)
+	r.ServeHTTP(w, req)
+	err = json.Unmarshal(w.Body.Bytes(), &alerts)
+	assert.NoError(t, err)
+	assert.Len(t, alerts, len(senders[watched])-2)
+}
+
+func TestGetNewSenders_InvalidDays(t *testing.T) {
+	r, _ := setupAlertHandler(t)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/senders/new?days=0", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestAllowlist(t *testing.T) {
+	r, _ := setupAlertHandler(t)
+
+	w := sendJSON(r, "POST", "/api/v1/allowlist", `{"identity": "  "}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = sendJSON(r, "POST", "/api/v1/allowlist", `{"identity": "Coach", "note": "Football"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var entry models.AllowlistEntry
+	err := json.Unmarshal(w.Body.Bytes(), &entry)
+	assert.NoError(t, err)
+	assert.Equal(t, "coach", entry.Identity)
+
+	w = sendJSON(r, "DELETE", fmt.Sprintf("/api/v1/allowlist/%d", entry.ID), "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = sendJSON(r, "DELETE", fmt.Sprintf("/api/v1/allowlist/%d", entry.ID), "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
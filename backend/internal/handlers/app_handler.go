@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lileye/backend/internal/apierror"
+	"github.com/lileye/backend/internal/models"
+	"github.com/lileye/backend/internal/storage"
+	"gorm.io/gorm"
+)
+
+// AppHandler handles HTTP requests for the app catalog
+type AppHandler struct {
+	storage *storage.AppStorage
+	maxSize int64
+}
+
+// NewAppHandler creates a new AppHandler instance accepting icons of at
+// most maxSize bytes
+func NewAppHandler(storage *storage.AppStorage, maxSize int64) *AppHandler {
+	return &AppHandler{storage: storage, maxSize: maxSize}
+}
+
+// RegisterRoutes registers the app catalog routes with the API route group
+func (h *AppHandler) RegisterRoutes(r gin.IRouter) {
+	r.GET("/apps", h.GetApps)
+	r.POST("/apps", h.ReportApps)
+	r.GET("/apps/:package", h.GetApp)
+	r.PUT("/apps/:package/category", h.SetCategory)
+	r.PUT("/apps/:package/watch", h.SetWatched)
+	r.PUT("/apps/:package/icon", h.UploadIcon)
+	r.GET("/apps/:package/icon", h.ServeIcon)
+}
+
+// GetApps handles retrieving the app catalog
+func (h *AppHandler) GetApps(c *gin.Context) {
+	apps, err := h.storage.List(c.Request.Context(), c.Query("category"))
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, apps)
+}
+
+// ReportApps handles devices reporting the labels of their installed apps
+func (h *AppHandler) ReportApps(c *gin.Context) {
+	var apps []models.App
+	if err := c.ShouldBindJSON(&apps); err != nil {
+		apierror.Binding(c, err)
+		return
+	}
+	for _, app := range apps {
+		if app.PackageName == "" || app.Name == "" {
+			apierror.Abort(c, http.StatusBadRequest, "package_name and name are required")
+			return
+		}
+	}
+
+	if err := h.storage.ReportLabels(c.Request.Context(), apps); err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Updated{Updated: int64(len(apps))})
+}
+
+// GetApp handles retrieving the catalog entry of a package
+func (h *AppHandler) GetApp(c *gin.Context) {
+	app, err := h.storage.GetByPackageName(c.Request.Context(), c.Param("package"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		apierror.NotFound(c, "app not found")
+		return
+	}
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, app)
+}
+
+// SetCategory handles assigning a category to a package
+func (h *AppHandler) SetCategory(c *gin.Context) {
+	var request struct {
+		Category string `json:"category"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		apierror.Binding(c, err)
+		return
+	}
+	if !isAppCategory(request.Category) {
+		apierror.Abort(c, http.StatusBadRequest, "unknown category", models.FieldError{
+			Field:   "category",
+			Message: "must be one of " + strings.Join(models.AppCategories, ", "),
+		})
+		return
+	}
+
+	app, err := h.storage.SetCategory(c.Request.Context(), c.Param("package"), request.Category)
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, app)
+}
+
+// SetWatched handles turning new contact alerts for a package on or off
+func (h *AppHandler) SetWatched(c *gin.Context) {
+	var request struct {
+		Watched *bool `json:"watched" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		apierror.Binding(c, err)
+		return
+	}
+
+	app, err := h.storage.SetWatched(c.Request.Context(), c.Param("package"), *request.Watched)
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, app)
+}
+
+// UploadIcon handles a device uploading the icon of a package as the
+// multipart form field "file"
+func (h *AppHandler) UploadIcon(c *gin.Context) {
+	header, ok := formFile(c, h.maxSize)
+	if !ok {
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+	defer file.Close()
+
+	app, err := h.storage.SetIcon(c.Request.Context(), c.Param("package"), file)
+	switch {
+	case errors.Is(err, storage.ErrBlobTooLarge):
+		apierror.Abort(c, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	case errors.Is(err, storage.ErrUnsupportedMediaType):
+		apierror.Abort(c, http.StatusUnsupportedMediaType, err.Error())
+		return
+	case err != nil:
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, app)
+}
+
+// ServeIcon handles serving the icon of a package
+func (h *AppHandler) ServeIcon(c *gin.Context) {
+	app, err := h.storage.GetByPackageName(c.Request.Context(), c.Param("package"))
+	if errors.Is(err, gorm.ErrRecordNotFound) || err == nil && app.IconSHA256 == "" {
+		apierror.NotFound(c, "icon not found")
+		return
+	}
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	file, err := h.storage.OpenIcon(app)
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Header("ETag", `"`+app.IconSHA256+`"`)
+	c.DataFromReader(http.StatusOK, info.Size(), app.IconMimeType, file, nil)
+}
+
+func isAppCategory(category string) bool {
+	for _, c := range models.AppCategories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
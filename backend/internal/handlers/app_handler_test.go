@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lileye/backend/internal/fixtures"
+	"github.com/lileye/backend/internal/models"
+	"github.com/lileye/backend/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupAppHandler(t *testing.T) (*gin.Engine, *storage.NotificationStorage) {
+	r, db := setupTest(t)
+	blobs, err := storage.NewBlobStore(t.TempDir(), 1024)
+	assert.NoError(t, err)
+
+	notificationStorage := storage.NewNotificationStorage(db)
+	NewNotificationHandler(notificationStorage, testValidator(), nil).RegisterRoutes(r.Group("/api/v1"))
+	NewAppHandler(storage.NewAppStorage(db, blobs), 1024).RegisterRoutes(r.Group("/api/v1"))
+
+	return r, notificationStorage
+}
+
+func TestReportAppsAndSetCategory(t *testing.T) {
+	r, s := setupAppHandler(t)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/apps", bytes.NewBufferString(`[{"package_name": "com.example.chat", "name": "Chat"}]`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PUT", "/api/v1/apps/com.example.chat/category", bytes.NewBufferString(`{"category": "messaging"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var app models.App
+	err := json.Unmarshal(w.Body.Bytes(), &app)
+	assert.NoError(t, err)
+	assert.Equal(t, "Chat", app.Name)
+	assert.Equal(t, "messaging", app.Category)
+
+	// A notification from an app not in the catalog
+	notification := fixtures.NewGenerator(1, fixtures.Devices("test123")).Next(time.Now())
+	notification.PackageName = "com.example.chat"
+	err = s.Create(context.Background(), &notification)
+	assert.NoError(t, err)
+	search := "/api/v1/notifications/device/test123/search?" + url.Values{"q": {notification.Message}}.Encode()
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", search+"&app_category=messaging", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var notifications []models.Notification
+	err = json.Unmarshal(w.Body.Bytes(), &notifications)
+	assert.NoError(t, err)
+	assert.Len(t, notifications, 1)
+	assert.Equal(t, "Chat", notifications[0].AppName)
+	assert.Equal(t, "messaging", notifications[0].AppCategory)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", search+"&app_category=email", nil)
+	r.ServeHTTP(w, req)
+	assert.JSONEq(t, `[]`, w.Body.String())
+}
+
+func TestSetCategory_Invalid(t *testing.T) {
+	r, _ := setupAppHandler(t)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", "/api/v1/apps/com.example.chat/category", bytes.NewBufferString(`{"category": "games"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/v1/apps/com.example.chat", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestUploadAndServeIcon(t *testing.T) {
+	r, _ := setupAppHandler(t)
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, _ := writer.CreateFormFile("file", "icon.png")
+	_, _ = part.Write(testPNG)
+	_ = writer.Close()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", "/api/v1/apps/com.whatsapp/icon", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/v1/apps/com.whatsapp/icon", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	assert.Equal(t, testPNG, w.Body.Bytes())
+}
+
+func TestUploadIcon_BodyTooLarge(t *testing.T) {
+	r, _ := setupAppHandler(t)
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, _ := writer.CreateFormFile("file", "icon.png")
+	_, _ = part.Write(append(testPNG, make([]byte, 1024+multipartOverhead)...))
+	_ = writer.Close()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", "/api/v1/apps/com.whatsapp/icon", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"payload_too_large"`)
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lileye/backend/internal/apierror"
+	"github.com/lileye/backend/internal/middleware"
+	"github.com/lileye/backend/internal/models"
+	"github.com/lileye/backend/internal/storage"
+	"gorm.io/gorm"
+)
+
+// AttachmentHandler handles HTTP requests for notification attachments
+type AttachmentHandler struct {
+	storage       *storage.AttachmentStorage
+	notifications *storage.NotificationStorage
+	maxSize       int64
+}
+
+// NewAttachmentHandler creates a new AttachmentHandler instance accepting
+// uploads of at most maxSize bytes
+func NewAttachmentHandler(storage *storage.AttachmentStorage, notifications *storage.NotificationStorage, maxSize int64) *AttachmentHandler {
+	return &AttachmentHandler{storage: storage, notifications: notifications, maxSize: maxSize}
+}
+
+// RegisterRoutes registers the attachment routes with the API route
+// group. Attachments are only reachable through the notification they
+// belong to.
+func (h *AttachmentHandler) RegisterRoutes(r gin.IRouter) {
+	r.POST("/notifications/:id/attachments", h.UploadAttachment)
+	r.GET("/notifications/:id/attachments", middleware.Audited("attachment.list"), h.GetAttachments)
+	r.GET("/notifications/:id/attachments/:attachmentID", middleware.Audited("attachment.read"), h.ServeAttachment)
+}
+
+// UploadAttachment handles uploading a file attached to a notification as the
+// multipart form field "file"
+func (h *AttachmentHandler) UploadAttachment(c *gin.Context) {
+	notification, ok := h.notification(c)
+	if !ok {
+		return
+	}
+	header, ok := formFile(c, h.maxSize)
+	if !ok {
+		return
+	}
+
+	kind := c.DefaultPostForm("kind", models.AttachmentImage)
+	switch kind {
+	case models.AttachmentIcon, models.AttachmentImage, models.AttachmentAvatar:
+	default:
+		apierror.Invalid(c, "kind", "kind must be one of icon, image or avatar")
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+	defer file.Close()
+
+	attachment, err := h.storage.Create(c.Request.Context(), notification.ID, kind, filepath.Base(header.Filename), file)
+	switch {
+	case errors.Is(err, storage.ErrBlobTooLarge):
+		apierror.Abort(c, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	case errors.Is(err, storage.ErrUnsupportedMediaType):
+		apierror.Abort(c, http.StatusUnsupportedMediaType, err.Error())
+		return
+	case err != nil:
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, attachment)
+}
+
+// GetAttachments handles listing the attachments of a notification
+func (h *AttachmentHandler) GetAttachments(c *gin.Context) {
+	notification, ok := h.notification(c)
+	if !ok {
+		return
+	}
+
+	attachments, err := h.storage.GetByNotificationID(c.Request.Context(), notification.ID)
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, attachments)
+}
+
+// ServeAttachment handles serving the content of an attachment
+func (h *AttachmentHandler) ServeAttachment(c *gin.Context) {
+	notification, ok := h.notification(c)
+	if !ok {
+		return
+	}
+
+	var id uint
+	if _, err := fmt.Sscanf(c.Param("attachmentID"), "%d", &id); err != nil {
+		apierror.Invalid(c, "attachmentID", "invalid attachment id format")
+		return
+	}
+	attachment, err := h.storage.GetByID(c.Request.Context(), id)
+	if errors.Is(err, gorm.ErrRecordNotFound) || err == nil && attachment.NotificationID != notification.ID {
+		apierror.NotFound(c, "attachment not found")
+		return
+	}
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	file, err := h.storage.Open(attachment)
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+	defer file.Close()
+
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Cache-Control", "private, max-age=86400, immutable")
+	c.Header("ETag", `"`+attachment.SHA256+`"`)
+	c.DataFromReader(http.StatusOK, attachment.Size, attachment.MimeType, file, nil)
+}
+
+// notification loads the notification named by the id parameter, writing an
+// error response if it cannot be found
+func (h *AttachmentHandler) notification(c *gin.Context) (*models.Notification, bool) {
+	var id uint
+	if _, err := fmt.Sscanf(c.Param("id"), "%d", &id); err != nil {
+		apierror.Invalid(c, "id", "invalid id format")
+		return nil, false
+	}
+
+	notification, err := h.notifications.GetByID(c.Request.Context(), id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		apierror.NotFound(c, "notification not found")
+		return nil, false
+	}
+	if err != nil {
+		apierror.Internal(c, err)
+		return nil, false
+	}
+	return notification, true
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lileye/backend/internal/fixtures"
+	"github.com/lileye/backend/internal/models"
+	"github.com/lileye/backend/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+var testPNG = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func setupAttachmentHandler(t *testing.T) (*gin.Engine, *models.Notification) {
+	r, db := setupTest(t)
+	blobs, err := storage.NewBlobStore(t.TempDir(), 1024)
+	assert.NoError(t, err)
+
+	notificationStorage := storage.NewNotificationStorage(db)
+	handler := NewAttachmentHandler(storage.NewAttachmentStorage(db, blobs), notificationStorage, 1024)
+	handler.RegisterRoutes(r.Group("/api/v1"))
+
+	generated := fixtures.NewGenerator(1, fixtures.Devices("test123")).Next(time.Now())
+	notification := &generated
+	assert.NoError(t, notificationStorage.Create(context.Background(), notification))
+
+	return r, notification
+}
+
+func uploadAttachment(r *gin.Engine, notificationID uint, content []byte) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	_ = writer.WriteField("kind", "image")
+	part, _ := writer.CreateFormFile("file", "photo.png")
+	_, _ = part.Write(content)
+	_ = writer.Close()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", fmt.Sprintf("/api/v1/notifications/%d/attachments", notificationID), &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestUploadAndServeAttachment(t *testing.T) {
+	r, notification := setupAttachmentHandler(t)
+
+	w := uploadAttachment(r, notification.ID, testPNG)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var attachment models.Attachment
+	err := json.Unmarshal(w.Body.Bytes(), &attachment)
+	assert.NoError(t, err)
+	assert.Equal(t, "image/png", attachment.MimeType)
+	assert.Equal(t, "photo.png", attachment.Filename)
+
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/api/v1/notifications/%d/attachments/%d", notification.ID, attachment.ID), nil)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, testPNG, w.Body.Bytes())
+
+	// The attachment is not reachable through another notification
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/api/v1/notifications/%d/attachments/%d", notification.ID+1, attachment.ID), nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestUploadAttachment_Rejected(t *testing.T) {
+	r, notification := setupAttachmentHandler(t)
+
+	w := uploadAttachment(r, notification.ID, []byte("<html><script></script></html>"))
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+
+	w = uploadAttachment(r, notification.ID, append(testPNG, make([]byte, 1024)...))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	w = uploadAttachment(r, notification.ID+1, testPNG)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestUploadAttachment_BodyTooLarge(t *testing.T) {
+	r, notification := setupAttachmentHandler(t)
+
+	// The body is refused while it is read, before the form is parsed
+	w := uploadAttachment(r, notification.ID, append(testPNG, make([]byte, 1024+multipartOverhead)...))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	var response models.ErrorResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, models.CodePayloadTooLarge, response.Error.Code)
+	assert.Equal(t, "uploads must be at most 1024 bytes", response.Error.Message)
+}
+
+func TestGetAttachments(t *testing.T) {
+	r, notification := setupAttachmentHandler(t)
+
+	assert.Equal(t, http.StatusCreated, uploadAttachment(r, notification.ID, testPNG).Code)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/api/v1/notifications/%d/attachments", notification.ID), nil)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var attachments []models.Attachment
+	err := json.Unmarshal(w.Body.Bytes(), &attachments)
+	assert.NoError(t, err)
+	assert.Len(t, attachments, 1)
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lileye/backend/internal/apierror"
+	"github.com/lileye/backend/internal/middleware"
+	"github.com/lileye/backend/internal/storage"
+)
+
+// AuditHandler handles HTTP requests for the audit log
+type AuditHandler struct {
+	storage *storage.AuditStorage
+}
+
+// NewAuditHandler creates a new AuditHandler instance
+func NewAuditHandler(storage *storage.AuditStorage) *AuditHandler {
+	return &AuditHandler{storage: storage}
+}
+
+// RegisterRoutes registers the audit routes with the API route group.
+// Reading the audit log is itself audited.
+func (h *AuditHandler) RegisterRoutes(r gin.IRouter) {
+	r.GET("/audit", middleware.Audited("audit.list"), h.GetAuditLog)
+	r.GET("/audit/verify", middleware.Audited("audit.verify"), h.VerifyAuditLog)
+}
+
+// GetAuditLog handles retrieving a page of the audit log, newest first,
+// optionally filtered by actor, action, device, notification and time
+func (h *AuditHandler) GetAuditLog(c *gin.Context) {
+	limit, offset, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
+	filter := storage.AuditFilter{
+		Actor:    c.Query("actor"),
+		Action:   c.Query("action"),
+		DeviceID: c.Query("device_id"),
+	}
+	if s := c.Query("notification_id"); s != "" {
+		id, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			apierror.Invalid(c, "notification_id", "invalid notification_id")
+			return
+		}
+		filter.NotificationID = uint(id)
+	}
+	if s := c.Query("since"); s != "" {
+		var err error
+		if filter.Since, err = time.Parse(time.RFC3339, s); err != nil {
+			apierror.Invalid(c, "since", "invalid since date format")
+			return
+		}
+	}
+	if s := c.Query("until"); s != "" {
+		var err error
+		if filter.Until, err = time.Parse(time.RFC3339, s); err != nil {
+			apierror.Invalid(c, "until", "invalid until date format")
+			return
+		}
+	}
+
+	page, err := h.storage.List(c.Request.Context(), filter, limit, offset)
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// VerifyAuditLog handles checking the hash chain of the audit log
+func (h *AuditHandler) VerifyAuditLog(c *gin.Context) {
+	result, err := h.storage.Verify(c.Request.Context())
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lileye/backend/internal/logging"
+	"github.com/lileye/backend/internal/middleware"
+	"github.com/lileye/backend/internal/models"
+	"github.com/lileye/backend/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditLogRecordsAccess(t *testing.T) {
+	r, db := setupTest(t)
+	audit := storage.NewAuditStorage(db, bytes.Repeat([]byte{7}, storage.AuditKeySize))
+	r.Use(middleware.RequestID(), middleware.Audit(audit, logging.New(&bytes.Buffer{}, slog.LevelInfo)))
+	NewNotificationHandler(storage.NewNotificationStorage(db), testValidator(), nil).RegisterRoutes(r.Group("/api/v1"))
+	NewAuditHandler(audit).RegisterRoutes(r.Group("/api/v1"))
+
+	send := func(method, path, actor string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, nil)
+		req.Header.Set(middleware.ActorHeader, actor)
+		req.RemoteAddr = "192.168.1.20:40000"
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, send("GET", "/api/v1/notifications/device/device1/search?q=park", "mum").Code)
+	assert.Equal(t, http.StatusNotFound, send("GET", "/api/v1/notifications/42", "").Code)
+	assert.Equal(t, http.StatusOK, send("DELETE", "/api/v1/notifications/all", "dad").Code)
+	assert.Equal(t, http.StatusOK, send("GET", "/api/v1/devices", "mum").Code)
+
+	w := send("GET", "/api/v1/audit?limit=10", "mum")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var page models.AuditPage
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Equal(t, int64(4), page.Total)
+
+	devices, deleted, read, search := page.Entries[0], page.Entries[1], page.Entries[2], page.Entries[3]
+	assert.Equal(t, "notification.search", search.Action)
+	// Without an admin key the actor is anonymous, and the name the client
+	// sent is kept apart as unverified
+	assert.Equal(t, "anonymous", search.Actor)
+	assert.Equal(t, "mum", search.ClaimedActor)
+	assert.Equal(t, "device1", search.DeviceID)
+	// Search terms are not kept
+	assert.Equal(t, "deviceID=device1&q=redacted", search.Params)
+	assert.Equal(t, "192.168.1.20", search.IP)
+	assert.NotEmpty(t, search.RequestID)
+	assert.Equal(t, "anonymous", read.Actor)
+	assert.Empty(t, read.ClaimedActor)
+	assert.Equal(t, uint(42), read.NotificationID)
+	assert.Equal(t, http.StatusNotFound, read.Status)
+	assert.Equal(t, "notification.delete_all", deleted.Action)
+	assert.Equal(t, deleted.PrevHash, read.Hash)
+	assert.Equal(t, "device.list", devices.Action)
+
+	w = send("GET", "/api/v1/audit?action=audit.list&actor=anonymous", "mum")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Equal(t, int64(1), page.Total)
+
+	w = send("GET", "/api/v1/audit?since=yesterday", "mum")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = send("GET", "/api/v1/audit/verify", "mum")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var result models.AuditVerification
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.True(t, result.Valid)
+	assert.Equal(t, int64(7), result.Entries)
+}
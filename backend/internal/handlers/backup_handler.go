@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lileye/backend/internal/apierror"
+	"github.com/lileye/backend/internal/backup"
+	"github.com/lileye/backend/internal/middleware"
+)
+
+// BackupHandler handles HTTP requests for database backups
+type BackupHandler struct {
+	backups *backup.Manager
+}
+
+// NewBackupHandler creates a new BackupHandler instance
+func NewBackupHandler(backups *backup.Manager) *BackupHandler {
+	return &BackupHandler{backups: backups}
+}
+
+// RegisterRoutes registers the backup routes with the API route group
+func (h *BackupHandler) RegisterRoutes(r gin.IRouter) {
+	r.GET("/admin/backups", middleware.Audited("backup.list"), h.GetBackups)
+	r.POST("/admin/backups", middleware.Audited("backup.create"), h.CreateBackup)
+	r.GET("/admin/backups/:name", middleware.Audited("backup.download"), h.DownloadBackup)
+}
+
+// GetBackups handles listing the backups, newest first
+func (h *BackupHandler) GetBackups(c *gin.Context) {
+	manifests, err := h.backups.List()
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, manifests)
+}
+
+// CreateBackup handles taking a backup now
+func (h *BackupHandler) CreateBackup(c *gin.Context) {
+	manifest, err := h.backups.Create()
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, manifest)
+}
+
+// DownloadBackup handles downloading the database snapshot of a backup
+func (h *BackupHandler) DownloadBackup(c *gin.Context) {
+	path, err := h.backups.Path(c.Param("name"))
+	if errors.Is(err, backup.ErrNotFound) {
+		apierror.NotFound(c, "backup not found")
+		return
+	}
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.FileAttachment(path, c.Param("name"))
+}
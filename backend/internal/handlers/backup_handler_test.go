@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lileye/backend/internal/backup"
+	"github.com/lileye/backend/internal/models"
+	"github.com/lileye/backend/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackups(t *testing.T) {
+	r, db := setupTest(t)
+	NewBackupHandler(backup.NewManager(db, t.TempDir(), 3)).RegisterRoutes(r.Group("/api/v1"))
+	send := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, nil)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send("GET", "/api/v1/admin/backups")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, "[]", w.Body.String())
+
+	w = send("POST", "/api/v1/admin/backups")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var manifest models.BackupManifest
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &manifest))
+	assert.Equal(t, storage.SchemaVersion, manifest.SchemaVersion)
+
+	w = send("GET", "/api/v1/admin/backups")
+	var manifests []models.BackupManifest
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &manifests))
+	assert.Equal(t, []models.BackupManifest{manifest}, manifests)
+
+	w = send("GET", "/api/v1/admin/backups/"+manifest.File)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.HasPrefix(w.Body.String(), "SQLite format 3"))
+	assert.Equal(t, int64(w.Body.Len()), manifest.Size)
+
+	w = send("GET", "/api/v1/admin/backups/notifications.db")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
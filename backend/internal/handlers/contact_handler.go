@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lileye/backend/internal/apierror"
+	"github.com/lileye/backend/internal/middleware"
+	"github.com/lileye/backend/internal/models"
+	"github.com/lileye/backend/internal/storage"
+	"gorm.io/gorm"
+)
+
+// ContactHandler handles HTTP requests for contacts
+type ContactHandler struct {
+	storage *storage.ContactStorage
+}
+
+// NewContactHandler creates a new ContactHandler instance
+func NewContactHandler(storage *storage.ContactStorage) *ContactHandler {
+	return &ContactHandler{storage: storage}
+}
+
+// RegisterRoutes registers the contact routes with the API route group
+func (h *ContactHandler) RegisterRoutes(r gin.IRouter) {
+	r.GET("/contacts", middleware.Audited("contact.list"), h.GetContacts)
+	r.GET("/contacts/:id", middleware.Audited("contact.read"), h.GetContact)
+	r.PUT("/contacts/:id", h.UpdateContact)
+	r.POST("/contacts/:id/merge", h.MergeContacts)
+	r.GET("/contacts/:id/activity", middleware.Audited("contact.activity"), h.GetContactActivity)
+	r.GET("/contacts/:id/notifications", middleware.Audited("contact.notifications"), h.GetContactNotifications)
+}
+
+// GetContacts handles retrieving all contacts. New senders become contacts
+// as their notifications are stored.
+func (h *ContactHandler) GetContacts(c *gin.Context) {
+	contacts, err := h.storage.List(c.Request.Context(), c.Query("status"))
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, contacts)
+}
+
+// GetContact handles retrieving a contact and its aliases
+func (h *ContactHandler) GetContact(c *gin.Context) {
+	id, ok := contactID(c)
+	if !ok {
+		return
+	}
+
+	contact, err := h.storage.GetByID(c.Request.Context(), id)
+	if err != nil {
+		contactError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, contact)
+}
+
+// UpdateContact handles renaming a contact or changing its status
+func (h *ContactHandler) UpdateContact(c *gin.Context) {
+	id, ok := contactID(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Name   string `json:"name"`
+		Status string `json:"status"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		apierror.Binding(c, err)
+		return
+	}
+	switch request.Status {
+	case "", models.ContactUnknown, models.ContactTrusted, models.ContactBlocked:
+	default:
+		apierror.Invalid(c, "status", "status must be one of unknown, trusted or blocked")
+		return
+	}
+
+	if _, err := h.storage.GetByID(c.Request.Context(), id); err != nil {
+		contactError(c, err)
+		return
+	}
+	contact, err := h.storage.Update(c.Request.Context(), id, request.Name, request.Status)
+	if err != nil {
+		contactError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, contact)
+}
+
+// MergeContacts handles merging other contacts into a contact
+func (h *ContactHandler) MergeContacts(c *gin.Context) {
+	id, ok := contactID(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		ContactIDs []uint `json:"contact_ids" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		apierror.Binding(c, err)
+		return
+	}
+
+	contact, err := h.storage.Merge(c.Request.Context(), id, request.ContactIDs)
+	if err != nil {
+		contactError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, contact)
+}
+
+// GetContactActivity handles retrieving a contact's activity per device and app
+func (h *ContactHandler) GetContactActivity(c *gin.Context) {
+	id, ok := contactID(c)
+	if !ok {
+		return
+	}
+	if _, err := h.storage.GetByID(c.Request.Context(), id); err != nil {
+		contactError(c, err)
+		return
+	}
+
+	activity, err := h.storage.GetActivity(c.Request.Context(), id)
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, activity)
+}
+
+// GetContactNotifications handles retrieving a page of a contact's
+// notifications across all apps and devices
+func (h *ContactHandler) GetContactNotifications(c *gin.Context) {
+	id, ok := contactID(c)
+	if !ok {
+		return
+	}
+	limit, offset, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+	if _, err := h.storage.GetByID(c.Request.Context(), id); err != nil {
+		contactError(c, err)
+		return
+	}
+
+	page, err := h.storage.GetNotifications(c.Request.Context(), id, limit, offset)
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+func contactID(c *gin.Context) (uint, bool) {
+	var id uint
+	if _, err := fmt.Sscanf(c.Param("id"), "%d", &id); err != nil {
+		apierror.Invalid(c, "id", "invalid id format")
+		return 0, false
+	}
+	return id, true
+}
+
+func contactError(c *gin.Context, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		apierror.NotFound(c, "contact not found")
+		return
+	}
+	apierror.Internal(c, err)
+}
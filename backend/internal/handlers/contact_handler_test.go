@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lileye/backend/internal/fixtures"
+	"github.com/lileye/backend/internal/models"
+	"github.com/lileye/backend/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupContactHandler(t *testing.T) (*gin.Engine, *fixtures.Dataset) {
+	r, db := setupTest(t)
+	NewContactHandler(storage.NewContactStorage(db)).RegisterRoutes(r.Group("/api/v1"))
+
+	ds := storeFixtures(t, db, fixtures.Options{Seed: 1, Devices: fixtures.Devices("test123", "test456"), End: fixturesEnd, Days: 2, PerDay: 40})
+	return r, ds
+}
+
+func getContacts(t *testing.T, r *gin.Engine, query string) map[string]models.Contact {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/contacts"+query, nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var contacts []models.Contact
+	err := json.Unmarshal(w.Body.Bytes(), &contacts)
+	assert.NoError(t, err)
+
+	byName := make(map[string]models.Contact)
+	for _, contact := range contacts {
+		byName[contact.Name] = contact
+	}
+	return byName
+}
+
+func TestGetContacts(t *testing.T) {
+	r, ds := setupContactHandler(t)
+
+	// Every sender is a contact of its own until contacts are merged
+	senders := map[string]bool{}
+	for _, n := range ds.Notifications {
+		senders[n.From] = true
+	}
+	contacts := getContacts(t, r, "")
+	assert.Len(t, contacts, len(senders))
+	for from := range senders {
+		assert.Equal(t, "unknown", contacts[from].Status, from)
+	}
+}
+
+func TestMergeAndUpdateContact(t *testing.T) {
+	r, ds := setupContactHandler(t)
+	contacts := getContacts(t, r, "")
+
+	// Merge the two first senders, who may write from several apps and
+	// devices
+	var merged []string
+	activity := map[[2]string]int64{}
+	var total int64
+	for _, n := range ds.Notifications {
+		if len(merged) < 2 && !slices.Contains(merged, n.From) {
+			merged = append(merged, n.From)
+		}
+	}
+	for _, n := range ds.Notifications {
+		if slices.Contains(merged, n.From) {
+			activity[[2]string{n.DeviceID, n.PackageName}]++
+			total++
+		}
+	}
+	if len(merged) < 2 {
+		t.Fatal("the fixtures have fewer than two senders")
+	}
+	first := contacts[merged[0]]
+
+	body := fmt.Sprintf(`{"contact_ids": [%d]}`, contacts[merged[1]].ID)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", fmt.Sprintf("/api/v1/contacts/%d/merge", first.ID), bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PUT", fmt.Sprintf("/api/v1/contacts/%d", first.ID), bytes.NewBufferString(`{"status": "trusted"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var contact models.Contact
+	err := json.Unmarshal(w.Body.Bytes(), &contact)
+	assert.NoError(t, err)
+	assert.Equal(t, "trusted", contact.Status)
+	assert.Len(t, contact.Aliases, 2)
+
+	trusted := getContacts(t, r, "?status=trusted")
+	assert.Len(t, trusted, 1)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/api/v1/contacts/%d/activity", first.ID), nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response []models.ContactActivity
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Len(t, response, len(activity))
+	for _, a := range response {
+		assert.Equal(t, activity[[2]string{a.DeviceID, a.PackageName}], a.MessageCount)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/api/v1/contacts/%d/notifications", first.ID), nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var page models.NotificationPage
+	err = json.Unmarshal(w.Body.Bytes(), &page)
+	assert.NoError(t, err)
+	assert.Equal(t, total, page.Total)
+}
+
+func TestUpdateContact_Invalid(t *testing.T) {
+	r, ds := setupContactHandler(t)
+	contacts := getContacts(t, r, "")
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", fmt.Sprintf("/api/v1/contacts/%d", contacts[ds.Notifications[0].From].ID), bytes.NewBufferString(`{"status": "friend"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/v1/contacts/9999", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lileye/backend/internal/apierror"
+	"github.com/lileye/backend/internal/middleware"
+	"github.com/lileye/backend/internal/models"
+	"github.com/lileye/backend/internal/storage"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+// ConversationHandler handles HTTP requests for conversation threads
+type ConversationHandler struct {
+	storage *storage.ConversationStorage
+}
+
+// NewConversationHandler creates a new ConversationHandler instance
+func NewConversationHandler(storage *storage.ConversationStorage) *ConversationHandler {
+	return &ConversationHandler{storage: storage}
+}
+
+// RegisterRoutes registers the conversation routes with the API route group
+func (h *ConversationHandler) RegisterRoutes(r gin.IRouter) {
+	r.GET("/conversations/device/:deviceID", middleware.Audited("conversation.list"), h.GetConversations)
+	r.GET("/conversations/device/:deviceID/thread", middleware.Audited("conversation.read"), h.GetThread)
+	r.POST("/conversations/device/:deviceID/thread/read", h.MarkThreadRead)
+}
+
+// GetConversations handles retrieving the conversation threads of a device
+func (h *ConversationHandler) GetConversations(c *gin.Context) {
+	conversations, err := h.storage.GetConversations(c.Request.Context(), c.Param("deviceID"), c.Query("app_category"))
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, conversations)
+}
+
+// GetThread handles retrieving a page of messages in a conversation
+func (h *ConversationHandler) GetThread(c *gin.Context) {
+	packageName := c.Query("package")
+	if packageName == "" {
+		apierror.Invalid(c, "package", "package is required")
+		return
+	}
+
+	limit, offset, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
+	page, err := h.storage.GetThread(c.Request.Context(), c.Param("deviceID"), packageName, c.Query("from"), limit, offset)
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// MarkThreadRead handles marking every message in a conversation as read
+func (h *ConversationHandler) MarkThreadRead(c *gin.Context) {
+	packageName := c.Query("package")
+	if packageName == "" {
+		apierror.Invalid(c, "package", "package is required")
+		return
+	}
+
+	updated, err := h.storage.MarkThreadRead(c.Request.Context(), c.Param("deviceID"), packageName, c.Query("from"))
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Updated{Updated: updated})
+}
+
+// parsePagination reads the limit and offset query parameters
+func parsePagination(c *gin.Context) (limit, offset int, ok bool) {
+	limit = defaultPageLimit
+	if s := c.Query("limit"); s != "" {
+		var err error
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			apierror.Invalid(c, "limit", fmt.Sprintf("limit must be between 1 and %d", maxPageLimit))
+			return 0, 0, false
+		}
+	}
+	if s := c.Query("offset"); s != "" {
+		var err error
+		offset, err = strconv.Atoi(s)
+		if err != nil || offset < 0 {
+			apierror.Invalid(c, "offset", "offset must be a non-negative integer")
+			return 0, 0, false
+		}
+	}
+	return limit, offset, true
+}
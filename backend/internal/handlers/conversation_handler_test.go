@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lileye/backend/internal/fixtures"
+	"github.com/lileye/backend/internal/models"
+	"github.com/lileye/backend/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// thread is what the fixtures expect of a conversation
+type thread struct {
+	PackageName string
+	From        string
+	Messages    []models.Notification
+	Unread      int64
+}
+
+func setupConversationHandler(t *testing.T) (*gin.Engine, []*thread) {
+	r, db := setupTest(t)
+	NewConversationHandler(storage.NewConversationStorage(db)).RegisterRoutes(r.Group("/api/v1"))
+
+	ds := storeFixtures(t, db, fixtures.Options{Seed: 1, Devices: fixtures.Devices("test123"), End: fixturesEnd, Days: 2, PerDay: 40})
+	// Threads are keyed by group title or sender, most recently active
+	// first, with their messages newest first
+	var threads []*thread
+	byKey := map[[2]string]*thread{}
+	for i := len(ds.Notifications) - 1; i >= 0; i-- {
+		n := ds.Notifications[i]
+		from := n.ConversationTitle
+		if from == "" {
+			from = n.From
+		}
+		th, ok := byKey[[2]string{n.PackageName, from}]
+		if !ok {
+			th = &thread{PackageName: n.PackageName, From: from}
+			byKey[[2]string{n.PackageName, from}] = th
+			threads = append(threads, th)
+		}
+		th.Messages = append(th.Messages, n)
+		if !n.Read {
+			th.Unread++
+		}
+	}
+	return r, threads
+}
+
+func TestGetConversations(t *testing.T) {
+	r, threads := setupConversationHandler(t)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/conversations/device/test123", nil)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response []models.Conversation
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, threads)
+	if !assert.Len(t, response, len(threads)) {
+		return
+	}
+	for i, conversation := range response {
+		assert.Equal(t, threads[i].PackageName, conversation.PackageName)
+		assert.Equal(t, threads[i].From, conversation.From)
+		assert.Equal(t, int64(len(threads[i].Messages)), conversation.MessageCount)
+		assert.Equal(t, threads[i].Unread, conversation.UnreadCount)
+	}
+}
+
+func TestGetThread(t *testing.T) {
+	r, threads := setupConversationHandler(t)
+	latest := threads[0]
+
+	query := url.Values{"package": {latest.PackageName}, "from": {latest.From}, "limit": {"1"}}
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/conversations/device/test123/thread?"+query.Encode(), nil)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.NotificationPage
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(latest.Messages)), response.Total)
+	if assert.Len(t, response.Notifications, 1) {
+		assert.Equal(t, latest.Messages[0].ID, response.Notifications[0].ID)
+	}
+}
+
+func TestGetThread_InvalidParams(t *testing.T) {
+	r, _ := setupConversationHandler(t)
+
+	for _, query := range []string{"from=Alice", "package=com.whatsapp&limit=0", "package=com.whatsapp&offset=-1"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/conversations/device/test123/thread?"+query, nil)
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestMarkThreadRead(t *testing.T) {
+	r, threads := setupConversationHandler(t)
+	// Marking a thread read takes one with new messages
+	var unread *thread
+	for _, th := range threads {
+		if th.Unread > 0 {
+			unread = th
+			break
+		}
+	}
+	if unread == nil {
+		t.Fatal("the fixtures have no unread thread")
+	}
+
+	query := url.Values{"package": {unread.PackageName}, "from": {unread.From}}
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/conversations/device/test123/thread/read?"+query.Encode(), nil)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response map[string]int64
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, map[string]int64{"updated": unread.Unread}, response)
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lileye/backend/internal/apierror"
+	"github.com/lileye/backend/internal/middleware"
+	"github.com/lileye/backend/internal/models"
+	"github.com/lileye/backend/internal/storage"
+)
+
+// EventHandler handles HTTP requests for notification lifecycle events
+type EventHandler struct {
+	storage *storage.EventStorage
+}
+
+// NewEventHandler creates a new EventHandler instance
+func NewEventHandler(storage *storage.EventStorage) *EventHandler {
+	return &EventHandler{storage: storage}
+}
+
+// RegisterRoutes registers the event routes with the API route group
+func (h *EventHandler) RegisterRoutes(r gin.IRouter) {
+	r.POST("/events", h.CreateEvent)
+	r.GET("/events/device/:deviceID", middleware.Audited("event.list"), h.GetEventsByDevice)
+	r.GET("/notifications/:id/events", middleware.Audited("event.list"), h.GetNotificationEvents)
+}
+
+// CreateEvent handles recording a notification lifecycle event
+func (h *EventHandler) CreateEvent(c *gin.Context) {
+	var event models.NotificationEvent
+	if err := c.ShouldBindJSON(&event); err != nil {
+		apierror.Binding(c, err)
+		return
+	}
+
+	if event.Key == "" || event.DeviceID == "" {
+		apierror.Abort(c, http.StatusBadRequest, "key and device_id are required")
+		return
+	}
+	switch event.Type {
+	case models.EventPosted, models.EventUpdated, models.EventRemoved:
+	default:
+		apierror.Invalid(c, "type", "type must be one of posted, updated or removed")
+		return
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	if err := h.storage.Record(c.Request.Context(), &event); err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, event)
+}
+
+// GetEventsByDevice handles retrieving the events of a device
+func (h *EventHandler) GetEventsByDevice(c *gin.Context) {
+	events, err := h.storage.GetByDeviceID(c.Request.Context(), c.Param("deviceID"), c.Query("key"))
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
+
+// GetNotificationEvents handles retrieving the events of a notification
+func (h *EventHandler) GetNotificationEvents(c *gin.Context) {
+	var id uint
+	if _, err := fmt.Sscanf(c.Param("id"), "%d", &id); err != nil {
+		apierror.Invalid(c, "id", "invalid id format")
+		return
+	}
+
+	events, err := h.storage.GetByNotificationID(c.Request.Context(), id)
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
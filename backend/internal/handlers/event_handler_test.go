@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lileye/backend/internal/fixtures"
+	"github.com/lileye/backend/internal/models"
+	"github.com/lileye/backend/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupEventHandler(t *testing.T) (*gin.Engine, *storage.NotificationStorage) {
+	r, db := setupTest(t)
+	notificationStorage := storage.NewNotificationStorage(db)
+	NewNotificationHandler(notificationStorage, testValidator(), nil).RegisterRoutes(r.Group("/api/v1"))
+	NewEventHandler(storage.NewEventStorage(db)).RegisterRoutes(r.Group("/api/v1"))
+
+	return r, notificationStorage
+}
+
+func TestCreateEvent(t *testing.T) {
+	r, s := setupEventHandler(t)
+
+	posted := time.Now().Add(-time.Minute).UTC().Truncate(time.Second)
+	notification := fixtures.NewGenerator(1, fixtures.Devices("test123")).Next(posted)
+	assert.NoError(t, s.Create(context.Background(), &notification))
+
+	body := fmt.Sprintf(`{"key": %q, "device_id": "test123", "type": "removed", "reason": "click", "timestamp": %q}`,
+		notification.Key, posted.Add(45*time.Second).Format(time.RFC3339))
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/events", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/api/v1/notifications/%d", notification.ID), nil)
+	r.ServeHTTP(w, req)
+
+	var response models.Notification
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, "removed", response.State)
+	assert.Equal(t, "click", response.RemovalReason)
+	assert.InDelta(t, 45, *response.OnScreenSeconds, 0.001)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/api/v1/notifications/%d/events", notification.ID), nil)
+	r.ServeHTTP(w, req)
+
+	var events []models.NotificationEvent
+	err = json.Unmarshal(w.Body.Bytes(), &events)
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, "removed", events[0].Type)
+}
+
+func TestCreateEvent_Invalid(t *testing.T) {
+	r, _ := setupEventHandler(t)
+
+	for _, body := range []string{
+		`{"device_id": "test123", "type": "removed"}`,
+		`{"key": "key1", "device_id": "test123", "type": "read"}`,
+		`not json`,
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/events", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+}
+
+func TestGetEventsByDevice(t *testing.T) {
+	r, _ := setupEventHandler(t)
+
+	for _, eventType := range []string{"posted", "removed"} {
+		body := fmt.Sprintf(`{"key": "key1", "device_id": "test123", "type": %q}`, eventType)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/events", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusCreated, w.Code)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/events/device/test123?key=key1", nil)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var events []models.NotificationEvent
+	err := json.Unmarshal(w.Body.Bytes(), &events)
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lileye/backend/internal/apierror"
+	"github.com/lileye/backend/internal/export"
+	"github.com/lileye/backend/internal/middleware"
+	"github.com/lileye/backend/internal/models"
+	"github.com/lileye/backend/internal/storage"
+)
+
+// exportFlushEvery is the number of notifications written between flushes
+// of an export to the client
+const exportFlushEvery = 100
+
+// ExportHandler handles HTTP requests for notification exports
+type ExportHandler struct {
+	storage *storage.NotificationStorage
+}
+
+// NewExportHandler creates a new ExportHandler instance
+func NewExportHandler(storage *storage.NotificationStorage) *ExportHandler {
+	return &ExportHandler{storage: storage}
+}
+
+// RegisterRoutes registers the export routes with the API route group
+func (h *ExportHandler) RegisterRoutes(r gin.IRouter) {
+	r.GET("/export", middleware.Audited("notification.export"), h.Export)
+}
+
+// Export handles streaming the notifications matching a filter, oldest
+// first, as CSV, NDJSON or an HTML report
+func (h *ExportHandler) Export(c *gin.Context) {
+	format, ok := export.Lookup(c.DefaultQuery("format", "csv"))
+	if !ok {
+		apierror.Invalid(c, "format", "format must be one of "+strings.Join(export.Names(), ", "))
+		return
+	}
+
+	filter := notificationFilter(c)
+	filter.DeviceID = c.Query("device_id")
+	filter.PackageName = c.Query("package")
+	filter.Query = c.Query("q")
+	for _, bound := range []struct {
+		name string
+		dst  *time.Time
+	}{{"start", &filter.Start}, {"end", &filter.End}} {
+		if s := c.Query(bound.name); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				apierror.Invalid(c, bound.name, "invalid "+bound.name+" date format")
+				return
+			}
+			*bound.dst = t
+		}
+	}
+
+	now := time.Now()
+	device := filter.DeviceID
+	if device == "" {
+		device = "all"
+	}
+	disposition := "attachment"
+	if format.Name == "html" {
+		disposition = "inline"
+	}
+	c.Header("Content-Type", format.ContentType)
+	c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{
+		"filename": fmt.Sprintf("notifications-%s-%s.%s", device, now.Format("20060102-150405"), format.Extension),
+	}))
+	c.Status(http.StatusOK)
+
+	// Large exports outlast the server's write timeout
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	w, err := format.NewWriter(c.Writer, export.Report{Generated: now, Filters: exportFilters(c)})
+	count := 0
+	if err == nil {
+		err = h.storage.Each(c.Request.Context(), filter, func(n *models.Notification) error {
+			if err := w.Write(n); err != nil {
+				return err
+			}
+			if count++; count%exportFlushEvery == 0 {
+				if err := w.Flush(); err != nil {
+					return err
+				}
+				c.Writer.Flush()
+			}
+			return nil
+		})
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	// The status has been sent, so a failed export can only be cut short
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Export failed", "format", format.Name, "written", count, "error", err)
+	}
+}
+
+// exportFilters lists the filter query parameters of an export for the
+// report header
+func exportFilters(c *gin.Context) []export.Filter {
+	params := []struct{ key, name string }{
+		{"device_id", "Device"},
+		{"package", "App"},
+		{"start", "From"},
+		{"end", "Until"},
+		{"q", "Search"},
+		{"app_category", "App category"},
+		{"category", "Category"},
+		{"channel_id", "Channel"},
+		{"sub_text", "Sub text"},
+		{"conversation_title", "Conversation"},
+		{"person", "Person"},
+	}
+	var filters []export.Filter
+	for _, p := range params {
+		if v := c.Query(p.key); v != "" {
+			filters = append(filters, export.Filter{Name: p.name, Value: v})
+		}
+	}
+	return filters
+}
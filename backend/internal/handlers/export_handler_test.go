@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lileye/backend/internal/fixtures"
+	"github.com/lileye/backend/internal/models"
+	"github.com/lileye/backend/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupExportHandler(t *testing.T) (*gin.Engine, *fixtures.Dataset) {
+	r, db := setupTest(t)
+	NewExportHandler(storage.NewNotificationStorage(db)).RegisterRoutes(r.Group("/api/v1"))
+
+	ds := storeFixtures(t, db, fixtures.Options{Seed: 1, Devices: fixtures.Devices("device1", "device2"), End: fixturesEnd, Days: 2, PerDay: 40})
+	return r, ds
+}
+
+func TestExport(t *testing.T) {
+	r, ds := setupExportHandler(t)
+
+	// The notifications of device1 in the last afternoon, and those of
+	// device2 about a meeting
+	start, end := fixturesEnd.Add(-6*time.Hour), fixturesEnd
+	var afternoon, meetings []models.Notification
+	for _, n := range ds.Notifications {
+		if n.DeviceID == "device1" && !n.Timestamp.Before(start) && !n.Timestamp.After(end) {
+			afternoon = append(afternoon, n)
+		}
+		if n.DeviceID == "device2" && strings.Contains(strings.ToLower(n.Title+"\n"+n.Message+"\n"+n.From), "meeting") {
+			meetings = append(meetings, n)
+		}
+	}
+	if len(afternoon) == 0 || len(meetings) == 0 {
+		t.Fatal("the fixtures have nothing to export")
+	}
+
+	w := httptest.NewRecorder()
+	query := url.Values{"device_id": {"device1"}, "start": {start.Format(time.RFC3339)}, "end": {end.Format(time.RFC3339)}}
+	req, _ := http.NewRequest("GET", "/api/v1/export?"+query.Encode(), nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Regexp(t, `^attachment; filename=notifications-device1-\d{8}-\d{6}\.csv$`, w.Header().Get("Content-Disposition"))
+	records, err := csv.NewReader(w.Body).ReadAll()
+	assert.NoError(t, err)
+	// A header, then the notifications oldest first
+	if assert.Len(t, records, 1+len(afternoon)) {
+		assert.Equal(t, afternoon[0].Timestamp.Format(time.RFC3339), records[1][1])
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/v1/export?format=ndjson", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	assert.Equal(t, len(ds.Notifications), strings.Count(w.Body.String(), "\n"))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/v1/export?format=html&device_id=device2&q=meeting", nil)
+	r.ServeHTTP(w, req)
+	assert.True(t, strings.HasPrefix(w.Header().Get("Content-Disposition"), "inline;"))
+	assert.Contains(t, w.Body.String(), "<dt>Search</dt><dd>meeting</dd>")
+	footer := fmt.Sprintf("<footer>%d notifications. End of report.</footer>\n</body>\n</html>\n", len(meetings))
+	assert.True(t, strings.HasSuffix(w.Body.String(), footer))
+}
+
+func TestExportInvalidParameters(t *testing.T) {
+	r, _ := setupExportHandler(t)
+
+	for _, query := range []string{"format=xlsx", "start=yesterday", "end=2026-10-19"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/export?"+query, nil)
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lileye/backend/internal/health"
+	"github.com/lileye/backend/internal/models"
+	"github.com/lileye/backend/internal/version"
+)
+
+// readyTimeout bounds the database checks of a readiness probe
+const readyTimeout = 2 * time.Second
+
+// HealthHandler handles liveness, readiness and version probes
+type HealthHandler struct {
+	checker *health.Checker
+}
+
+// NewHealthHandler creates a new HealthHandler instance
+func NewHealthHandler(checker *health.Checker) *HealthHandler {
+	return &HealthHandler{checker: checker}
+}
+
+// RegisterRoutes registers the probe routes with the Gin engine
+func (h *HealthHandler) RegisterRoutes(r *gin.Engine) {
+	r.GET("/healthz", h.Healthz)
+	r.GET("/readyz", h.Readyz)
+	r.GET("/version", h.Version)
+}
+
+// Healthz reports that the process is up and serving requests
+func (h *HealthHandler) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, models.HealthStatus{Status: "ok"})
+}
+
+// Readyz reports whether the server can take traffic
+func (h *HealthHandler) Readyz(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readyTimeout)
+	defer cancel()
+
+	report := h.checker.Ready(ctx)
+	status := http.StatusOK
+	if !report.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
+
+// Version returns the build information of the server
+func (h *HealthHandler) Version(c *gin.Context) {
+	c.JSON(http.StatusOK, version.Get())
+}
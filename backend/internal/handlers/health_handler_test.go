@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lileye/backend/internal/health"
+	"github.com/lileye/backend/internal/models"
+	"github.com/lileye/backend/internal/version"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func setupHealthHandler(t *testing.T) (*gin.Engine, *gorm.DB, *health.Checker) {
+	r, db := setupTest(t)
+	checker := health.NewChecker(db)
+	NewHealthHandler(checker).RegisterRoutes(r)
+
+	return r, db, checker
+}
+
+func getReady(t *testing.T, r *gin.Engine) (int, models.HealthReport) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/readyz", nil)
+	r.ServeHTTP(w, req)
+
+	var report models.HealthReport
+	err := json.Unmarshal(w.Body.Bytes(), &report)
+	assert.NoError(t, err)
+	return w.Code, report
+}
+
+func TestHealthz(t *testing.T) {
+	r, _, _ := setupHealthHandler(t)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/healthz", nil)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "ok")
+}
+
+func TestReadyz(t *testing.T) {
+	r, _, checker := setupHealthHandler(t)
+	worker := checker.Worker("cleanup")
+	worker.Ran(errors.New("disk full"))
+
+	code, report := getReady(t, r)
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, report.Ready)
+	assert.Len(t, report.Checks, 2)
+	assert.Len(t, report.Workers, 1)
+	assert.Equal(t, models.WorkerRunning, report.Workers[0].State)
+	assert.Equal(t, int64(1), report.Workers[0].Runs)
+	assert.Equal(t, "last run failed; see the server log", report.Workers[0].LastError)
+
+	worker.Stopped()
+	checker.Drain()
+	code, report = getReady(t, r)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.False(t, report.Ready)
+	assert.True(t, report.Draining)
+	assert.Equal(t, models.WorkerStopped, report.Workers[0].State)
+}
+
+func TestReadyzFailures(t *testing.T) {
+	r, db, _ := setupHealthHandler(t)
+
+	err := db.Migrator().DropTable(&models.Alert{})
+	assert.NoError(t, err)
+
+	code, report := getReady(t, r)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "migrations", report.Checks[1].Name)
+	assert.False(t, report.Checks[1].OK)
+	assert.Equal(t, "database schema is not up to date", report.Checks[1].Error)
+
+	sqlDB, err := db.DB()
+	assert.NoError(t, err)
+	sqlDB.Close()
+
+	code, report = getReady(t, r)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "database", report.Checks[0].Name)
+	assert.False(t, report.Checks[0].OK)
+	assert.Equal(t, "database is unreachable", report.Checks[0].Error)
+}
+
+func TestVersion(t *testing.T) {
+	r, _, _ := setupHealthHandler(t)
+	version.Version = "1.2.3"
+	defer func() { version.Version = "dev" }()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/version", nil)
+	r.ServeHTTP(w, req)
+
+	var info version.Info
+	err := json.Unmarshal(w.Body.Bytes(), &info)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1.2.3", info.Version)
+	assert.NotEmpty(t, info.GoVersion)
+}
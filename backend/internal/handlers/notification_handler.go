@@ -1,76 +1,214 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/lileye/backend/internal/apierror"
+	"github.com/lileye/backend/internal/metrics"
+	"github.com/lileye/backend/internal/middleware"
 	"github.com/lileye/backend/internal/models"
 	"github.com/lileye/backend/internal/storage"
+	"github.com/lileye/backend/internal/throttle"
+	"github.com/lileye/backend/internal/validation"
+	"golang.org/x/net/websocket"
+	"gorm.io/gorm"
 )
 
 // NotificationHandler handles HTTP requests for notifications
 type NotificationHandler struct {
-	storage *storage.NotificationStorage
+	storage   *storage.NotificationStorage
+	validator *validation.Validator
+	dedup     *throttle.Dedup
+
+	// Open WebSocket streams, which the HTTP server does not track
+	mu       sync.Mutex
+	streams  map[*websocket.Conn]bool
+	running  sync.WaitGroup
+	draining bool
 }
 
-// NewNotificationHandler creates a new NotificationHandler instance
-func NewNotificationHandler(storage *storage.NotificationStorage) *NotificationHandler {
-	return &NotificationHandler{storage: storage}
+// NewNotificationHandler creates a new NotificationHandler instance.
+// Notifications sent by devices are checked and normalized by validator,
+// and those repeating one stored recently are dropped by dedup, when not
+// nil.
+func NewNotificationHandler(storage *storage.NotificationStorage, validator *validation.Validator, dedup *throttle.Dedup) *NotificationHandler {
+	return &NotificationHandler{
+		storage:   storage,
+		validator: validator,
+		dedup:     dedup,
+		streams:   map[*websocket.Conn]bool{},
+	}
 }
 
-// RegisterRoutes registers the notification routes with the Gin engine
-func (h *NotificationHandler) RegisterRoutes(r *gin.Engine) {
-	r.POST("/api/notifications", h.CreateNotification)
-	r.GET("/api/notifications/:id", h.GetNotification)
-	r.GET("/api/notifications/device/:deviceID", h.GetNotificationsByDevice)
-	r.GET("/api/notifications/device/:deviceID/range", h.GetNotificationsByDateRange)
-	r.GET("/api/notifications/device/:deviceID/search", h.SearchNotifications)
-	r.GET("/api/devices", h.GetDevices)
-	r.DELETE("/api/notifications/all", h.DeleteAllNotifications)
+// RegisterRoutes registers the notification routes with the API route group
+func (h *NotificationHandler) RegisterRoutes(r gin.IRouter) {
+	r.POST("/notifications", h.CreateNotification)
+	r.POST("/notifications/batch", h.CreateNotifications)
+	r.GET("/notifications/stream", h.StreamNotifications)
+	r.GET("/notifications/:id", middleware.Audited("notification.read"), h.GetNotification)
+	r.GET("/notifications/device/:deviceID", middleware.Audited("notification.list"), h.GetNotificationsByDevice)
+	r.GET("/notifications/device/:deviceID/range", middleware.Audited("notification.list"), h.GetNotificationsByDateRange)
+	r.GET("/notifications/device/:deviceID/search", middleware.Audited("notification.search"), h.SearchNotifications)
+	r.GET("/devices", middleware.Audited("device.list"), h.GetDevices)
+	r.DELETE("/notifications/all", middleware.Audited("notification.delete_all"), h.DeleteAllNotifications)
 }
 
-// CreateNotification handles the creation of a new notification
+// CreateNotification handles the creation of a new notification. A repeat
+// of a notification stored recently is not stored again; the stored one is
+// returned with 200 instead. A body larger than the configured limit is
+// refused with 413 before it is read to the end.
 func (h *NotificationHandler) CreateNotification(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.validator.MaxBody())
 	var notification models.Notification
 	if err := c.ShouldBindJSON(&notification); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apierror.Binding(c, err)
+		return
+	}
+	if fields := h.validator.Notification(&notification); len(fields) > 0 {
+		apierror.Abort(c, http.StatusBadRequest, "invalid notification", fields...)
+		return
+	}
+	if !middleware.AllowDevice(c, notification.DeviceID, 1) {
 		return
 	}
 
-	if err := h.storage.Create(&notification); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	created, err := h.store(c.Request.Context(), &notification)
+	if err != nil {
+		apierror.Internal(c, err)
+		return
+	}
+	if !created {
+		c.JSON(http.StatusOK, notification)
 		return
 	}
 
 	c.JSON(http.StatusCreated, notification)
 }
 
+// store stores a valid notification and reports true, unless it repeats a
+// notification stored recently, which then replaces it
+func (h *NotificationHandler) store(ctx context.Context, notification *models.Notification) (bool, error) {
+	if h.dedup != nil {
+		id, ok, err := h.dedup.Seen(ctx, notification)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			stored, err := h.storage.GetByID(ctx, id)
+			if err == nil {
+				metrics.DuplicatesSuppressed.Inc()
+				*notification = *stored
+				return false, nil
+			}
+			// The stored notification was deleted since, so store this one
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return false, err
+			}
+		}
+	}
+
+	if err := h.storage.Create(ctx, notification); err != nil {
+		if h.dedup != nil {
+			h.dedup.Forget(notification)
+		}
+		return false, err
+	}
+	if h.dedup != nil {
+		h.dedup.Stored(notification)
+	}
+	return true, nil
+}
+
+// maxBatch is the largest number of notifications accepted in one batch
+const maxBatch = 500
+
+// CreateNotifications handles the creation of several notifications at once,
+// such as those a device queued while offline. Repeats, of notifications
+// stored recently or earlier in the batch, are left out, so the response
+// holds the notifications stored. A body larger than the configured limit
+// is refused with 413.
+func (h *NotificationHandler) CreateNotifications(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.validator.MaxBody())
+	var notifications []models.Notification
+	if err := c.ShouldBindJSON(&notifications); err != nil {
+		apierror.Binding(c, err)
+		return
+	}
+	if len(notifications) == 0 || len(notifications) > maxBatch {
+		apierror.Abort(c, http.StatusBadRequest, fmt.Sprintf("a batch holds 1 to %d notifications", maxBatch))
+		return
+	}
+	if fields := h.validator.Notifications(notifications); len(fields) > 0 {
+		apierror.Abort(c, http.StatusBadRequest, "invalid notifications", fields...)
+		return
+	}
+	perDevice := map[string]int{}
+	for _, n := range notifications {
+		perDevice[n.DeviceID]++
+	}
+	if !middleware.AllowDevices(c, perDevice) {
+		return
+	}
+
+	if h.dedup != nil {
+		fresh := h.dedup.Fresh(notifications)
+		metrics.DuplicatesSuppressed.Add(float64(len(notifications) - len(fresh)))
+		notifications = fresh
+	}
+	if len(notifications) > 0 {
+		if err := h.storage.CreateBatch(c.Request.Context(), notifications); err != nil {
+			if h.dedup != nil {
+				for i := range notifications {
+					h.dedup.Forget(&notifications[i])
+				}
+			}
+			apierror.Internal(c, err)
+			return
+		}
+	}
+	if h.dedup != nil {
+		for i := range notifications {
+			h.dedup.Stored(&notifications[i])
+		}
+	}
+
+	c.JSON(http.StatusCreated, notifications)
+}
+
 // GetNotification handles retrieving a notification by ID
 func (h *NotificationHandler) GetNotification(c *gin.Context) {
 	id := c.Param("id")
 	var idUint uint
 	if _, err := fmt.Sscanf(id, "%d", &idUint); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id format"})
+		apierror.Invalid(c, "id", "invalid id format")
 		return
 	}
 
-	notification, err := h.storage.GetByID(idUint)
+	notification, err := h.storage.GetByID(c.Request.Context(), idUint)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		apierror.NotFound(c, "notification not found")
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "notification not found"})
+		apierror.Internal(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, notification)
 }
 
-// GetNotificationsByDevice handles retrieving notifications for a specific device
+// GetNotificationsByDevice handles retrieving notifications for a specific
+// device, optionally filtered by app category or notification extras
 func (h *NotificationHandler) GetNotificationsByDevice(c *gin.Context) {
-	deviceID := c.Param("deviceID")
-	notifications, err := h.storage.GetByDeviceID(deviceID)
+	notifications, err := h.storage.Find(c.Request.Context(), notificationFilter(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		apierror.Internal(c, err)
 		return
 	}
 
@@ -79,25 +217,27 @@ func (h *NotificationHandler) GetNotificationsByDevice(c *gin.Context) {
 
 // GetNotificationsByDateRange handles retrieving notifications within a date range
 func (h *NotificationHandler) GetNotificationsByDateRange(c *gin.Context) {
-	deviceID := c.Param("deviceID")
 	startStr := c.Query("start")
 	endStr := c.Query("end")
 
 	start, err := time.Parse(time.RFC3339, startStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid start date format"})
+		apierror.Invalid(c, "start", "invalid start date format")
 		return
 	}
 
 	end, err := time.Parse(time.RFC3339, endStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid end date format"})
+		apierror.Invalid(c, "end", "invalid end date format")
 		return
 	}
 
-	notifications, err := h.storage.GetByDateRange(deviceID, start, end)
+	filter := notificationFilter(c)
+	filter.Start = start
+	filter.End = end
+	notifications, err := h.storage.Find(c.Request.Context(), filter)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		apierror.Internal(c, err)
 		return
 	}
 
@@ -106,28 +246,43 @@ func (h *NotificationHandler) GetNotificationsByDateRange(c *gin.Context) {
 
 // SearchNotifications handles searching notifications
 func (h *NotificationHandler) SearchNotifications(c *gin.Context) {
-	deviceID := c.Param("deviceID")
 	query := c.Query("q")
 
 	if query == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "search query is required"})
+		apierror.Invalid(c, "q", "search query is required")
 		return
 	}
 
-	notifications, err := h.storage.Search(deviceID, query)
+	filter := notificationFilter(c)
+	filter.Query = query
+	notifications, err := h.storage.Find(c.Request.Context(), filter)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		apierror.Internal(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, notifications)
 }
 
+// notificationFilter builds a filter from the device ID parameter and the
+// optional filter query parameters shared by the notification list endpoints
+func notificationFilter(c *gin.Context) storage.NotificationFilter {
+	return storage.NotificationFilter{
+		DeviceID:          c.Param("deviceID"),
+		AppCategory:       c.Query("app_category"),
+		Category:          c.Query("category"),
+		ChannelID:         c.Query("channel_id"),
+		SubText:           c.Query("sub_text"),
+		ConversationTitle: c.Query("conversation_title"),
+		Person:            c.Query("person"),
+	}
+}
+
 // GetDevices handles retrieving all unique device IDs
 func (h *NotificationHandler) GetDevices(c *gin.Context) {
-	devices, err := h.storage.GetDevices()
+	devices, err := h.storage.GetDevices(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		apierror.Internal(c, err)
 		return
 	}
 
@@ -136,10 +291,10 @@ func (h *NotificationHandler) GetDevices(c *gin.Context) {
 
 // DeleteAllNotifications handles deleting all notifications
 func (h *NotificationHandler) DeleteAllNotifications(c *gin.Context) {
-	if err := h.storage.DeleteAll(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.storage.DeleteAll(c.Request.Context()); err != nil {
+		apierror.Internal(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "All notifications deleted successfully"})
+	c.JSON(http.StatusOK, models.Message{Message: "All notifications deleted successfully"})
 } 
\ No newline at end of file
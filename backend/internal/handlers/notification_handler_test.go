@@ -2,35 +2,39 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/lileye/backend/internal/config"
+	"github.com/lileye/backend/internal/fixtures"
+	"github.com/lileye/backend/internal/logging"
+	"github.com/lileye/backend/internal/middleware"
 	"github.com/lileye/backend/internal/models"
 	"github.com/lileye/backend/internal/storage"
+	"github.com/lileye/backend/internal/throttle"
+	"github.com/lileye/backend/internal/validation"
 	"github.com/stretchr/testify/assert"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
-func setupTestHandler(t *testing.T) (*gin.Engine, *NotificationHandler) {
-	gin.SetMode(gin.TestMode)
-	
-	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-	assert.NoError(t, err)
-
-	err = db.AutoMigrate(&models.Notification{})
-	assert.NoError(t, err)
+// testValidator checks notifications with the default limits
+func testValidator() *validation.Validator {
+	return validation.New(config.Default().Validation)
+}
 
-	storage := storage.NewNotificationStorage(db)
-	handler := NewNotificationHandler(storage)
-	
-	r := gin.Default()
-	handler.RegisterRoutes(r)
+func setupTestHandler(t *testing.T) (*gin.Engine, *NotificationHandler) {
+	r, db := setupTest(t)
+	handler := NewNotificationHandler(storage.NewNotificationStorage(db), testValidator(), nil)
+	handler.RegisterRoutes(r.Group("/api/v1"))
 
 	return r, handler
 }
@@ -51,7 +55,7 @@ func TestCreateNotification(t *testing.T) {
 	assert.NoError(t, err)
 
 	w := httptest.NewRecorder()
-	req, _ := http.NewRequest("POST", "/api/notifications", bytes.NewBuffer(body))
+	req, _ := http.NewRequest("POST", "/api/v1/notifications", bytes.NewBuffer(body))
 	req.Header.Set("Content-Type", "application/json")
 	r.ServeHTTP(w, req)
 
@@ -64,6 +68,44 @@ func TestCreateNotification(t *testing.T) {
 	assert.Equal(t, notification.Title, response.Title)
 }
 
+func TestCreateNotifications(t *testing.T) {
+	r, h := setupTestHandler(t)
+	send := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/notifications/batch", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	w := send(`[{"title":"Hi","message":"Lunch?","timestamp":"` + now + `","from":"Alice","package_name":"com.whatsapp","device_id":"test123"},
+		{"title":"Hello","message":"Yes","timestamp":"` + now + `","from":"Bob","package_name":"com.whatsapp","device_id":"test123"}]`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var response []models.Notification
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response, 2)
+	assert.NotZero(t, response[1].ID)
+
+	stored, err := h.storage.GetByDeviceID(context.Background(), "test123")
+	assert.NoError(t, err)
+	assert.Len(t, stored, 2)
+
+	assert.Equal(t, http.StatusBadRequest, send(`[]`).Code)
+	assert.Equal(t, http.StatusBadRequest, send(`{"title":"Hi"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, send("["+strings.Repeat(`{},`, maxBatch)+`{}]`).Code)
+
+	// Invalid fields are named after the index of their notification
+	w = send(`[{"title":"Hi","message":"Lunch?","timestamp":"` + now + `","package_name":"com.whatsapp","device_id":"test123"},
+		{"title":"Hi","message":"Lunch?","timestamp":"` + now + `","package_name":"whatsapp","device_id":"test123"}]`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var errResponse models.ErrorResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &errResponse))
+	if assert.Len(t, errResponse.Error.Fields, 1) {
+		assert.Equal(t, "[1].package_name", errResponse.Error.Fields[0].Field)
+	}
+}
+
 func TestGetNotification(t *testing.T) {
 	r, h := setupTestHandler(t)
 
@@ -76,11 +118,11 @@ func TestGetNotification(t *testing.T) {
 		From:        "Test User",
 		DeviceID:    "test123",
 	}
-	err := h.storage.Create(&notification)
+	err := h.storage.Create(context.Background(), &notification)
 	assert.NoError(t, err)
 
 	w := httptest.NewRecorder()
-	req, _ := http.NewRequest("GET", fmt.Sprintf("/api/notifications/%d", notification.ID), nil)
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/api/v1/notifications/%d", notification.ID), nil)
 	r.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusOK, w.Code)
@@ -95,40 +137,33 @@ func TestGetNotification(t *testing.T) {
 func TestGetNotificationsByDevice(t *testing.T) {
 	r, h := setupTestHandler(t)
 
-	// Create test notifications
-	deviceID := "test123"
-	notification1 := models.Notification{
-		Title:       "Test Title 1",
-		Message:     "Test Message 1",
-		Timestamp:   time.Now(),
-		PackageName: "com.test.app",
-		From:        "Test User",
-		DeviceID:    deviceID,
+	ds := fixtures.Generate(fixtures.Options{Seed: 1, Devices: fixtures.Devices("test123", "other"),
+		End: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC), Days: 1, PerDay: 10})
+	expected := 0
+	for i := range ds.Notifications {
+		err := h.storage.Create(context.Background(), &ds.Notifications[i])
+		assert.NoError(t, err)
+		if ds.Notifications[i].DeviceID == "test123" {
+			expected++
+		}
 	}
-	err := h.storage.Create(&notification1)
-	assert.NoError(t, err)
-
-	notification2 := models.Notification{
-		Title:       "Test Title 2",
-		Message:     "Test Message 2",
-		Timestamp:   time.Now(),
-		PackageName: "com.test.app",
-		From:        "Test User",
-		DeviceID:    deviceID,
-	}
-	err = h.storage.Create(&notification2)
-	assert.NoError(t, err)
 
 	w := httptest.NewRecorder()
-	req, _ := http.NewRequest("GET", fmt.Sprintf("/api/notifications/device/%s", deviceID), nil)
+	req, _ := http.NewRequest("GET", "/api/v1/notifications/device/test123", nil)
 	r.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusOK, w.Code)
 
 	var response []models.Notification
-	err = json.Unmarshal(w.Body.Bytes(), &response)
+	err := json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(t, err)
-	assert.Len(t, response, 2)
+	// The fixture has to put notifications on the device for this to check
+	// anything
+	assert.NotZero(t, expected)
+	assert.Len(t, response, expected)
+	for _, n := range response {
+		assert.Equal(t, "test123", n.DeviceID)
+	}
 }
 
 func TestGetNotificationsByDateRange(t *testing.T) {
@@ -144,14 +179,14 @@ func TestGetNotificationsByDateRange(t *testing.T) {
 		From:        "Test User",
 		DeviceID:    deviceID,
 	}
-	err := h.storage.Create(&notification)
+	err := h.storage.Create(context.Background(), &notification)
 	assert.NoError(t, err)
 
 	start := now.Add(-time.Hour).Format(time.RFC3339)
 	end := now.Add(time.Hour).Format(time.RFC3339)
 
 	w := httptest.NewRecorder()
-	req, _ := http.NewRequest("GET", fmt.Sprintf("/api/notifications/device/%s/range?start=%s&end=%s", deviceID, start, end), nil)
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/api/v1/notifications/device/%s/range?start=%s&end=%s", deviceID, start, end), nil)
 	r.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusOK, w.Code)
@@ -174,11 +209,11 @@ func TestSearchNotifications(t *testing.T) {
 		From:        "Test User",
 		DeviceID:    deviceID,
 	}
-	err := h.storage.Create(&notification)
+	err := h.storage.Create(context.Background(), &notification)
 	assert.NoError(t, err)
 
 	w := httptest.NewRecorder()
-	req, _ := http.NewRequest("GET", fmt.Sprintf("/api/notifications/device/%s/search?q=Test", deviceID), nil)
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/api/v1/notifications/device/%s/search?q=Test", deviceID), nil)
 	r.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusOK, w.Code)
@@ -193,38 +228,248 @@ func TestGetDevices(t *testing.T) {
 	r, h := setupTestHandler(t)
 
 	// Create notifications for different devices
-	notification1 := models.Notification{
-		Title:       "Test Title 1",
-		Message:     "Test Message 1",
-		Timestamp:   time.Now(),
-		PackageName: "com.test.app",
-		From:        "Test User",
-		DeviceID:    "device1",
+	ds := fixtures.Generate(fixtures.Options{Seed: 1, Devices: fixtures.Devices("device1", "device2"),
+		End: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC), Days: 1, PerDay: 20})
+	devices := map[string]bool{}
+	for i := range ds.Notifications {
+		err := h.storage.Create(context.Background(), &ds.Notifications[i])
+		assert.NoError(t, err)
+		devices[ds.Notifications[i].DeviceID] = true
 	}
-	err := h.storage.Create(&notification1)
-	assert.NoError(t, err)
-
-	notification2 := models.Notification{
-		Title:       "Test Title 2",
-		Message:     "Test Message 2",
-		Timestamp:   time.Now(),
-		PackageName: "com.test.app",
-		From:        "Test User",
-		DeviceID:    "device2",
-	}
-	err = h.storage.Create(&notification2)
-	assert.NoError(t, err)
+	// The fixture puts notifications on both devices
+	assert.Len(t, devices, 2)
 
 	w := httptest.NewRecorder()
-	req, _ := http.NewRequest("GET", "/api/devices", nil)
+	req, _ := http.NewRequest("GET", "/api/v1/devices", nil)
 	r.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusOK, w.Code)
 
 	var response []string
-	err = json.Unmarshal(w.Body.Bytes(), &response)
+	err := json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(t, err)
 	assert.Len(t, response, 2)
 	assert.Contains(t, response, "device1")
 	assert.Contains(t, response, "device2")
-} 
\ No newline at end of file
+}
+
+func TestCreateNotificationWithExtras(t *testing.T) {
+	r, _ := setupTestHandler(t)
+
+	body := `{
+		"title": "Family",
+		"message": "Dinner is ready",
+		"timestamp": "2024-03-01T18:00:00Z",
+		"package_name": "com.whatsapp",
+		"from": "Mum",
+		"device_id": "test123",
+		"extras": {
+			"android.conversationTitle": "Family",
+			"android.subText": "2 new messages",
+			"category": "msg"
+		}
+	}`
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/notifications", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/v1/notifications/device/test123?category=msg", nil)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response []models.Notification
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Len(t, response, 1)
+	assert.Equal(t, "Family", response[0].ConversationTitle)
+	assert.Equal(t, "2 new messages", response[0].SubText)
+	assert.Equal(t, "Family", response[0].Extras["android.conversationTitle"])
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/v1/notifications/device/test123?category=other", nil)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[]`, w.Body.String())
+}
+
+func TestInternalErrorIncludesRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	sqlDB, err := db.DB()
+	assert.NoError(t, err)
+	sqlDB.Close()
+
+	r := gin.New()
+	r.Use(middleware.RequestID())
+	NewNotificationHandler(storage.NewNotificationStorage(db), testValidator(), nil).RegisterRoutes(r.Group("/api/v1"))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/devices", nil)
+	req.Header.Set(middleware.RequestIDHeader, "req-42")
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	var response models.ErrorResponse
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, models.CodeInternal, response.Error.Code)
+	assert.Equal(t, "req-42", response.Error.RequestID)
+	// The cause is logged, not sent
+	assert.NotContains(t, w.Body.String(), "closed")
+}
+
+func TestQueriesAreLoggedWithRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var buf bytes.Buffer
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: logging.NewGormLogger(logging.New(&buf, slog.LevelDebug)),
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, storage.Migrate(db))
+	buf.Reset()
+
+	r := gin.New()
+	r.Use(middleware.RequestID())
+	NewNotificationHandler(storage.NewNotificationStorage(db), testValidator(), nil).RegisterRoutes(r.Group("/api/v1"))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/devices", nil)
+	req.Header.Set(middleware.RequestIDHeader, "req-43")
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, buf.String(), "SELECT DISTINCT")
+	assert.Contains(t, buf.String(), `"request_id":"req-43"`)
+}
+
+func TestGetNotificationTellsNotFoundFromFailure(t *testing.T) {
+	r, _ := setupTestHandler(t)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/notifications/42", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	var response models.ErrorResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, models.CodeNotFound, response.Error.Code)
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	sqlDB, err := db.DB()
+	assert.NoError(t, err)
+	sqlDB.Close()
+	r = gin.New()
+	NewNotificationHandler(storage.NewNotificationStorage(db), testValidator(), nil).RegisterRoutes(r.Group("/api/v1"))
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestBindingErrorsListFields(t *testing.T) {
+	r, _ := setupTestHandler(t)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/notifications", bytes.NewBufferString(`{"title": 42}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var response models.ErrorResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, models.CodeInvalidRequest, response.Error.Code)
+	assert.Equal(t, []models.FieldError{{Field: "title", Message: "must be a string"}}, response.Error.Fields)
+}
+
+func TestCreateNotification_BodyTooLarge(t *testing.T) {
+	r, h := setupTestHandler(t)
+	send := func(path string, size int64) *httptest.ResponseRecorder {
+		body := `{"title":"` + strings.Repeat("x", int(size)-len(`{"title":""}`)) + `"}`
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// The body is refused while it is read, whatever it holds
+	limit := h.validator.MaxBody()
+	assert.Equal(t, int64(4<<20), limit)
+	for _, path := range []string{"/api/v1/notifications", "/api/v1/notifications/batch"} {
+		w := send(path, limit+1)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code, path)
+		var response models.ErrorResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, models.CodePayloadTooLarge, response.Error.Code)
+		assert.Equal(t, fmt.Sprintf("request body must be at most %d bytes", limit), response.Error.Message)
+	}
+
+	// A body within the limit is read and validated
+	assert.Equal(t, http.StatusBadRequest, send("/api/v1/notifications", limit).Code)
+}
+
+func TestRepeatedNotificationsAreStoredOnce(t *testing.T) {
+	r, db := setupTest(t)
+	notifications := storage.NewNotificationStorage(db)
+	NewNotificationHandler(notifications, testValidator(), throttle.NewDedup(time.Minute)).RegisterRoutes(r.Group("/api/v1"))
+
+	send := func(path string, body any) *httptest.ResponseRecorder {
+		data, err := json.Marshal(body)
+		assert.NoError(t, err)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", path, bytes.NewBuffer(data))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w
+	}
+	notification := models.Notification{
+		Title:       "Family",
+		Message:     "Dinner at 7",
+		Timestamp:   time.Now(),
+		PackageName: "com.whatsapp",
+		DeviceID:    "phone1",
+	}
+
+	w := send("/api/v1/notifications", notification)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var first models.Notification
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &first))
+
+	// The repeat returns the stored notification
+	w = send("/api/v1/notifications", notification)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var repeat models.Notification
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &repeat))
+	assert.Equal(t, first.ID, repeat.ID)
+
+	// A batch leaves out the repeats
+	other := notification
+	other.Message = "Dinner at 8"
+	w = send("/api/v1/notifications/batch", []models.Notification{notification, other, other})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var stored []models.Notification
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &stored))
+	assert.Len(t, stored, 1)
+	assert.Equal(t, "Dinner at 8", stored[0].Message)
+
+	// The same message posted again later is another notification
+	again := notification
+	again.Timestamp = notification.Timestamp.Add(time.Minute)
+	w = send("/api/v1/notifications", again)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var count int64
+	assert.NoError(t, db.Model(&models.Notification{}).Count(&count).Error)
+	assert.Equal(t, int64(3), count)
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lileye/backend/internal/apierror"
+	"github.com/lileye/backend/internal/middleware"
+	"github.com/lileye/backend/internal/models"
+	"golang.org/x/net/websocket"
+)
+
+// streamIdle is how long a stream stays open without a message
+const streamIdle = 5 * time.Minute
+
+// streamWrite bounds the time a reply takes to send
+const streamWrite = 10 * time.Second
+
+// StreamNotifications handles a WebSocket stream of notifications, for
+// devices that send many and would rather keep one connection open. Each
+// message holds one notification, which is stored as by CreateNotification
+// and answered with a models.StreamReply, in order. A stream closes after
+// streamIdle without a message, and when the server drains.
+func (h *NotificationHandler) StreamNotifications(c *gin.Context) {
+	if !strings.EqualFold(c.GetHeader("Upgrade"), "websocket") {
+		c.Header("Upgrade", "websocket")
+		apierror.Abort(c, http.StatusUpgradeRequired, "this route takes WebSocket connections")
+		return
+	}
+	websocket.Server{
+		Handshake: sameOrigin,
+		Handler:   func(conn *websocket.Conn) { h.stream(c, conn) },
+	}.ServeHTTP(c.Writer, c.Request)
+}
+
+// sameOrigin accepts devices, which send no Origin header, and pages of
+// the server itself, but not pages of other sites open in a browser
+func sameOrigin(cfg *websocket.Config, req *http.Request) error {
+	if req.Header.Get("Origin") == "" {
+		return nil
+	}
+	origin, err := websocket.Origin(cfg, req)
+	if err != nil {
+		return err
+	}
+	if origin == nil || origin.Host != req.Host {
+		return errors.New("the stream does not accept other origins")
+	}
+	return nil
+}
+
+// stream answers the messages of a stream until it is closed, idle or
+// drained
+func (h *NotificationHandler) stream(c *gin.Context, conn *websocket.Conn) {
+	h.track(conn)
+	defer h.untrack(conn)
+	defer conn.Close()
+	conn.MaxPayloadBytes = int(h.validator.MaxBody())
+	// The deadlines the server set for the handshake no longer apply
+	conn.SetDeadline(time.Time{})
+
+	for h.await(conn) {
+		var reply models.StreamReply
+		var data []byte
+		err := websocket.Message.Receive(conn, &data)
+		switch {
+		case errors.Is(err, websocket.ErrFrameTooLarge):
+			reply = streamError(http.StatusRequestEntityTooLarge, apierror.New(c.Request.Context(),
+				http.StatusRequestEntityTooLarge, fmt.Sprintf("message must be at most %d bytes", conn.MaxPayloadBytes)))
+		case err != nil:
+			return
+		default:
+			reply = h.streamed(c, data)
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(streamWrite))
+		if err := websocket.JSON.Send(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+// streamed stores a notification received on a stream, with the checks of
+// CreateNotification
+func (h *NotificationHandler) streamed(c *gin.Context, data []byte) models.StreamReply {
+	ctx := c.Request.Context()
+	var notification models.Notification
+	if err := json.Unmarshal(data, &notification); err != nil {
+		return streamError(apierror.BindingError(ctx, err))
+	}
+	if fields := h.validator.Notification(&notification); len(fields) > 0 {
+		return streamError(http.StatusBadRequest, apierror.New(ctx, http.StatusBadRequest, "invalid notification", fields...))
+	}
+	if ok, wait := middleware.TakeDevice(c, notification.DeviceID); !ok {
+		return streamError(http.StatusTooManyRequests, apierror.New(ctx, http.StatusTooManyRequests,
+			fmt.Sprintf("too many requests from this device; retry in %s", wait)))
+	}
+
+	created, err := h.store(ctx, &notification)
+	if err != nil {
+		return streamError(http.StatusInternalServerError, apierror.InternalError(ctx, c.FullPath(), err))
+	}
+	status := http.StatusCreated
+	if !created {
+		status = http.StatusOK
+	}
+	return models.StreamReply{Status: status, Notification: &notification}
+}
+
+func streamError(status int, err models.APIError) models.StreamReply {
+	return models.StreamReply{Status: status, Error: &err}
+}
+
+func (h *NotificationHandler) track(conn *websocket.Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.streams[conn] = true
+	h.running.Add(1)
+}
+
+func (h *NotificationHandler) untrack(conn *websocket.Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.streams, conn)
+	h.running.Done()
+}
+
+// await gives a stream streamIdle for its next message, and reports false
+// once the server drains
+func (h *NotificationHandler) await(conn *websocket.Conn) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.draining {
+		return false
+	}
+	conn.SetReadDeadline(time.Now().Add(streamIdle))
+	return true
+}
+
+// Drain closes the streams, each once the message it is handling has been
+// answered. The HTTP server does not drain them itself, since they left it
+// when they were upgraded.
+func (h *NotificationHandler) Drain() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.draining = true
+	for conn := range h.streams {
+		conn.SetReadDeadline(time.Now())
+	}
+}
+
+// Close waits for the streams to close after Drain, until ctx is done
+func (h *NotificationHandler) Close(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		h.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return errors.New("notification streams did not close in time")
+	}
+}
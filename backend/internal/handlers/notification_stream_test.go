@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lileye/backend/internal/middleware"
+	"github.com/lileye/backend/internal/models"
+	"github.com/lileye/backend/internal/storage"
+	"github.com/lileye/backend/internal/throttle"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+)
+
+func TestStreamNotifications(t *testing.T) {
+	r, db := setupTest(t)
+	rules, err := throttle.ParseRules([]string{"GET /api/v1/notifications/stream device=2/h"})
+	assert.NoError(t, err)
+	r.Use(middleware.RateLimit(rules))
+	h := NewNotificationHandler(storage.NewNotificationStorage(db), testValidator(), throttle.NewDedup(time.Minute))
+	h.RegisterRoutes(r.Group("/api/v1"))
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/v1/notifications/stream"
+
+	// Plain requests are told to upgrade
+	resp, err := http.Get(srv.URL + "/api/v1/notifications/stream")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUpgradeRequired, resp.StatusCode)
+
+	// Pages of other sites cannot open a stream
+	_, err = websocket.Dial(url, "", "http://example.com")
+	assert.Error(t, err)
+
+	conn, err := websocket.Dial(url, "", srv.URL)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer conn.Close()
+	send := func(message any) models.StreamReply {
+		t.Helper()
+		if s, ok := message.(string); ok {
+			assert.NoError(t, websocket.Message.Send(conn, s))
+		} else {
+			assert.NoError(t, websocket.JSON.Send(conn, message))
+		}
+		var reply models.StreamReply
+		assert.NoError(t, websocket.JSON.Receive(conn, &reply))
+		return reply
+	}
+
+	notification := models.Notification{
+		Title:       "Family",
+		Message:     "Dinner at 7",
+		Timestamp:   time.Now(),
+		PackageName: "com.whatsapp",
+		DeviceID:    "phone1",
+	}
+	reply := send(notification)
+	assert.Equal(t, http.StatusCreated, reply.Status)
+	if assert.NotNil(t, reply.Notification) {
+		assert.NotZero(t, reply.Notification.ID)
+	}
+	first := reply.Notification
+
+	// A repeat returns the stored notification
+	reply = send(notification)
+	assert.Equal(t, http.StatusOK, reply.Status)
+	if assert.NotNil(t, reply.Notification) && first != nil {
+		assert.Equal(t, first.ID, reply.Notification.ID)
+	}
+
+	// Invalid messages are answered with an error, and the stream goes on
+	reply = send("not json")
+	assert.Equal(t, http.StatusBadRequest, reply.Status)
+	if assert.NotNil(t, reply.Error) {
+		assert.Equal(t, models.CodeInvalidRequest, reply.Error.Code)
+	}
+	reply = send(`{"device_id": 5}`)
+	if assert.NotNil(t, reply.Error) && assert.Len(t, reply.Error.Fields, 1) {
+		assert.Equal(t, "device_id", reply.Error.Fields[0].Field)
+	}
+	limit := h.validator.MaxBody()
+	reply = send(strings.Repeat(" ", int(limit)+1))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, reply.Status)
+	if assert.NotNil(t, reply.Error) {
+		assert.Equal(t, fmt.Sprintf("message must be at most %d bytes", limit), reply.Error.Message)
+	}
+
+	// Each notification counts against the rate of its device
+	other := notification
+	other.Message = "Dinner at 8"
+	reply = send(other)
+	assert.Equal(t, http.StatusTooManyRequests, reply.Status)
+	if assert.NotNil(t, reply.Error) {
+		assert.Equal(t, models.CodeRateLimited, reply.Error.Code)
+	}
+
+	// Draining closes the stream
+	h.Drain()
+	var message []byte
+	assert.Error(t, websocket.Message.Receive(conn, &message))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, h.Close(ctx))
+}
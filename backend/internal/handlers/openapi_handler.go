@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lileye/backend/internal/openapi"
+)
+
+// OpenAPIHandler serves the OpenAPI document describing the API
+type OpenAPIHandler struct {
+	document []byte
+}
+
+// NewOpenAPIHandler creates a new OpenAPIHandler instance
+func NewOpenAPIHandler() *OpenAPIHandler {
+	return &OpenAPIHandler{document: openapi.JSON()}
+}
+
+// RegisterRoutes registers the OpenAPI route with the API route group
+func (h *OpenAPIHandler) RegisterRoutes(r gin.IRouter) {
+	r.GET("/openapi.json", h.GetDocument)
+}
+
+// GetDocument handles retrieving the OpenAPI document
+func (h *OpenAPIHandler) GetDocument(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json; charset=utf-8", h.document)
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lileye/backend/internal/fixtures"
+	"github.com/lileye/backend/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// fixturesEnd is the end of the period the fixtures of a test are
+// received in, so that every run stores the same notifications
+var fixturesEnd = time.Date(2026, 10, 19, 18, 0, 0, 0, time.UTC)
+
+// setupTest creates an empty router and a migrated in-memory database for
+// the handlers under test
+func setupTest(t *testing.T) (*gin.Engine, *gorm.DB) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, storage.Migrate(db))
+
+	return gin.New(), db
+}
+
+// storeFixtures generates a dataset and stores its notifications, which get
+// their IDs
+func storeFixtures(t *testing.T, db *gorm.DB, opts fixtures.Options) *fixtures.Dataset {
+	t.Helper()
+	ds := fixtures.Generate(opts)
+	notifications := storage.NewNotificationStorage(db)
+	for i := range ds.Notifications {
+		assert.NoError(t, notifications.Create(context.Background(), &ds.Notifications[i]))
+	}
+	return ds
+}
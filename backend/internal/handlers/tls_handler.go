@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lileye/backend/internal/models"
+)
+
+// TLSHandler serves the self-signed CA so that devices can pin or install it
+type TLSHandler struct {
+	ca *models.CAInfo
+}
+
+// NewTLSHandler creates a new TLSHandler instance
+func NewTLSHandler(ca *models.CAInfo) *TLSHandler {
+	return &TLSHandler{ca: ca}
+}
+
+// RegisterRoutes registers the TLS routes with the API route group
+func (h *TLSHandler) RegisterRoutes(r gin.IRouter) {
+	r.GET("/tls/ca", h.GetCA)
+	r.GET("/tls/ca.pem", h.GetCAPEM)
+}
+
+// GetCA handles retrieving the CA fingerprints and certificate
+func (h *TLSHandler) GetCA(c *gin.Context) {
+	c.JSON(http.StatusOK, h.ca)
+}
+
+// GetCAPEM handles downloading the CA certificate
+func (h *TLSHandler) GetCAPEM(c *gin.Context) {
+	c.Header("Content-Disposition", `attachment; filename="lileye-ca.pem"`)
+	c.Data(http.StatusOK, "application/x-pem-file", []byte(h.ca.PEM))
+}
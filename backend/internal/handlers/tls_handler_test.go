@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lileye/backend/internal/certs"
+	"github.com/lileye/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetCA(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	_, ca, err := certs.SelfSigned(t.TempDir(), []string{"localhost"})
+	assert.NoError(t, err)
+
+	r := gin.Default()
+	NewTLSHandler(ca).RegisterRoutes(r.Group("/api/v1"))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/tls/ca", nil)
+	r.ServeHTTP(w, req)
+
+	var response models.CAInfo
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, ca.Fingerprint, response.Fingerprint)
+	assert.Equal(t, ca.SPKIPin, response.SPKIPin)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/v1/tls/ca.pem", nil)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-pem-file", w.Header().Get("Content-Type"))
+	assert.Equal(t, ca.PEM, w.Body.String())
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lileye/backend/internal/apierror"
+)
+
+// multipartOverhead is the room allowed in an upload body for the multipart
+// boundaries, part headers and form fields around the file
+const multipartOverhead = 64 << 10
+
+// formFile returns the multipart form field "file" of an upload whose file
+// is at most maxSize bytes, writing an error response if there is none. The
+// body is capped before the form is parsed, so a larger upload is refused
+// with 413 rather than spooled to memory or disk first.
+func formFile(c *gin.Context, maxSize int64) (*multipart.FileHeader, bool) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+multipartOverhead)
+	header, err := c.FormFile("file")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		apierror.Abort(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("uploads must be at most %d bytes", maxSize))
+		return nil, false
+	}
+	if err != nil {
+		apierror.Invalid(c, "file", "file is required")
+		return nil, false
+	}
+	return header, true
+}
@@ -0,0 +1,126 @@
+// Package health tracks what the readiness probe reports: whether the
+// database is usable, the state of background workers and whether the
+// server is draining
+package health
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lileye/backend/internal/models"
+	"github.com/lileye/backend/internal/storage"
+	"gorm.io/gorm"
+)
+
+// Checker answers readiness probes
+type Checker struct {
+	db       *gorm.DB
+	draining atomic.Bool
+
+	mu      sync.Mutex
+	workers map[string]*models.WorkerStatus
+}
+
+// NewChecker creates a new Checker instance
+func NewChecker(db *gorm.DB) *Checker {
+	return &Checker{db: db, workers: make(map[string]*models.WorkerStatus)}
+}
+
+// Worker registers a background worker and returns the handle it reports
+// through
+func (c *Checker) Worker(name string) *Worker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.workers[name] = &models.WorkerStatus{Name: name, State: models.WorkerRunning}
+	return &Worker{checker: c, name: name}
+}
+
+// Drain marks the server as shutting down so that it stops being ready
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+// Draining reports whether Drain has been called
+func (c *Checker) Draining() bool {
+	return c.draining.Load()
+}
+
+// Ready checks the database and collects the worker statuses. Failed workers
+// are reported but do not make the server unready since they are retried on
+// their next run.
+func (c *Checker) Ready(ctx context.Context) models.HealthReport {
+	report := models.HealthReport{Draining: c.Draining()}
+	report.Checks = append(report.Checks,
+		check(ctx, "database", c.ping(ctx), "database is unreachable"),
+		check(ctx, "migrations", storage.CheckSchema(c.db.WithContext(ctx)), "database schema is not up to date"))
+
+	report.Ready = !report.Draining
+	for _, ch := range report.Checks {
+		report.Ready = report.Ready && ch.OK
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	report.Workers = make([]models.WorkerStatus, 0, len(c.workers))
+	for _, w := range c.workers {
+		report.Workers = append(report.Workers, *w)
+	}
+	sort.Slice(report.Workers, func(i, j int) bool {
+		return report.Workers[i].Name < report.Workers[j].Name
+	})
+	return report
+}
+
+func (c *Checker) ping(ctx context.Context) error {
+	sqlDB, err := c.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// check reports the result of a readiness check. The probe is served
+// without authentication, so the error is logged and only failure, a
+// fixed message, is reported.
+func check(ctx context.Context, name string, err error, failure string) models.HealthCheck {
+	if err != nil {
+		slog.ErrorContext(ctx, "Readiness check failed", "check", name, "error", err)
+		return models.HealthCheck{Name: name, Error: failure}
+	}
+	return models.HealthCheck{Name: name, OK: true}
+}
+
+// Worker reports the progress of one background worker
+type Worker struct {
+	checker *Checker
+	name    string
+}
+
+// workerFailed is reported for a worker whose last run failed. Workers log
+// their errors, which may hold paths and SQL unfit for the readiness probe.
+const workerFailed = "last run failed; see the server log"
+
+// Ran records a completed run and whether it failed
+func (w *Worker) Ran(err error) {
+	w.checker.mu.Lock()
+	defer w.checker.mu.Unlock()
+	status := w.checker.workers[w.name]
+	now := time.Now()
+	status.Runs++
+	status.LastRun = &now
+	status.LastError = ""
+	if err != nil {
+		status.LastError = workerFailed
+	}
+}
+
+// Stopped records that the worker has exited
+func (w *Worker) Stopped() {
+	w.checker.mu.Lock()
+	defer w.checker.mu.Unlock()
+	w.checker.workers[w.name].State = models.WorkerStopped
+}
@@ -0,0 +1,189 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lileye/backend/internal/export"
+	"github.com/lileye/backend/internal/models"
+)
+
+// csvFields are the notification fields CSV columns can be mapped to, by
+// the names of the csv export's columns
+var csvFields = map[string]func(n *models.Notification, value string, opts Options) error{
+	"timestamp": func(n *models.Notification, value string, opts Options) (err error) {
+		n.Timestamp, err = parseTime(value, opts.TimeFormat)
+		return err
+	},
+	"removed_at": func(n *models.Notification, value string, opts Options) error {
+		if value == "" {
+			return nil
+		}
+		t, err := parseTime(value, opts.TimeFormat)
+		n.RemovedAt = &t
+		return err
+	},
+	"read": func(n *models.Notification, value string, _ Options) (err error) {
+		if value != "" {
+			n.Read, err = strconv.ParseBool(value)
+		}
+		return err
+	},
+	"device_id":          text(func(n *models.Notification) *string { return &n.DeviceID }),
+	"device_name":        text(func(n *models.Notification) *string { return &n.DeviceName }),
+	"package_name":       text(func(n *models.Notification) *string { return &n.PackageName }),
+	"from":               text(func(n *models.Notification) *string { return &n.From }),
+	"title":              text(func(n *models.Notification) *string { return &n.Title }),
+	"message":            text(func(n *models.Notification) *string { return &n.Message }),
+	"big_text":           text(func(n *models.Notification) *string { return &n.BigText }),
+	"sub_text":           text(func(n *models.Notification) *string { return &n.SubText }),
+	"conversation_title": text(func(n *models.Notification) *string { return &n.ConversationTitle }),
+	"category":           text(func(n *models.Notification) *string { return &n.Category }),
+	"channel_id":         text(func(n *models.Notification) *string { return &n.ChannelID }),
+	"key":                text(func(n *models.Notification) *string { return &n.Key }),
+	"state":              text(func(n *models.Notification) *string { return &n.State }),
+	"removal_reason":     text(func(n *models.Notification) *string { return &n.RemovalReason }),
+}
+
+// text sets a string field, undoing the quoting of the csv export
+func text(field func(n *models.Notification) *string) func(*models.Notification, string, Options) error {
+	return func(n *models.Notification, value string, _ Options) error {
+		*field(n) = export.UnquoteCell(value)
+		return nil
+	}
+}
+
+// csvParser reads CSV files with a header row. Columns are matched to
+// fields by Options.Columns or by name, so exports read back unmapped.
+type csvParser struct {
+	reader *csv.Reader
+	opts   Options
+	// columns maps the index of every mapped column to its field
+	columns map[int]string
+}
+
+func newCSVParser(r io.Reader, opts Options) (Parser, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("csv: no header row")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("csv: %w", err)
+	}
+
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		index[strings.TrimSpace(name)] = i
+	}
+	columns := map[int]string{}
+	for field, column := range opts.Columns {
+		if _, ok := csvFields[field]; !ok {
+			return nil, fmt.Errorf("csv: unknown field %q, use one of %s", field, strings.Join(CSVFields(), ", "))
+		}
+		i, ok := index[column]
+		if !ok {
+			return nil, fmt.Errorf("csv: no column %q for %s", column, field)
+		}
+		columns[i] = field
+	}
+	for field := range csvFields {
+		if _, mapped := opts.Columns[field]; mapped {
+			continue
+		}
+		if i, ok := index[field]; ok {
+			if _, taken := columns[i]; !taken {
+				columns[i] = field
+			}
+		}
+	}
+
+	hasTimestamp := false
+	for _, field := range columns {
+		hasTimestamp = hasTimestamp || field == "timestamp"
+	}
+	if !hasTimestamp {
+		return nil, errors.New("csv: no timestamp column, map one with timestamp=<column>")
+	}
+	return &csvParser{reader: reader, opts: opts, columns: columns}, nil
+}
+
+func (p *csvParser) Next() (*models.Notification, error) {
+	record, err := p.reader.Read()
+	if err != nil {
+		var perr *csv.ParseError
+		if errors.As(err, &perr) {
+			return nil, &ParseError{Line: perr.Line, Err: perr.Err}
+		}
+		return nil, err
+	}
+	line, _ := p.reader.FieldPos(0)
+
+	n := &models.Notification{}
+	for i, field := range p.columns {
+		if i >= len(record) {
+			continue
+		}
+		if err := csvFields[field](n, record[i], p.opts); err != nil {
+			return nil, &ParseError{Line: line, Err: fmt.Errorf("%s: %w", field, err)}
+		}
+	}
+	if err := finish(n, p.opts); err != nil {
+		return nil, &ParseError{Line: line, Err: err}
+	}
+	return n, nil
+}
+
+// parseTime parses a CSV timestamp in the given layout
+func parseTime(value, layout string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	switch layout {
+	case "", time.RFC3339:
+		return time.Parse(time.RFC3339, value)
+	case "unix", "unixms":
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if layout == "unix" {
+			return time.Unix(i, 0), nil
+		}
+		return time.UnixMilli(i), nil
+	default:
+		return time.Parse(layout, value)
+	}
+}
+
+// CSVFields returns the fields CSV columns can be mapped to
+func CSVFields() []string {
+	fields := make([]string, 0, len(csvFields))
+	for field := range csvFields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// ParseColumns parses a column mapping such as "title=Subject,message=Body"
+func ParseColumns(s string) (map[string]string, error) {
+	columns := map[string]string{}
+	if strings.TrimSpace(s) == "" {
+		return columns, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		field, column, ok := strings.Cut(pair, "=")
+		field, column = strings.TrimSpace(field), strings.TrimSpace(column)
+		if !ok || field == "" || column == "" {
+			return nil, fmt.Errorf("invalid column mapping %q, want field=column", pair)
+		}
+		columns[field] = column
+	}
+	return columns, nil
+}
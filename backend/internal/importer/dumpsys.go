@@ -0,0 +1,162 @@
+package importer
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lileye/backend/internal/models"
+)
+
+// dumpsysParser reads the notification records printed by
+// "adb shell dumpsys notification --noredact". A record starts with a
+// NotificationRecord line naming the app and the notification's key and
+// channel, and holds the time it was posted in a when= line and its content
+// in an extras={ ... } block:
+//
+//	NotificationRecord(0x0c4e: pkg=com.whatsapp user=UserHandle{0} id=1 tag=null importance=4 key=0|com.whatsapp|1|null|10123: Notification(channel=chats category=msg ...))
+//	  when=1697711400000
+//	  extras={
+//	    android.title=String (Alice)
+//	    android.text=String (Meet at the park)
+//	  }
+type dumpsysParser struct {
+	scanner *bufio.Scanner
+	opts    Options
+	line    int
+	// pending is the line starting the next record, read while finishing the
+	// previous one
+	pending string
+}
+
+var (
+	dumpsysRecord   = regexp.MustCompile(`^NotificationRecord\(.*?\bpkg=(\S+)`)
+	dumpsysKey      = regexp.MustCompile(`\bkey=([^\s:]+)`)
+	dumpsysChannel  = regexp.MustCompile(`\bchannel=([^\s)]+)`)
+	dumpsysCategory = regexp.MustCompile(`\bcategory=([^\s)]+)`)
+	// dumpsysExtra matches an extra with a value of a type holding text or a
+	// scalar; icons, bundles and parcelables are skipped
+	dumpsysExtra = regexp.MustCompile(`^([\w.]+)=(String|SpannableString|SpannedString|Boolean|Integer|Long) \((.*)$`)
+	// dumpsysRedacted matches text hidden by dumpsys without --noredact
+	dumpsysRedacted = regexp.MustCompile(`^[\w.]+=\w+ \[length=\d+\]$`)
+)
+
+// errRedacted stops a dumpsys import whose text is hidden
+var errRedacted = errors.New("notification text is redacted, run dumpsys notification with --noredact")
+
+func newDumpsysParser(r io.Reader, opts Options) (Parser, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLine)
+	return &dumpsysParser{scanner: scanner, opts: opts}, nil
+}
+
+// maxLine is the longest line read, to fit long messages
+const maxLine = 16 << 20
+
+func (p *dumpsysParser) Next() (*models.Notification, error) {
+	// Skip to the start of the next record
+	for p.pending == "" {
+		line, ok, err := p.scan()
+		if err != nil || !ok {
+			return nil, orEOF(err)
+		}
+		if dumpsysRecord.MatchString(line) {
+			p.pending = line
+		}
+	}
+	start, header := p.line, p.pending
+	p.pending = ""
+
+	n := &models.Notification{Extras: map[string]string{}}
+	n.PackageName = dumpsysRecord.FindStringSubmatch(header)[1]
+	if m := dumpsysKey.FindStringSubmatch(header); m != nil {
+		n.Key = m[1]
+	}
+	if m := dumpsysChannel.FindStringSubmatch(header); m != nil && m[1] != "null" {
+		n.ChannelID = m[1]
+	}
+	if m := dumpsysCategory.FindStringSubmatch(header); m != nil && m[1] != "null" {
+		n.Category = m[1]
+	}
+
+	inExtras := false
+	for {
+		line, ok, err := p.scan()
+		if err != nil {
+			return nil, err
+		}
+		if !ok || dumpsysRecord.MatchString(line) {
+			p.pending = line
+			break
+		}
+		switch {
+		case !inExtras && line == "extras={":
+			inExtras = true
+		case !inExtras && strings.HasPrefix(line, "when="):
+			ms, err := strconv.ParseInt(strings.TrimPrefix(line, "when="), 10, 64)
+			if err == nil && ms > 0 {
+				n.Timestamp = time.UnixMilli(ms)
+			}
+		case inExtras && line == "}":
+			inExtras = false
+		case inExtras && dumpsysRedacted.MatchString(line):
+			return nil, errRedacted
+		case inExtras:
+			m := dumpsysExtra.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			value, err := p.value(m[3])
+			if err != nil {
+				return nil, err
+			}
+			n.Extras[m[1]] = value
+		}
+	}
+
+	n.Title = n.Extras["android.title"]
+	n.Message = n.Extras["android.text"]
+	n.From = n.Title
+	if err := finish(n, p.opts); err != nil {
+		return nil, &ParseError{Line: start, Err: err}
+	}
+	return n, nil
+}
+
+// value reads the rest of an extra's value, which continues over the
+// following lines until one ends the parenthesis opened before first
+func (p *dumpsysParser) value(first string) (string, error) {
+	value := first
+	for !strings.HasSuffix(value, ")") {
+		if !p.scanner.Scan() {
+			if err := p.scanner.Err(); err != nil {
+				return "", err
+			}
+			break
+		}
+		p.line++
+		value += "\n" + p.scanner.Text()
+	}
+	return strings.TrimSuffix(value, ")"), nil
+}
+
+// scan reads the next line without its indentation
+func (p *dumpsysParser) scan() (string, bool, error) {
+	if !p.scanner.Scan() {
+		return "", false, p.scanner.Err()
+	}
+	p.line++
+	return strings.TrimSpace(p.scanner.Text()), true, nil
+}
+
+// orEOF returns err, or io.EOF when it is nil
+func orEOF(err error) error {
+	if err == nil {
+		return io.EOF
+	}
+	return err
+}
@@ -0,0 +1,269 @@
+// Package importer loads notifications recorded elsewhere: the output of
+// Android's "dumpsys notification", NDJSON exports of this server and CSV
+// files. Files are parsed one record at a time, so imports of any size are
+// never held in memory.
+package importer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lileye/backend/internal/models"
+	"github.com/lileye/backend/internal/storage"
+	"gorm.io/gorm"
+)
+
+// Options configure how files are parsed
+type Options struct {
+	// DeviceID and DeviceName are set on notifications that do not name
+	// their device. dumpsys output never does.
+	DeviceID   string
+	DeviceName string
+	// Columns maps notification fields to the CSV columns holding them.
+	// Fields that are not mapped are read from the column of the same name.
+	Columns map[string]string
+	// TimeFormat is the layout of CSV timestamps, or "unix" or "unixms" for
+	// seconds or milliseconds since the epoch. It defaults to RFC 3339.
+	TimeFormat string
+}
+
+// Parser reads notifications from a file
+type Parser interface {
+	// Next returns the next notification, or io.EOF after the last one. A
+	// *ParseError reports a record that could not be read; the following
+	// records can still be.
+	Next() (*models.Notification, error)
+}
+
+// ParseError is a record that could not be read
+type ParseError struct {
+	Line int
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Format is a file format that can be imported
+type Format struct {
+	Name string
+	// Extensions are the file extensions the format is detected by
+	Extensions []string
+	newParser  func(r io.Reader, opts Options) (Parser, error)
+}
+
+var formats = []Format{
+	{Name: "dumpsys", Extensions: []string{".txt"}, newParser: newDumpsysParser},
+	{Name: "ndjson", Extensions: []string{".ndjson", ".jsonl"}, newParser: newNDJSONParser},
+	{Name: "csv", Extensions: []string{".csv"}, newParser: newCSVParser},
+}
+
+// Lookup returns the format with the given name
+func Lookup(name string) (Format, bool) {
+	for _, f := range formats {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Format{}, false
+}
+
+// Detect returns the format of the file at path by its extension
+func Detect(path string) (Format, bool) {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, f := range formats {
+		for _, e := range f.Extensions {
+			if e == ext {
+				return f, true
+			}
+		}
+	}
+	return Format{}, false
+}
+
+// Names returns the names of every format
+func Names() []string {
+	names := make([]string, len(formats))
+	for i, f := range formats {
+		names[i] = f.Name
+	}
+	return names
+}
+
+// NewParser starts parsing r
+func (f Format) NewParser(r io.Reader, opts Options) (Parser, error) {
+	return f.newParser(r, opts)
+}
+
+// finish fills in what the file left out of n and checks that it can be
+// stored
+func finish(n *models.Notification, opts Options) error {
+	n.Model = gorm.Model{}
+	if n.DeviceID == "" {
+		n.DeviceID = opts.DeviceID
+		if n.DeviceName == "" {
+			n.DeviceName = opts.DeviceName
+		}
+	}
+	n.Timestamp = n.Timestamp.UTC()
+	if n.State == "" {
+		n.State = "posted"
+	}
+
+	switch {
+	case n.DeviceID == "":
+		return errors.New("no device ID, set one for the import")
+	case n.PackageName == "":
+		return errors.New("no package name")
+	case n.Timestamp.IsZero():
+		return errors.New("no timestamp")
+	}
+	return nil
+}
+
+// Summary is the outcome of an import
+type Summary struct {
+	// Read counts the records read, including invalid ones
+	Read int `json:"read"`
+	// Imported counts the notifications stored, or that would be stored by
+	// a dry run
+	Imported   int `json:"imported"`
+	Duplicates int `json:"duplicates"`
+	Invalid    int `json:"invalid"`
+	// First and Last are the earliest and latest imported timestamps
+	First time.Time `json:"first"`
+	Last  time.Time `json:"last"`
+	// Packages counts the imported notifications of every app
+	Packages map[string]int `json:"packages"`
+}
+
+// batchSize is the number of notifications stored per transaction
+const batchSize = 500
+
+// Importer stores parsed notifications, skipping those that are already
+// stored
+type Importer struct {
+	notifications *storage.NotificationStorage
+	senders       *storage.SenderStorage
+	// DryRun counts what would be imported without storing anything
+	DryRun bool
+	// Progress is called after every batch, if set
+	Progress func(Summary)
+	// Invalid is called with every record that could not be read, if set
+	Invalid func(err *ParseError)
+}
+
+// New creates an Importer storing notifications in db
+func New(db *gorm.DB) *Importer {
+	return &Importer{
+		notifications: storage.NewNotificationStorage(db),
+		senders:       storage.NewSenderStorage(db),
+	}
+}
+
+// Run imports every notification p reads. Invalid records are counted and
+// skipped; any other error stops the import after the notifications read
+// before it were stored.
+func (im *Importer) Run(ctx context.Context, p Parser) (Summary, error) {
+	summary := Summary{Packages: map[string]int{}}
+	// seen holds the notifications of this import, which are not all
+	// stored yet when their duplicates are read
+	seen := map[[sha256.Size]byte]bool{}
+	batch := make([]models.Notification, 0, batchSize)
+
+	flush := func() error {
+		if !im.DryRun {
+			if err := im.notifications.Import(ctx, batch); err != nil {
+				return err
+			}
+		}
+		batch = batch[:0]
+		if im.Progress != nil {
+			im.Progress(summary)
+		}
+		return nil
+	}
+
+	for {
+		n, err := p.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var perr *ParseError
+		if errors.As(err, &perr) {
+			summary.Read++
+			summary.Invalid++
+			if im.Invalid != nil {
+				im.Invalid(perr)
+			}
+			continue
+		}
+		if err != nil {
+			return summary, errors.Join(err, flush())
+		}
+		summary.Read++
+
+		fingerprint := fingerprintOf(n)
+		duplicate := seen[fingerprint]
+		if !duplicate {
+			if duplicate, err = im.notifications.IsDuplicate(ctx, n); err != nil {
+				return summary, err
+			}
+		}
+		if duplicate {
+			summary.Duplicates++
+			continue
+		}
+		seen[fingerprint] = true
+
+		summary.Imported++
+		summary.Packages[n.PackageName]++
+		if summary.First.IsZero() || n.Timestamp.Before(summary.First) {
+			summary.First = n.Timestamp
+		}
+		if n.Timestamp.After(summary.Last) {
+			summary.Last = n.Timestamp
+		}
+		batch = append(batch, *n)
+		if len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return summary, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return summary, err
+	}
+
+	// Senders are recorded at the end, without the alerts new senders
+	// raise when notifications arrive from a device
+	if im.DryRun || summary.Imported == 0 {
+		return summary, nil
+	}
+	return summary, im.senders.Backfill(ctx)
+}
+
+// fingerprintOf identifies a notification by what IsDuplicate compares
+func fingerprintOf(n *models.Notification) [sha256.Size]byte {
+	h := sha256.New()
+	for _, s := range []string{n.DeviceID, n.PackageName, n.Title, n.Message} {
+		binary.Write(h, binary.BigEndian, uint64(len(s)))
+		io.WriteString(h, s)
+	}
+	binary.Write(h, binary.BigEndian, n.Timestamp.UnixNano())
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
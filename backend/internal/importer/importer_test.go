@@ -0,0 +1,247 @@
+package importer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lileye/backend/internal/export"
+	"github.com/lileye/backend/internal/models"
+	"github.com/lileye/backend/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "lileye.db")), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, storage.Migrate(db))
+	return db
+}
+
+func parse(t *testing.T, format, input string, opts Options) ([]models.Notification, []error) {
+	f, ok := Lookup(format)
+	assert.True(t, ok)
+	p, err := f.NewParser(strings.NewReader(input), opts)
+	assert.NoError(t, err)
+
+	var notifications []models.Notification
+	var invalid []error
+	for {
+		n, err := p.Next()
+		var perr *ParseError
+		switch {
+		case err == nil:
+			notifications = append(notifications, *n)
+		case errors.As(err, &perr):
+			invalid = append(invalid, err)
+		default:
+			return notifications, invalid
+		}
+	}
+}
+
+const dumpsys = `Current Notification Manager state:
+  Notification List:
+    NotificationRecord(0x0c4e1a2b: pkg=com.whatsapp user=UserHandle{0} id=1 tag=null importance=4 key=0|com.whatsapp|1|null|10123: Notification(channel=individual_chat category=msg groupKey=messages vis=PRIVATE))
+      uid=10123 userId=0
+      opPkg=com.whatsapp
+      key=0|com.whatsapp|1|null|10123
+      when=1792400400000
+      extras={
+        android.title=String (Alice)
+        android.subText=null
+        android.text=String (Meet at the park
+at 5 (the big one))
+        android.isGroupConversation=Boolean (false)
+        android.largeIcon=Icon(typ=BITMAP size=96x96)
+        android.messages=Parcelable[] (1)
+      }
+      stats=SingleNotificationStats{posttimeElapsedMs=1}
+    NotificationRecord(0x0c4e1a2c: pkg=android user=UserHandle{0} id=2 tag=null importance=2 key=0|android|2|null|1000: Notification(channel=null))
+      uid=1000 userId=0
+      extras={
+        android.title=String (USB debugging connected)
+      }
+    NotificationRecord(0x0c4e1a2d: pkg=com.instagram.android user=UserHandle{0} id=3 tag=null importance=4 key=0|com.instagram.android|3|null|10200: Notification(channel=ig_direct))
+      when=1792400460000
+      extras={
+        android.title=SpannableString (bob_92)
+        android.text=String (sent you a photo)
+      }
+`
+
+func TestDumpsys(t *testing.T) {
+	notifications, invalid := parse(t, "dumpsys", dumpsys, Options{DeviceID: "device1", DeviceName: "Pixel"})
+	assert.Len(t, invalid, 1)
+	assert.Contains(t, invalid[0].Error(), "line 18: no timestamp")
+	if !assert.Len(t, notifications, 2) {
+		return
+	}
+
+	n := notifications[0]
+	assert.Equal(t, "com.whatsapp", n.PackageName)
+	assert.Equal(t, "0|com.whatsapp|1|null|10123", n.Key)
+	assert.Equal(t, "individual_chat", n.ChannelID)
+	assert.Equal(t, "msg", n.Category)
+	assert.Equal(t, "Alice", n.Title)
+	assert.Equal(t, "Alice", n.From)
+	assert.Equal(t, "Meet at the park\nat 5 (the big one)", n.Message)
+	assert.Equal(t, time.UnixMilli(1792400400000).UTC(), n.Timestamp)
+	assert.Equal(t, "device1", n.DeviceID)
+	assert.Equal(t, "Pixel", n.DeviceName)
+	assert.Equal(t, "false", n.Extras["android.isGroupConversation"])
+	assert.NotContains(t, n.Extras, "android.subText")
+	assert.NotContains(t, n.Extras, "android.messages")
+
+	assert.Equal(t, "bob_92", notifications[1].Title)
+}
+
+func TestDumpsysRedacted(t *testing.T) {
+	redacted := strings.Replace(dumpsys, "android.title=String (Alice)", "android.title=String [length=5]", 1)
+	p, err := newDumpsysParser(strings.NewReader(redacted), Options{DeviceID: "device1"})
+	assert.NoError(t, err)
+	_, err = p.Next()
+	assert.ErrorIs(t, err, errRedacted)
+}
+
+func TestNDJSONReadsExport(t *testing.T) {
+	exported := []models.Notification{
+		{Title: "Alice", Message: "Hi", From: "Alice", DeviceID: "device1", PackageName: "com.whatsapp",
+			Timestamp: time.Date(2026, 10, 19, 9, 30, 0, 0, time.UTC), Extras: map[string]string{"android.title": "Alice"}},
+		{Title: "Bob", Message: "Hey", DeviceID: "device1", PackageName: "com.whatsapp",
+			Timestamp: time.Date(2026, 10, 19, 9, 31, 0, 0, time.UTC)},
+	}
+	exported[0].ID = 7
+
+	var buf bytes.Buffer
+	f, _ := export.Lookup("ndjson")
+	w, err := f.NewWriter(&buf, export.Report{})
+	assert.NoError(t, err)
+	for i := range exported {
+		assert.NoError(t, w.Write(&exported[i]))
+	}
+	assert.NoError(t, w.Close())
+
+	notifications, invalid := parse(t, "ndjson", buf.String()+"\n{not json}\n", Options{})
+	assert.Len(t, invalid, 1)
+	assert.Len(t, notifications, 2)
+	assert.Zero(t, notifications[0].ID)
+	assert.Equal(t, "Alice", notifications[0].Extras["android.title"])
+	assert.Equal(t, exported[1].Timestamp, notifications[1].Timestamp)
+}
+
+func TestCSVReadsExport(t *testing.T) {
+	var buf bytes.Buffer
+	f, _ := export.Lookup("csv")
+	w, err := f.NewWriter(&buf, export.Report{})
+	assert.NoError(t, err)
+	assert.NoError(t, w.Write(&models.Notification{Title: "=1+1", Message: "Hi", DeviceID: "device1",
+		PackageName: "com.whatsapp", Timestamp: time.Date(2026, 10, 19, 9, 30, 0, 0, time.UTC), Read: true}))
+	assert.NoError(t, w.Close())
+
+	notifications, invalid := parse(t, "csv", buf.String(), Options{})
+	assert.Empty(t, invalid)
+	if assert.Len(t, notifications, 1) {
+		assert.Equal(t, "=1+1", notifications[0].Title)
+		assert.True(t, notifications[0].Read)
+	}
+}
+
+func TestCSVColumnMapping(t *testing.T) {
+	input := "Date,App,Subject,Body\n" +
+		"1792400400000,com.whatsapp,Alice,Hi\n" +
+		"yesterday,com.whatsapp,Bob,Hey\n"
+	opts := Options{DeviceID: "device1", TimeFormat: "unixms",
+		Columns: map[string]string{"timestamp": "Date", "package_name": "App", "title": "Subject", "message": "Body"}}
+	notifications, invalid := parse(t, "csv", input, opts)
+	if assert.Len(t, invalid, 1) {
+		assert.Contains(t, invalid[0].Error(), "line 3: timestamp")
+	}
+	if assert.Len(t, notifications, 1) {
+		assert.Equal(t, "Alice", notifications[0].Title)
+		assert.Equal(t, "Hi", notifications[0].Message)
+		assert.Equal(t, "device1", notifications[0].DeviceID)
+	}
+
+	_, err := newCSVParser(strings.NewReader(input), Options{Columns: map[string]string{"subject": "Subject"}})
+	assert.ErrorContains(t, err, `unknown field "subject"`)
+	_, err = newCSVParser(strings.NewReader(input), Options{Columns: map[string]string{"title": "Missing"}})
+	assert.ErrorContains(t, err, `no column "Missing"`)
+	_, err = newCSVParser(strings.NewReader(input), Options{})
+	assert.ErrorContains(t, err, "no timestamp column")
+}
+
+func TestParseColumns(t *testing.T) {
+	columns, err := ParseColumns("title=Subject, message = Body")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"title": "Subject", "message": "Body"}, columns)
+
+	_, err = ParseColumns("title")
+	assert.Error(t, err)
+}
+
+func TestDetect(t *testing.T) {
+	f, ok := Detect("export.NDJSON")
+	assert.True(t, ok)
+	assert.Equal(t, "ndjson", f.Name)
+	_, ok = Detect("export.xml")
+	assert.False(t, ok)
+}
+
+func TestRunSkipsDuplicates(t *testing.T) {
+	db := setupTestDB(t)
+	opts := Options{DeviceID: "device1"}
+	f, _ := Lookup("dumpsys")
+
+	// A dry run counts without storing
+	im := New(db)
+	im.DryRun = true
+	p, err := f.NewParser(strings.NewReader(dumpsys+dumpsys), opts)
+	assert.NoError(t, err)
+	summary, err := im.Run(context.Background(), p)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, summary.Read)
+	assert.Equal(t, 2, summary.Imported)
+	assert.Equal(t, 2, summary.Duplicates)
+	assert.Equal(t, 2, summary.Invalid)
+	assert.Equal(t, map[string]int{"com.whatsapp": 1, "com.instagram.android": 1}, summary.Packages)
+	assert.Equal(t, time.UnixMilli(1792400400000).UTC(), summary.First)
+	assert.Equal(t, time.UnixMilli(1792400460000).UTC(), summary.Last)
+
+	var count int64
+	db.Model(&models.Notification{}).Count(&count)
+	assert.Zero(t, count)
+
+	var progress []Summary
+	im = New(db)
+	im.Progress = func(s Summary) { progress = append(progress, s) }
+	p, _ = f.NewParser(strings.NewReader(dumpsys), opts)
+	summary, err = im.Run(context.Background(), p)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, summary.Imported)
+	assert.NotEmpty(t, progress)
+
+	db.Model(&models.Notification{}).Count(&count)
+	assert.Equal(t, int64(2), count)
+	var senders int64
+	db.Model(&models.Sender{}).Count(&senders)
+	assert.Equal(t, int64(2), senders)
+	var alerts int64
+	db.Model(&models.Alert{}).Count(&alerts)
+	assert.Zero(t, alerts)
+
+	// Importing the same file again stores nothing
+	p, _ = f.NewParser(strings.NewReader(dumpsys), opts)
+	summary, err = New(db).Run(context.Background(), p)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, summary.Imported)
+	assert.Equal(t, 2, summary.Duplicates)
+	db.Model(&models.Notification{}).Count(&count)
+	assert.Equal(t, int64(2), count)
+}
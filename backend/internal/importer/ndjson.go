@@ -0,0 +1,43 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/lileye/backend/internal/models"
+)
+
+// ndjsonParser reads one JSON notification per line, as written by the
+// ndjson export
+type ndjsonParser struct {
+	scanner *bufio.Scanner
+	opts    Options
+	line    int
+}
+
+func newNDJSONParser(r io.Reader, opts Options) (Parser, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLine)
+	return &ndjsonParser{scanner: scanner, opts: opts}, nil
+}
+
+func (p *ndjsonParser) Next() (*models.Notification, error) {
+	for p.scanner.Scan() {
+		p.line++
+		line := strings.TrimSpace(p.scanner.Text())
+		if line == "" {
+			continue
+		}
+		var n models.Notification
+		if err := json.Unmarshal([]byte(line), &n); err != nil {
+			return nil, &ParseError{Line: p.line, Err: err}
+		}
+		if err := finish(&n, p.opts); err != nil {
+			return nil, &ParseError{Line: p.line, Err: err}
+		}
+		return &n, nil
+	}
+	return nil, orEOF(p.scanner.Err())
+}
@@ -0,0 +1,78 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("debug")
+	assert.NoError(t, err)
+	assert.Equal(t, slog.LevelDebug, level)
+
+	level, err = ParseLevel("WARN")
+	assert.NoError(t, err)
+	assert.Equal(t, slog.LevelWarn, level)
+
+	_, err = ParseLevel("verbose")
+	assert.Error(t, err)
+}
+
+func TestLoggerAddsRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelInfo).With("component", "test")
+
+	ctx := WithRequestID(context.Background(), "abc123")
+	assert.Equal(t, "abc123", RequestID(ctx))
+	logger.InfoContext(ctx, "hello")
+	logger.Debug("hidden")
+
+	var line map[string]interface{}
+	err := json.Unmarshal(buf.Bytes(), &line)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", line["msg"])
+	assert.Equal(t, "abc123", line["request_id"])
+	assert.Equal(t, "test", line["component"])
+}
+
+func TestGormLoggerOmitsParameters(t *testing.T) {
+	var buf bytes.Buffer
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: NewGormLogger(New(&buf, slog.LevelDebug)),
+	})
+	assert.NoError(t, err)
+
+	type secret struct {
+		ID   uint
+		Body string
+	}
+	assert.NoError(t, db.AutoMigrate(&secret{}))
+	assert.NoError(t, db.WithContext(WithRequestID(context.Background(), "req-1")).
+		Create(&secret{Body: "meet me after school"}).Error)
+
+	assert.Contains(t, buf.String(), "INSERT INTO")
+	assert.Contains(t, buf.String(), `"request_id":"req-1"`)
+	assert.NotContains(t, buf.String(), "meet me after school")
+}
+
+func TestGormLoggerLogsFailures(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewGormLogger(New(&buf, slog.LevelInfo))
+
+	logger.Trace(context.Background(), time.Now(), func() (string, int64) { return "SELECT 1", 0 }, nil)
+	assert.Empty(t, buf.String())
+
+	logger.Trace(context.Background(), time.Now(), func() (string, int64) { return "SELECT 1", 0 }, gorm.ErrRecordNotFound)
+	assert.Empty(t, buf.String())
+
+	logger.Trace(context.Background(), time.Now(), func() (string, int64) { return "SELECT 1", 0 }, gorm.ErrInvalidDB)
+	assert.Contains(t, buf.String(), "query failed")
+}
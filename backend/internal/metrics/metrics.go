@@ -0,0 +1,181 @@
+// Package metrics defines the Prometheus metrics exported by the server
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "lileye"
+
+// Registry holds every metric exported by the server
+var Registry = prometheus.NewRegistry()
+
+var (
+	// HTTPRequests counts requests by method, route and status code
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests handled, by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPDuration observes request latency by method and route
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency, by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	// NotificationsIngested counts stored notifications by device and
+	// package. Both come from clients, so Ingested caps their values.
+	NotificationsIngested = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_ingested_total",
+		Help:      "Notifications stored, by device and package.",
+	}, []string{"device_id", "package_name"})
+
+	// StorageDuration observes notification storage calls by method
+	StorageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "storage_query_duration_seconds",
+		Help:      "NotificationStorage call latency, by method.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"method"})
+
+	// PurgeRuns counts runs of the orphaned attachment cleanup by result
+	PurgeRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "purge_runs_total",
+		Help:      "Orphaned attachment cleanup runs, by result.",
+	}, []string{"result"})
+
+	// PurgeRemoved counts rows and blobs removed by the cleanup
+	PurgeRemoved = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "purge_removed_total",
+		Help:      "Attachments and blobs removed by the orphaned attachment cleanup.",
+	}, []string{"kind"})
+
+	// BackupRuns counts database backups by result
+	BackupRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "backup_runs_total",
+		Help:      "Database backups taken, by result.",
+	}, []string{"result"})
+
+	// BackupLastSuccess is the time of the last successful backup
+	BackupLastSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "backup_last_success_timestamp_seconds",
+		Help:      "Unix time of the last successful database backup.",
+	})
+
+	// RetentionDeleted counts notifications deleted by the retention policy
+	RetentionDeleted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "retention_deleted_total",
+		Help:      "Notifications deleted for being older than the retention period.",
+	})
+
+	// RateLimited counts requests refused for exceeding a rate limit, by
+	// route and the key limited, ip or device
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_total",
+		Help:      "Requests refused for exceeding a rate limit, by route and key.",
+	}, []string{"route", "key"})
+
+	// DuplicatesSuppressed counts notifications not stored because an app
+	// sent them again
+	DuplicatesSuppressed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "duplicates_suppressed_total",
+		Help:      "Notifications not stored for repeating one stored recently.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPDuration,
+		NotificationsIngested,
+		StorageDuration,
+		PurgeRuns,
+		PurgeRemoved,
+		BackupRuns,
+		BackupLastSuccess,
+		RetentionDeleted,
+		RateLimited,
+		DuplicatesSuppressed,
+	)
+}
+
+// RegisterDB exports the connection pool statistics of db
+func RegisterDB(db *sql.DB) error {
+	return Registry.Register(collectors.NewDBStatsCollector(db, "notifications"))
+}
+
+// ObserveStorage starts timing a storage call; call the returned function
+// when it finishes
+func ObserveStorage(method string) func() {
+	start := time.Now()
+	return func() {
+		StorageDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Other is the label value shared by the values past the cap of a label
+const Other = "other"
+
+// Caps on the values of the labels of NotificationsIngested. A household
+// has a few devices and a few hundred apps; past these, a client making up
+// IDs would add a series per request.
+var (
+	ingestedDevices  = newLabelSet(50)
+	ingestedPackages = newLabelSet(500)
+)
+
+// Ingested counts a notification stored for a device and package
+func Ingested(deviceID, packageName string) {
+	NotificationsIngested.WithLabelValues(ingestedDevices.value(deviceID), ingestedPackages.value(packageName)).Inc()
+}
+
+// labelSet caps the distinct values of a label taken from client input. The
+// first values seen keep their own series; later ones share Other.
+type labelSet struct {
+	max  int
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+func newLabelSet(max int) *labelSet {
+	return &labelSet{max: max, seen: map[string]bool{}}
+}
+
+// value returns the label value to record v under
+func (l *labelSet) value(v string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.seen[v] {
+		return v
+	}
+	if len(l.seen) >= l.max {
+		return Other
+	}
+	l.seen[v] = true
+	return v
+}
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
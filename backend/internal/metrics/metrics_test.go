@@ -0,0 +1,21 @@
+package metrics
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLabelSet(t *testing.T) {
+	l := newLabelSet(2)
+	assert.Equal(t, "phone1", l.value("phone1"))
+	assert.Equal(t, "phone2", l.value("phone2"))
+
+	// Values past the cap share a series, and those seen before keep theirs
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, Other, l.value(fmt.Sprintf("made-up-%d", i)))
+	}
+	assert.Equal(t, "phone1", l.value("phone1"))
+	assert.Len(t, l.seen, 2)
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lileye/backend/internal/apierror"
+	"github.com/lileye/backend/internal/storage"
+)
+
+// APIPrefix starts the routes of the current version of the API
+const APIPrefix = "/api/v1"
+
+// LegacyPrefix starts the routes of the API from before it was versioned.
+// They remain as deprecated aliases of the routes under APIPrefix.
+const LegacyPrefix = "/api"
+
+// AdminPrefix starts the routes that require an admin key
+const AdminPrefix = APIPrefix + "/admin/"
+
+// userKey holds the name of the user whose admin key authenticated the
+// request in the Gin context
+const userKey = "user"
+
+// Authenticate checks the admin key sent as a bearer token. Routes under
+// AdminPrefix require one; elsewhere a key is optional but, when sent, must
+// be valid. The key's user is recorded as the actor in the audit log.
+func Authenticate(keys *storage.AdminStorage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if header == "" {
+			if route, ok := apiRoute(c.FullPath()); ok && strings.HasPrefix(route, "/admin/") {
+				unauthorized(c, "an admin key is required")
+			}
+			return
+		}
+
+		value, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok {
+			unauthorized(c, "the Authorization header must hold a bearer token")
+			return
+		}
+		key, err := keys.Authenticate(c.Request.Context(), strings.TrimSpace(value))
+		if errors.Is(err, storage.ErrInvalidKey) {
+			unauthorized(c, "invalid admin key")
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to check admin key", "error", err)
+			apierror.Abort(c, http.StatusInternalServerError, "internal server error")
+			return
+		}
+		c.Set(userKey, key.User)
+	}
+}
+
+// User returns the name of the user authenticated by Authenticate, or ""
+func User(c *gin.Context) string {
+	return c.GetString(userKey)
+}
+
+func unauthorized(c *gin.Context, message string) {
+	c.Header("WWW-Authenticate", `Bearer realm="lileye"`)
+	apierror.Abort(c, http.StatusUnauthorized, message)
+}
+
+// apiRoute returns a route of the API relative to the prefix it is served
+// under, such as /notifications/:id for /api/v1/notifications/:id and its
+// legacy alias. It reports false for routes outside the API.
+func apiRoute(route string) (string, bool) {
+	for _, prefix := range []string{APIPrefix, LegacyPrefix} {
+		if rest, ok := strings.CutPrefix(route, prefix); ok && strings.HasPrefix(rest, "/") {
+			return rest, true
+		}
+	}
+	return "", false
+}
+
+// Deprecated marks the responses of the routes under LegacyPrefix as
+// deprecated, and links to the route under APIPrefix that replaces each
+func Deprecated() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Deprecation", "true")
+		if rest, ok := strings.CutPrefix(c.Request.URL.Path, LegacyPrefix); ok {
+			c.Header("Link", "<"+APIPrefix+rest+`>; rel="successor-version"`)
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lileye/backend/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestAuthenticate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, storage.Migrate(db))
+	admins := storage.NewAdminStorage(db)
+	_, err = admins.CreateUser(context.Background(), "alice")
+	assert.NoError(t, err)
+	key, err := admins.CreateKey(context.Background(), "alice", "")
+	assert.NoError(t, err)
+
+	r := gin.New()
+	r.Use(Authenticate(admins))
+	whoami := func(c *gin.Context) { c.String(http.StatusOK, User(c)) }
+	r.GET("/api/v1/admin/stats", whoami)
+	r.GET("/api/admin/stats", whoami)
+	r.GET("/api/v1/notifications", whoami)
+
+	send := func(path, authorization string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send("/api/v1/admin/stats", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `Bearer realm="lileye"`, w.Header().Get("WWW-Authenticate"))
+	assert.Contains(t, w.Body.String(), `"code":"unauthorized"`)
+	// The legacy alias is guarded the same way
+	w = send("/api/admin/stats", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = send("/api/v1/admin/stats", "Bearer "+key.Key)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "alice", w.Body.String())
+
+	// Elsewhere a key is optional, but must be valid when sent
+	w = send("/api/v1/notifications", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Body.String())
+	w = send("/api/v1/notifications", "Bearer lek_wrong")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = send("/api/v1/notifications", "Basic YWxpY2U6")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
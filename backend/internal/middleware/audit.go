@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lileye/backend/internal/logging"
+	"github.com/lileye/backend/internal/models"
+	"github.com/lileye/backend/internal/storage"
+)
+
+// ActorHeader names the person making a request. Anyone can send any name,
+// so it is recorded apart from the actor, as the claimed actor.
+const ActorHeader = "X-Actor"
+
+// anonymousActor is recorded for requests without an admin key
+const anonymousActor = "anonymous"
+
+// maxClaimedActor is the longest claimed actor recorded, in bytes
+const maxClaimedActor = 100
+
+// redactedParams are the parameters that match notification content or
+// senders. The audit log cannot be purged, so only their presence is
+// recorded.
+var redactedParams = []string{"q", "from", "person", "conversation_title", "sub_text"}
+
+// auditActionKey holds the audit action of the matched route in the Gin
+// context
+const auditActionKey = "audit_action"
+
+// Audited marks a route for the audit log under the given action, such as
+// "notification.search". It is registered ahead of the route's handler.
+func Audited(action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(auditActionKey, action)
+	}
+}
+
+// Audit appends an entry to the audit log for every request to a route
+// marked with Audited, once the request has been handled. Requests are not
+// failed when the entry cannot be stored; the error is logged instead.
+func Audit(audit *storage.AuditStorage, logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		action := c.GetString(auditActionKey)
+		if action == "" {
+			return
+		}
+
+		actor := User(c)
+		if actor == "" {
+			actor = anonymousActor
+		}
+		claimed := strings.ToValidUTF8(strings.TrimSpace(c.GetHeader(ActorHeader)), "")
+		if len(claimed) > maxClaimedActor {
+			claimed = strings.ToValidUTF8(claimed[:maxClaimedActor], "")
+		}
+		params := c.Request.URL.Query()
+		for _, p := range c.Params {
+			params.Set(p.Key, p.Value)
+		}
+		for _, name := range redactedParams {
+			if params.Has(name) {
+				params.Set(name, "redacted")
+			}
+		}
+
+		entry := &models.AuditEntry{
+			Actor:        actor,
+			ClaimedActor: claimed,
+			Action:       action,
+			DeviceID:     auditDeviceID(c, params),
+			Params:       params.Encode(),
+			IP:           c.ClientIP(),
+			RequestID:    logging.RequestID(c.Request.Context()),
+			Status:       c.Writer.Status(),
+		}
+		if route, _ := apiRoute(c.FullPath()); strings.HasPrefix(route, "/notifications/:id") {
+			if id, err := strconv.ParseUint(c.Param("id"), 10, 64); err == nil {
+				entry.NotificationID = uint(id)
+			}
+		}
+
+		if err := audit.Append(c.Request.Context(), entry); err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to write audit log", "action", action, "error", err)
+		}
+	}
+}
+
+// auditDeviceID returns the device a request is about, from the deviceID
+// path parameter or the device_id query parameter
+func auditDeviceID(c *gin.Context, params url.Values) string {
+	if id := c.Param("deviceID"); id != "" {
+		return id
+	}
+	return params.Get("device_id")
+}
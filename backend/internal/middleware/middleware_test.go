@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lileye/backend/internal/logging"
+	"github.com/lileye/backend/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupRouter(buf *bytes.Buffer) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	logger := logging.New(buf, slog.LevelInfo)
+
+	r := gin.New()
+	r.Use(RequestID(), Logger(logger), Metrics(), Recovery(logger))
+	r.GET("/echo", func(c *gin.Context) {
+		c.String(http.StatusOK, logging.RequestID(c.Request.Context()))
+	})
+	r.GET("/panic", func(c *gin.Context) {
+		panic("boom")
+	})
+	return r
+}
+
+func TestRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	r := setupRouter(&buf)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/echo", nil)
+	r.ServeHTTP(w, req)
+
+	id := w.Header().Get(RequestIDHeader)
+	assert.Len(t, id, 32)
+	assert.Equal(t, id, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/echo", nil)
+	req.Header.Set(RequestIDHeader, "client-id-1")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, "client-id-1", w.Header().Get(RequestIDHeader))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/echo", nil)
+	req.Header.Set(RequestIDHeader, "bad id\n")
+	r.ServeHTTP(w, req)
+	assert.NotEqual(t, "bad id\n", w.Header().Get(RequestIDHeader))
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	r := setupRouter(&buf)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/echo?q=secret+message", nil)
+	r.ServeHTTP(w, req)
+
+	var line map[string]interface{}
+	err := json.Unmarshal(buf.Bytes(), &line)
+	assert.NoError(t, err)
+	assert.Equal(t, "request", line["msg"])
+	assert.Equal(t, "/echo", line["route"])
+	assert.Equal(t, float64(200), line["status"])
+	assert.Equal(t, w.Header().Get(RequestIDHeader), line["request_id"])
+	assert.NotContains(t, buf.String(), "secret")
+}
+
+func TestRecovery(t *testing.T) {
+	var buf bytes.Buffer
+	r := setupRouter(&buf)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/panic", nil)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, w.Body.String(), w.Header().Get(RequestIDHeader))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 2)
+	assert.Contains(t, lines[0], `"msg":"panic"`)
+	assert.Contains(t, lines[1], `"level":"ERROR"`)
+}
+
+func TestMetrics(t *testing.T) {
+	var buf bytes.Buffer
+	r := setupRouter(&buf)
+
+	requests := metrics.HTTPRequests.WithLabelValues("GET", "/echo", "200")
+	unmatched := metrics.HTTPRequests.WithLabelValues("GET", "unmatched", "404")
+	before, beforeUnmatched := testutil.ToFloat64(requests), testutil.ToFloat64(unmatched)
+
+	for _, path := range []string{"/echo", "/echo", "/missing/1"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		r.ServeHTTP(w, req)
+	}
+
+	assert.Equal(t, before+2, testutil.ToFloat64(requests))
+	assert.Equal(t, beforeUnmatched+1, testutil.ToFloat64(unmatched))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	metrics.Handler().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `lileye_http_request_duration_seconds_count{method="GET",route="/echo"}`)
+}
+
+func TestDeprecated(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.Group(APIPrefix).GET("/devices", ok)
+	r.Group(LegacyPrefix, Deprecated()).GET("/devices", ok)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/devices", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "true", w.Header().Get("Deprecation"))
+	assert.Equal(t, `</api/v1/devices>; rel="successor-version"`, w.Header().Get("Link"))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/v1/devices", nil)
+	r.ServeHTTP(w, req)
+	assert.Empty(t, w.Header().Get("Deprecation"))
+}
@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lileye/backend/internal/apierror"
+	"github.com/lileye/backend/internal/metrics"
+	"github.com/lileye/backend/internal/throttle"
+)
+
+// rateLimitKey holds the limit of the route of the request in the Gin
+// context
+const rateLimitKey = "rate_limit"
+
+// limit is a rule with the buckets of the clients it has seen
+type limit struct {
+	rule       throttle.Rule
+	ip, device *throttle.Limiter
+}
+
+// RateLimit refuses requests beyond the rates of the first of rules that
+// matches their route, with 429 and a Retry-After header. Rules name the
+// routes under APIPrefix, and also cover their legacy aliases. Requests are
+// counted per client address and, for routes of a device such as
+// /notifications/device/:deviceID, per device; handlers count the devices
+// named in request bodies with AllowDevice.
+func RateLimit(rules []throttle.Rule) gin.HandlerFunc {
+	limits := make([]*limit, len(rules))
+	for i, rule := range rules {
+		limits[i] = &limit{rule: rule}
+		if rule.IP != nil {
+			limits[i].ip = throttle.NewLimiter(*rule.IP)
+		}
+		if rule.Device != nil {
+			limits[i].device = throttle.NewLimiter(*rule.Device)
+		}
+	}
+
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if rest, ok := apiRoute(route); ok {
+			route = APIPrefix + rest
+		}
+		if route == "" {
+			return
+		}
+		for _, l := range limits {
+			if !l.rule.Match(c.Request.Method, route) {
+				continue
+			}
+			c.Set(rateLimitKey, l)
+			if l.ip != nil && !allow(c, l.ip, "ip", map[string]int{c.ClientIP(): 1}) {
+				return
+			}
+			device := c.Param("deviceID")
+			if device == "" {
+				device = c.Query("device_id")
+			}
+			if device != "" {
+				AllowDevice(c, device, 1)
+			}
+			return
+		}
+	}
+}
+
+// AllowDevice counts n requests of a device against the rate limit of the
+// route. When the device is over its limit, it responds with 429 and
+// reports false.
+func AllowDevice(c *gin.Context, deviceID string, n int) bool {
+	return AllowDevices(c, map[string]int{deviceID: n})
+}
+
+// AllowDevices counts counts[device] requests of each device at once, as
+// for a batch naming several devices. When any device is over its limit,
+// none are counted, and it responds with 429 and reports false.
+func AllowDevices(c *gin.Context, counts map[string]int) bool {
+	l := routeLimit(c)
+	if l == nil || l.device == nil {
+		return true
+	}
+	return allow(c, l.device, "device", counts)
+}
+
+// TakeDevice counts a request of a device against the rate limit of the
+// route like AllowDevice, but leaves the response to the caller, as for the
+// messages of a stream. When the device is over its limit, it reports false
+// with the time to wait, in whole seconds.
+func TakeDevice(c *gin.Context, deviceID string) (bool, time.Duration) {
+	l := routeLimit(c)
+	if l == nil || l.device == nil {
+		return true, 0
+	}
+	return take(c, l.device, "device", map[string]int{deviceID: 1})
+}
+
+// routeLimit returns the limit RateLimit found for the route, or nil
+func routeLimit(c *gin.Context) *limit {
+	value, ok := c.Get(rateLimitKey)
+	if !ok {
+		return nil
+	}
+	return value.(*limit)
+}
+
+func allow(c *gin.Context, limiter *throttle.Limiter, kind string, counts map[string]int) bool {
+	ok, wait := take(c, limiter, kind, counts)
+	if ok {
+		return true
+	}
+	c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())))
+	who := "device"
+	if kind == "ip" {
+		who = "address"
+	}
+	apierror.Abort(c, http.StatusTooManyRequests, fmt.Sprintf("too many requests from this %s; retry in %s", who, wait))
+	return false
+}
+
+// take counts requests against limiter, rounding the wait of refused ones
+// up to whole seconds as Retry-After gives them
+func take(c *gin.Context, limiter *throttle.Limiter, kind string, counts map[string]int) (bool, time.Duration) {
+	ok, wait := limiter.AllowAll(counts)
+	if ok {
+		return true, 0
+	}
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	metrics.RateLimited.WithLabelValues(c.FullPath(), kind).Inc()
+	return false, time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lileye/backend/internal/throttle"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rules, err := throttle.ParseRules([]string{
+		"POST /api/v1/notifications ip=3/h device=2/h",
+		"GET /api/v1/notifications/device/:deviceID device=1/h",
+		"* /api/v1/* ip=1/h",
+	})
+	assert.NoError(t, err)
+
+	r := gin.New()
+	r.Use(RateLimit(rules))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	create := func(c *gin.Context) {
+		if AllowDevice(c, c.Query("device"), 1) {
+			c.Status(http.StatusCreated)
+		}
+	}
+	r.POST("/api/v1/notifications", create)
+	r.POST("/api/notifications", create)
+	r.GET("/api/v1/notifications/device/:deviceID", ok)
+	r.GET("/api/v1/devices", ok)
+	r.GET("/healthz", ok)
+
+	send := func(method, path, ip string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, nil)
+		req.RemoteAddr = ip + ":1234"
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// Devices named by handlers are limited within the address limit
+	assert.Equal(t, http.StatusCreated, send("POST", "/api/v1/notifications?device=phone1", "192.0.2.1").Code)
+	assert.Equal(t, http.StatusCreated, send("POST", "/api/v1/notifications?device=phone1", "192.0.2.2").Code)
+	w := send("POST", "/api/v1/notifications?device=phone1", "192.0.2.3")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"rate_limited"`)
+	assert.Contains(t, w.Body.String(), "too many requests from this device")
+	retry, err := strconv.Atoi(w.Header().Get("Retry-After"))
+	assert.NoError(t, err)
+	assert.InDelta(t, 1800, retry, 1)
+
+	// The legacy alias shares the rule, and its buckets
+	assert.Equal(t, http.StatusCreated, send("POST", "/api/notifications?device=phone2", "192.0.2.1").Code)
+	assert.Equal(t, http.StatusCreated, send("POST", "/api/notifications?device=phone3", "192.0.2.1").Code)
+	w = send("POST", "/api/v1/notifications?device=phone4", "192.0.2.1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Contains(t, w.Body.String(), "too many requests from this address")
+
+	// Devices in the path are limited by the middleware
+	assert.Equal(t, http.StatusOK, send("GET", "/api/v1/notifications/device/phone1", "192.0.2.1").Code)
+	assert.Equal(t, http.StatusTooManyRequests, send("GET", "/api/v1/notifications/device/phone1", "192.0.2.1").Code)
+	assert.Equal(t, http.StatusOK, send("GET", "/api/v1/notifications/device/phone2", "192.0.2.1").Code)
+
+	// Only the first matching rule applies
+	assert.Equal(t, http.StatusOK, send("GET", "/api/v1/devices", "192.0.2.1").Code)
+	assert.Equal(t, http.StatusTooManyRequests, send("GET", "/api/v1/devices", "192.0.2.1").Code)
+
+	// Routes no rule matches are not limited
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, send("GET", "/healthz", "192.0.2.1").Code)
+	}
+}
+
+func TestAllowDevices(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rules, err := throttle.ParseRules([]string{"POST /api/v1/notifications/batch device=2/h"})
+	assert.NoError(t, err)
+
+	r := gin.New()
+	r.Use(RateLimit(rules))
+	r.POST("/api/v1/notifications/batch", func(c *gin.Context) {
+		counts := map[string]int{}
+		for _, device := range c.QueryArray("device") {
+			counts[device]++
+		}
+		if AllowDevices(c, counts) {
+			c.Status(http.StatusCreated)
+		}
+	})
+
+	send := func(query string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/notifications/batch?"+query, nil)
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusCreated, send("device=phone2&device=phone2"))
+	// A batch with a device over its limit counts none of its devices
+	assert.Equal(t, http.StatusTooManyRequests, send("device=phone1&device=phone1&device=phone2"))
+	assert.Equal(t, http.StatusCreated, send("device=phone1&device=phone1"))
+}
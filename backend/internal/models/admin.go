@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+// User is a person allowed to operate the server through the admin API
+type User struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name" gorm:"not null;uniqueIndex"`
+}
+
+func (User) TableName() string {
+	return "users"
+}
+
+// AdminKey is a credential of a user for the admin API. Only the SHA-256
+// hash of the key is stored; the key itself is shown once, when created.
+type AdminKey struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at"`
+	// User is the name of the user holding the key
+	User string `json:"user" gorm:"not null;index"`
+	Name string `json:"name"`
+	// Prefix is the start of the key, to recognise it by
+	Prefix     string     `json:"prefix" gorm:"not null"`
+	Hash       string     `json:"-" gorm:"not null;uniqueIndex"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+func (AdminKey) TableName() string {
+	return "admin_keys"
+}
+
+// CreatedAdminKey is a new admin key together with its secret value
+type CreatedAdminKey struct {
+	AdminKey
+	Key string `json:"key"`
+}
+
+// Stats summarises what the server stores
+type Stats struct {
+	Notifications int64 `json:"notifications"`
+	Devices       int64 `json:"devices"`
+	Apps          int64 `json:"apps"`
+	Senders       int64 `json:"senders"`
+	Attachments   int64 `json:"attachments"`
+	// OpenAlerts counts the alerts not acknowledged yet
+	OpenAlerts int64 `json:"open_alerts"`
+	// Oldest and Newest are the timestamps of the oldest and newest
+	// notifications
+	Oldest        *time.Time `json:"oldest,omitempty"`
+	Newest        *time.Time `json:"newest,omitempty"`
+	DatabaseBytes int64      `json:"database_bytes"`
+	SchemaVersion int        `json:"schema_version"`
+}
+
+// DeviceStats summarises the notifications of one device
+type DeviceStats struct {
+	DeviceID      string `json:"device_id"`
+	DeviceName    string `json:"device_name"`
+	Notifications int64  `json:"notifications"`
+	// LastSeen is the timestamp of the device's newest notification
+	LastSeen time.Time `json:"last_seen"`
+}
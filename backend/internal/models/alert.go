@@ -0,0 +1,49 @@
+package models
+
+import (
+	"github.com/lileye/backend/internal/fieldcrypt"
+	"gorm.io/gorm"
+)
+
+// Alert types
+const (
+	AlertNewContact = "new_contact"
+)
+
+// Alert flags something a parent should look at, such as a child talking to
+// someone new on a watched app
+type Alert struct {
+	gorm.Model
+	Type           string `json:"type" gorm:"not null;index"`
+	DeviceID       string `json:"device_id" gorm:"not null;index"`
+	PackageName    string `json:"package_name" gorm:"not null"`
+	From           string `json:"from" gorm:"serializer:encrypted"`
+	NotificationID uint   `json:"notification_id"`
+	Acknowledged   bool   `json:"acknowledged" gorm:"not null;default:false;index"`
+}
+
+func (Alert) TableName() string {
+	return "alerts"
+}
+
+// AllowlistEntry suppresses new contact alerts for a known sender. Empty
+// device and package fields match any device or app. Identity is encrypted
+// at rest and matched by IdentityIndex, its blind index.
+type AllowlistEntry struct {
+	gorm.Model
+	Identity      string `json:"identity" gorm:"not null;serializer:encrypted"`
+	IdentityIndex string `json:"-" gorm:"index"`
+	DeviceID      string `json:"device_id"`
+	PackageName   string `json:"package_name"`
+	Note          string `json:"note"`
+}
+
+func (AllowlistEntry) TableName() string {
+	return "allowlist"
+}
+
+// BeforeSave indexes the identity
+func (e *AllowlistEntry) BeforeSave(*gorm.DB) error {
+	e.IdentityIndex = fieldcrypt.BlindIndex(e.Identity)
+	return nil
+}
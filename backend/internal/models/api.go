@@ -0,0 +1,215 @@
+package models
+
+import "time"
+
+// Bodies of API requests and responses that are not stored. They are
+// described in the OpenAPI document and used by the Go client.
+
+// ErrorResponse is the body of every error response
+type ErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+// APIError describes why a request failed
+type APIError struct {
+	// Code is one of the Code constants, for clients to act on
+	Code string `json:"code"`
+	// Message explains the error to a person
+	Message string `json:"message"`
+	// RequestID finds the request in the server logs
+	RequestID string `json:"request_id"`
+	// Fields lists the invalid fields of the request, if any
+	Fields []FieldError `json:"fields,omitempty"`
+}
+
+// FieldError is an invalid field or parameter of a request
+type FieldError struct {
+	// Field is the name of the field as sent, such as "device_id"
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Codes of API errors
+const (
+	CodeInvalidRequest       = "invalid_request"
+	CodeUnauthorized         = "unauthorized"
+	CodeNotFound             = "not_found"
+	CodeConflict             = "conflict"
+	CodePayloadTooLarge      = "payload_too_large"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeRateLimited          = "rate_limited"
+	CodeInternal             = "internal"
+)
+
+// StreamReply answers a notification sent on the notification stream, in
+// the order they were sent. Status is that of the same notification posted
+// to /notifications: 201 when it was stored, 200 when it repeats one stored
+// recently, or that of its error.
+type StreamReply struct {
+	Status       int           `json:"status"`
+	Notification *Notification `json:"notification,omitempty"`
+	Error        *APIError     `json:"error,omitempty"`
+}
+
+// Message is the response of requests that delete or acknowledge
+// something
+type Message struct {
+	Message string `json:"message"`
+}
+
+// Updated is the number of records a request changed
+type Updated struct {
+	Updated int64 `json:"updated"`
+}
+
+// HealthStatus is the response of the liveness probe
+type HealthStatus struct {
+	Status string `json:"status"`
+}
+
+// Worker states
+const (
+	WorkerRunning = "running"
+	WorkerStopped = "stopped"
+)
+
+// WorkerStatus describes a background worker
+type WorkerStatus struct {
+	Name      string     `json:"name"`
+	State     string     `json:"state"`
+	Runs      int64      `json:"runs"`
+	LastRun   *time.Time `json:"last_run,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+}
+
+// HealthCheck is the result of one readiness check
+type HealthCheck struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// HealthReport is the readiness of the server
+type HealthReport struct {
+	Ready    bool           `json:"ready"`
+	Draining bool           `json:"draining"`
+	Checks   []HealthCheck  `json:"checks"`
+	Workers  []WorkerStatus `json:"workers"`
+}
+
+// PurgeResult is the number of notifications a purge deleted, or would
+// delete on a dry run
+type PurgeResult struct {
+	Notifications int64 `json:"notifications"`
+	DryRun        bool  `json:"dry_run"`
+}
+
+// CreateUserRequest adds a user
+type CreateUserRequest struct {
+	Name string `json:"name"`
+}
+
+// CreateKeyRequest creates an admin key for a user
+type CreateKeyRequest struct {
+	User string `json:"user"`
+	// Name describes what the key is for
+	Name string `json:"name,omitempty"`
+}
+
+// SetCategoryRequest assigns a category to an app
+type SetCategoryRequest struct {
+	Category string `json:"category"`
+}
+
+// SetWatchedRequest turns new contact alerts for an app on or off
+type SetWatchedRequest struct {
+	Watched bool `json:"watched"`
+}
+
+// UpdateContactRequest renames a contact or changes its status. Empty
+// fields are left unchanged.
+type UpdateContactRequest struct {
+	Name   string `json:"name,omitempty"`
+	Status string `json:"status,omitempty"`
+}
+
+// MergeContactsRequest merges contacts into another one
+type MergeContactsRequest struct {
+	ContactIDs []uint `json:"contact_ids"`
+}
+
+// AuditVerification is the result of checking the hash chain of the audit
+// log
+type AuditVerification struct {
+	Valid   bool  `json:"valid"`
+	Entries int64 `json:"entries"`
+	// Head is the hash of the last entry. Keeping a copy of it elsewhere
+	// also detects entries removed from the end of the log.
+	Head     string `json:"head"`
+	BrokenAt uint   `json:"broken_at,omitempty"`
+	Problem  string `json:"problem,omitempty"`
+}
+
+// BackupManifest describes a backup
+type BackupManifest struct {
+	// File is the name of the snapshot in the backup directory
+	File          string    `json:"file"`
+	CreatedAt     time.Time `json:"created_at"`
+	Size          int64     `json:"size"`
+	SHA256        string    `json:"sha256"`
+	SchemaVersion int       `json:"schema_version"`
+	Notifications int64     `json:"notifications"`
+	// AppVersion is the version of the server that took the backup
+	AppVersion string `json:"app_version"`
+}
+
+// RetentionRun is one application of the retention policy
+type RetentionRun struct {
+	Time time.Time `json:"time"`
+	// Cutoff is the time before which notifications were deleted
+	Cutoff  time.Time `json:"cutoff"`
+	Deleted int64     `json:"deleted"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// RetentionStatus describes the retention policy and what it would delete
+// now
+type RetentionStatus struct {
+	MaxAge   Duration `json:"max_age"`
+	Interval Duration `json:"interval"`
+	// Cutoff and Eligible are the time before which notifications are
+	// deleted and their number, when the policy is enabled
+	Cutoff   *time.Time    `json:"cutoff,omitempty"`
+	Eligible int64         `json:"eligible"`
+	LastRun  *RetentionRun `json:"last_run,omitempty"`
+}
+
+// CAInfo identifies the CA that issued the server certificate so that
+// clients can pin it
+type CAInfo struct {
+	// Fingerprint is the SHA-256 of the CA certificate, as colon-separated hex
+	Fingerprint string `json:"fingerprint_sha256"`
+	// SPKIPin is the base64 SHA-256 of the CA public key, the format used by
+	// OkHttp's CertificatePinner and Android network security config
+	SPKIPin  string    `json:"spki_sha256"`
+	NotAfter time.Time `json:"not_after"`
+	PEM      string    `json:"pem"`
+}
+
+// Duration is a time.Duration written as a string such as "30s" or "1h"
+type Duration time.Duration
+
+// UnmarshalText parses a duration string
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalText formats the duration as a string
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
@@ -0,0 +1,59 @@
+package models
+
+import "gorm.io/gorm"
+
+// App categories that can be assigned in the app catalog
+const (
+	AppCategoryMessaging     = "messaging"
+	AppCategoryEmail         = "email"
+	AppCategorySystem        = "system"
+	AppCategoryEntertainment = "entertainment"
+	AppCategoryOther         = "other"
+)
+
+// AppCategories lists every valid app category
+var AppCategories = []string{
+	AppCategoryMessaging,
+	AppCategoryEmail,
+	AppCategorySystem,
+	AppCategoryEntertainment,
+	AppCategoryOther,
+}
+
+// App is an entry in the app catalog, giving an Android package a friendly
+// name, a category and optionally an icon kept in the blob store
+type App struct {
+	gorm.Model
+	PackageName  string `json:"package_name" gorm:"not null;uniqueIndex"`
+	Name         string `json:"name"`
+	Category     string `json:"category" gorm:"index"`
+	IconSHA256   string `json:"icon_sha256,omitempty" gorm:"column:icon_sha256"`
+	IconMimeType string `json:"icon_mime_type,omitempty"`
+
+	// Watched apps raise an alert when a new sender appears
+	Watched bool `json:"watched" gorm:"not null;default:false"`
+}
+
+func (App) TableName() string {
+	return "apps"
+}
+
+// DefaultApps seeds the app catalog with well-known apps
+var DefaultApps = []App{
+	{PackageName: "com.whatsapp", Name: "WhatsApp", Category: AppCategoryMessaging, Watched: true},
+	{PackageName: "com.facebook.orca", Name: "Messenger", Category: AppCategoryMessaging, Watched: true},
+	{PackageName: "com.telegram", Name: "Telegram", Category: AppCategoryMessaging, Watched: true},
+	{PackageName: "org.telegram.messenger", Name: "Telegram", Category: AppCategoryMessaging, Watched: true},
+	{PackageName: "com.snapchat.android", Name: "Snapchat", Category: AppCategoryMessaging, Watched: true},
+	{PackageName: "com.instagram.android", Name: "Instagram", Category: AppCategoryMessaging, Watched: true},
+	{PackageName: "com.google.android.gm", Name: "Gmail", Category: AppCategoryEmail},
+	{PackageName: "com.microsoft.office.outlook", Name: "Outlook", Category: AppCategoryEmail},
+	{PackageName: "com.yahoo.mobile.client.android.mail", Name: "Yahoo Mail", Category: AppCategoryEmail},
+	{PackageName: "com.android.systemui", Name: "System", Category: AppCategorySystem},
+	{PackageName: "com.google.android.apps.nexuslauncher", Name: "Launcher", Category: AppCategorySystem},
+	{PackageName: "com.android.settings", Name: "Settings", Category: AppCategorySystem},
+	{PackageName: "com.netflix.mediaclient", Name: "Netflix", Category: AppCategoryEntertainment},
+	{PackageName: "com.spotify.music", Name: "Spotify", Category: AppCategoryEntertainment},
+	{PackageName: "com.google.android.youtube", Name: "YouTube", Category: AppCategoryEntertainment},
+	{PackageName: "com.amazon.avod.thirdpartyclient", Name: "Prime Video", Category: AppCategoryEntertainment},
+}
@@ -0,0 +1,27 @@
+package models
+
+import "gorm.io/gorm"
+
+// Attachment kinds reported by devices
+const (
+	AttachmentIcon   = "icon"
+	AttachmentImage  = "image"
+	AttachmentAvatar = "avatar"
+)
+
+// Attachment is a binary file, such as a message image or avatar, that
+// belongs to a notification. The content lives in the blob store under its
+// SHA-256 hash so identical files are stored once.
+type Attachment struct {
+	gorm.Model
+	NotificationID uint   `json:"notification_id" gorm:"not null;index"`
+	Kind           string `json:"kind" gorm:"not null"`
+	Filename       string `json:"filename"`
+	MimeType       string `json:"mime_type" gorm:"not null"`
+	Size           int64  `json:"size" gorm:"not null"`
+	SHA256         string `json:"sha256" gorm:"column:sha256;not null;index"`
+}
+
+func (Attachment) TableName() string {
+	return "attachments"
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// AuditEntry records one access to monitored data: who read, searched,
+// exported or deleted what. Entries are append-only and chained by a keyed
+// hash, each one covering the hash of the entry before it, so that changing
+// or removing an entry breaks the chain.
+type AuditEntry struct {
+	ID    uint      `json:"id" gorm:"primarykey"`
+	Time  time.Time `json:"time" gorm:"not null;index"`
+	Actor string    `json:"actor" gorm:"not null;index"`
+	// ClaimedActor is the name the client gave for itself, unverified
+	ClaimedActor   string `json:"claimed_actor,omitempty"`
+	Action         string `json:"action" gorm:"not null;index"`
+	DeviceID       string `json:"device_id,omitempty" gorm:"index"`
+	NotificationID uint   `json:"notification_id,omitempty" gorm:"index"`
+	// Params are the path and query parameters of the request, URL-encoded
+	Params    string `json:"params,omitempty"`
+	IP        string `json:"ip"`
+	RequestID string `json:"request_id"`
+	Status    int    `json:"status"`
+	PrevHash  string `json:"prev_hash"`
+	Hash      string `json:"hash" gorm:"not null;uniqueIndex"`
+}
+
+func (AuditEntry) TableName() string {
+	return "audit_log"
+}
+
+// AuditPage is a single page of audit entries together with the total
+// number of matching entries
+type AuditPage struct {
+	Entries []AuditEntry `json:"entries"`
+	Total   int64        `json:"total"`
+	Limit   int          `json:"limit"`
+	Offset  int          `json:"offset"`
+}
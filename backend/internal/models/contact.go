@@ -0,0 +1,82 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/lileye/backend/internal/fieldcrypt"
+	"gorm.io/gorm"
+)
+
+// Contact statuses
+const (
+	ContactUnknown = "unknown"
+	ContactTrusted = "trusted"
+	ContactBlocked = "blocked"
+)
+
+// Contact is a person that sends notifications, possibly under several
+// names or numbers across apps and devices. Name is encrypted at rest when
+// encryption is configured.
+type Contact struct {
+	gorm.Model
+	Name    string         `json:"name" gorm:"not null;serializer:encrypted"`
+	Status  string         `json:"status" gorm:"not null;default:unknown;index"`
+	Aliases []ContactAlias `json:"aliases,omitempty"`
+}
+
+func (Contact) TableName() string {
+	return "contacts"
+}
+
+// ContactAlias is a sender identity, as it appears in the From field of
+// notifications, that belongs to a contact. Name and Identity are encrypted
+// at rest, and aliases are matched by IdentityIndex, the blind index of
+// Identity.
+type ContactAlias struct {
+	gorm.Model
+	ContactID     uint   `json:"contact_id" gorm:"not null;index"`
+	Name          string `json:"name" gorm:"not null;serializer:encrypted"`
+	Identity      string `json:"identity" gorm:"not null;serializer:encrypted"`
+	IdentityIndex string `json:"-" gorm:"uniqueIndex"`
+}
+
+func (ContactAlias) TableName() string {
+	return "contact_aliases"
+}
+
+// BeforeSave indexes the identity
+func (a *ContactAlias) BeforeSave(*gorm.DB) error {
+	a.IdentityIndex = fieldcrypt.BlindIndex(a.Identity)
+	return nil
+}
+
+// AliasIndex links the blind index of a From value to the alias its
+// identity belongs to. An alias matches every spelling of its identity,
+// such as "Alice" and " alice ", and each spelling has its own blind index,
+// so a contact's notifications are found through the from_index column
+// without decrypting senders.
+type AliasIndex struct {
+	FromIndex string `gorm:"primaryKey"`
+	AliasID   uint   `gorm:"not null;index"`
+}
+
+func (AliasIndex) TableName() string {
+	return "contact_alias_indexes"
+}
+
+// NormalizeIdentity turns a From value into the identity used to match
+// aliases, so that differences in case and surrounding spaces are ignored
+func NormalizeIdentity(from string) string {
+	return strings.ToLower(strings.TrimSpace(from))
+}
+
+// ContactActivity summarises a contact's notifications in one app on one
+// device
+type ContactActivity struct {
+	DeviceID     string    `json:"device_id"`
+	PackageName  string    `json:"package_name"`
+	MessageCount int64     `json:"message_count"`
+	FirstSeen    time.Time `json:"first_seen"`
+	LastSeen     time.Time `json:"last_seen"`
+}
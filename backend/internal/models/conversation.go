@@ -0,0 +1,14 @@
+package models
+
+// Conversation summarises a messaging thread on a device. Threads are keyed by
+// device, package and sender, except for group chats which are keyed by their
+// conversation title so that messages from every member end up together.
+type Conversation struct {
+	DeviceID     string       `json:"device_id"`
+	PackageName  string       `json:"package_name"`
+	From         string       `json:"from"`
+	IsGroup      bool         `json:"is_group"`
+	MessageCount int64        `json:"message_count"`
+	UnreadCount  int64        `json:"unread_count"`
+	LastMessage  Notification `json:"last_message"`
+}
@@ -1,21 +1,143 @@
 package models
 
 import (
+	"strings"
 	"time"
 
+	"github.com/lileye/backend/internal/fieldcrypt"
 	"gorm.io/gorm"
 )
 
-// Notification represents an Android notification in the system
+// Notification represents an Android notification in the system. Title,
+// Message, From, ConversationTitle, SubText, BigText, People and Extras are
+// encrypted at rest when encryption is configured.
 type Notification struct {
 	gorm.Model
-	Title       string    `json:"title" gorm:"not null"`
-	Message     string    `json:"message" gorm:"not null"`
+	Title       string    `json:"title" gorm:"not null;serializer:encrypted"`
+	Message     string    `json:"message" gorm:"not null;serializer:encrypted"`
 	Timestamp   time.Time `json:"timestamp" gorm:"not null;index"`
 	PackageName string    `json:"package_name" gorm:"not null;index"`
-	From        string    `json:"from" gorm:"index"`
+	From        string    `json:"from" gorm:"serializer:encrypted"`
 	DeviceID    string    `json:"device_id" gorm:"not null;index"`
 	DeviceName  string    `json:"device_name"`
+
+	// FromIndex is the blind index of From, used to match senders in SQL
+	FromIndex string `json:"-" gorm:"index"`
+
+	// Extras holds every Android notification extra as reported by the
+	// device. Well-known keys are promoted to the columns below on save.
+	Extras map[string]string `json:"extras,omitempty" gorm:"serializer:encrypted"`
+
+	// ConversationTitle and IsGroupConversation mirror the Android
+	// android.conversationTitle and android.isGroupConversation extras and are
+	// used to recognise group chats when threading conversations.
+	ConversationTitle   string `json:"conversation_title" gorm:"serializer:encrypted"`
+	IsGroupConversation bool   `json:"is_group_conversation"`
+	SubText             string `json:"sub_text" gorm:"serializer:encrypted"`
+	BigText             string `json:"big_text" gorm:"serializer:encrypted"`
+	People              string `json:"people" gorm:"serializer:encrypted"`
+	Category            string `json:"category" gorm:"index"`
+	ChannelID           string `json:"channel_id" gorm:"index"`
+	Read                bool   `json:"read" gorm:"not null;default:false"`
+
+	// ConversationTitleIndex and SubTextIndex are the blind indexes of
+	// their columns. PeopleIndex holds the blind index of each person,
+	// between commas.
+	ConversationTitleIndex string `json:"-" gorm:"index"`
+	SubTextIndex           string `json:"-" gorm:"index"`
+	PeopleIndex            string `json:"-"`
+
+	// Key is the stable Android notification key that lifecycle events refer
+	// to. State, RemovedAt and RemovalReason follow the latest event.
+	Key           string     `json:"key,omitempty" gorm:"column:notification_key;index"`
+	State         string     `json:"state" gorm:"not null;default:posted"`
+	RemovedAt     *time.Time `json:"removed_at,omitempty"`
+	RemovalReason string     `json:"removal_reason,omitempty"`
+
+	// AppName and AppCategory come from the app catalog and are filled in
+	// when loading
+	AppName     string `json:"app_name,omitempty" gorm:"-"`
+	AppCategory string `json:"app_category,omitempty" gorm:"-"`
+
+	// OnScreenSeconds is how long the notification was shown before it was
+	// removed. It is computed when loading and not stored.
+	OnScreenSeconds *float64 `json:"on_screen_seconds,omitempty" gorm:"-"`
+}
+
+// Keys of the notification extras that are promoted to their own columns.
+// Category and channel ID are properties of the Android notification rather
+// than extras, so devices send them under plain keys.
+const (
+	ExtraSubText             = "android.subText"
+	ExtraBigText             = "android.bigText"
+	ExtraConversationTitle   = "android.conversationTitle"
+	ExtraIsGroupConversation = "android.isGroupConversation"
+	ExtraPeople              = "android.people"
+	ExtraPeopleList          = "android.people.list"
+	ExtraCategory            = "category"
+	ExtraChannelID           = "channel_id"
+)
+
+// BeforeSave promotes well-known extras to their own columns and indexes
+// the sender, conversation, sub text and people. Fields that were set
+// explicitly take precedence over the extras.
+func (n *Notification) BeforeSave(*gorm.DB) error {
+	promote := func(field *string, keys ...string) {
+		for _, key := range keys {
+			if *field == "" {
+				*field = n.Extras[key]
+			}
+		}
+	}
+
+	promote(&n.SubText, ExtraSubText)
+	promote(&n.BigText, ExtraBigText)
+	promote(&n.ConversationTitle, ExtraConversationTitle)
+	promote(&n.People, ExtraPeople, ExtraPeopleList)
+	promote(&n.Category, ExtraCategory)
+	promote(&n.ChannelID, ExtraChannelID)
+	if n.Extras[ExtraIsGroupConversation] == "true" {
+		n.IsGroupConversation = true
+	}
+	n.FromIndex = fieldcrypt.BlindIndex(n.From)
+	n.ConversationTitleIndex = fieldcrypt.BlindIndex(n.ConversationTitle)
+	n.SubTextIndex = fieldcrypt.BlindIndex(n.SubText)
+	n.PeopleIndex = IndexPeople(n.People)
+	return nil
+}
+
+// IndexPeople returns the blind indexes of the people in a comma-separated
+// list, each between commas, so that one person is matched in SQL by
+// looking for ",<index>,"
+func IndexPeople(people string) string {
+	var index strings.Builder
+	for _, person := range strings.Split(people, ",") {
+		if person = strings.TrimSpace(person); person != "" {
+			index.WriteString("," + fieldcrypt.BlindIndex(person))
+		}
+	}
+	if index.Len() == 0 {
+		return ""
+	}
+	return index.String() + ","
+}
+
+// NotificationPage is a single page of notifications together with the
+// total number of matching notifications
+type NotificationPage struct {
+	Notifications []Notification `json:"notifications"`
+	Total         int64          `json:"total"`
+	Limit         int            `json:"limit"`
+	Offset        int            `json:"offset"`
+}
+
+// AfterFind computes how long a removed notification stayed on screen
+func (n *Notification) AfterFind(*gorm.DB) error {
+	if n.RemovedAt != nil {
+		seconds := n.RemovedAt.Sub(n.Timestamp).Seconds()
+		n.OnScreenSeconds = &seconds
+	}
+	return nil
 }
 
 func (Notification) TableName() string {
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Lifecycle event types reported by devices
+const (
+	EventPosted  = "posted"
+	EventUpdated = "updated"
+	EventRemoved = "removed"
+)
+
+// StateReplaced is the state of a notification whose key was posted again
+const StateReplaced = "replaced"
+
+// NotificationEvent records a change in the lifecycle of an Android
+// notification, identified by its stable notification key
+type NotificationEvent struct {
+	gorm.Model
+	NotificationID *uint     `json:"notification_id" gorm:"index"`
+	Key            string    `json:"key" gorm:"column:notification_key;not null;index"`
+	DeviceID       string    `json:"device_id" gorm:"not null;index"`
+	Type           string    `json:"type" gorm:"not null"`
+	Reason         string    `json:"reason,omitempty"`
+	Timestamp      time.Time `json:"timestamp" gorm:"not null;index"`
+}
+
+func (NotificationEvent) TableName() string {
+	return "notification_events"
+}
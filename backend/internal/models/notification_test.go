@@ -62,4 +62,44 @@ func TestNotificationModel(t *testing.T) {
 	result = db.First(&found, notification.ID)
 	assert.Error(t, result.Error)
 	assert.Equal(t, gorm.ErrRecordNotFound, result.Error)
-} 
\ No newline at end of file
+}
+
+func TestNotificationExtrasPromotion(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+
+	err = db.AutoMigrate(&Notification{})
+	assert.NoError(t, err)
+
+	notification := &Notification{
+		Title:       "Family",
+		Message:     "Dinner is ready",
+		Timestamp:   time.Now(),
+		PackageName: "com.whatsapp",
+		From:        "Mum",
+		DeviceID:    "test123",
+		Category:    "msg",
+		Extras: map[string]string{
+			ExtraSubText:             "2 new messages",
+			ExtraBigText:             "Dinner is ready, come downstairs",
+			ExtraConversationTitle:   "Family",
+			ExtraIsGroupConversation: "true",
+			ExtraPeople:              "Mum, Dad",
+			ExtraCategory:            "social",
+			ExtraChannelID:           "group_chats",
+		},
+	}
+	assert.NoError(t, db.Create(notification).Error)
+
+	var found Notification
+	assert.NoError(t, db.First(&found, notification.ID).Error)
+	assert.Equal(t, notification.Extras, found.Extras)
+	assert.Equal(t, "2 new messages", found.SubText)
+	assert.Equal(t, "Dinner is ready, come downstairs", found.BigText)
+	assert.Equal(t, "Family", found.ConversationTitle)
+	assert.True(t, found.IsGroupConversation)
+	assert.Equal(t, "Mum, Dad", found.People)
+	assert.Equal(t, "group_chats", found.ChannelID)
+	// Explicitly set fields win over extras
+	assert.Equal(t, "msg", found.Category)
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lileye/backend/internal/fieldcrypt"
+	"gorm.io/gorm"
+)
+
+// Sender records the first time a sender was seen in an app on a device
+type Sender struct {
+	gorm.Model
+	DeviceID    string    `json:"device_id" gorm:"not null;uniqueIndex:idx_sender_identity"`
+	PackageName string    `json:"package_name" gorm:"not null;uniqueIndex:idx_sender_identity"`
+	From        string    `json:"from" gorm:"not null;serializer:encrypted"`
+	FromIndex   string    `json:"-" gorm:"not null;uniqueIndex:idx_sender_identity"`
+	FirstSeen   time.Time `json:"first_seen" gorm:"not null;index"`
+
+	// AppName is filled in from the app catalog when loading
+	AppName string `json:"app_name,omitempty" gorm:"-"`
+}
+
+func (Sender) TableName() string {
+	return "senders"
+}
+
+// BeforeSave indexes the sender
+func (s *Sender) BeforeSave(*gorm.DB) error {
+	s.FromIndex = fieldcrypt.BlindIndex(s.From)
+	return nil
+}
@@ -0,0 +1,238 @@
+package openapi
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ClientFile is the file of the client package that ClientSource is
+// written to
+const ClientFile = "operations.go"
+
+// ClientSource returns the source of the operations of the Go client in
+// internal/client: a method per operation, taking the path parameters as
+// arguments and the query and form parameters as a struct.
+func ClientSource() ([]byte, error) {
+	g := &clientGen{imports: map[string]bool{"context": true}}
+	for i := range Operations {
+		g.operation(&Operations[i])
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by go run ./internal/openapi/genclient; DO NOT EDIT.\n\npackage client\n\nimport (\n")
+	paths := make([]string, 0, len(g.imports))
+	for p := range g.imports {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	// The standard library first, then the packages of the module
+	for _, std := range []bool{true, false} {
+		for _, p := range paths {
+			if !strings.Contains(p, ".") == std {
+				fmt.Fprintf(&out, "\t%q\n", p)
+			}
+		}
+		fmt.Fprintf(&out, "\n")
+	}
+	fmt.Fprintf(&out, ")\n")
+	out.Write(g.body.Bytes())
+	return format.Source(out.Bytes())
+}
+
+type clientGen struct {
+	body    bytes.Buffer
+	imports map[string]bool
+}
+
+func (g *clientGen) printf(format string, args ...any) {
+	fmt.Fprintf(&g.body, format, args...)
+}
+
+func (g *clientGen) operation(op *Operation) {
+	var pathParams, queryParams []Param
+	for _, p := range op.Params {
+		if p.In == InPath {
+			pathParams = append(pathParams, p)
+		} else {
+			queryParams = append(queryParams, p)
+		}
+	}
+	paramsType := op.ID + "Params"
+	if len(queryParams) > 0 {
+		g.params(op, paramsType, queryParams)
+	}
+
+	// Arguments
+	args := []string{"ctx context.Context"}
+	path, pathArgs := op.Path, []string{}
+	for _, p := range pathParams {
+		name := goArg(p.Name)
+		if p.Type == Integer {
+			args = append(args, name+" uint")
+			path = strings.Replace(path, ":"+p.Name, "%d", 1)
+			pathArgs = append(pathArgs, name)
+		} else {
+			args = append(args, name+" string")
+			path = strings.Replace(path, ":"+p.Name, "%s", 1)
+			pathArgs = append(pathArgs, "url.PathEscape("+name+")")
+			g.imports["net/url"] = true
+		}
+	}
+	pathExpr := fmt.Sprintf("%q", path)
+	if len(pathArgs) > 0 {
+		pathExpr = fmt.Sprintf("fmt.Sprintf(%q, %s)", path, strings.Join(pathArgs, ", "))
+		g.imports["fmt"] = true
+	}
+	query := "nil"
+	if len(queryParams) > 0 {
+		args = append(args, "params *"+paramsType)
+		query = "params.values()"
+	}
+	body := "nil"
+	if op.Body != nil {
+		args = append(args, "body "+g.argType(reflect.TypeOf(op.Body)))
+		body = "body"
+	}
+	if op.Upload {
+		args = append(args, "filename string", "file io.Reader")
+		g.imports["io"] = true
+	}
+
+	// Results
+	var result, zero string
+	switch {
+	case op.Response != nil:
+		t := reflect.TypeOf(op.Response)
+		result, zero = g.argType(t), "nil"
+		if t.Kind() == reflect.Struct {
+			result = "*" + g.goType(t)
+		}
+	case len(op.Media) > 0:
+		args = append(args, "w io.Writer")
+		g.imports["io"] = true
+	}
+
+	g.printf("\n// %s calls %s %s to %s\n", op.ID, op.Method, op.OpenAPIPath(), lowerFirst(op.Summary))
+	if result == "" {
+		g.printf("func (c *Client) %s(%s) error {\n", op.ID, strings.Join(args, ", "))
+		g.printf("return c.download(ctx, %s, %s, w)\n}\n", pathExpr, query)
+		return
+	}
+	g.printf("func (c *Client) %s(%s) (%s, error) {\n", op.ID, strings.Join(args, ", "), result)
+	outType := strings.TrimPrefix(result, "*")
+	g.printf("var out %s\n", outType)
+	if op.Upload {
+		g.printf("if err := c.upload(ctx, %q, %s, %s, filename, file, &out); err != nil {\n", op.Method, pathExpr, query)
+	} else {
+		g.printf("if err := c.do(ctx, %q, %s, %s, %s, &out); err != nil {\n", op.Method, pathExpr, query, body)
+	}
+	g.printf("return %s, err\n}\n", zero)
+	if strings.HasPrefix(result, "*") {
+		g.printf("return &out, nil\n}\n")
+	} else {
+		g.printf("return out, nil\n}\n")
+	}
+}
+
+// params writes the struct of the query or form parameters of op, with the
+// method encoding them
+func (g *clientGen) params(op *Operation, name string, params []Param) {
+	in := "query"
+	if op.Upload {
+		in = "form"
+	}
+	g.printf("\n// %s are the %s parameters of %s\ntype %s struct {\n", name, in, op.ID, name)
+	for _, p := range params {
+		doc := p.Description
+		if p.Required && doc == "" {
+			doc = "Required"
+		} else if p.Required {
+			doc += "; required"
+		}
+		if doc != "" {
+			g.printf("// %s\n", doc)
+		}
+		g.printf("%s %s\n", goField(p.Name), paramType(p))
+	}
+	g.printf("}\n\nfunc (p *%s) values() url.Values {\nv := url.Values{}\nif p == nil {\nreturn v\n}\n", name)
+	g.imports["net/url"] = true
+	for _, p := range params {
+		field := "p." + goField(p.Name)
+		switch p.Type {
+		case Integer:
+			g.printf("if %s != 0 {\nv.Set(%q, strconv.Itoa(%s))\n}\n", field, p.Name, field)
+			g.imports["strconv"] = true
+		case Boolean:
+			g.printf("if %s {\nv.Set(%q, \"true\")\n}\n", field, p.Name)
+		case DateTime:
+			g.imports["time"] = true
+			g.printf("if !%s.IsZero() {\nv.Set(%q, %s.Format(time.RFC3339))\n}\n", field, p.Name, field)
+		default:
+			g.printf("if %s != \"\" {\nv.Set(%q, %s)\n}\n", field, p.Name, field)
+		}
+	}
+	g.printf("return v\n}\n")
+}
+
+func paramType(p Param) string {
+	switch p.Type {
+	case Integer:
+		return "int"
+	case Boolean:
+		return "bool"
+	case DateTime:
+		return "time.Time"
+	}
+	return "string"
+}
+
+// argType returns the Go type of a body, with structs passed by pointer
+func (g *clientGen) argType(t reflect.Type) string {
+	if t.Kind() == reflect.Struct {
+		return "*" + g.goType(t)
+	}
+	return g.goType(t)
+}
+
+// goType returns the Go expression of t and imports its packages
+func (g *clientGen) goType(t reflect.Type) string {
+	inner := t
+	for inner.Kind() == reflect.Slice || inner.Kind() == reflect.Pointer || inner.Kind() == reflect.Map {
+		inner = inner.Elem()
+	}
+	if inner.PkgPath() != "" {
+		g.imports[inner.PkgPath()] = true
+	}
+	return strings.ReplaceAll(t.String(), "interface {}", "any")
+}
+
+// goField returns the Go name of a query parameter, as in DeviceID for
+// device_id
+func goField(name string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(name, "_") {
+		if part == "id" {
+			b.WriteString("ID")
+			continue
+		}
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+// goArg returns the Go name of a path parameter
+func goArg(name string) string {
+	if token.IsKeyword(name) {
+		return name + "Name"
+	}
+	return name
+}
+
+func lowerFirst(s string) string {
+	return strings.ToLower(s[:1]) + s[1:]
+}
@@ -0,0 +1,380 @@
+package openapi_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lileye/backend/internal/api"
+	"github.com/lileye/backend/internal/certs"
+	"github.com/lileye/backend/internal/client"
+	"github.com/lileye/backend/internal/config"
+	"github.com/lileye/backend/internal/fixtures"
+	"github.com/lileye/backend/internal/middleware"
+	"github.com/lileye/backend/internal/models"
+	"github.com/lileye/backend/internal/openapi"
+	"github.com/lileye/backend/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+var testPNG = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+// contractServer runs the API in-process, with every optional route, and
+// returns it with an admin key
+func contractServer(t *testing.T) (*api.API, string) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(dir, "lileye.db")), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, storage.Migrate(db))
+
+	cfg := config.Default()
+	cfg.Attachments.Dir = filepath.Join(dir, "blobs")
+	cfg.Backup.Dir = filepath.Join(dir, "backups")
+	cfg.Audit.KeyFile = filepath.Join(dir, "audit.key")
+	cfg.Retention.MaxAge = config.Duration(30 * 24 * time.Hour)
+	_, ca, err := certs.SelfSigned(filepath.Join(dir, "tls"), []string{"localhost"})
+	assert.NoError(t, err)
+	a, err := api.New(db, &cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), ca)
+	assert.NoError(t, err)
+
+	admins := storage.NewAdminStorage(db)
+	_, err = admins.CreateUser(context.Background(), "alice")
+	assert.NoError(t, err)
+	key, err := admins.CreateKey(context.Background(), "alice", "test")
+	assert.NoError(t, err)
+	return a, key.Key
+}
+
+// TestRoutes fails when a route is added, removed or changed without
+// updating the operations
+func TestRoutes(t *testing.T) {
+	a, _ := contractServer(t)
+
+	var routes, described []string
+	for _, r := range a.Router.Routes() {
+		routes = append(routes, r.Method+" "+r.Path)
+	}
+	for _, op := range openapi.Operations {
+		described = append(described, op.Method+" "+op.Path)
+		// Versioned routes keep a deprecated alias under the legacy prefix
+		if rest, ok := strings.CutPrefix(op.Path, middleware.APIPrefix); ok {
+			described = append(described, op.Method+" "+middleware.LegacyPrefix+rest)
+		}
+	}
+	// The document leaves out WebSocket routes, which are not HTTP
+	// operations
+	for _, rest := range []string{"/notifications/stream"} {
+		described = append(described, "GET "+middleware.APIPrefix+rest, "GET "+middleware.LegacyPrefix+rest)
+	}
+	sort.Strings(routes)
+	sort.Strings(described)
+	assert.Equal(t, described, routes)
+}
+
+// validator checks every response the client receives against the
+// document and records the operations that succeeded
+type validator struct {
+	t       *testing.T
+	doc     *openapi.Document
+	next    http.RoundTripper
+	mu      sync.Mutex
+	covered map[string]bool
+}
+
+func (v *validator) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := v.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	op := match(req.Method, req.URL.Path)
+	if op == nil {
+		v.t.Errorf("%s %s: no operation describes it", req.Method, req.URL.Path)
+		return resp, nil
+	}
+	responses := v.doc.Paths[op.OpenAPIPath()][strings.ToLower(op.Method)].Responses
+	described, ok := responses[fmt.Sprint(resp.StatusCode)]
+	if !ok {
+		described = responses["default"]
+	} else {
+		v.mu.Lock()
+		v.covered[op.ID] = true
+		v.mu.Unlock()
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if media, ok := described.Content["application/json"]; ok {
+		var value any
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		if err := dec.Decode(&value); err != nil {
+			v.t.Errorf("%s %d: invalid JSON: %v", op.ID, resp.StatusCode, err)
+		} else if err := v.validate(media.Schema, value, "body"); err != nil {
+			v.t.Errorf("%s %d: %v", op.ID, resp.StatusCode, err)
+		}
+		return resp, nil
+	}
+	for media := range described.Content {
+		if ok, _ := filepath.Match(media, mediaType); ok {
+			return resp, nil
+		}
+	}
+	v.t.Errorf("%s %d: undocumented media type %s", op.ID, resp.StatusCode, mediaType)
+	return resp, nil
+}
+
+// match returns the operation of a request. Static segments win over
+// parameters, as in the router.
+func match(method, path string) *openapi.Operation {
+	var best *openapi.Operation
+	for i := range openapi.Operations {
+		op := &openapi.Operations[i]
+		pattern := "^" + regexp.MustCompile(`:\w+`).ReplaceAllString(regexp.QuoteMeta(op.Path), `[^/]+`) + "$"
+		if op.Method != method || !regexp.MustCompile(pattern).MatchString(path) {
+			continue
+		}
+		if best == nil || strings.Count(op.Path, ":") < strings.Count(best.Path, ":") {
+			best = op
+		}
+	}
+	return best
+}
+
+// validate checks a decoded JSON value against a schema
+func (v *validator) validate(s *openapi.Schema, value any, at string) error {
+	if s.Ref != "" {
+		name := strings.TrimPrefix(s.Ref, "#/components/schemas/")
+		resolved, ok := v.doc.Components.Schemas[name]
+		if !ok {
+			return fmt.Errorf("%s: unknown schema %s", at, s.Ref)
+		}
+		return v.validate(resolved, value, at)
+	}
+	if value == nil {
+		if s.Nullable || (s.Type == "" && len(s.AllOf) == 0) {
+			return nil
+		}
+		return fmt.Errorf("%s: null is not allowed", at)
+	}
+	for _, sub := range s.AllOf {
+		if err := v.validate(sub, value, at); err != nil {
+			return err
+		}
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: want an object, got %T", at, value)
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s: missing required field %s", at, name)
+			}
+		}
+		for name, field := range obj {
+			prop, ok := s.Properties[name]
+			if !ok {
+				additional, isSchema := s.AdditionalProperties.(*openapi.Schema)
+				if !isSchema {
+					return fmt.Errorf("%s: undocumented field %s", at, name)
+				}
+				prop = additional
+			}
+			if err := v.validate(prop, field, at+"."+name); err != nil {
+				return err
+			}
+		}
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s: want an array, got %T", at, value)
+		}
+		for i, item := range items {
+			if err := v.validate(s.Items, item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s: want a string, got %T", at, value)
+		}
+		if s.Format == openapi.DateTime {
+			if _, err := time.Parse(time.RFC3339Nano, str); err != nil {
+				return fmt.Errorf("%s: %v", at, err)
+			}
+		}
+	case "integer":
+		n, ok := value.(json.Number)
+		if _, err := n.Int64(); !ok || err != nil {
+			return fmt.Errorf("%s: want an integer, got %v", at, value)
+		}
+	case "number":
+		if _, ok := value.(json.Number); !ok {
+			return fmt.Errorf("%s: want a number, got %T", at, value)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: want a boolean, got %T", at, value)
+		}
+	}
+	return nil
+}
+
+// TestContract calls every operation through the generated client and
+// checks the responses against the document
+func TestContract(t *testing.T) {
+	a, key := contractServer(t)
+	srv := httptest.NewServer(a.Router)
+	defer srv.Close()
+
+	v := &validator{t: t, doc: openapi.Build(), next: http.DefaultTransport, covered: map[string]bool{}}
+	c, err := client.New(srv.URL, client.WithKey(key), client.WithHTTPClient(&http.Client{Transport: v}))
+	assert.NoError(t, err)
+	ctx := context.Background()
+	must := func(_ any, err error) {
+		t.Helper()
+		assert.NoError(t, err)
+	}
+	var buf bytes.Buffer
+
+	// Probes
+	must(c.Healthz(ctx))
+	must(c.Readyz(ctx))
+	must(c.GetVersion(ctx))
+	must(c.GetOpenAPI(ctx))
+	must(nil, c.GetCAPEM(ctx, &buf))
+	must(c.GetCA(ctx))
+
+	// Notifications from a watched app raise alerts for new senders
+	ds := fixtures.Generate(fixtures.Options{Seed: 1, Devices: fixtures.Devices("phone1"), Days: 1, PerDay: 20})
+	first := ds.Notifications[0]
+	must(c.SetAppWatched(ctx, first.PackageName, &models.SetWatchedRequest{Watched: true}))
+	n, err := c.CreateNotification(ctx, &first)
+	assert.NoError(t, err)
+	// A second sender, to merge contacts
+	other := first
+	other.From, other.Title, other.Key = "Mom", "Mom", ""
+	must(c.CreateNotifications(ctx, append(ds.Notifications[1:], other)))
+	must(c.GetNotification(ctx, n.ID))
+	must(c.ListNotifications(ctx, "phone1", &client.ListNotificationsParams{AppCategory: models.AppCategoryMessaging}))
+	must(c.ListNotificationsInRange(ctx, "phone1", &client.ListNotificationsInRangeParams{
+		Start: n.Timestamp.Add(-time.Hour), End: time.Now(),
+	}))
+	must(c.SearchNotifications(ctx, "phone1", &client.SearchNotificationsParams{Q: n.Message}))
+	must(c.ListDevices(ctx))
+
+	must(c.ListConversations(ctx, "phone1", nil))
+	must(c.GetThread(ctx, "phone1", &client.GetThreadParams{Package: n.PackageName, From: n.From, Limit: 10}))
+	must(c.MarkThreadRead(ctx, "phone1", &client.MarkThreadReadParams{Package: n.PackageName, From: n.From}))
+
+	must(c.CreateEvent(ctx, &models.NotificationEvent{Key: n.Key, DeviceID: "phone1", Type: models.EventRemoved}))
+	must(c.ListDeviceEvents(ctx, "phone1", &client.ListDeviceEventsParams{Key: n.Key}))
+	must(c.ListNotificationEvents(ctx, n.ID))
+
+	attachment, err := c.UploadAttachment(ctx, n.ID, &client.UploadAttachmentParams{Kind: models.AttachmentImage},
+		"photo.png", bytes.NewReader(testPNG))
+	assert.NoError(t, err)
+	must(c.ListAttachments(ctx, n.ID))
+	must(nil, c.DownloadAttachment(ctx, n.ID, attachment.ID, &buf))
+
+	// Apps
+	must(c.ListApps(ctx, nil))
+	must(c.ReportApps(ctx, []models.App{{PackageName: "org.example.chat", Name: "Chat"}}))
+	must(c.GetApp(ctx, "org.example.chat"))
+	must(c.SetAppCategory(ctx, "org.example.chat", &models.SetCategoryRequest{Category: models.AppCategoryMessaging}))
+	must(c.UploadAppIcon(ctx, "org.example.chat", "icon.png", bytes.NewReader(testPNG)))
+	must(nil, c.DownloadAppIcon(ctx, "org.example.chat", &buf))
+
+	// Contacts
+	contacts, err := c.ListContacts(ctx, nil)
+	assert.NoError(t, err)
+	if !assert.GreaterOrEqual(t, len(contacts), 2) {
+		t.FailNow()
+	}
+	must(c.GetContact(ctx, contacts[0].ID))
+	must(c.UpdateContact(ctx, contacts[0].ID, &models.UpdateContactRequest{Status: models.ContactTrusted}))
+	must(c.MergeContacts(ctx, contacts[0].ID, &models.MergeContactsRequest{ContactIDs: []uint{contacts[1].ID}}))
+	must(c.GetContactActivity(ctx, contacts[0].ID))
+	must(c.ListContactNotifications(ctx, contacts[0].ID, nil))
+
+	// Alerts
+	must(c.ListNewSenders(ctx, &client.ListNewSendersParams{Days: 30}))
+	alerts, err := c.ListAlerts(ctx, &client.ListAlertsParams{Unacknowledged: true})
+	assert.NoError(t, err)
+	if !assert.NotEmpty(t, alerts) {
+		t.FailNow()
+	}
+	must(c.AcknowledgeAlert(ctx, alerts[0].ID))
+	entry, err := c.AddAllowlistEntry(ctx, &models.AllowlistEntry{Identity: "Mom"})
+	assert.NoError(t, err)
+	must(c.ListAllowlist(ctx))
+	must(c.DeleteAllowlistEntry(ctx, entry.ID))
+
+	// Audit log and export
+	must(c.ListAuditLog(ctx, &client.ListAuditLogParams{Action: "notification.read", Limit: 5}))
+	must(c.VerifyAuditLog(ctx))
+	must(nil, c.Export(ctx, &client.ExportParams{Format: "ndjson", DeviceID: "phone1"}, &buf))
+
+	// Administration
+	manifest, err := c.CreateBackup(ctx)
+	assert.NoError(t, err)
+	must(c.ListBackups(ctx))
+	must(nil, c.DownloadBackup(ctx, manifest.File, &buf))
+	must(c.CreateUser(ctx, &models.CreateUserRequest{Name: "bob"}))
+	must(c.ListUsers(ctx))
+	created, err := c.CreateKey(ctx, &models.CreateKeyRequest{User: "bob", Name: "laptop"})
+	assert.NoError(t, err)
+	must(c.ListKeys(ctx))
+	must(c.RevokeKey(ctx, created.ID))
+	must(c.DeleteUser(ctx, "bob"))
+	must(c.GetStats(ctx))
+	must(c.ListDeviceStats(ctx))
+	must(c.GetRetention(ctx))
+	must(c.RunRetention(ctx))
+	must(c.PurgeNotifications(ctx, &client.PurgeNotificationsParams{DeviceID: "phone1", DryRun: true}))
+	must(c.DeleteAllNotifications(ctx))
+
+	// Error responses follow the error schema
+	_, err = c.GetNotification(ctx, n.ID)
+	var apiErr *client.Error
+	assert.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+	assert.Equal(t, models.CodeNotFound, apiErr.Code)
+	assert.NotEmpty(t, apiErr.RequestID)
+	_, err = c.SetAppCategory(ctx, "org.example.chat", &models.SetCategoryRequest{Category: "nonsense"})
+	assert.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, models.CodeInvalidRequest, apiErr.Code)
+	if assert.Len(t, apiErr.Fields, 1) {
+		assert.Equal(t, "category", apiErr.Fields[0].Field)
+	}
+
+	for _, op := range openapi.Operations {
+		assert.True(t, v.covered[op.ID], "%s was not called successfully", op.ID)
+	}
+}
@@ -0,0 +1,26 @@
+// Command genclient writes the operations of the Go client in
+// internal/client from the OpenAPI operations. Run it with go generate
+// after changing the API.
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/lileye/backend/internal/openapi"
+)
+
+func main() {
+	dir := "."
+	if len(os.Args) > 1 {
+		dir = os.Args[1]
+	}
+	src, err := openapi.ClientSource()
+	if err != nil {
+		log.Fatalf("Failed to generate client: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, openapi.ClientFile), src, 0o644); err != nil {
+		log.Fatalf("Failed to write client: %v", err)
+	}
+}
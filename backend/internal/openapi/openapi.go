@@ -0,0 +1,318 @@
+// Package openapi describes the HTTP API as an OpenAPI 3 document. The
+// operations are listed in Operations; request and response schemas are
+// derived from the Go types the handlers bind and return, so the document
+// follows the code. The Go client in internal/client is generated from the
+// same table, and contract tests check both against the router.
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/lileye/backend/internal/middleware"
+	"github.com/lileye/backend/internal/models"
+	"github.com/lileye/backend/internal/version"
+)
+
+// Types of parameters
+const (
+	String   = "string"
+	Integer  = "integer"
+	Boolean  = "boolean"
+	DateTime = "date-time"
+)
+
+// Where parameters are sent
+const (
+	InPath  = "path"
+	InQuery = "query"
+	// InForm parameters are fields of a multipart/form-data body
+	InForm = "form"
+)
+
+// Param is a path, query or form parameter of an operation
+type Param struct {
+	Name        string
+	In          string
+	Type        string
+	Required    bool
+	Description string
+}
+
+// Operation is an endpoint of the API
+type Operation struct {
+	// ID is the operationId, and the name of the client method
+	ID     string
+	Method string
+	// Path is in Gin syntax, with :name path parameters
+	Path    string
+	Tag     string
+	Summary string
+	Params  []Param
+	// Body is a value of the type of the JSON request body, or nil
+	Body any
+	// Upload is set when the request is a multipart form with the uploaded
+	// file in the "file" field. Other fields are InForm params.
+	Upload bool
+	// Status is the status of a successful response, 200 by default
+	Status int
+	// Response is a value of the type of the JSON response body
+	Response any
+	// Media are the media types of a response that is not JSON, in which
+	// case Response is nil
+	Media []string
+	// AlsoStatus is another status Response is sent with, such as the 503
+	// of a failed readiness probe or the 200 of a repeated notification
+	AlsoStatus int
+}
+
+// SuccessStatus returns the status of a successful response
+func (op *Operation) SuccessStatus() int {
+	if op.Status == 0 {
+		return http.StatusOK
+	}
+	return op.Status
+}
+
+// Admin reports whether the operation requires an admin key
+func (op *Operation) Admin() bool {
+	return strings.HasPrefix(op.Path, middleware.AdminPrefix)
+}
+
+var pathParam = regexp.MustCompile(`:(\w+)`)
+
+// OpenAPIPath returns the path in OpenAPI syntax, with {name} parameters
+func (op *Operation) OpenAPIPath() string {
+	return pathParam.ReplaceAllString(op.Path, "{$1}")
+}
+
+// Document is an OpenAPI 3 document, limited to what the API uses
+type Document struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       Info                            `json:"info"`
+	Tags       []Tag                           `json:"tags"`
+	Paths      map[string]map[string]*OpObject `json:"paths"`
+	Components Components                      `json:"components"`
+}
+
+// Info describes the API
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Version     string `json:"version"`
+}
+
+// Tag groups operations
+type Tag struct {
+	Name string `json:"name"`
+}
+
+// OpObject is the OpenAPI description of an operation
+type OpObject struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary"`
+	Tags        []string              `json:"tags"`
+	Parameters  []ParamObject         `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security"`
+}
+
+// ParamObject is the OpenAPI description of a path or query parameter
+type ParamObject struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody is the OpenAPI description of a request body
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response is the OpenAPI description of a response
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType holds the schema of a body
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Components holds the schemas that operations refer to
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes"`
+}
+
+// SecurityScheme describes how requests authenticate
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme"`
+	Description string `json:"description"`
+}
+
+// Schema is an OpenAPI schema object
+type Schema struct {
+	Ref         string             `json:"$ref,omitempty"`
+	Type        string             `json:"type,omitempty"`
+	Format      string             `json:"format,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Nullable    bool               `json:"nullable,omitempty"`
+	AllOf       []*Schema          `json:"allOf,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	// AdditionalProperties is the schema of the values of a map, or false
+	// for structs, whose fields are all listed in Properties
+	AdditionalProperties any `json:"additionalProperties,omitempty"`
+}
+
+// securityScheme is the name of the admin key scheme
+const securityScheme = "adminKey"
+
+var (
+	buildOnce sync.Once
+	document  *Document
+	encoded   []byte
+)
+
+// Build returns the document describing Operations
+func Build() *Document {
+	buildOnce.Do(func() {
+		document = build(Operations)
+		var err error
+		if encoded, err = json.MarshalIndent(document, "", "  "); err != nil {
+			panic(err)
+		}
+	})
+	return document
+}
+
+// JSON returns the document encoded as JSON
+func JSON() []byte {
+	Build()
+	return encoded
+}
+
+func build(ops []Operation) *Document {
+	schemas := newSchemas()
+	errorRef := schemas.ref(reflect.TypeOf(models.ErrorResponse{}))
+	errorResponse := &Response{
+		Description: "The request failed",
+		Content:     map[string]MediaType{"application/json": {Schema: errorRef}},
+	}
+
+	doc := &Document{
+		OpenAPI: "3.0.3",
+		Info: Info{
+			Title: "lileye API",
+			Description: "Stores and searches the notifications of Android devices. Routes under " +
+				middleware.AdminPrefix + " require an admin key; elsewhere a key is optional, and identifies the actor in the audit log. " +
+				"Every route under " + middleware.APIPrefix + " is also served under " + middleware.LegacyPrefix +
+				", as it was before the API was versioned; those aliases are deprecated. " +
+				"Requests beyond the rate limits of the server are refused with 429 and a Retry-After header.",
+			Version: version.Get().Version,
+		},
+		Paths: map[string]map[string]*OpObject{},
+		Components: Components{SecuritySchemes: map[string]SecurityScheme{
+			securityScheme: {Type: "http", Scheme: "bearer", Description: "An admin key created with lileye keys create"},
+		}},
+	}
+	tags := map[string]bool{}
+	for i := range ops {
+		op := &ops[i]
+		if !tags[op.Tag] {
+			tags[op.Tag] = true
+			doc.Tags = append(doc.Tags, Tag{Name: op.Tag})
+		}
+
+		obj := &OpObject{
+			OperationID: op.ID,
+			Summary:     op.Summary,
+			Tags:        []string{op.Tag},
+			Responses:   map[string]*Response{"default": errorResponse},
+			Security:    []map[string][]string{{securityScheme: {}}},
+		}
+		if !op.Admin() {
+			// The key is optional
+			obj.Security = append(obj.Security, map[string][]string{})
+		}
+
+		var form []Param
+		for _, p := range op.Params {
+			if p.In == InForm {
+				form = append(form, p)
+				continue
+			}
+			obj.Parameters = append(obj.Parameters, ParamObject{
+				Name:        p.Name,
+				In:          p.In,
+				Description: p.Description,
+				Required:    p.Required || p.In == InPath,
+				Schema:      paramSchema(p),
+			})
+		}
+
+		switch {
+		case op.Upload:
+			body := &Schema{
+				Type:       "object",
+				Properties: map[string]*Schema{"file": {Type: "string", Format: "binary"}},
+				Required:   []string{"file"},
+			}
+			for _, p := range form {
+				s := paramSchema(p)
+				s.Description = p.Description
+				body.Properties[p.Name] = s
+				if p.Required {
+					body.Required = append(body.Required, p.Name)
+				}
+			}
+			obj.RequestBody = &RequestBody{Required: true, Content: map[string]MediaType{"multipart/form-data": {Schema: body}}}
+		case op.Body != nil:
+			obj.RequestBody = &RequestBody{Required: true, Content: map[string]MediaType{
+				"application/json": {Schema: schemas.ref(reflect.TypeOf(op.Body))},
+			}}
+		}
+
+		success := &Response{Description: http.StatusText(op.SuccessStatus()), Content: map[string]MediaType{}}
+		if op.Response != nil {
+			success.Content["application/json"] = MediaType{Schema: schemas.ref(reflect.TypeOf(op.Response))}
+		}
+		for _, media := range op.Media {
+			success.Content[media] = MediaType{Schema: &Schema{Type: "string", Format: "binary"}}
+		}
+		obj.Responses[strconv.Itoa(op.SuccessStatus())] = success
+		if op.AlsoStatus != 0 {
+			obj.Responses[strconv.Itoa(op.AlsoStatus)] = &Response{Description: http.StatusText(op.AlsoStatus), Content: success.Content}
+		}
+
+		path := op.OpenAPIPath()
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = map[string]*OpObject{}
+		}
+		doc.Paths[path][strings.ToLower(op.Method)] = obj
+	}
+	sort.Slice(doc.Tags, func(i, j int) bool { return doc.Tags[i].Name < doc.Tags[j].Name })
+	doc.Components.Schemas = schemas.defs
+	return doc
+}
+
+func paramSchema(p Param) *Schema {
+	if p.Type == DateTime {
+		return &Schema{Type: "string", Format: DateTime}
+	}
+	return &Schema{Type: p.Type}
+}
@@ -0,0 +1,93 @@
+package openapi
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOperations(t *testing.T) {
+	ids := map[string]bool{}
+	routes := map[string]bool{}
+	for _, op := range Operations {
+		assert.False(t, ids[op.ID], "duplicate operation %s", op.ID)
+		ids[op.ID] = true
+		route := op.Method + " " + op.Path
+		assert.False(t, routes[route], "duplicate route %s", route)
+		routes[route] = true
+
+		// Every path parameter is described, and only those
+		var inPath []string
+		for _, p := range op.Params {
+			if p.In == InPath {
+				inPath = append(inPath, p.Name)
+			}
+			if p.In == InForm {
+				assert.True(t, op.Upload, "%s: form parameter %s without an upload", op.ID, p.Name)
+			}
+		}
+		var want []string
+		for _, m := range pathParam.FindAllStringSubmatch(op.Path, -1) {
+			want = append(want, m[1])
+		}
+		assert.Equal(t, want, inPath, op.ID)
+
+		assert.True(t, (op.Response == nil) != (len(op.Media) == 0), "%s: needs either a JSON or another response", op.ID)
+		assert.NotEmpty(t, op.Tag, op.ID)
+		assert.NotEmpty(t, op.Summary, op.ID)
+	}
+}
+
+func TestDocument(t *testing.T) {
+	var doc map[string]any
+	assert.NoError(t, json.Unmarshal(JSON(), &doc))
+	assert.Equal(t, "3.0.3", doc["openapi"])
+
+	d := Build()
+	assert.Len(t, d.Paths["/api/v1/notifications/{id}"], 1)
+	op := d.Paths["/api/v1/notifications/{id}"]["get"]
+	assert.Equal(t, "GetNotification", op.OperationID)
+	assert.Equal(t, schemaPrefix+"Notification", op.Responses["200"].Content["application/json"].Schema.Ref)
+	assert.Equal(t, schemaPrefix+"ErrorResponse", op.Responses["default"].Content["application/json"].Schema.Ref)
+	// The key is optional outside the admin routes
+	assert.Len(t, op.Security, 2)
+	assert.Len(t, d.Paths["/api/v1/admin/stats"]["get"].Security, 1)
+
+	// Embedded gorm.Model fields are promoted, and omitempty fields are
+	// optional
+	n := d.Components.Schemas["Notification"]
+	assert.Contains(t, n.Properties, "ID")
+	assert.Equal(t, "date-time", n.Properties["timestamp"].Format)
+	assert.True(t, n.Properties["DeletedAt"].Nullable)
+	assert.NotContains(t, n.Properties, "FromIndex")
+	assert.Contains(t, n.Required, "title")
+	assert.NotContains(t, n.Required, "extras")
+	assert.Equal(t, &Schema{Type: "string"}, n.Properties["extras"].AdditionalProperties)
+
+	upload := d.Paths["/api/v1/notifications/{id}/attachments"]["post"].RequestBody.Content["multipart/form-data"].Schema
+	assert.Equal(t, []string{"file"}, upload.Required)
+	assert.Contains(t, upload.Properties, "kind")
+}
+
+func TestSchemaPanicsOnCustomEncoding(t *testing.T) {
+	assert.Panics(t, func() { newSchemas().ref(reflect.TypeOf(json.RawMessage{})) })
+	assert.NotPanics(t, func() { newSchemas().ref(reflect.TypeOf(struct{ A []string }{})) })
+}
+
+// TestClientUpToDate fails when the operations changed without running go
+// generate in internal/client
+func TestClientUpToDate(t *testing.T) {
+	want, err := ClientSource()
+	assert.NoError(t, err)
+	got, err := os.ReadFile(filepath.Join("..", "client", ClientFile))
+	assert.NoError(t, err)
+	if string(got) != string(want) {
+		t.Errorf("internal/client/%s is out of date; run go generate ./internal/client", ClientFile)
+	}
+	assert.True(t, strings.HasPrefix(string(want), "// Code generated"))
+}
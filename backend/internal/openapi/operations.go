@@ -0,0 +1,285 @@
+package openapi
+
+import (
+	"net/http"
+
+	"github.com/lileye/backend/internal/models"
+	"github.com/lileye/backend/internal/version"
+)
+
+// Parameters shared by several operations
+var (
+	idParam       = Param{Name: "id", In: InPath, Type: Integer}
+	deviceIDParam = Param{Name: "deviceID", In: InPath, Type: String, Description: "ID of the device"}
+	packageParam  = Param{Name: "package", In: InPath, Type: String, Description: "Package name of the app"}
+
+	limitParam  = Param{Name: "limit", In: InQuery, Type: Integer, Description: "Page size, 50 by default and at most 500"}
+	offsetParam = Param{Name: "offset", In: InQuery, Type: Integer, Description: "Number of results to skip"}
+
+	deviceFilter  = Param{Name: "device_id", In: InQuery, Type: String, Description: "Only this device"}
+	packageFilter = Param{Name: "package", In: InQuery, Type: String, Description: "Only this app"}
+
+	// notificationFilters narrow down the notification lists and exports
+	notificationFilters = []Param{
+		{Name: "app_category", In: InQuery, Type: String, Description: "Only apps of this category"},
+		{Name: "category", In: InQuery, Type: String, Description: "Only this Android notification category"},
+		{Name: "channel_id", In: InQuery, Type: String, Description: "Only this notification channel"},
+		{Name: "sub_text", In: InQuery, Type: String, Description: "Only this sub text"},
+		{Name: "conversation_title", In: InQuery, Type: String, Description: "Only this conversation"},
+		{Name: "person", In: InQuery, Type: String, Description: "Only notifications involving this person, by exact name"},
+	}
+)
+
+// params joins parameters and lists of parameters
+func params(groups ...[]Param) []Param {
+	var all []Param
+	for _, g := range groups {
+		all = append(all, g...)
+	}
+	return all
+}
+
+// Operations are the endpoints of the API, in the order of the
+// documentation
+var Operations = []Operation{
+	// Probes and metadata
+	{ID: "Healthz", Method: http.MethodGet, Path: "/healthz", Tag: "probes",
+		Summary: "Report that the process is up", Response: models.HealthStatus{}},
+	{ID: "Readyz", Method: http.MethodGet, Path: "/readyz", Tag: "probes",
+		Summary: "Report whether the server can take traffic", Response: models.HealthReport{},
+		AlsoStatus: http.StatusServiceUnavailable},
+	{ID: "GetVersion", Method: http.MethodGet, Path: "/version", Tag: "probes",
+		Summary: "Get the build information of the server", Response: version.Info{}},
+	{ID: "GetOpenAPI", Method: http.MethodGet, Path: "/api/v1/openapi.json", Tag: "probes",
+		Summary: "Get the OpenAPI document of the API", Response: map[string]any{}},
+
+	// Notifications
+	{ID: "CreateNotification", Method: http.MethodPost, Path: "/api/v1/notifications", Tag: "notifications",
+		Summary: "Store a notification, or return the one it repeats", Body: models.Notification{},
+		Status: http.StatusCreated, Response: models.Notification{}, AlsoStatus: http.StatusOK},
+	{ID: "CreateNotifications", Method: http.MethodPost, Path: "/api/v1/notifications/batch", Tag: "notifications",
+		Summary: "Store up to 500 notifications at once", Body: []models.Notification{},
+		Status: http.StatusCreated, Response: []models.Notification{}},
+	{ID: "GetNotification", Method: http.MethodGet, Path: "/api/v1/notifications/:id", Tag: "notifications",
+		Summary: "Get a notification", Params: []Param{idParam}, Response: models.Notification{}},
+	{ID: "ListNotifications", Method: http.MethodGet, Path: "/api/v1/notifications/device/:deviceID", Tag: "notifications",
+		Summary: "List the notifications of a device", Params: params([]Param{deviceIDParam}, notificationFilters),
+		Response: []models.Notification{}},
+	{ID: "ListNotificationsInRange", Method: http.MethodGet, Path: "/api/v1/notifications/device/:deviceID/range", Tag: "notifications",
+		Summary: "List the notifications a device received in a period",
+		Params: params([]Param{
+			deviceIDParam,
+			{Name: "start", In: InQuery, Type: DateTime, Required: true},
+			{Name: "end", In: InQuery, Type: DateTime, Required: true},
+		}, notificationFilters),
+		Response: []models.Notification{}},
+	{ID: "SearchNotifications", Method: http.MethodGet, Path: "/api/v1/notifications/device/:deviceID/search", Tag: "notifications",
+		Summary: "Search the notifications of a device",
+		Params: params([]Param{
+			deviceIDParam,
+			{Name: "q", In: InQuery, Type: String, Required: true, Description: "Text to search for"},
+		}, notificationFilters),
+		Response: []models.Notification{}},
+	{ID: "ListDevices", Method: http.MethodGet, Path: "/api/v1/devices", Tag: "notifications",
+		Summary: "List the IDs of the devices that sent notifications", Response: []string{}},
+	{ID: "DeleteAllNotifications", Method: http.MethodDelete, Path: "/api/v1/notifications/all", Tag: "notifications",
+		Summary: "Delete every notification", Response: models.Message{}},
+
+	// Conversations
+	{ID: "ListConversations", Method: http.MethodGet, Path: "/api/v1/conversations/device/:deviceID", Tag: "conversations",
+		Summary: "List the conversations of a device",
+		Params: []Param{
+			deviceIDParam,
+			{Name: "app_category", In: InQuery, Type: String, Description: "Only apps of this category"},
+		},
+		Response: []models.Conversation{}},
+	{ID: "GetThread", Method: http.MethodGet, Path: "/api/v1/conversations/device/:deviceID/thread", Tag: "conversations",
+		Summary: "Get a page of the messages of a conversation",
+		Params: []Param{
+			deviceIDParam,
+			{Name: "package", In: InQuery, Type: String, Required: true, Description: "Package name of the app"},
+			{Name: "from", In: InQuery, Type: String, Description: "Sender, or conversation title of a group chat"},
+			limitParam, offsetParam,
+		},
+		Response: models.NotificationPage{}},
+	{ID: "MarkThreadRead", Method: http.MethodPost, Path: "/api/v1/conversations/device/:deviceID/thread/read", Tag: "conversations",
+		Summary: "Mark the messages of a conversation as read",
+		Params: []Param{
+			deviceIDParam,
+			{Name: "package", In: InQuery, Type: String, Required: true, Description: "Package name of the app"},
+			{Name: "from", In: InQuery, Type: String, Description: "Sender, or conversation title of a group chat"},
+		},
+		Response: models.Updated{}},
+
+	// Lifecycle events
+	{ID: "CreateEvent", Method: http.MethodPost, Path: "/api/v1/events", Tag: "events",
+		Summary: "Record that a notification was posted, updated or removed", Body: models.NotificationEvent{},
+		Status: http.StatusCreated, Response: models.NotificationEvent{}},
+	{ID: "ListDeviceEvents", Method: http.MethodGet, Path: "/api/v1/events/device/:deviceID", Tag: "events",
+		Summary: "List the lifecycle events of a device",
+		Params: []Param{
+			deviceIDParam,
+			{Name: "key", In: InQuery, Type: String, Description: "Only events of this notification key"},
+		},
+		Response: []models.NotificationEvent{}},
+	{ID: "ListNotificationEvents", Method: http.MethodGet, Path: "/api/v1/notifications/:id/events", Tag: "events",
+		Summary: "List the lifecycle events of a notification", Params: []Param{idParam},
+		Response: []models.NotificationEvent{}},
+
+	// Attachments
+	{ID: "UploadAttachment", Method: http.MethodPost, Path: "/api/v1/notifications/:id/attachments", Tag: "attachments",
+		Summary: "Upload an image of a notification",
+		Params: []Param{
+			idParam,
+			{Name: "kind", In: InForm, Type: String, Description: "icon, image or avatar; image by default"},
+		},
+		Upload: true, Status: http.StatusCreated, Response: models.Attachment{}},
+	{ID: "ListAttachments", Method: http.MethodGet, Path: "/api/v1/notifications/:id/attachments", Tag: "attachments",
+		Summary: "List the attachments of a notification", Params: []Param{idParam}, Response: []models.Attachment{}},
+	{ID: "DownloadAttachment", Method: http.MethodGet, Path: "/api/v1/notifications/:id/attachments/:attachmentID", Tag: "attachments",
+		Summary: "Download an attachment",
+		Params:  []Param{idParam, {Name: "attachmentID", In: InPath, Type: Integer}},
+		Media:   []string{"*/*"}},
+
+	// App catalog
+	{ID: "ListApps", Method: http.MethodGet, Path: "/api/v1/apps", Tag: "apps",
+		Summary:  "List the app catalog",
+		Params:   []Param{{Name: "category", In: InQuery, Type: String, Description: "Only apps of this category"}},
+		Response: []models.App{}},
+	{ID: "ReportApps", Method: http.MethodPost, Path: "/api/v1/apps", Tag: "apps",
+		Summary: "Report the apps installed on a device", Body: []models.App{}, Response: models.Updated{}},
+	{ID: "GetApp", Method: http.MethodGet, Path: "/api/v1/apps/:package", Tag: "apps",
+		Summary: "Get an app", Params: []Param{packageParam}, Response: models.App{}},
+	{ID: "SetAppCategory", Method: http.MethodPut, Path: "/api/v1/apps/:package/category", Tag: "apps",
+		Summary: "Set the category of an app", Params: []Param{packageParam},
+		Body: models.SetCategoryRequest{}, Response: models.App{}},
+	{ID: "SetAppWatched", Method: http.MethodPut, Path: "/api/v1/apps/:package/watch", Tag: "apps",
+		Summary: "Turn new contact alerts for an app on or off", Params: []Param{packageParam},
+		Body: models.SetWatchedRequest{}, Response: models.App{}},
+	{ID: "UploadAppIcon", Method: http.MethodPut, Path: "/api/v1/apps/:package/icon", Tag: "apps",
+		Summary: "Upload the icon of an app", Params: []Param{packageParam}, Upload: true, Response: models.App{}},
+	{ID: "DownloadAppIcon", Method: http.MethodGet, Path: "/api/v1/apps/:package/icon", Tag: "apps",
+		Summary: "Download the icon of an app", Params: []Param{packageParam}, Media: []string{"image/*"}},
+
+	// Contacts
+	{ID: "ListContacts", Method: http.MethodGet, Path: "/api/v1/contacts", Tag: "contacts",
+		Summary:  "List contacts",
+		Params:   []Param{{Name: "status", In: InQuery, Type: String, Description: "unknown, trusted or blocked"}},
+		Response: []models.Contact{}},
+	{ID: "GetContact", Method: http.MethodGet, Path: "/api/v1/contacts/:id", Tag: "contacts",
+		Summary: "Get a contact and its aliases", Params: []Param{idParam}, Response: models.Contact{}},
+	{ID: "UpdateContact", Method: http.MethodPut, Path: "/api/v1/contacts/:id", Tag: "contacts",
+		Summary: "Rename a contact or change its status", Params: []Param{idParam},
+		Body: models.UpdateContactRequest{}, Response: models.Contact{}},
+	{ID: "MergeContacts", Method: http.MethodPost, Path: "/api/v1/contacts/:id/merge", Tag: "contacts",
+		Summary: "Merge contacts into this one", Params: []Param{idParam},
+		Body: models.MergeContactsRequest{}, Response: models.Contact{}},
+	{ID: "GetContactActivity", Method: http.MethodGet, Path: "/api/v1/contacts/:id/activity", Tag: "contacts",
+		Summary: "Get the activity of a contact per device and app", Params: []Param{idParam},
+		Response: []models.ContactActivity{}},
+	{ID: "ListContactNotifications", Method: http.MethodGet, Path: "/api/v1/contacts/:id/notifications", Tag: "contacts",
+		Summary: "Get a page of the notifications of a contact", Params: []Param{idParam, limitParam, offsetParam},
+		Response: models.NotificationPage{}},
+
+	// New contact alerts
+	{ID: "ListNewSenders", Method: http.MethodGet, Path: "/api/v1/senders/new", Tag: "alerts",
+		Summary: "List the senders first seen recently",
+		Params: []Param{
+			{Name: "days", In: InQuery, Type: Integer, Description: "How far back to look, 7 days by default"},
+			deviceFilter,
+		},
+		Response: []models.Sender{}},
+	{ID: "ListAlerts", Method: http.MethodGet, Path: "/api/v1/alerts", Tag: "alerts",
+		Summary: "List new contact alerts",
+		Params: []Param{
+			deviceFilter,
+			{Name: "unacknowledged", In: InQuery, Type: Boolean, Description: "Only alerts not acknowledged yet"},
+		},
+		Response: []models.Alert{}},
+	{ID: "AcknowledgeAlert", Method: http.MethodPost, Path: "/api/v1/alerts/:id/ack", Tag: "alerts",
+		Summary: "Acknowledge an alert", Params: []Param{idParam}, Response: models.Message{}},
+	{ID: "ListAllowlist", Method: http.MethodGet, Path: "/api/v1/allowlist", Tag: "alerts",
+		Summary: "List the senders that never raise alerts", Response: []models.AllowlistEntry{}},
+	{ID: "AddAllowlistEntry", Method: http.MethodPost, Path: "/api/v1/allowlist", Tag: "alerts",
+		Summary: "Stop a sender from raising alerts", Body: models.AllowlistEntry{},
+		Status: http.StatusCreated, Response: models.AllowlistEntry{}},
+	{ID: "DeleteAllowlistEntry", Method: http.MethodDelete, Path: "/api/v1/allowlist/:id", Tag: "alerts",
+		Summary: "Remove a sender from the allowlist", Params: []Param{idParam}, Response: models.Message{}},
+
+	// Audit log
+	{ID: "ListAuditLog", Method: http.MethodGet, Path: "/api/v1/audit", Tag: "audit",
+		Summary: "Get a page of the audit log, newest first",
+		Params: []Param{
+			{Name: "actor", In: InQuery, Type: String},
+			{Name: "action", In: InQuery, Type: String, Description: "Such as notification.read"},
+			deviceFilter,
+			{Name: "notification_id", In: InQuery, Type: Integer},
+			{Name: "since", In: InQuery, Type: DateTime},
+			{Name: "until", In: InQuery, Type: DateTime},
+			limitParam, offsetParam,
+		},
+		Response: models.AuditPage{}},
+	{ID: "VerifyAuditLog", Method: http.MethodGet, Path: "/api/v1/audit/verify", Tag: "audit",
+		Summary: "Check the hash chain of the audit log", Response: models.AuditVerification{}},
+
+	// Export
+	{ID: "Export", Method: http.MethodGet, Path: "/api/v1/export", Tag: "export",
+		Summary: "Export notifications as CSV, NDJSON or an HTML report",
+		Params: params([]Param{
+			{Name: "format", In: InQuery, Type: String, Description: "csv, ndjson or html; csv by default"},
+			deviceFilter, packageFilter,
+			{Name: "q", In: InQuery, Type: String, Description: "Text to search for"},
+			{Name: "start", In: InQuery, Type: DateTime},
+			{Name: "end", In: InQuery, Type: DateTime},
+		}, notificationFilters),
+		Media: []string{"text/csv", "application/x-ndjson", "text/html"}},
+
+	// Backups
+	{ID: "ListBackups", Method: http.MethodGet, Path: "/api/v1/admin/backups", Tag: "admin",
+		Summary: "List the backups, newest first", Response: []models.BackupManifest{}},
+	{ID: "CreateBackup", Method: http.MethodPost, Path: "/api/v1/admin/backups", Tag: "admin",
+		Summary: "Take a backup", Status: http.StatusCreated, Response: models.BackupManifest{}},
+	{ID: "DownloadBackup", Method: http.MethodGet, Path: "/api/v1/admin/backups/:name", Tag: "admin",
+		Summary: "Download a backup",
+		Params:  []Param{{Name: "name", In: InPath, Type: String, Description: "File name of the backup"}},
+		Media:   []string{"application/octet-stream"}},
+
+	// Administration
+	{ID: "ListUsers", Method: http.MethodGet, Path: "/api/v1/admin/users", Tag: "admin",
+		Summary: "List the users", Response: []models.User{}},
+	{ID: "CreateUser", Method: http.MethodPost, Path: "/api/v1/admin/users", Tag: "admin",
+		Summary: "Add a user", Body: models.CreateUserRequest{}, Status: http.StatusCreated, Response: models.User{}},
+	{ID: "DeleteUser", Method: http.MethodDelete, Path: "/api/v1/admin/users/:name", Tag: "admin",
+		Summary: "Remove a user and revoke their keys", Params: []Param{{Name: "name", In: InPath, Type: String}},
+		Response: models.Message{}},
+	{ID: "ListKeys", Method: http.MethodGet, Path: "/api/v1/admin/keys", Tag: "admin",
+		Summary: "List the admin keys without their secret", Response: []models.AdminKey{}},
+	{ID: "CreateKey", Method: http.MethodPost, Path: "/api/v1/admin/keys", Tag: "admin",
+		Summary: "Create an admin key; the response is the only time it is shown", Body: models.CreateKeyRequest{},
+		Status: http.StatusCreated, Response: models.CreatedAdminKey{}},
+	{ID: "RevokeKey", Method: http.MethodDelete, Path: "/api/v1/admin/keys/:id", Tag: "admin",
+		Summary: "Revoke an admin key", Params: []Param{idParam}, Response: models.Message{}},
+	{ID: "GetStats", Method: http.MethodGet, Path: "/api/v1/admin/stats", Tag: "admin",
+		Summary: "Get the size of the database", Response: models.Stats{}},
+	{ID: "ListDeviceStats", Method: http.MethodGet, Path: "/api/v1/admin/devices", Tag: "admin",
+		Summary: "List the devices with their number of notifications", Response: []models.DeviceStats{}},
+	{ID: "PurgeNotifications", Method: http.MethodDelete, Path: "/api/v1/admin/notifications", Tag: "admin",
+		Summary: "Delete notifications permanently; at least one filter or all is required",
+		Params: []Param{
+			deviceFilter, packageFilter,
+			{Name: "before", In: InQuery, Type: DateTime, Description: "Only notifications received before"},
+			{Name: "all", In: InQuery, Type: Boolean, Description: "Delete every notification"},
+			{Name: "dry_run", In: InQuery, Type: Boolean, Description: "Count the notifications without deleting them"},
+		},
+		Response: models.PurgeResult{}},
+	{ID: "GetRetention", Method: http.MethodGet, Path: "/api/v1/admin/retention", Tag: "admin",
+		Summary: "Get the retention policy and its last run", Response: models.RetentionStatus{}},
+	{ID: "RunRetention", Method: http.MethodPost, Path: "/api/v1/admin/retention/run", Tag: "admin",
+		Summary: "Delete the notifications older than the retention period now", Response: models.RetentionRun{}},
+
+	// Self-signed TLS, served when the server made its own CA
+	{ID: "GetCA", Method: http.MethodGet, Path: "/api/v1/tls/ca", Tag: "tls",
+		Summary: "Get the fingerprints of the self-signed CA", Response: models.CAInfo{}},
+	{ID: "GetCAPEM", Method: http.MethodGet, Path: "/api/v1/tls/ca.pem", Tag: "tls",
+		Summary: "Download the self-signed CA certificate", Media: []string{"application/x-pem-file"}},
+}
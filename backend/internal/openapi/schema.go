@@ -0,0 +1,146 @@
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/lileye/backend/internal/config"
+	"gorm.io/gorm"
+)
+
+// schemaPrefix starts the references to component schemas
+const schemaPrefix = "#/components/schemas/"
+
+// Types with their own JSON encoding
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	deletedAtType = reflect.TypeOf(gorm.DeletedAt{})
+	durationType  = reflect.TypeOf(config.Duration(0))
+)
+
+// schemas derives schemas from Go types the way encoding/json encodes them.
+// Named structs become component schemas that are referred to by $ref.
+type schemas struct {
+	defs  map[string]*Schema
+	types map[string]reflect.Type
+}
+
+func newSchemas() *schemas {
+	return &schemas{defs: map[string]*Schema{}, types: map[string]reflect.Type{}}
+}
+
+// ref returns the schema of t
+func (s *schemas) ref(t reflect.Type) *Schema {
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: DateTime}
+	case deletedAtType:
+		return &Schema{Type: "string", Format: DateTime, Nullable: true}
+	case durationType:
+		return &Schema{Type: "string", Description: "A Go duration, such as 720h0m0s"}
+	}
+	if t.Kind() != reflect.Pointer && (t.Implements(marshalerType) || reflect.PointerTo(t).Implements(marshalerType) ||
+		t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType)) {
+		panic(fmt.Sprintf("openapi: %s has its own JSON encoding; describe it in schemas.ref", t))
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Interface:
+		return &Schema{}
+	case reflect.Pointer:
+		inner := s.ref(t.Elem())
+		if inner.Ref != "" {
+			// Siblings of $ref are ignored, so the reference is wrapped
+			return &Schema{Nullable: true, AllOf: []*Schema{inner}}
+		}
+		inner.Nullable = true
+		return inner
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte", Nullable: true}
+		}
+		// A nil slice is encoded as null
+		return &Schema{Type: "array", Items: s.ref(t.Elem()), Nullable: true}
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			break
+		}
+		return &Schema{Type: "object", AdditionalProperties: s.ref(t.Elem()), Nullable: true}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		name := schemaName(t)
+		if other, ok := s.types[name]; ok && other != t {
+			panic(fmt.Sprintf("openapi: %s and %s are both named %s", t, other, name))
+		}
+		if _, ok := s.defs[name]; !ok {
+			s.types[name] = t
+			// Added before its fields, in case they refer back to it
+			s.defs[name] = &Schema{}
+			*s.defs[name] = *s.object(t)
+		}
+		return &Schema{Ref: schemaPrefix + name}
+	}
+	panic(fmt.Sprintf("openapi: cannot describe %s", t))
+}
+
+var (
+	marshalerType     = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// object returns the schema of a struct. Fields without omitempty are
+// always sent, so they are required.
+func (s *schemas) object(t reflect.Type) *Schema {
+	obj := &Schema{Type: "object", Properties: map[string]*Schema{}, AdditionalProperties: false}
+	s.fields(t, obj)
+	return obj
+}
+
+func (s *schemas) fields(t reflect.Type, obj *Schema) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || (!f.IsExported() && !f.Anonymous) {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			// The fields of embedded structs are promoted
+			s.fields(f.Type, obj)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		obj.Properties[name] = s.ref(f.Type)
+		if !strings.Contains(opts, "omitempty") {
+			obj.Required = append(obj.Required, name)
+		}
+	}
+}
+
+// schemaName names the schema of a struct. Types outside the models
+// package are prefixed with their package, as in RetentionStatus.
+func schemaName(t reflect.Type) string {
+	pkg := path.Base(t.PkgPath())
+	if pkg == "models" {
+		return t.Name()
+	}
+	return strings.ToUpper(pkg[:1]) + pkg[1:] + t.Name()
+}
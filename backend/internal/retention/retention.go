@@ -0,0 +1,86 @@
+// Package retention deletes notifications once they are older than the
+// configured retention period
+package retention
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/lileye/backend/internal/config"
+	"github.com/lileye/backend/internal/metrics"
+	"github.com/lileye/backend/internal/models"
+	"github.com/lileye/backend/internal/storage"
+)
+
+// ErrDisabled is returned when applying a policy that keeps notifications
+// forever
+var ErrDisabled = errors.New("retention is disabled, set retention.max_age")
+
+// Policy deletes notifications older than a maximum age
+type Policy struct {
+	notifications *storage.NotificationStorage
+	cfg           config.Retention
+	now           func() time.Time
+
+	mu      sync.Mutex
+	lastRun *models.RetentionRun
+}
+
+// New creates the policy configured by cfg
+func New(notifications *storage.NotificationStorage, cfg config.Retention) *Policy {
+	return &Policy{notifications: notifications, cfg: cfg, now: time.Now}
+}
+
+// Enabled reports whether notifications are ever deleted
+func (p *Policy) Enabled() bool {
+	return p.cfg.MaxAge > 0
+}
+
+// Interval is how often the policy is applied
+func (p *Policy) Interval() time.Duration {
+	return time.Duration(p.cfg.Interval)
+}
+
+// Status returns the policy and what applying it now would delete
+func (p *Policy) Status(ctx context.Context) (*models.RetentionStatus, error) {
+	status := &models.RetentionStatus{MaxAge: p.cfg.MaxAge, Interval: p.cfg.Interval}
+	p.mu.Lock()
+	status.LastRun = p.lastRun
+	p.mu.Unlock()
+	if !p.Enabled() {
+		return status, nil
+	}
+
+	cutoff := p.cutoff()
+	eligible, err := p.notifications.CountPurge(ctx, storage.PurgeFilter{Before: cutoff})
+	if err != nil {
+		return nil, err
+	}
+	status.Cutoff, status.Eligible = &cutoff, eligible
+	return status, nil
+}
+
+// Apply deletes the notifications older than the maximum age
+func (p *Policy) Apply(ctx context.Context) (*models.RetentionRun, error) {
+	if !p.Enabled() {
+		return nil, ErrDisabled
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	run := &models.RetentionRun{Time: p.now(), Cutoff: p.cutoff()}
+	deleted, err := p.notifications.Purge(ctx, storage.PurgeFilter{Before: run.Cutoff})
+	run.Deleted = deleted
+	if err != nil {
+		run.Error = err.Error()
+	}
+	metrics.RetentionDeleted.Add(float64(deleted))
+	p.lastRun = run
+	return run, err
+}
+
+func (p *Policy) cutoff() time.Time {
+	return p.now().Add(-time.Duration(p.cfg.MaxAge)).UTC()
+}
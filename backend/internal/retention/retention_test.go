@@ -0,0 +1,51 @@
+package retention
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lileye/backend/internal/config"
+	"github.com/lileye/backend/internal/models"
+	"github.com/lileye/backend/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestPolicy(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "lileye.db")), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, storage.Migrate(db))
+	notifications := storage.NewNotificationStorage(db)
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	for _, age := range []time.Duration{time.Hour, 10 * 24 * time.Hour, 40 * 24 * time.Hour} {
+		assert.NoError(t, notifications.Create(context.Background(), &models.Notification{DeviceID: "device1", Timestamp: now.Add(-age)}))
+	}
+
+	disabled := New(notifications, config.Retention{Interval: config.Duration(time.Hour)})
+	assert.False(t, disabled.Enabled())
+	_, err = disabled.Apply(context.Background())
+	assert.ErrorIs(t, err, ErrDisabled)
+	status, err := disabled.Status(context.Background())
+	assert.NoError(t, err)
+	assert.Nil(t, status.Cutoff)
+
+	policy := New(notifications, config.Retention{MaxAge: config.Duration(7 * 24 * time.Hour), Interval: config.Duration(time.Hour)})
+	policy.now = func() time.Time { return now }
+	status, err = policy.Status(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(-7*24*time.Hour), *status.Cutoff)
+	assert.Equal(t, int64(2), status.Eligible)
+	assert.Nil(t, status.LastRun)
+
+	run, err := policy.Apply(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), run.Deleted)
+	status, err = policy.Status(context.Background())
+	assert.NoError(t, err)
+	assert.Zero(t, status.Eligible)
+	assert.Equal(t, run, status.LastRun)
+}
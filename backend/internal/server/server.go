@@ -0,0 +1,180 @@
+// Package server runs the HTTP server and its background workers and shuts
+// them down in order when the process is asked to stop
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config holds the listener address and timeouts of a Server
+type Config struct {
+	Addr              string
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// TLSConfig serves HTTPS when set
+	TLSConfig *tls.Config
+	// ShutdownTimeout bounds how long in-flight requests and workers are
+	// given to finish once shutdown starts
+	ShutdownTimeout time.Duration
+}
+
+// Server is an http.Server with background workers and cleanup hooks that
+// run on shutdown
+type Server struct {
+	http            *http.Server
+	shutdownTimeout time.Duration
+
+	workerCtx  context.Context
+	stopWorker context.CancelFunc
+	workers    sync.WaitGroup
+
+	onDrain []func()
+	onClose []func(ctx context.Context) error
+}
+
+// New creates a new Server instance
+func New(handler http.Handler, cfg Config) *Server {
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	return &Server{
+		http: &http.Server{
+			Addr:              cfg.Addr,
+			Handler:           handler,
+			ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+			ReadTimeout:       cfg.ReadTimeout,
+			WriteTimeout:      cfg.WriteTimeout,
+			IdleTimeout:       cfg.IdleTimeout,
+			TLSConfig:         cfg.TLSConfig,
+		},
+		shutdownTimeout: cfg.ShutdownTimeout,
+		workerCtx:       workerCtx,
+		stopWorker:      stopWorker,
+	}
+}
+
+// Go runs a background worker. Its context is cancelled once the HTTP
+// server has drained, and shutdown waits for it to return.
+func (s *Server) Go(worker func(ctx context.Context)) {
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		worker(s.workerCtx)
+	}()
+}
+
+// OnDrain registers a function called as soon as shutdown starts, before
+// connections are drained
+func (s *Server) OnDrain(f func()) {
+	s.onDrain = append(s.onDrain, f)
+}
+
+// OnClose registers a function called after the HTTP server and workers
+// have stopped. Functions run in reverse order of registration.
+func (s *Server) OnClose(f func(ctx context.Context) error) {
+	s.onClose = append(s.onClose, f)
+}
+
+// ListenAndServe listens on the configured address and serves until ctx is
+// done, then shuts down
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.http.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Serve serves requests from ln until ctx is done, then shuts down: it
+// calls the drain hooks, waits for in-flight requests, stops the workers
+// and runs the close hooks. Everything after the drain hooks shares the
+// shutdown timeout.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		if s.http.TLSConfig != nil {
+			serveErr <- s.http.ServeTLS(ln, "", "")
+			return
+		}
+		serveErr <- s.http.Serve(ln)
+	}()
+
+	select {
+	case err := <-serveErr:
+		s.stop(context.Background())
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down", "timeout", s.shutdownTimeout.String())
+	for _, f := range s.onDrain {
+		f()
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+
+	var errs []error
+	if err := s.http.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, err)
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		errs = append(errs, err)
+	}
+	errs = append(errs, s.stop(shutdownCtx)...)
+	return errors.Join(errs...)
+}
+
+// stop cancels the workers, waits for them until ctx is done and runs the
+// close hooks
+func (s *Server) stop(ctx context.Context) []error {
+	s.stopWorker()
+	done := make(chan struct{})
+	go func() {
+		s.workers.Wait()
+		close(done)
+	}()
+
+	var errs []error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		errs = append(errs, errors.New("background workers did not stop in time"))
+	}
+
+	for i := len(s.onClose) - 1; i >= 0; i-- {
+		if err := s.onClose[i](ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// RedirectToHTTPS redirects every request to the same host and path on
+// httpsAddr, keeping the method and body with 308 Permanent Redirect
+func RedirectToHTTPS(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+
+		target := url.URL{Scheme: "https", Host: host, Path: r.URL.Path, RawPath: r.URL.RawPath, RawQuery: r.URL.RawQuery}
+		http.Redirect(w, r, target.String(), http.StatusPermanentRedirect)
+	})
+}
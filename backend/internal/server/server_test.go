@@ -0,0 +1,166 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lileye/backend/internal/certs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInFlightRequestsComplete(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		io.WriteString(w, "stored")
+	})
+
+	var order []string
+	s := New(handler, Config{ShutdownTimeout: 5 * time.Second})
+	s.OnDrain(func() { order = append(order, "drain") })
+	s.Go(func(ctx context.Context) {
+		<-ctx.Done()
+		order = append(order, "worker")
+	})
+	s.OnClose(func(ctx context.Context) error {
+		order = append(order, "close db")
+		return nil
+	})
+	s.OnClose(func(ctx context.Context) error {
+		order = append(order, "close metrics")
+		return nil
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := "http://" + ln.Addr().String()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(ctx, ln) }()
+
+	type result struct {
+		body string
+		err  error
+	}
+	response := make(chan result, 1)
+	go func() {
+		resp, err := http.Post(addr+"/api/notifications", "application/json", nil)
+		if err != nil {
+			response <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		response <- result{body: string(body), err: err}
+	}()
+
+	<-started
+	cancel()
+
+	// New connections are refused once shutdown starts
+	assert.Eventually(t, func() bool {
+		_, err := net.Dial("tcp", ln.Addr().String())
+		return err != nil
+	}, time.Second, 10*time.Millisecond)
+
+	select {
+	case <-served:
+		t.Fatal("server stopped before the in-flight request finished")
+	default:
+	}
+
+	close(release)
+	r := <-response
+	assert.NoError(t, r.err)
+	assert.Equal(t, "stored", r.body)
+	assert.NoError(t, <-served)
+	assert.Equal(t, []string{"drain", "worker", "close metrics", "close db"}, order)
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+
+	closed := false
+	s := New(handler, Config{ShutdownTimeout: 50 * time.Millisecond})
+	s.OnClose(func(ctx context.Context) error {
+		closed = true
+		return nil
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(ctx, ln) }()
+	go http.Get("http://" + ln.Addr().String())
+
+	<-started
+	cancel()
+	assert.ErrorIs(t, <-served, context.DeadlineExceeded)
+	assert.True(t, closed)
+}
+
+func TestServeTLS(t *testing.T) {
+	config, info, err := certs.SelfSigned(t.TempDir(), []string{"127.0.0.1"})
+	assert.NoError(t, err)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "secure")
+	})
+	s := New(handler, Config{TLSConfig: config, ShutdownTimeout: time.Second})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(ctx, ln) }()
+
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM([]byte(info.PEM))
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	resp, err := client.Get("https://" + ln.Addr().String())
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "secure", string(body))
+
+	cancel()
+	assert.NoError(t, <-served)
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		httpsAddr, host, target string
+	}{
+		{":8443", "192.168.1.20:8080", "https://192.168.1.20:8443/api/devices?x=1"},
+		{":443", "lileye.local:8080", "https://lileye.local/api/devices?x=1"},
+		{"0.0.0.0:443", "lileye.local", "https://lileye.local/api/devices?x=1"},
+		{":8443", "[fe80::1]:8080", "https://[fe80::1]:8443/api/devices?x=1"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/api/devices?x=1", nil)
+		req.Host = tt.host
+		RedirectToHTTPS(tt.httpsAddr).ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusPermanentRedirect, w.Code)
+		assert.Equal(t, tt.target, w.Header().Get("Location"))
+	}
+}
@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lileye/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrUserExists is returned when creating a user whose name is taken
+	ErrUserExists = errors.New("user already exists")
+	// ErrInvalidKey is returned for an admin key that is unknown or revoked
+	ErrInvalidKey = errors.New("invalid admin key")
+)
+
+// adminKeyPrefix starts every admin key, so that leaked keys are easy to
+// search for
+const adminKeyPrefix = "lek_"
+
+// lastUsedPrecision is how often the last use of a key is recorded
+const lastUsedPrecision = time.Minute
+
+// AdminStorage handles database operations for users and their admin keys
+type AdminStorage struct {
+	db *gorm.DB
+}
+
+// NewAdminStorage creates a new AdminStorage instance
+func NewAdminStorage(db *gorm.DB) *AdminStorage {
+	return &AdminStorage{db: db}
+}
+
+// ListUsers retrieves every user by name
+func (s *AdminStorage) ListUsers(ctx context.Context) ([]models.User, error) {
+	users := []models.User{}
+	err := s.db.WithContext(ctx).Order("name").Find(&users).Error
+	return users, err
+}
+
+// CreateUser stores a new user
+func (s *AdminStorage) CreateUser(ctx context.Context, name string) (*models.User, error) {
+	user := &models.User{Name: strings.TrimSpace(name)}
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.User{}).Where("name = ?", user.Name).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrUserExists
+		}
+		return tx.Create(user).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// DeleteUser removes a user and revokes their keys
+func (s *AdminStorage) DeleteUser(ctx context.Context, name string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("name = ?", name).Delete(&models.User{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Model(&models.AdminKey{}).
+			Where(`"user" = ? AND revoked_at IS NULL`, name).
+			Update("revoked_at", time.Now()).Error
+	})
+}
+
+// ListKeys retrieves the keys of every user, revoked ones included, in the
+// order they were created
+func (s *AdminStorage) ListKeys(ctx context.Context) ([]models.AdminKey, error) {
+	keys := []models.AdminKey{}
+	err := s.db.WithContext(ctx).Order("id").Find(&keys).Error
+	return keys, err
+}
+
+// CreateKey creates a key for an existing user. The returned key holds its
+// secret value, which is not stored.
+func (s *AdminStorage) CreateKey(ctx context.Context, user, name string) (*models.CreatedAdminKey, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	value := adminKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	key := &models.CreatedAdminKey{
+		AdminKey: models.AdminKey{User: user, Name: name, Prefix: value[:len(adminKeyPrefix)+6], Hash: hashKey(value)},
+		Key:      value,
+	}
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("name = ?", user).First(&models.User{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&key.AdminKey).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// RevokeKey revokes a key so that it is no longer accepted
+func (s *AdminStorage) RevokeKey(ctx context.Context, id uint) error {
+	result := s.db.WithContext(ctx).Model(&models.AdminKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	if result.Error == nil && result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return result.Error
+}
+
+// Authenticate returns the key with the given value and records that it
+// was used. It returns ErrInvalidKey for unknown and revoked keys.
+func (s *AdminStorage) Authenticate(ctx context.Context, value string) (*models.AdminKey, error) {
+	if !strings.HasPrefix(value, adminKeyPrefix) {
+		return nil, ErrInvalidKey
+	}
+	var key models.AdminKey
+	err := s.db.WithContext(ctx).Where("hash = ? AND revoked_at IS NULL", hashKey(value)).First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= lastUsedPrecision {
+		key.LastUsedAt = &now
+		if err := s.db.WithContext(ctx).Model(&key).UpdateColumn("last_used_at", now).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &key, nil
+}
+
+// hashKey returns the stored form of a key. Keys are random, so a fast
+// unsalted hash is enough.
+func hashKey(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestAdminStorage_Keys(t *testing.T) {
+	db, _ := setupTestDB(t)
+	admins := NewAdminStorage(db)
+
+	_, err := admins.CreateKey(context.Background(), "alice", "laptop")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	_, err = admins.CreateUser(context.Background(), "alice")
+	assert.NoError(t, err)
+	_, err = admins.CreateUser(context.Background(), " alice ")
+	assert.ErrorIs(t, err, ErrUserExists)
+
+	created, err := admins.CreateKey(context.Background(), "alice", "laptop")
+	assert.NoError(t, err)
+	assert.Regexp(t, `^lek_[A-Za-z0-9_-]{43}$`, created.Key)
+	assert.NotContains(t, created.Hash, created.Key)
+
+	key, err := admins.Authenticate(context.Background(), created.Key)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", key.User)
+	assert.NotNil(t, key.LastUsedAt)
+	_, err = admins.Authenticate(context.Background(), created.Key+"x")
+	assert.ErrorIs(t, err, ErrInvalidKey)
+
+	assert.NoError(t, admins.RevokeKey(context.Background(), key.ID))
+	assert.ErrorIs(t, admins.RevokeKey(context.Background(), key.ID), gorm.ErrRecordNotFound)
+	_, err = admins.Authenticate(context.Background(), created.Key)
+	assert.ErrorIs(t, err, ErrInvalidKey)
+
+	keys, err := admins.ListKeys(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, keys, 1)
+	assert.NotNil(t, keys[0].RevokedAt)
+}
+
+func TestAdminStorage_DeleteUserRevokesKeys(t *testing.T) {
+	db, _ := setupTestDB(t)
+	admins := NewAdminStorage(db)
+	_, err := admins.CreateUser(context.Background(), "alice")
+	assert.NoError(t, err)
+	created, err := admins.CreateKey(context.Background(), "alice", "")
+	assert.NoError(t, err)
+
+	assert.NoError(t, admins.DeleteUser(context.Background(), "alice"))
+	assert.ErrorIs(t, admins.DeleteUser(context.Background(), "alice"), gorm.ErrRecordNotFound)
+	_, err = admins.Authenticate(context.Background(), created.Key)
+	assert.ErrorIs(t, err, ErrInvalidKey)
+
+	// The name can be taken again
+	_, err = admins.CreateUser(context.Background(), "alice")
+	assert.NoError(t, err)
+	users, err := admins.ListUsers(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+}
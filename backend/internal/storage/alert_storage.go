@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+	"sort"
+
+	"github.com/lileye/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// AlertStorage handles database operations for alerts and the allowlist
+type AlertStorage struct {
+	db *gorm.DB
+}
+
+// NewAlertStorage creates a new AlertStorage instance
+func NewAlertStorage(db *gorm.DB) *AlertStorage {
+	return &AlertStorage{db: db}
+}
+
+// List retrieves alerts, newest first, optionally restricted to a device and
+// to unacknowledged alerts
+func (s *AlertStorage) List(ctx context.Context, deviceID string, unacknowledgedOnly bool) ([]models.Alert, error) {
+	query := s.db.WithContext(ctx).Order("created_at desc")
+	if deviceID != "" {
+		query = query.Where("device_id = ?", deviceID)
+	}
+	if unacknowledgedOnly {
+		query = query.Where("acknowledged = ?", false)
+	}
+
+	var alerts []models.Alert
+	err := query.Find(&alerts).Error
+	return alerts, err
+}
+
+// Acknowledge marks an alert as acknowledged
+func (s *AlertStorage) Acknowledge(ctx context.Context, id uint) error {
+	result := s.db.WithContext(ctx).Model(&models.Alert{}).Where("id = ?", id).Update("acknowledged", true)
+	if result.Error == nil && result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return result.Error
+}
+
+// ListAllowlist retrieves every allowlist entry, sorted by identity.
+// Identities may be encrypted, so they are sorted once loaded.
+func (s *AlertStorage) ListAllowlist(ctx context.Context) ([]models.AllowlistEntry, error) {
+	var entries []models.AllowlistEntry
+	if err := s.db.WithContext(ctx).Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Identity < entries[j].Identity })
+	return entries, nil
+}
+
+// AddAllowlist stores a new allowlist entry, normalizing its identity
+func (s *AlertStorage) AddAllowlist(ctx context.Context, entry *models.AllowlistEntry) error {
+	entry.Identity = models.NormalizeIdentity(entry.Identity)
+	return s.db.WithContext(ctx).Create(entry).Error
+}
+
+// DeleteAllowlist removes an allowlist entry
+func (s *AlertStorage) DeleteAllowlist(ctx context.Context, id uint) error {
+	result := s.db.WithContext(ctx).Delete(&models.AllowlistEntry{}, id)
+	if result.Error == nil && result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return result.Error
+}
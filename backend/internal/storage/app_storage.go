@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/lileye/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AppStorage handles database operations for the app catalog
+type AppStorage struct {
+	db    *gorm.DB
+	blobs *BlobStore
+}
+
+// NewAppStorage creates a new AppStorage instance
+func NewAppStorage(db *gorm.DB, blobs *BlobStore) *AppStorage {
+	return &AppStorage{db: db, blobs: blobs}
+}
+
+// Seed adds the given apps to the catalog, leaving existing entries alone
+func (s *AppStorage) Seed(ctx context.Context, apps []models.App) error {
+	if len(apps) == 0 {
+		return nil
+	}
+	seed := make([]models.App, len(apps))
+	copy(seed, apps)
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&seed).Error
+}
+
+// List retrieves the app catalog, optionally restricted to a category
+func (s *AppStorage) List(ctx context.Context, category string) ([]models.App, error) {
+	query := s.db.WithContext(ctx).Order("package_name")
+	if category != "" {
+		query = query.Where("category = ?", category)
+	}
+
+	var apps []models.App
+	err := query.Find(&apps).Error
+	return apps, err
+}
+
+// GetByPackageName retrieves the catalog entry of a package
+func (s *AppStorage) GetByPackageName(ctx context.Context, packageName string) (*models.App, error) {
+	var app models.App
+	err := s.db.WithContext(ctx).Where("package_name = ?", packageName).First(&app).Error
+	if err != nil {
+		return nil, err
+	}
+	return &app, nil
+}
+
+// ReportLabels records the labels devices report for their apps, adding
+// apps that are not in the catalog yet. Categories are left alone.
+func (s *AppStorage) ReportLabels(ctx context.Context, apps []models.App) error {
+	if len(apps) == 0 {
+		return nil
+	}
+	labels := make([]models.App, len(apps))
+	for i, app := range apps {
+		labels[i] = models.App{PackageName: app.PackageName, Name: app.Name}
+	}
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "package_name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "updated_at"}),
+	}).Create(&labels).Error
+}
+
+// SetCategory assigns a category to a package, adding it to the catalog if
+// needed
+func (s *AppStorage) SetCategory(ctx context.Context, packageName, category string) (*models.App, error) {
+	return s.upsert(ctx, &models.App{PackageName: packageName, Category: category}, "category")
+}
+
+// SetWatched sets whether new senders in a package raise alerts, adding it
+// to the catalog if needed
+func (s *AppStorage) SetWatched(ctx context.Context, packageName string, watched bool) (*models.App, error) {
+	return s.upsert(ctx, &models.App{PackageName: packageName, Watched: watched}, "watched")
+}
+
+// SetIcon stores the content of r as the icon of a package, adding it to the
+// catalog if needed
+func (s *AppStorage) SetIcon(ctx context.Context, packageName string, r io.Reader) (*models.App, error) {
+	var app *models.App
+	err := s.blobs.Put(r, func(blob Blob) error {
+		var err error
+		app, err = s.upsert(ctx, &models.App{
+			PackageName:  packageName,
+			IconSHA256:   blob.Hash,
+			IconMimeType: blob.MimeType,
+		}, "icon_sha256", "icon_mime_type")
+		return err
+	})
+	return app, err
+}
+
+// OpenIcon opens the icon of an app for reading
+func (s *AppStorage) OpenIcon(app *models.App) (*os.File, error) {
+	return s.blobs.Open(app.IconSHA256)
+}
+
+func (s *AppStorage) upsert(ctx context.Context, app *models.App, columns ...string) (*models.App, error) {
+	err := s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "package_name"}},
+		DoUpdates: clause.AssignmentColumns(append(columns, "updated_at")),
+	}).Create(app).Error
+	if err != nil {
+		return nil, err
+	}
+	return s.GetByPackageName(ctx, app.PackageName)
+}
+
+// attachApps fills in the app name and category of notifications from the
+// app catalog
+func attachApps(db *gorm.DB, notifications []models.Notification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var packages []string
+	for _, n := range notifications {
+		if !seen[n.PackageName] {
+			seen[n.PackageName] = true
+			packages = append(packages, n.PackageName)
+		}
+	}
+
+	var apps []models.App
+	if err := db.Where("package_name IN ?", packages).Find(&apps).Error; err != nil {
+		return err
+	}
+	byPackage := make(map[string]models.App, len(apps))
+	for _, app := range apps {
+		byPackage[app.PackageName] = app
+	}
+
+	for i := range notifications {
+		app := byPackage[notifications[i].PackageName]
+		notifications[i].AppName = app.Name
+		notifications[i].AppCategory = app.Category
+	}
+	return nil
+}
+
+// inAppCategory restricts a notification query to packages in an app
+// category
+func inAppCategory(category string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("package_name IN (?)",
+			db.Session(&gorm.Session{NewDB: true}).Model(&models.App{}).Select("package_name").Where("category = ?", category))
+	}
+}
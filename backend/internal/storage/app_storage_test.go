@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lileye/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupAppStorage(t *testing.T) (*NotificationStorage, *AppStorage) {
+	db, notificationStorage := setupTestDB(t)
+
+	blobs, err := NewBlobStore(t.TempDir(), 1024)
+	assert.NoError(t, err)
+
+	return notificationStorage, NewAppStorage(db, blobs)
+}
+
+func TestAppStorage_Seed(t *testing.T) {
+	_, storage := setupAppStorage(t)
+
+	_, err := storage.SetCategory(context.Background(), "com.whatsapp", models.AppCategoryOther)
+	assert.NoError(t, err)
+	assert.NoError(t, storage.Seed(context.Background(), models.DefaultApps))
+	assert.NoError(t, storage.Seed(context.Background(), models.DefaultApps))
+
+	apps, err := storage.List(context.Background(), "")
+	assert.NoError(t, err)
+	assert.Len(t, apps, len(models.DefaultApps))
+
+	// Seeding does not override existing entries
+	app, err := storage.GetByPackageName(context.Background(), "com.whatsapp")
+	assert.NoError(t, err)
+	assert.Equal(t, models.AppCategoryOther, app.Category)
+
+	email, err := storage.List(context.Background(), models.AppCategoryEmail)
+	assert.NoError(t, err)
+	assert.Len(t, email, 3)
+}
+
+func TestAppStorage_ReportLabelsKeepsCategory(t *testing.T) {
+	_, storage := setupAppStorage(t)
+
+	_, err := storage.SetCategory(context.Background(), "com.example.chat", models.AppCategoryMessaging)
+	assert.NoError(t, err)
+
+	err = storage.ReportLabels(context.Background(), []models.App{
+		{PackageName: "com.example.chat", Name: "Chat", Category: models.AppCategorySystem},
+		{PackageName: "com.example.game", Name: "Game"},
+	})
+	assert.NoError(t, err)
+
+	app, err := storage.GetByPackageName(context.Background(), "com.example.chat")
+	assert.NoError(t, err)
+	assert.Equal(t, "Chat", app.Name)
+	assert.Equal(t, models.AppCategoryMessaging, app.Category)
+
+	app, err = storage.GetByPackageName(context.Background(), "com.example.game")
+	assert.NoError(t, err)
+	assert.Equal(t, "Game", app.Name)
+	assert.Empty(t, app.Category)
+}
+
+func TestAppStorage_SetIcon(t *testing.T) {
+	_, storage := setupAppStorage(t)
+
+	app, err := storage.SetIcon(context.Background(), "com.whatsapp", bytes.NewReader(testPNG))
+	assert.NoError(t, err)
+	assert.Equal(t, "image/png", app.IconMimeType)
+
+	file, err := storage.OpenIcon(app)
+	assert.NoError(t, err)
+	file.Close()
+}
+
+func TestNotificationStorage_AppCatalog(t *testing.T) {
+	notificationStorage, storage := setupAppStorage(t)
+	assert.NoError(t, storage.Seed(context.Background(), models.DefaultApps))
+
+	for _, packageName := range []string{"com.whatsapp", "com.google.android.gm", "com.unknown"} {
+		err := notificationStorage.Create(context.Background(), &models.Notification{
+			Title:       "Test Title",
+			Message:     "Test Message",
+			Timestamp:   time.Now(),
+			PackageName: packageName,
+			DeviceID:    "device1",
+		})
+		assert.NoError(t, err)
+	}
+
+	messaging, err := notificationStorage.Find(context.Background(), NotificationFilter{DeviceID: "device1", AppCategory: models.AppCategoryMessaging})
+	assert.NoError(t, err)
+	assert.Len(t, messaging, 1)
+	assert.Equal(t, "WhatsApp", messaging[0].AppName)
+	assert.Equal(t, models.AppCategoryMessaging, messaging[0].AppCategory)
+
+	all, err := notificationStorage.GetByDeviceID(context.Background(), "device1")
+	assert.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	found, err := notificationStorage.GetByID(context.Background(), all[1].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Gmail", found.AppName)
+
+	conversations, err := NewConversationStorage(storage.db).GetConversations(context.Background(), "device1", models.AppCategoryEmail)
+	assert.NoError(t, err)
+	assert.Len(t, conversations, 1)
+	assert.Equal(t, "Gmail", conversations[0].LastMessage.AppName)
+}
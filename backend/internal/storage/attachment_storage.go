@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/lileye/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// AttachmentStorage handles database and blob operations for attachments
+type AttachmentStorage struct {
+	db    *gorm.DB
+	blobs *BlobStore
+}
+
+// NewAttachmentStorage creates a new AttachmentStorage instance
+func NewAttachmentStorage(db *gorm.DB, blobs *BlobStore) *AttachmentStorage {
+	return &AttachmentStorage{db: db, blobs: blobs}
+}
+
+// Create stores the content of r in the blob store and records it as an
+// attachment of the notification
+func (s *AttachmentStorage) Create(ctx context.Context, notificationID uint, kind, filename string, r io.Reader) (*models.Attachment, error) {
+	attachment := &models.Attachment{
+		NotificationID: notificationID,
+		Kind:           kind,
+		Filename:       filename,
+	}
+	err := s.blobs.Put(r, func(blob Blob) error {
+		attachment.MimeType = blob.MimeType
+		attachment.Size = blob.Size
+		attachment.SHA256 = blob.Hash
+		return s.db.WithContext(ctx).Create(attachment).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return attachment, nil
+}
+
+// GetByID retrieves an attachment by its ID
+func (s *AttachmentStorage) GetByID(ctx context.Context, id uint) (*models.Attachment, error) {
+	var attachment models.Attachment
+	err := s.db.WithContext(ctx).First(&attachment, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+// GetByNotificationID retrieves the attachments of a notification
+func (s *AttachmentStorage) GetByNotificationID(ctx context.Context, notificationID uint) ([]models.Attachment, error) {
+	var attachments []models.Attachment
+	err := s.db.WithContext(ctx).Where("notification_id = ?", notificationID).Find(&attachments).Error
+	return attachments, err
+}
+
+// Open opens the content of an attachment for reading
+func (s *AttachmentStorage) Open(attachment *models.Attachment) (*os.File, error) {
+	return s.blobs.Open(attachment.SHA256)
+}
+
+// DeleteOrphans removes attachments whose notification no longer exists and
+// then every blob that neither an attachment nor an app icon refers to. It
+// returns the number of attachments and blobs removed.
+func (s *AttachmentStorage) DeleteOrphans(ctx context.Context) (attachments int64, blobs int, err error) {
+	result := s.db.WithContext(ctx).Unscoped().
+		Where("notification_id NOT IN (?)", s.db.WithContext(ctx).Model(&models.Notification{}).Select("id")).
+		Delete(&models.Attachment{})
+	if result.Error != nil {
+		return 0, 0, result.Error
+	}
+
+	blobs, err = s.blobs.Sweep(func() ([]string, error) {
+		var hashes []string
+		err := s.db.WithContext(ctx).Raw("SELECT sha256 FROM attachments WHERE deleted_at IS NULL " +
+			"UNION SELECT icon_sha256 FROM apps WHERE icon_sha256 <> ''").
+			Scan(&hashes).Error
+		return hashes, err
+	})
+	return result.RowsAffected, blobs, err
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/lileye/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupAttachmentStorage(t *testing.T) (*NotificationStorage, *AttachmentStorage) {
+	db, notificationStorage := setupTestDB(t)
+	blobs, err := NewBlobStore(t.TempDir(), 1024)
+	assert.NoError(t, err)
+
+	return notificationStorage, NewAttachmentStorage(db, blobs)
+}
+
+func TestAttachmentStorage_Create(t *testing.T) {
+	notificationStorage, storage := setupAttachmentStorage(t)
+	notification := createTestNotification(t, notificationStorage, "device1")
+
+	first, err := storage.Create(context.Background(), notification.ID, models.AttachmentImage, "photo.png", bytes.NewReader(testPNG))
+	assert.NoError(t, err)
+	assert.Equal(t, "image/png", first.MimeType)
+
+	second, err := storage.Create(context.Background(), notification.ID, models.AttachmentAvatar, "avatar.png", bytes.NewReader(testPNG))
+	assert.NoError(t, err)
+	assert.Equal(t, first.SHA256, second.SHA256)
+
+	attachments, err := storage.GetByNotificationID(context.Background(), notification.ID)
+	assert.NoError(t, err)
+	assert.Len(t, attachments, 2)
+
+	found, err := storage.GetByID(context.Background(), first.ID)
+	assert.NoError(t, err)
+	file, err := storage.Open(found)
+	assert.NoError(t, err)
+	file.Close()
+}
+
+func TestAttachmentStorage_DeleteOrphans(t *testing.T) {
+	notificationStorage, storage := setupAttachmentStorage(t)
+	kept := createTestNotification(t, notificationStorage, "device1")
+	deleted := createTestNotification(t, notificationStorage, "device1")
+
+	_, err := storage.Create(context.Background(), kept.ID, models.AttachmentImage, "kept.png", bytes.NewReader(testPNG))
+	assert.NoError(t, err)
+	_, err = storage.Create(context.Background(), deleted.ID, models.AttachmentImage, "shared.png", bytes.NewReader(testPNG))
+	assert.NoError(t, err)
+	orphan, err := storage.Create(context.Background(), deleted.ID, models.AttachmentImage, "orphan.gif", bytes.NewReader([]byte("GIF89a")))
+	assert.NoError(t, err)
+
+	assert.NoError(t, notificationStorage.db.Delete(&models.Notification{}, deleted.ID).Error)
+
+	attachments, blobs, err := storage.DeleteOrphans(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), attachments)
+	assert.Equal(t, 1, blobs)
+
+	_, err = storage.Open(orphan)
+	assert.Error(t, err)
+
+	remaining, err := storage.blobs.list()
+	assert.NoError(t, err)
+	assert.Len(t, remaining, 1)
+}
+
+func TestAttachmentStorage_DeleteOrphansKeepsAppIcons(t *testing.T) {
+	_, storage := setupAttachmentStorage(t)
+	apps := NewAppStorage(storage.db, storage.blobs)
+
+	_, err := apps.SetIcon(context.Background(), "com.whatsapp", bytes.NewReader(testPNG))
+	assert.NoError(t, err)
+
+	_, blobs, err := storage.DeleteOrphans(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, blobs)
+}
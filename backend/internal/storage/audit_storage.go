@@ -0,0 +1,210 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lileye/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// auditTriggers reject changes to stored audit entries
+var auditTriggers = []string{
+	`CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+	BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END`,
+	`CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+	BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END`,
+}
+
+// AuditKeySize is the size of the key the audit log is chained with
+const AuditKeySize = 32
+
+// AuditStorage handles database operations for the audit log
+type AuditStorage struct {
+	db *gorm.DB
+	// key keys the hash chain, so that someone who can write the database
+	// but has not got the key cannot recompute the chain after a change
+	key []byte
+	// mu serializes appends so that each entry chains onto the last one
+	mu sync.Mutex
+}
+
+// NewAuditStorage creates a new AuditStorage instance chaining entries
+// with key
+func NewAuditStorage(db *gorm.DB, key []byte) *AuditStorage {
+	return &AuditStorage{db: db, key: key}
+}
+
+// LoadAuditKey reads the audit key from path, the base64 of AuditKeySize
+// bytes. When the file does not exist, a random key is written to it.
+func LoadAuditKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		key := make([]byte, AuditKeySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		_, err = f.WriteString(base64.StdEncoding.EncodeToString(key) + "\n")
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		return key, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != AuditKeySize {
+		return nil, fmt.Errorf("audit key %s: want the base64 of %d bytes", path, AuditKeySize)
+	}
+	return key, nil
+}
+
+// AuditFilter narrows down a listing of the audit log. Zero fields match
+// every entry.
+type AuditFilter struct {
+	Actor          string
+	Action         string
+	DeviceID       string
+	NotificationID uint
+	Since          time.Time
+	Until          time.Time
+}
+
+// Append chains an entry onto the log and stores it. The time is set to now
+// when missing.
+func (s *AuditStorage) Append(ctx context.Context, entry *models.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var last models.AuditEntry
+		if err := tx.Order("id desc").Limit(1).Find(&last).Error; err != nil {
+			return err
+		}
+
+		if entry.Time.IsZero() {
+			entry.Time = time.Now()
+		}
+		// Stored times keep microseconds, so the hash covers no more
+		entry.Time = entry.Time.UTC().Truncate(time.Microsecond)
+		entry.PrevHash = last.Hash
+		entry.Hash = s.hash(entry)
+		return tx.Create(entry).Error
+	})
+}
+
+// List retrieves a page of matching entries, newest first
+func (s *AuditStorage) List(ctx context.Context, filter AuditFilter, limit, offset int) (*models.AuditPage, error) {
+	query := s.db.WithContext(ctx).Model(&models.AuditEntry{})
+	if filter.Actor != "" {
+		query = query.Where("actor = ?", filter.Actor)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.DeviceID != "" {
+		query = query.Where("device_id = ?", filter.DeviceID)
+	}
+	if filter.NotificationID != 0 {
+		query = query.Where("notification_id = ?", filter.NotificationID)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("time >= ?", filter.Since.UTC())
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("time <= ?", filter.Until.UTC())
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, err
+	}
+	entries := []models.AuditEntry{}
+	if err := query.Order("id desc").Limit(limit).Offset(offset).Find(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	return &models.AuditPage{Entries: entries, Total: total, Limit: limit, Offset: offset}, nil
+}
+
+// Verify walks the log from the first entry and checks that every entry
+// links to the one before it and matches its hash
+func (s *AuditStorage) Verify(ctx context.Context) (*models.AuditVerification, error) {
+	result := &models.AuditVerification{Valid: true}
+	var batch []models.AuditEntry
+	err := s.db.WithContext(ctx).Order("id").FindInBatches(&batch, 500, func(_ *gorm.DB, _ int) error {
+		for i := range batch {
+			entry := &batch[i]
+			switch {
+			case entry.PrevHash != result.Head:
+				result.Problem = "entry does not link to the previous entry"
+			case entry.Hash != s.hash(entry):
+				result.Problem = "entry does not match its hash"
+			default:
+				result.Entries++
+				result.Head = entry.Hash
+				continue
+			}
+			result.Valid = false
+			result.BrokenAt = entry.ID
+			return errStopVerify
+		}
+		return nil
+	}).Error
+	if err != nil && !errors.Is(err, errStopVerify) {
+		return nil, err
+	}
+	return result, nil
+}
+
+// errStopVerify ends the walk of Verify at the first broken entry
+var errStopVerify = errors.New("audit chain broken")
+
+// hash returns the HMAC of an entry's content and the hash before it
+func (s *AuditStorage) hash(entry *models.AuditEntry) string {
+	content, _ := json.Marshal(struct {
+		PrevHash       string
+		Time           int64
+		Actor          string
+		ClaimedActor   string
+		Action         string
+		DeviceID       string
+		NotificationID uint
+		Params         string
+		IP             string
+		RequestID      string
+		Status         int
+	}{
+		entry.PrevHash,
+		entry.Time.UnixMicro(),
+		entry.Actor,
+		entry.ClaimedActor,
+		entry.Action,
+		entry.DeviceID,
+		entry.NotificationID,
+		entry.Params,
+		entry.IP,
+		entry.RequestID,
+		entry.Status,
+	})
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write(content)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lileye/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+var testAuditKey = bytes.Repeat([]byte{7}, AuditKeySize)
+
+func TestAuditLog(t *testing.T) {
+	db, _ := setupTestDB(t)
+	audit := NewAuditStorage(db, testAuditKey)
+
+	start := time.Now().Add(-time.Minute)
+	for _, entry := range []models.AuditEntry{
+		{Actor: "mum", Action: "notification.search", DeviceID: "device1", Params: "q=park", Status: 200},
+		{Actor: "dad", Action: "notification.read", DeviceID: "device1", NotificationID: 7, Status: 200},
+		{Actor: "mum", Action: "notification.delete_all", Status: 200},
+	} {
+		assert.NoError(t, audit.Append(context.Background(), &entry))
+	}
+
+	page, err := audit.List(context.Background(), AuditFilter{Actor: "mum"}, 50, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), page.Total)
+	assert.Equal(t, "notification.delete_all", page.Entries[0].Action)
+
+	page, err = audit.List(context.Background(), AuditFilter{DeviceID: "device1", NotificationID: 7, Since: start}, 50, 0)
+	assert.NoError(t, err)
+	assert.Len(t, page.Entries, 1)
+	assert.Equal(t, "dad", page.Entries[0].Actor)
+
+	page, err = audit.List(context.Background(), AuditFilter{Until: start}, 50, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), page.Total)
+
+	result, err := audit.Verify(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, result.Valid)
+	assert.Equal(t, int64(3), result.Entries)
+
+	page, err = audit.List(context.Background(), AuditFilter{}, 1, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, page.Entries[0].Hash, result.Head)
+}
+
+func TestAuditLogIsAppendOnly(t *testing.T) {
+	db, _ := setupTestDB(t)
+	audit := NewAuditStorage(db, testAuditKey)
+	for _, actor := range []string{"mum", "dad", "mum"} {
+		assert.NoError(t, audit.Append(context.Background(), &models.AuditEntry{Actor: actor, Action: "notification.list"}))
+	}
+
+	err := db.Exec("UPDATE audit_log SET actor = 'nobody' WHERE id = 2").Error
+	assert.ErrorContains(t, err, "append-only")
+	err = db.Exec("DELETE FROM audit_log WHERE id = 2").Error
+	assert.ErrorContains(t, err, "append-only")
+
+	// Someone with access to the database file can drop the triggers, but
+	// the change still breaks the chain
+	assert.NoError(t, db.Exec("DROP TRIGGER audit_log_no_update").Error)
+	assert.NoError(t, db.Exec("UPDATE audit_log SET actor = 'nobody' WHERE id = 2").Error)
+	result, err := audit.Verify(context.Background())
+	assert.NoError(t, err)
+	assert.False(t, result.Valid)
+	assert.Equal(t, uint(2), result.BrokenAt)
+	assert.Equal(t, "entry does not match its hash", result.Problem)
+
+	assert.NoError(t, db.Exec("DROP TRIGGER audit_log_no_delete").Error)
+	assert.NoError(t, db.Exec("DELETE FROM audit_log WHERE id = 2").Error)
+	result, err = audit.Verify(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, uint(3), result.BrokenAt)
+	assert.Equal(t, "entry does not link to the previous entry", result.Problem)
+}
+
+func TestAuditLogCannotBeRecomputed(t *testing.T) {
+	db, _ := setupTestDB(t)
+	audit := NewAuditStorage(db, testAuditKey)
+	for _, actor := range []string{"mum", "dad", "mum"} {
+		assert.NoError(t, audit.Append(context.Background(), &models.AuditEntry{Actor: actor, Action: "notification.list"}))
+	}
+
+	// Someone who can write the database rewrites an entry and recomputes
+	// the chain from there, but without the key
+	assert.NoError(t, db.Exec("DROP TRIGGER audit_log_no_update").Error)
+	var entries []models.AuditEntry
+	assert.NoError(t, db.Order("id").Find(&entries).Error)
+	entries[1].Actor = "nobody"
+	forger := NewAuditStorage(db, bytes.Repeat([]byte{8}, AuditKeySize))
+	for i := 1; i < len(entries); i++ {
+		entries[i].PrevHash = entries[i-1].Hash
+		entries[i].Hash = forger.hash(&entries[i])
+		assert.NoError(t, db.Save(&entries[i]).Error)
+	}
+
+	result, err := audit.Verify(context.Background())
+	assert.NoError(t, err)
+	assert.False(t, result.Valid)
+	assert.Equal(t, uint(2), result.BrokenAt)
+	assert.Equal(t, "entry does not match its hash", result.Problem)
+
+	// With the key, the same rewrite would pass: the key is what protects
+	// the chain
+	keyed := NewAuditStorage(db, testAuditKey)
+	for i := 1; i < len(entries); i++ {
+		entries[i].PrevHash = entries[i-1].Hash
+		entries[i].Hash = keyed.hash(&entries[i])
+		assert.NoError(t, db.Save(&entries[i]).Error)
+	}
+	result, err = audit.Verify(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, result.Valid)
+}
+
+func TestLoadAuditKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.key")
+	key, err := LoadAuditKey(path)
+	assert.NoError(t, err)
+	assert.Len(t, key, AuditKeySize)
+
+	// The key written is the key read back
+	again, err := LoadAuditKey(path)
+	assert.NoError(t, err)
+	assert.Equal(t, key, again)
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	assert.NoError(t, os.WriteFile(path, []byte("short"), 0o600))
+	_, err = LoadAuditKey(path)
+	assert.ErrorContains(t, err, "want the base64 of 32 bytes")
+}
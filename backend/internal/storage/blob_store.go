@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrBlobTooLarge is returned when a blob exceeds the store's size limit
+	ErrBlobTooLarge = errors.New("blob exceeds the maximum size")
+	// ErrUnsupportedMediaType is returned when a blob is not an image, audio
+	// or video file
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+)
+
+// allowedMediaTypes are the sniffed MIME type prefixes accepted by the store.
+// Anything else, HTML in particular, is rejected so that blobs can be served
+// back safely.
+var allowedMediaTypes = []string{"image/", "audio/", "video/"}
+
+// Blob describes content stored in the blob store
+type Blob struct {
+	Hash     string
+	Size     int64
+	MimeType string
+}
+
+// BlobStore is a content-addressed file store. Blobs are named after the
+// hex SHA-256 of their content and spread over 256 subdirectories.
+type BlobStore struct {
+	dir     string
+	maxSize int64
+
+	// mu keeps Sweep from removing a blob that has been stored but whose
+	// reference has not been recorded yet
+	mu sync.RWMutex
+}
+
+// NewBlobStore creates a new BlobStore rooted at dir, creating it if needed
+func NewBlobStore(dir string, maxSize int64) (*BlobStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &BlobStore{dir: dir, maxSize: maxSize}, nil
+}
+
+// Put stores the content of r and passes the stored blob to record, which
+// should save a reference to it. Storing content that is already present
+// does not write it again.
+func (s *BlobStore) Put(r io.Reader, record func(Blob) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	blob, err := s.write(r)
+	if err != nil {
+		return err
+	}
+	return record(blob)
+}
+
+func (s *BlobStore) write(r io.Reader) (Blob, error) {
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return Blob{}, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hasher), io.LimitReader(r, s.maxSize+1))
+	if err != nil {
+		return Blob{}, err
+	}
+	if size > s.maxSize {
+		return Blob{}, ErrBlobTooLarge
+	}
+
+	head := make([]byte, 512)
+	n, err := tmp.ReadAt(head, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return Blob{}, err
+	}
+	blob := Blob{
+		Hash:     hex.EncodeToString(hasher.Sum(nil)),
+		Size:     size,
+		MimeType: http.DetectContentType(head[:n]),
+	}
+	if !isAllowedMediaType(blob.MimeType) {
+		return Blob{}, fmt.Errorf("%w: %s", ErrUnsupportedMediaType, blob.MimeType)
+	}
+
+	path := s.path(blob.Hash)
+	if _, err := os.Stat(path); err == nil {
+		return blob, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return Blob{}, err
+	}
+	if err := tmp.Close(); err != nil {
+		return Blob{}, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return Blob{}, err
+	}
+	return blob, nil
+}
+
+// Open opens the blob with the given hash for reading
+func (s *BlobStore) Open(hash string) (*os.File, error) {
+	return os.Open(s.path(hash))
+}
+
+// Sweep removes every blob whose hash is not returned by referenced and
+// returns the number of blobs removed
+func (s *BlobStore) Sweep(referenced func() ([]string, error)) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hashes, err := referenced()
+	if err != nil {
+		return 0, err
+	}
+	keep := make(map[string]bool, len(hashes))
+	for _, hash := range hashes {
+		keep[hash] = true
+	}
+
+	stored, err := s.list()
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, hash := range stored {
+		if keep[hash] {
+			continue
+		}
+		if err := os.Remove(s.path(hash)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+func (s *BlobStore) list() ([]string, error) {
+	var hashes []string
+	err := filepath.WalkDir(s.dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && !strings.HasPrefix(d.Name(), ".") {
+			hashes = append(hashes, d.Name())
+		}
+		return nil
+	})
+	return hashes, err
+}
+
+func (s *BlobStore) path(hash string) string {
+	return filepath.Join(s.dir, hash[:2], hash)
+}
+
+func isAllowedMediaType(mimeType string) bool {
+	for _, prefix := range allowedMediaTypes {
+		if strings.HasPrefix(mimeType, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testPNG is enough of a PNG file for MIME sniffing
+var testPNG = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func putBlob(t *testing.T, store *BlobStore, r io.Reader) (Blob, error) {
+	var stored Blob
+	err := store.Put(r, func(blob Blob) error {
+		stored = blob
+		return nil
+	})
+	return stored, err
+}
+
+func TestBlobStore_PutDeduplicates(t *testing.T) {
+	store, err := NewBlobStore(t.TempDir(), 1024)
+	assert.NoError(t, err)
+
+	blob, err := putBlob(t, store, bytes.NewReader(testPNG))
+	assert.NoError(t, err)
+	assert.Len(t, blob.Hash, 64)
+	assert.Equal(t, int64(len(testPNG)), blob.Size)
+	assert.Equal(t, "image/png", blob.MimeType)
+
+	again, err := putBlob(t, store, bytes.NewReader(testPNG))
+	assert.NoError(t, err)
+	assert.Equal(t, blob.Hash, again.Hash)
+
+	hashes, err := store.list()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{blob.Hash}, hashes)
+
+	file, err := store.Open(blob.Hash)
+	assert.NoError(t, err)
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	assert.NoError(t, err)
+	assert.Equal(t, testPNG, content)
+}
+
+func TestBlobStore_PutRejects(t *testing.T) {
+	store, err := NewBlobStore(t.TempDir(), 16)
+	assert.NoError(t, err)
+
+	_, err = putBlob(t, store, bytes.NewReader(append(testPNG, make([]byte, 16)...)))
+	assert.ErrorIs(t, err, ErrBlobTooLarge)
+
+	_, err = putBlob(t, store, strings.NewReader("<html></html>"))
+	assert.ErrorIs(t, err, ErrUnsupportedMediaType)
+
+	hashes, err := store.list()
+	assert.NoError(t, err)
+	assert.Empty(t, hashes)
+}
+
+func TestBlobStore_Sweep(t *testing.T) {
+	store, err := NewBlobStore(t.TempDir(), 1024)
+	assert.NoError(t, err)
+
+	kept, err := putBlob(t, store, bytes.NewReader(testPNG))
+	assert.NoError(t, err)
+	swept, err := putBlob(t, store, strings.NewReader("GIF89a"))
+	assert.NoError(t, err)
+
+	removed, err := store.Sweep(func() ([]string, error) {
+		return []string{kept.Hash}, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, removed)
+
+	_, err = store.Open(swept.Hash)
+	assert.Error(t, err)
+	file, err := store.Open(kept.Hash)
+	assert.NoError(t, err)
+	file.Close()
+}
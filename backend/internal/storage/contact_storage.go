@@ -0,0 +1,240 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/lileye/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// sqliteTimestampFormat is how the SQLite driver stores time.Time values.
+// Aggregates such as MIN(timestamp) lose the column type and come back as
+// text in this format.
+const sqliteTimestampFormat = "2006-01-02 15:04:05.999999999-07:00"
+
+// ContactStorage handles database operations for contacts
+type ContactStorage struct {
+	db *gorm.DB
+}
+
+// NewContactStorage creates a new ContactStorage instance
+func NewContactStorage(db *gorm.DB) *ContactStorage {
+	return &ContactStorage{db: db}
+}
+
+// recordContact makes sure the sender of a newly stored notification
+// belongs to a contact. A From value whose identity has no alias yet
+// becomes a new contact, and the blind index of every spelling is linked to
+// the alias of its identity.
+func recordContact(tx *gorm.DB, from, fromIndex string) error {
+	identity := models.NormalizeIdentity(from)
+	if identity == "" {
+		return nil
+	}
+	var known int64
+	if err := tx.Model(&models.AliasIndex{}).Where("from_index = ?", fromIndex).Count(&known).Error; err != nil || known > 0 {
+		return err
+	}
+
+	var aliases []models.ContactAlias
+	if err := tx.Where("identity_index IN ?", blindIndexes(identity)).Limit(1).Find(&aliases).Error; err != nil {
+		return err
+	}
+	if len(aliases) == 0 {
+		contact := models.Contact{
+			Name:    from,
+			Status:  models.ContactUnknown,
+			Aliases: []models.ContactAlias{{Name: from, Identity: identity}},
+		}
+		if err := tx.Create(&contact).Error; err != nil {
+			return err
+		}
+		aliases = contact.Aliases
+	}
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.AliasIndex{FromIndex: fromIndex, AliasID: aliases[0].ID}).Error
+}
+
+// indexAliases records the contacts of the senders not linked to an alias
+// yet, such as those of imported notifications, of a database from before
+// aliases were indexed, or of every sender after the blind index changed.
+// One sender per blind index is loaded and decrypted.
+func indexAliases(db *gorm.DB) error {
+	var senders []models.Sender
+	err := db.Select("id", "from", "from_index").
+		Where("id IN (?)", db.Model(&models.Sender{}).
+			Select("MIN(id)").
+			Where("from_index NOT IN (?)", db.Model(&models.AliasIndex{}).Select("from_index")).
+			Group("from_index")).
+		Find(&senders).Error
+	if err != nil || len(senders) == 0 {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, sender := range senders {
+			if err := recordContact(tx, sender.From, sender.FromIndex); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// List retrieves all contacts with their aliases, optionally restricted to
+// a status, sorted by name. Names may be encrypted, so they are sorted once
+// loaded.
+func (s *ContactStorage) List(ctx context.Context, status string) ([]models.Contact, error) {
+	query := s.db.WithContext(ctx).Preload("Aliases")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var contacts []models.Contact
+	if err := query.Find(&contacts).Error; err != nil {
+		return nil, err
+	}
+	sort.SliceStable(contacts, func(i, j int) bool { return contacts[i].Name < contacts[j].Name })
+	return contacts, nil
+}
+
+// GetByID retrieves a contact with its aliases
+func (s *ContactStorage) GetByID(ctx context.Context, id uint) (*models.Contact, error) {
+	var contact models.Contact
+	err := s.db.WithContext(ctx).Preload("Aliases").First(&contact, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &contact, nil
+}
+
+// Update changes the name and status of a contact. Empty values are left
+// unchanged.
+func (s *ContactStorage) Update(ctx context.Context, id uint, name, status string) (*models.Contact, error) {
+	err := s.db.WithContext(ctx).Model(&models.Contact{Model: gorm.Model{ID: id}}).
+		Updates(models.Contact{Name: name, Status: status}).Error
+	if err != nil {
+		return nil, err
+	}
+	return s.GetByID(ctx, id)
+}
+
+// Merge moves the aliases of the other contacts to the contact with the
+// given ID and deletes the other contacts
+func (s *ContactStorage) Merge(ctx context.Context, id uint, others []uint) (*models.Contact, error) {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&models.Contact{}, id).Error; err != nil {
+			return err
+		}
+
+		var merged []uint
+		for _, other := range others {
+			if other != id {
+				merged = append(merged, other)
+			}
+		}
+		if len(merged) == 0 {
+			return nil
+		}
+
+		var count int64
+		if err := tx.Model(&models.Contact{}).Where("id IN ?", merged).Count(&count).Error; err != nil {
+			return err
+		}
+		if int(count) != len(merged) {
+			return gorm.ErrRecordNotFound
+		}
+
+		err := tx.Model(&models.ContactAlias{}).
+			Where("contact_id IN ?", merged).
+			Update("contact_id", id).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&models.Contact{}, merged).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetByID(ctx, id)
+}
+
+// GetActivity retrieves a contact's notification activity per device and app
+func (s *ContactStorage) GetActivity(ctx context.Context, id uint) ([]models.ContactActivity, error) {
+	var rows []struct {
+		DeviceID     string
+		PackageName  string
+		MessageCount int64
+		FirstSeen    string
+		LastSeen     string
+	}
+	err := s.db.WithContext(ctx).Model(&models.Notification{}).
+		Select("device_id, package_name, COUNT(*) AS message_count, "+
+			"MIN(timestamp) AS first_seen, MAX(timestamp) AS last_seen").
+		Where("from_index IN (?)", s.senders(ctx, id)).
+		Group("device_id, package_name").
+		Order("last_seen desc").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	activity := make([]models.ContactActivity, len(rows))
+	for i, row := range rows {
+		activity[i] = models.ContactActivity{
+			DeviceID:     row.DeviceID,
+			PackageName:  row.PackageName,
+			MessageCount: row.MessageCount,
+			FirstSeen:    parseTimestamp(row.FirstSeen),
+			LastSeen:     parseTimestamp(row.LastSeen),
+		}
+	}
+	return activity, nil
+}
+
+// GetNotifications retrieves a page of a contact's notifications across all
+// apps and devices, newest first
+func (s *ContactStorage) GetNotifications(ctx context.Context, id uint, limit, offset int) (*models.NotificationPage, error) {
+	var total int64
+	query := func() *gorm.DB {
+		return s.db.WithContext(ctx).Model(&models.Notification{}).Where("from_index IN (?)", s.senders(ctx, id))
+	}
+	if err := query().Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	notifications := []models.Notification{}
+	err := query().Order("timestamp desc").Limit(limit).Offset(offset).Find(&notifications).Error
+	if err != nil {
+		return nil, err
+	}
+	if err := attachApps(s.db.WithContext(ctx), notifications); err != nil {
+		return nil, err
+	}
+
+	return &models.NotificationPage{
+		Notifications: notifications,
+		Total:         total,
+		Limit:         limit,
+		Offset:        offset,
+	}, nil
+}
+
+// senders returns a subquery of the blind indexes of the From values that
+// match one of the contact's aliases
+func (s *ContactStorage) senders(ctx context.Context, id uint) *gorm.DB {
+	return s.db.WithContext(ctx).Model(&models.AliasIndex{}).
+		Select("from_index").
+		Where("alias_id IN (?)", s.db.WithContext(ctx).Model(&models.ContactAlias{}).Select("id").Where("contact_id = ?", id))
+}
+
+// parseTimestamp parses a timestamp returned by an SQLite aggregate
+func parseTimestamp(value string) time.Time {
+	t, err := time.Parse(sqliteTimestampFormat, value)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lileye/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func setupContactStorage(t *testing.T) (*NotificationStorage, *ContactStorage) {
+	db, notificationStorage := setupTestDB(t)
+	return notificationStorage, NewContactStorage(db)
+}
+
+func createSenderNotification(t *testing.T, storage *NotificationStorage, deviceID, packageName, from string, timestamp time.Time) {
+	err := storage.Create(context.Background(), &models.Notification{
+		Title:       from,
+		Message:     "Test Message",
+		Timestamp:   timestamp,
+		PackageName: packageName,
+		From:        from,
+		DeviceID:    deviceID,
+	})
+	assert.NoError(t, err)
+}
+
+func findContact(t *testing.T, contacts []models.Contact, name string) models.Contact {
+	for _, contact := range contacts {
+		if contact.Name == name {
+			return contact
+		}
+	}
+	t.Fatalf("contact %q not found", name)
+	return models.Contact{}
+}
+
+func TestContactStorage_RecordedOnCreate(t *testing.T) {
+	notificationStorage, storage := setupContactStorage(t)
+	now := time.Now()
+	createSenderNotification(t, notificationStorage, "device1", "com.whatsapp", "Alice", now)
+	createSenderNotification(t, notificationStorage, "device1", "com.whatsapp", " alice ", now)
+	createSenderNotification(t, notificationStorage, "device1", "com.whatsapp", "Bob", now)
+	createSenderNotification(t, notificationStorage, "device1", "com.whatsapp", "", now)
+	assert.NoError(t, notificationStorage.CreateBatch(context.Background(), []models.Notification{
+		{Title: "Bob", Message: "Hi", Timestamp: now, PackageName: "com.whatsapp", From: "Bob", DeviceID: "device2"},
+		{Title: "Carol", Message: "Hi", Timestamp: now, PackageName: "com.whatsapp", From: "Carol", DeviceID: "device2"},
+	}))
+
+	contacts, err := storage.List(context.Background(), "")
+	assert.NoError(t, err)
+	assert.Len(t, contacts, 3)
+	assert.Equal(t, models.ContactUnknown, contacts[0].Status)
+	assert.Len(t, contacts[0].Aliases, 1)
+
+	// Every spelling of an identity matches its contact
+	page, err := storage.GetNotifications(context.Background(), findContact(t, contacts, "Alice").ID, 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), page.Total)
+}
+
+func TestContactStorage_MergeAndActivity(t *testing.T) {
+	notificationStorage, storage := setupContactStorage(t)
+	now := time.Now().UTC()
+	createSenderNotification(t, notificationStorage, "device1", "com.whatsapp", "Alice", now.Add(-time.Hour))
+	createSenderNotification(t, notificationStorage, "device1", "com.whatsapp", "Alice Smith", now)
+	createSenderNotification(t, notificationStorage, "device2", "com.google.android.apps.messaging", "+44 7700 900123", now)
+	createSenderNotification(t, notificationStorage, "device1", "com.whatsapp", "Bob", now)
+
+	contacts, err := storage.List(context.Background(), "")
+	assert.NoError(t, err)
+	alice := findContact(t, contacts, "Alice")
+	aliceSmith := findContact(t, contacts, "Alice Smith")
+	phone := findContact(t, contacts, "+44 7700 900123")
+
+	merged, err := storage.Merge(context.Background(), alice.ID, []uint{aliceSmith.ID, phone.ID})
+	assert.NoError(t, err)
+	assert.Len(t, merged.Aliases, 3)
+
+	contacts, err = storage.List(context.Background(), "")
+	assert.NoError(t, err)
+	assert.Len(t, contacts, 2)
+
+	activity, err := storage.GetActivity(context.Background(), alice.ID)
+	assert.NoError(t, err)
+	assert.Len(t, activity, 2)
+	for _, a := range activity {
+		if a.DeviceID == "device1" {
+			assert.Equal(t, int64(2), a.MessageCount)
+			assert.WithinDuration(t, now.Add(-time.Hour), a.FirstSeen, time.Millisecond)
+			assert.WithinDuration(t, now, a.LastSeen, time.Millisecond)
+		}
+	}
+
+	page, err := storage.GetNotifications(context.Background(), alice.ID, 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), page.Total)
+
+	// Merged contacts do not come back when their senders send again
+	createSenderNotification(t, notificationStorage, "device1", "com.whatsapp", "Alice Smith", now)
+	contacts, err = storage.List(context.Background(), "")
+	assert.NoError(t, err)
+	assert.Len(t, contacts, 2)
+	page, err = storage.GetNotifications(context.Background(), alice.ID, 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), page.Total)
+
+	_, err = storage.Merge(context.Background(), alice.ID, []uint{9999})
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+func TestContactStorage_Update(t *testing.T) {
+	notificationStorage, storage := setupContactStorage(t)
+	createSenderNotification(t, notificationStorage, "device1", "com.whatsapp", "Alice", time.Now())
+
+	contacts, err := storage.List(context.Background(), "")
+	assert.NoError(t, err)
+
+	contact, err := storage.Update(context.Background(), contacts[0].ID, "", models.ContactTrusted)
+	assert.NoError(t, err)
+	assert.Equal(t, "Alice", contact.Name)
+	assert.Equal(t, models.ContactTrusted, contact.Status)
+
+	trusted, err := storage.List(context.Background(), models.ContactTrusted)
+	assert.NoError(t, err)
+	assert.Len(t, trusted, 1)
+
+	blocked, err := storage.List(context.Background(), models.ContactBlocked)
+	assert.NoError(t, err)
+	assert.Empty(t, blocked)
+}
@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"context"
+	"github.com/lileye/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// threadExpr is the thread key of a notification: the blind index of the
+// conversation title for group chats and that of the sender for everything
+// else
+const threadExpr = `CASE WHEN conversation_title <> '' THEN conversation_title_index ELSE from_index END`
+
+// ConversationStorage handles database operations for conversation threads
+type ConversationStorage struct {
+	db *gorm.DB
+}
+
+// NewConversationStorage creates a new ConversationStorage instance
+func NewConversationStorage(db *gorm.DB) *ConversationStorage {
+	return &ConversationStorage{db: db}
+}
+
+type conversationRow struct {
+	LastID       uint
+	DeviceID     string
+	PackageName  string
+	Thread       string
+	IsGroup      bool
+	MessageCount int64
+	UnreadCount  int64
+}
+
+// GetConversations retrieves all conversation threads for a device, most
+// recently active first, optionally restricted to an app category
+func (s *ConversationStorage) GetConversations(ctx context.Context, deviceID, appCategory string) ([]models.Conversation, error) {
+	// SQLite takes bare columns from the row that holds MAX(timestamp), so id
+	// is the ID of the latest message in each thread.
+	query := s.db.WithContext(ctx).Model(&models.Notification{})
+	if appCategory != "" {
+		query = query.Scopes(inAppCategory(appCategory))
+	}
+
+	var rows []conversationRow
+	err := query.
+		Select("id AS last_id, MAX(timestamp) AS last_timestamp, device_id, package_name, "+
+			threadExpr+" AS thread, "+
+			"SUM(is_group_conversation OR conversation_title <> '') > 0 AS is_group, "+
+			"COUNT(*) AS message_count, "+
+			"SUM(CASE WHEN \"read\" THEN 0 ELSE 1 END) AS unread_count").
+		Where("device_id = ?", deviceID).
+		Group("device_id, package_name, thread").
+		Order("last_timestamp desc").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, len(rows))
+	for i, row := range rows {
+		ids[i] = row.LastID
+	}
+	var latest []models.Notification
+	if err := s.db.WithContext(ctx).Where("id IN ?", ids).Find(&latest).Error; err != nil {
+		return nil, err
+	}
+	if err := attachApps(s.db.WithContext(ctx), latest); err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]models.Notification, len(latest))
+	for _, n := range latest {
+		byID[n.ID] = n
+	}
+
+	conversations := make([]models.Conversation, len(rows))
+	for i, row := range rows {
+		// The thread key is a blind index, so the title or sender is taken
+		// from the latest message instead
+		latest := byID[row.LastID]
+		from := latest.ConversationTitle
+		if from == "" {
+			from = latest.From
+		}
+		conversations[i] = models.Conversation{
+			DeviceID:     row.DeviceID,
+			PackageName:  row.PackageName,
+			From:         from,
+			IsGroup:      row.IsGroup,
+			MessageCount: row.MessageCount,
+			UnreadCount:  row.UnreadCount,
+			LastMessage:  byID[row.LastID],
+		}
+	}
+	return conversations, nil
+}
+
+// GetThread retrieves a page of messages in a conversation, newest first
+func (s *ConversationStorage) GetThread(ctx context.Context, deviceID, packageName, from string, limit, offset int) (*models.NotificationPage, error) {
+	var total int64
+	if err := s.thread(ctx, deviceID, packageName, from).Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	var notifications []models.Notification
+	err := s.thread(ctx, deviceID, packageName, from).
+		Order("timestamp desc").
+		Limit(limit).
+		Offset(offset).
+		Find(&notifications).Error
+	if err != nil {
+		return nil, err
+	}
+	if err := attachApps(s.db.WithContext(ctx), notifications); err != nil {
+		return nil, err
+	}
+
+	return &models.NotificationPage{
+		Notifications: notifications,
+		Total:         total,
+		Limit:         limit,
+		Offset:        offset,
+	}, nil
+}
+
+// MarkThreadRead marks every message in a conversation as read and returns
+// the number of messages that were unread
+func (s *ConversationStorage) MarkThreadRead(ctx context.Context, deviceID, packageName, from string) (int64, error) {
+	result := s.thread(ctx, deviceID, packageName, from).
+		Where("\"read\" = ?", false).
+		Update("read", true)
+	return result.RowsAffected, result.Error
+}
+
+// thread selects the messages of a conversation. from is either the title of
+// a group chat or a sender, which are matched through their blind index.
+func (s *ConversationStorage) thread(ctx context.Context, deviceID, packageName, from string) *gorm.DB {
+	return s.db.WithContext(ctx).Model(&models.Notification{}).
+		Where("device_id = ? AND package_name = ? AND "+threadExpr+" IN ?",
+			deviceID, packageName, blindIndexes(from))
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lileye/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestMessage(t *testing.T, storage *NotificationStorage, packageName, from, conversationTitle string, timestamp time.Time) *models.Notification {
+	notification := &models.Notification{
+		Title:             from,
+		Message:           "Test Message",
+		Timestamp:         timestamp,
+		PackageName:       packageName,
+		From:              from,
+		DeviceID:          "device1",
+		ConversationTitle: conversationTitle,
+	}
+
+	err := storage.Create(context.Background(), notification)
+	assert.NoError(t, err)
+	return notification
+}
+
+func TestConversationStorage_GetConversations(t *testing.T) {
+	db, notificationStorage := setupTestDB(t)
+	storage := NewConversationStorage(db)
+	now := time.Now()
+
+	createTestMessage(t, notificationStorage, "com.whatsapp", "Alice", "", now.Add(-3*time.Minute))
+	latestAlice := createTestMessage(t, notificationStorage, "com.whatsapp", "Alice", "", now.Add(-2*time.Minute))
+	createTestMessage(t, notificationStorage, "com.telegram", "Alice", "", now.Add(-10*time.Minute))
+	createTestMessage(t, notificationStorage, "com.whatsapp", "Bob", "Family", now.Add(-5*time.Minute))
+	latestFamily := createTestMessage(t, notificationStorage, "com.whatsapp", "Carol", "Family", now.Add(-time.Minute))
+
+	conversations, err := storage.GetConversations(context.Background(), "device1", "")
+	assert.NoError(t, err)
+	assert.Len(t, conversations, 3)
+
+	assert.Equal(t, "Family", conversations[0].From)
+	assert.True(t, conversations[0].IsGroup)
+	assert.Equal(t, int64(2), conversations[0].MessageCount)
+	assert.Equal(t, int64(2), conversations[0].UnreadCount)
+	assert.Equal(t, latestFamily.ID, conversations[0].LastMessage.ID)
+
+	assert.Equal(t, "Alice", conversations[1].From)
+	assert.Equal(t, "com.whatsapp", conversations[1].PackageName)
+	assert.False(t, conversations[1].IsGroup)
+	assert.Equal(t, int64(2), conversations[1].MessageCount)
+	assert.Equal(t, latestAlice.ID, conversations[1].LastMessage.ID)
+
+	assert.Equal(t, "com.telegram", conversations[2].PackageName)
+}
+
+func TestConversationStorage_GetThread(t *testing.T) {
+	db, notificationStorage := setupTestDB(t)
+	storage := NewConversationStorage(db)
+	now := time.Now()
+
+	for i := 0; i < 5; i++ {
+		createTestMessage(t, notificationStorage, "com.whatsapp", "Alice", "", now.Add(time.Duration(i)*time.Minute))
+	}
+	createTestMessage(t, notificationStorage, "com.whatsapp", "Bob", "", now)
+
+	page, err := storage.GetThread(context.Background(), "device1", "com.whatsapp", "Alice", 2, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), page.Total)
+	assert.Len(t, page.Notifications, 2)
+	assert.True(t, page.Notifications[0].Timestamp.After(page.Notifications[1].Timestamp))
+}
+
+func TestConversationStorage_MarkThreadRead(t *testing.T) {
+	db, notificationStorage := setupTestDB(t)
+	storage := NewConversationStorage(db)
+	now := time.Now()
+
+	createTestMessage(t, notificationStorage, "com.whatsapp", "Bob", "Family", now)
+	createTestMessage(t, notificationStorage, "com.whatsapp", "Carol", "Family", now)
+	createTestMessage(t, notificationStorage, "com.whatsapp", "Alice", "", now)
+
+	updated, err := storage.MarkThreadRead(context.Background(), "device1", "com.whatsapp", "Family")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), updated)
+
+	conversations, err := storage.GetConversations(context.Background(), "device1", "")
+	assert.NoError(t, err)
+	for _, conversation := range conversations {
+		if conversation.From == "Family" {
+			assert.Equal(t, int64(0), conversation.UnreadCount)
+		} else {
+			assert.Equal(t, int64(1), conversation.UnreadCount)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/lileye/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// EventStorage handles database operations for notification lifecycle events
+type EventStorage struct {
+	db *gorm.DB
+}
+
+// NewEventStorage creates a new EventStorage instance
+func NewEventStorage(db *gorm.DB) *EventStorage {
+	return &EventStorage{db: db}
+}
+
+// Record stores a lifecycle event, links it to the latest notification with
+// the same key on the device and updates that notification's state
+func (s *EventStorage) Record(ctx context.Context, event *models.NotificationEvent) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var notification models.Notification
+		err := tx.Where("device_id = ? AND notification_key = ?", event.DeviceID, event.Key).
+			Order("timestamp desc").
+			First(&notification).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return tx.Create(event).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		event.NotificationID = &notification.ID
+		updates := map[string]interface{}{"state": event.Type}
+		if event.Type == models.EventRemoved {
+			updates["removed_at"] = event.Timestamp
+			updates["removal_reason"] = event.Reason
+		} else {
+			// Earlier notifications posted under the same key have been
+			// replaced by this one
+			err := tx.Model(&models.Notification{}).
+				Where("device_id = ? AND notification_key = ? AND id <> ? AND state IN ?",
+					event.DeviceID, event.Key, notification.ID, []string{models.EventPosted, models.EventUpdated}).
+				Update("state", models.StateReplaced).Error
+			if err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&notification).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(event).Error
+	})
+}
+
+// GetByNotificationID retrieves the events of a notification in order
+func (s *EventStorage) GetByNotificationID(ctx context.Context, notificationID uint) ([]models.NotificationEvent, error) {
+	var events []models.NotificationEvent
+	err := s.db.WithContext(ctx).Where("notification_id = ?", notificationID).
+		Order("timestamp asc").
+		Find(&events).Error
+	return events, err
+}
+
+// GetByDeviceID retrieves the events of a device, newest first, optionally
+// restricted to a single notification key
+func (s *EventStorage) GetByDeviceID(ctx context.Context, deviceID, key string) ([]models.NotificationEvent, error) {
+	query := s.db.WithContext(ctx).Where("device_id = ?", deviceID)
+	if key != "" {
+		query = query.Where("notification_key = ?", key)
+	}
+
+	var events []models.NotificationEvent
+	err := query.Order("timestamp desc").Find(&events).Error
+	return events, err
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lileye/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupEventStorage(t *testing.T) (*NotificationStorage, *EventStorage) {
+	db, notificationStorage := setupTestDB(t)
+	return notificationStorage, NewEventStorage(db)
+}
+
+func createKeyedNotification(t *testing.T, storage *NotificationStorage, key string, timestamp time.Time) *models.Notification {
+	notification := &models.Notification{
+		Title:       "Test Title",
+		Message:     "Test Message",
+		Timestamp:   timestamp,
+		PackageName: "com.test.app",
+		DeviceID:    "device1",
+		Key:         key,
+	}
+
+	err := storage.Create(context.Background(), notification)
+	assert.NoError(t, err)
+	return notification
+}
+
+func TestEventStorage_RecordRemoved(t *testing.T) {
+	notificationStorage, storage := setupEventStorage(t)
+	posted := time.Now().Add(-time.Minute)
+	notification := createKeyedNotification(t, notificationStorage, "0|com.test.app|1|null|10001", posted)
+
+	event := &models.NotificationEvent{
+		Key:       notification.Key,
+		DeviceID:  "device1",
+		Type:      models.EventRemoved,
+		Reason:    "cancel",
+		Timestamp: posted.Add(30 * time.Second),
+	}
+	assert.NoError(t, storage.Record(context.Background(), event))
+	assert.Equal(t, notification.ID, *event.NotificationID)
+
+	found, err := notificationStorage.GetByID(context.Background(), notification.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.EventRemoved, found.State)
+	assert.Equal(t, "cancel", found.RemovalReason)
+	assert.NotNil(t, found.OnScreenSeconds)
+	assert.InDelta(t, 30, *found.OnScreenSeconds, 0.001)
+
+	events, err := storage.GetByNotificationID(context.Background(), notification.ID)
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+}
+
+func TestEventStorage_RecordUpdatedReplacesEarlier(t *testing.T) {
+	notificationStorage, storage := setupEventStorage(t)
+	now := time.Now()
+	first := createKeyedNotification(t, notificationStorage, "key1", now.Add(-time.Minute))
+	second := createKeyedNotification(t, notificationStorage, "key1", now)
+
+	event := &models.NotificationEvent{Key: "key1", DeviceID: "device1", Type: models.EventUpdated, Timestamp: now}
+	assert.NoError(t, storage.Record(context.Background(), event))
+	assert.Equal(t, second.ID, *event.NotificationID)
+
+	found, err := notificationStorage.GetByID(context.Background(), first.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.StateReplaced, found.State)
+	assert.Nil(t, found.OnScreenSeconds)
+
+	found, err = notificationStorage.GetByID(context.Background(), second.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.EventUpdated, found.State)
+}
+
+func TestEventStorage_RecordUnknownKey(t *testing.T) {
+	_, storage := setupEventStorage(t)
+
+	event := &models.NotificationEvent{Key: "missing", DeviceID: "device1", Type: models.EventRemoved, Timestamp: time.Now()}
+	assert.NoError(t, storage.Record(context.Background(), event))
+	assert.Nil(t, event.NotificationID)
+
+	events, err := storage.GetByDeviceID(context.Background(), "device1", "missing")
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+
+	events, err = storage.GetByDeviceID(context.Background(), "device1", "other")
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+}
@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/lileye/backend/internal/fieldcrypt"
+	"github.com/lileye/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// SchemaVersion is the version of the schema created by Migrate. It is
+// stored in the database's user_version and must be raised whenever a
+// migration makes a database unusable by earlier releases or adds tables,
+// which backups taken before lack.
+const SchemaVersion = 4
+
+// schemaModels lists every model with a table, in migration order
+var schemaModels = []interface{}{
+	&models.Notification{},
+	&models.NotificationEvent{},
+	&models.Attachment{},
+	&models.App{},
+	&models.Contact{},
+	&models.ContactAlias{},
+	&models.AliasIndex{},
+	&models.Sender{},
+	&models.Alert{},
+	&models.AllowlistEntry{},
+	&models.AuditEntry{},
+	&models.User{},
+	&models.AdminKey{},
+}
+
+// Migrate creates or updates the tables of every model
+func Migrate(db *gorm.DB) error {
+	// Senders are derived from notifications and rebuilt by Backfill. A table
+	// from before the blind index is dropped since its unique index cannot be
+	// moved onto the new column in place.
+	migrator := db.Migrator()
+	if migrator.HasTable(&models.Sender{}) && !migrator.HasColumn(&models.Sender{}, "from_index") {
+		if err := migrator.DropTable(&models.Sender{}); err != nil {
+			return err
+		}
+	}
+
+	// Columns now encrypted lose the plaintext indexes they had; they are
+	// matched by their blind index instead
+	for _, index := range plaintextIndexes {
+		if migrator.HasIndex(index.model, index.name) {
+			if err := migrator.DropIndex(index.model, index.name); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := db.AutoMigrate(schemaModels...); err != nil {
+		return err
+	}
+	for _, trigger := range auditTriggers {
+		if err := db.Exec(trigger).Error; err != nil {
+			return err
+		}
+	}
+	if err := indexColumns(db); err != nil {
+		return err
+	}
+	return db.Exec(fmt.Sprintf("PRAGMA user_version = %d", SchemaVersion)).Error
+}
+
+// GetSchemaVersion returns the schema version recorded in a database, 0
+// for databases migrated before versions were recorded
+func GetSchemaVersion(db *gorm.DB) (int, error) {
+	var version int
+	err := db.Raw("PRAGMA user_version").Scan(&version).Error
+	return version, err
+}
+
+// plaintextIndexes are the indexes of columns stored in plaintext before
+// they were encrypted
+var plaintextIndexes = []struct {
+	model interface{}
+	name  string
+}{
+	{&models.Notification{}, "idx_notifications_conversation_title"},
+	{&models.Notification{}, "idx_notifications_sub_text"},
+	{&models.Notification{}, "idx_notifications_people"},
+	{&models.ContactAlias{}, "idx_contact_aliases_identity"},
+	{&models.AllowlistEntry{}, "idx_allowlist_identity"},
+}
+
+// indexColumns fills in the blind indexes of rows stored before they
+// existed
+func indexColumns(db *gorm.DB) error {
+	err := indexRows[models.Notification](db, "from_index IS NULL AND \"from\" <> ''", func(n *models.Notification) map[string]interface{} {
+		return map[string]interface{}{"from_index": fieldcrypt.BlindIndex(n.From)}
+	}, "from")
+	if err != nil {
+		return err
+	}
+	err = indexRows[models.Notification](db, "conversation_title_index IS NULL", func(n *models.Notification) map[string]interface{} {
+		return map[string]interface{}{
+			"conversation_title_index": fieldcrypt.BlindIndex(n.ConversationTitle),
+			"sub_text_index":           fieldcrypt.BlindIndex(n.SubText),
+			"people_index":             models.IndexPeople(n.People),
+		}
+	}, "conversation_title", "sub_text", "people")
+	if err != nil {
+		return err
+	}
+	err = indexRows[models.ContactAlias](db, "identity_index IS NULL", func(a *models.ContactAlias) map[string]interface{} {
+		return map[string]interface{}{"identity_index": fieldcrypt.BlindIndex(a.Identity)}
+	}, "identity")
+	if err != nil {
+		return err
+	}
+	return indexRows[models.AllowlistEntry](db, "identity_index IS NULL", func(e *models.AllowlistEntry) map[string]interface{} {
+		return map[string]interface{}{"identity_index": fieldcrypt.BlindIndex(e.Identity)}
+	}, "identity")
+}
+
+// indexRows loads the given columns of the rows matching where in batches
+// and writes the blind indexes index computes from them, without running
+// hooks or touching updated_at
+func indexRows[T any](db *gorm.DB, where string, index func(row *T) map[string]interface{}, columns ...string) error {
+	var batch []T
+	return db.Unscoped().
+		Select(append([]string{"id"}, columns...)).
+		Where(where).
+		FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+			for i := range batch {
+				err := db.Unscoped().Model(&batch[i]).UpdateColumns(index(&batch[i])).Error
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
+
+// CheckSchema reports whether the database has every table and column the
+// models expect, i.e. whether Migrate has run against the current code
+func CheckSchema(db *gorm.DB) error {
+	migrator := db.Migrator()
+	for _, model := range schemaModels {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return err
+		}
+		table := stmt.Schema.Table
+		if !migrator.HasTable(model) {
+			return fmt.Errorf("table %s is missing", table)
+		}
+		for _, column := range stmt.Schema.DBNames {
+			if !migrator.HasColumn(model, column) {
+				return fmt.Errorf("column %s.%s is missing", table, column)
+			}
+		}
+	}
+	return nil
+}
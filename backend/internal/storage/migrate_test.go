@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lileye/backend/internal/fieldcrypt"
+	"github.com/lileye/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrateIndexesEncryptedColumns(t *testing.T) {
+	db, storage := setupTestDB(t)
+	createMessage(t, storage, "Alice", "Stored before the blind indexes")
+	assert.NoError(t, NewAlertStorage(db).AddAllowlist(context.Background(), &models.AllowlistEntry{Identity: "Grandma"}))
+
+	// A database from before the columns were encrypted has plaintext
+	// indexes and no blind index columns
+	migrator := db.Migrator()
+	for _, index := range []string{
+		"idx_notifications_conversation_title ON notifications(conversation_title)",
+		"idx_notifications_sub_text ON notifications(sub_text)",
+		"idx_notifications_people ON notifications(people)",
+		"idx_contact_aliases_identity ON contact_aliases(identity)",
+		"idx_allowlist_identity ON allowlist(identity)",
+	} {
+		assert.NoError(t, db.Exec("CREATE INDEX "+index).Error)
+	}
+	assert.True(t, migrator.HasIndex(&models.Notification{}, "idx_notifications_people"))
+	for _, column := range []string{"conversation_title_index", "sub_text_index", "people_index"} {
+		assert.NoError(t, migrator.DropColumn(&models.Notification{}, column))
+	}
+	assert.NoError(t, migrator.DropIndex(&models.ContactAlias{}, "idx_contact_aliases_identity_index"))
+	assert.NoError(t, migrator.DropColumn(&models.ContactAlias{}, "identity_index"))
+	assert.NoError(t, migrator.DropColumn(&models.AllowlistEntry{}, "identity_index"))
+
+	useTestKeyring(t, "1")
+	assert.NoError(t, Migrate(db))
+	for _, index := range plaintextIndexes {
+		assert.False(t, migrator.HasIndex(index.model, index.name), index.name)
+	}
+	assert.Equal(t, []string{fieldcrypt.BlindIndex("alice")}, rawColumn(t, db, "contact_aliases", "identity_index"))
+	assert.Equal(t, []string{fieldcrypt.BlindIndex("grandma")}, rawColumn(t, db, "allowlist", "identity_index"))
+	assert.Equal(t, []string{""}, rawColumn(t, db, "notifications", "conversation_title_index"))
+}
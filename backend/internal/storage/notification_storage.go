@@ -1,8 +1,12 @@
 package storage
 
 import (
+	"context"
+	"strings"
 	"time"
 
+	"github.com/lileye/backend/internal/fieldcrypt"
+	"github.com/lileye/backend/internal/metrics"
 	"github.com/lileye/backend/internal/models"
 	"gorm.io/gorm"
 )
@@ -17,55 +21,338 @@ func NewNotificationStorage(db *gorm.DB) *NotificationStorage {
 	return &NotificationStorage{db: db}
 }
 
-// Create stores a new notification in the database
-func (s *NotificationStorage) Create(notification *models.Notification) error {
-	return s.db.Create(notification).Error
+// Create stores a new notification in the database and records its sender
+// and contact
+func (s *NotificationStorage) Create(ctx context.Context, notification *models.Notification) error {
+	defer metrics.ObserveStorage("Create")()
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(notification).Error; err != nil {
+			return err
+		}
+		if err := recordSender(tx, notification); err != nil {
+			return err
+		}
+		return recordContact(tx, notification.From, notification.FromIndex)
+	})
+	if err != nil {
+		return err
+	}
+	metrics.Ingested(notification.DeviceID, notification.PackageName)
+	return nil
+}
+
+// CreateBatch stores several new notifications in one transaction and
+// records their senders and contacts. Either all of them are stored or none.
+func (s *NotificationStorage) CreateBatch(ctx context.Context, notifications []models.Notification) error {
+	defer metrics.ObserveStorage("CreateBatch")()
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for i := range notifications {
+			if err := tx.Create(&notifications[i]).Error; err != nil {
+				return err
+			}
+			if err := recordSender(tx, &notifications[i]); err != nil {
+				return err
+			}
+			if err := recordContact(tx, notifications[i].From, notifications[i].FromIndex); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, n := range notifications {
+		metrics.Ingested(n.DeviceID, n.PackageName)
+	}
+	return nil
+}
+
+// Import stores notifications brought in from another source in one
+// transaction. Unlike Create it records no senders and raises no alerts,
+// since imported history is not new activity; SenderStorage.Backfill
+// records the senders afterwards.
+func (s *NotificationStorage) Import(ctx context.Context, notifications []models.Notification) error {
+	defer metrics.ObserveStorage("Import")()
+	if len(notifications) == 0 {
+		return nil
+	}
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return tx.Create(&notifications).Error
+	})
+}
+
+// IsDuplicate reports whether a notification with the same device, app,
+// timestamp, title and message is stored. Timestamps match when they were
+// stored in UTC or in the server's time zone.
+func (s *NotificationStorage) IsDuplicate(ctx context.Context, n *models.Notification) (bool, error) {
+	defer metrics.ObserveStorage("IsDuplicate")()
+	var stored []models.Notification
+	err := s.db.WithContext(ctx).Select("title", "message").
+		Where("device_id = ? AND package_name = ?", n.DeviceID, n.PackageName).
+		Where("timestamp IN ?", []time.Time{n.Timestamp.UTC(), n.Timestamp.Local()}).
+		Find(&stored).Error
+	if err != nil {
+		return false, err
+	}
+	for _, other := range stored {
+		if other.Title == n.Title && other.Message == n.Message {
+			return true, nil
+		}
+	}
+	return false, nil
 }
 
 // GetByID retrieves a notification by its ID
-func (s *NotificationStorage) GetByID(id uint) (*models.Notification, error) {
+func (s *NotificationStorage) GetByID(ctx context.Context, id uint) (*models.Notification, error) {
+	defer metrics.ObserveStorage("GetByID")()
 	var notification models.Notification
-	err := s.db.First(&notification, id).Error
+	err := s.db.WithContext(ctx).First(&notification, id).Error
 	if err != nil {
 		return nil, err
 	}
-	return &notification, nil
+	notifications := []models.Notification{notification}
+	if err := attachApps(s.db.WithContext(ctx), notifications); err != nil {
+		return nil, err
+	}
+	return &notifications[0], nil
 }
 
 // GetByDeviceID retrieves notifications for a specific device
-func (s *NotificationStorage) GetByDeviceID(deviceID string) ([]models.Notification, error) {
+func (s *NotificationStorage) GetByDeviceID(ctx context.Context, deviceID string) ([]models.Notification, error) {
+	defer metrics.ObserveStorage("GetByDeviceID")()
 	var notifications []models.Notification
-	err := s.db.Where("device_id = ?", deviceID).Find(&notifications).Error
-	return notifications, err
+	err := s.db.WithContext(ctx).Where("device_id = ?", deviceID).Find(&notifications).Error
+	if err != nil {
+		return nil, err
+	}
+	return notifications, attachApps(s.db.WithContext(ctx), notifications)
 }
 
-// GetByDateRange retrieves notifications within a date range
-func (s *NotificationStorage) GetByDateRange(deviceID string, start, end time.Time) ([]models.Notification, error) {
-	var notifications []models.Notification
-	err := s.db.Where("device_id = ? AND timestamp BETWEEN ? AND ?", deviceID, start, end).
-		Order("timestamp desc").
-		Find(&notifications).Error
-	return notifications, err
+// NotificationFilter narrows down notifications. Empty fields are ignored,
+// so an empty device ID matches every device.
+type NotificationFilter struct {
+	DeviceID          string
+	Start             time.Time
+	End               time.Time
+	Query             string
+	PackageName       string
+	AppCategory       string
+	Category          string
+	ChannelID         string
+	SubText           string
+	ConversationTitle string
+	Person            string
 }
 
-// Search searches notifications by title, message, or from field
-func (s *NotificationStorage) Search(deviceID, query string) ([]models.Notification, error) {
+// Find retrieves the notifications matching a filter, newest first. When
+// content is encrypted the text query cannot run in SQL, so it is applied to
+// the decrypted notifications that match the other filters.
+func (s *NotificationStorage) Find(ctx context.Context, filter NotificationFilter) ([]models.Notification, error) {
+	defer metrics.ObserveStorage("Find")()
 	var notifications []models.Notification
-	err := s.db.Where("device_id = ? AND (title LIKE ? OR message LIKE ? OR \"from\" LIKE ?)",
-		deviceID, "%"+query+"%", "%"+query+"%", "%"+query+"%").
-		Order("timestamp desc").
-		Find(&notifications).Error
-	return notifications, err
+	err := s.filtered(ctx, filter).Order("timestamp desc").Find(&notifications).Error
+	if err != nil {
+		return nil, err
+	}
+	if filter.Query != "" && fieldcrypt.Enabled() {
+		notifications = matchQuery(notifications, filter.Query)
+	}
+	return notifications, attachApps(s.db.WithContext(ctx), notifications)
+}
+
+// Each calls fn with every notification matching a filter, oldest first,
+// reading them one at a time from a database cursor so that any number of
+// notifications can be processed in constant memory. Iteration stops at the
+// first error returned by fn.
+func (s *NotificationStorage) Each(ctx context.Context, filter NotificationFilter, fn func(*models.Notification) error) error {
+	defer metrics.ObserveStorage("Each")()
+	var apps []models.App
+	if err := s.db.WithContext(ctx).Find(&apps).Error; err != nil {
+		return err
+	}
+	byPackage := make(map[string]models.App, len(apps))
+	for _, app := range apps {
+		byPackage[app.PackageName] = app
+	}
+
+	rows, err := s.filtered(ctx, filter).Model(&models.Notification{}).Order("timestamp, id").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	encrypted := fieldcrypt.Enabled()
+	for rows.Next() {
+		var n models.Notification
+		if err := s.db.WithContext(ctx).ScanRows(rows, &n); err != nil {
+			return err
+		}
+		if filter.Query != "" && encrypted && len(matchQuery([]models.Notification{n}, filter.Query)) == 0 {
+			continue
+		}
+		if err := n.AfterFind(s.db.WithContext(ctx)); err != nil {
+			return err
+		}
+		n.AppName = byPackage[n.PackageName].Name
+		n.AppCategory = byPackage[n.PackageName].Category
+		if err := fn(&n); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// filtered builds the query of the notifications matching a filter. The
+// text query is left out when content is encrypted.
+func (s *NotificationStorage) filtered(ctx context.Context, filter NotificationFilter) *gorm.DB {
+	query := s.db.WithContext(ctx)
+	if filter.DeviceID != "" {
+		query = query.Where("device_id = ?", filter.DeviceID)
+	}
+	if !filter.Start.IsZero() {
+		query = query.Where("timestamp >= ?", filter.Start)
+	}
+	if !filter.End.IsZero() {
+		query = query.Where("timestamp <= ?", filter.End)
+	}
+	if filter.Query != "" && !fieldcrypt.Enabled() {
+		pattern := "%" + filter.Query + "%"
+		query = query.Where("(title LIKE ? OR message LIKE ? OR \"from\" LIKE ? OR sub_text LIKE ? OR big_text LIKE ?)",
+			pattern, pattern, pattern, pattern, pattern)
+	}
+	if filter.PackageName != "" {
+		query = query.Where("package_name = ?", filter.PackageName)
+	}
+	if filter.AppCategory != "" {
+		query = query.Scopes(inAppCategory(filter.AppCategory))
+	}
+	if filter.Category != "" {
+		query = query.Where("category = ?", filter.Category)
+	}
+	if filter.ChannelID != "" {
+		query = query.Where("channel_id = ?", filter.ChannelID)
+	}
+	if filter.SubText != "" {
+		query = query.Where("sub_text_index IN ?", blindIndexes(filter.SubText))
+	}
+	if filter.ConversationTitle != "" {
+		query = query.Where("conversation_title_index IN ?", blindIndexes(filter.ConversationTitle))
+	}
+	if filter.Person != "" {
+		people := blindIndexes(strings.TrimSpace(filter.Person))
+		query = query.Where("(instr(people_index, ?) > 0 OR instr(people_index, ?) > 0)",
+			","+people[0]+",", ","+people[1]+",")
+	}
+	return query
+}
+
+// blindIndexes returns what a blind index column holds for value: its
+// blind index, or the value itself in rows stored before encryption was
+// turned on and not reencrypted yet
+func blindIndexes(value string) []string {
+	return []string{fieldcrypt.BlindIndex(value), value}
+}
+
+// matchQuery keeps the notifications whose title, message, from, sub text
+// or big text contain query, ignoring case
+func matchQuery(notifications []models.Notification, query string) []models.Notification {
+	query = strings.ToLower(query)
+	matched := notifications[:0]
+	for _, n := range notifications {
+		for _, field := range []string{n.Title, n.Message, n.From, n.SubText, n.BigText} {
+			if strings.Contains(strings.ToLower(field), query) {
+				matched = append(matched, n)
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// GetByDateRange retrieves notifications within a date range
+func (s *NotificationStorage) GetByDateRange(ctx context.Context, deviceID string, start, end time.Time) ([]models.Notification, error) {
+	return s.Find(ctx, NotificationFilter{DeviceID: deviceID, Start: start, End: end})
+}
+
+// Search searches notifications by title, message, from, sub text or big text
+func (s *NotificationStorage) Search(ctx context.Context, deviceID, query string) ([]models.Notification, error) {
+	return s.Find(ctx, NotificationFilter{DeviceID: deviceID, Query: query})
 }
 
 // GetDevices retrieves all unique device IDs
-func (s *NotificationStorage) GetDevices() ([]string, error) {
+func (s *NotificationStorage) GetDevices(ctx context.Context) ([]string, error) {
+	defer metrics.ObserveStorage("GetDevices")()
 	var devices []string
-	err := s.db.Model(&models.Notification{}).Distinct().Pluck("device_id", &devices).Error
+	err := s.db.WithContext(ctx).Model(&models.Notification{}).Distinct().Pluck("device_id", &devices).Error
 	return devices, err
 }
 
-// DeleteAll deletes all notifications from the database
-func (s *NotificationStorage) DeleteAll() error {
-	return s.db.Exec("DELETE FROM notifications").Error
+// PurgeFilter selects the notifications to purge. Empty fields match
+// every notification.
+type PurgeFilter struct {
+	DeviceID    string
+	PackageName string
+	// Before keeps notifications posted at or after it
+	Before time.Time
+}
+
+// Purge permanently deletes the notifications matching a filter together
+// with their lifecycle events, and returns the number deleted. Their
+// attachments are left to the orphaned attachment cleanup.
+func (s *NotificationStorage) Purge(ctx context.Context, filter PurgeFilter) (int64, error) {
+	defer metrics.ObserveStorage("Purge")()
+	var deleted int64
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Where("notification_id IN (?)", purging(tx, filter).Select("id")).
+			Delete(&models.NotificationEvent{}).Error
+		if err != nil {
+			return err
+		}
+		result := purging(tx, filter).Delete(&models.Notification{})
+		deleted = result.RowsAffected
+		return result.Error
+	})
+	return deleted, err
+}
+
+// CountPurge returns the number of notifications Purge would delete
+func (s *NotificationStorage) CountPurge(ctx context.Context, filter PurgeFilter) (int64, error) {
+	defer metrics.ObserveStorage("CountPurge")()
+	var count int64
+	err := purging(s.db.WithContext(ctx), filter).Count(&count).Error
+	return count, err
+}
+
+// purging builds the query of the notifications matching a purge filter,
+// soft-deleted ones included. An empty filter matches every notification.
+func purging(db *gorm.DB, filter PurgeFilter) *gorm.DB {
+	query := db.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Model(&models.Notification{})
+	if filter.DeviceID != "" {
+		query = query.Where("device_id = ?", filter.DeviceID)
+	}
+	if filter.PackageName != "" {
+		query = query.Where("package_name = ?", filter.PackageName)
+	}
+	if !filter.Before.IsZero() {
+		query = query.Where("timestamp < ?", filter.Before)
+	}
+	return query
+}
+
+// DeleteAll deletes all notifications from the database in one
+// transaction, with their events, the senders first seen in them and the
+// alerts they raised. As with Purge, attachments are left to the orphaned
+// attachment cleanup.
+func (s *NotificationStorage) DeleteAll(ctx context.Context) error {
+	defer metrics.ObserveStorage("DeleteAll")()
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, model := range []any{&models.NotificationEvent{}, &models.Sender{}, &models.Alert{}, &models.Notification{}} {
+			err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(model).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 } 
\ No newline at end of file
@@ -1,10 +1,15 @@
 package storage
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
 
+	"github.com/lileye/backend/internal/fixtures"
+	"github.com/lileye/backend/internal/metrics"
 	"github.com/lileye/backend/internal/models"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -14,7 +19,7 @@ func setupTestDB(t *testing.T) (*gorm.DB, *NotificationStorage) {
 	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
 	assert.NoError(t, err)
 
-	err = db.AutoMigrate(&models.Notification{})
+	err = Migrate(db)
 	assert.NoError(t, err)
 
 	return db, NewNotificationStorage(db)
@@ -30,7 +35,7 @@ func createTestNotification(t *testing.T, storage *NotificationStorage, deviceID
 		DeviceID:    deviceID,
 	}
 
-	err := storage.Create(notification)
+	err := storage.Create(context.Background(), notification)
 	assert.NoError(t, err)
 	return notification
 }
@@ -45,7 +50,7 @@ func TestNotificationStorage_GetByID(t *testing.T) {
 	_, storage := setupTestDB(t)
 	created := createTestNotification(t, storage, "device1")
 
-	found, err := storage.GetByID(created.ID)
+	found, err := storage.GetByID(context.Background(), created.ID)
 	assert.NoError(t, err)
 	assert.Equal(t, created.Title, found.Title)
 	assert.Equal(t, created.DeviceID, found.DeviceID)
@@ -57,7 +62,7 @@ func TestNotificationStorage_GetByDeviceID(t *testing.T) {
 	notification2 := createTestNotification(t, storage, "device1")
 	_ = createTestNotification(t, storage, "device2")
 
-	notifications, err := storage.GetByDeviceID("device1")
+	notifications, err := storage.GetByDeviceID(context.Background(), "device1")
 	assert.NoError(t, err)
 	assert.Len(t, notifications, 2)
 	assert.Contains(t, []uint{notification1.ID, notification2.ID}, notifications[0].ID)
@@ -75,10 +80,10 @@ func TestNotificationStorage_GetByDateRange(t *testing.T) {
 		From:        "Test User",
 		DeviceID:    "device1",
 	}
-	err := storage.Create(notification)
+	err := storage.Create(context.Background(), notification)
 	assert.NoError(t, err)
 
-	notifications, err := storage.GetByDateRange("device1", now.Add(-time.Hour), now.Add(time.Hour))
+	notifications, err := storage.GetByDateRange(context.Background(), "device1", now.Add(-time.Hour), now.Add(time.Hour))
 	assert.NoError(t, err)
 	assert.Len(t, notifications, 1)
 	assert.Equal(t, notification.ID, notifications[0].ID)
@@ -89,19 +94,19 @@ func TestNotificationStorage_Search(t *testing.T) {
 	notification := createTestNotification(t, storage, "device1")
 
 	// Search by title
-	results, err := storage.Search("device1", "Test Title")
+	results, err := storage.Search(context.Background(), "device1", "Test Title")
 	assert.NoError(t, err)
 	assert.Len(t, results, 1)
 	assert.Equal(t, notification.ID, results[0].ID)
 
 	// Search by message
-	results, err = storage.Search("device1", "Test Message")
+	results, err = storage.Search(context.Background(), "device1", "Test Message")
 	assert.NoError(t, err)
 	assert.Len(t, results, 1)
 	assert.Equal(t, notification.ID, results[0].ID)
 
 	// Search by from
-	results, err = storage.Search("device1", "Test User")
+	results, err = storage.Search(context.Background(), "device1", "Test User")
 	assert.NoError(t, err)
 	assert.Len(t, results, 1)
 	assert.Equal(t, notification.ID, results[0].ID)
@@ -113,7 +118,7 @@ func TestNotificationStorage_GetDevices(t *testing.T) {
 	_ = createTestNotification(t, storage, "device2")
 	_ = createTestNotification(t, storage, "device1")
 
-	devices, err := storage.GetDevices()
+	devices, err := storage.GetDevices(context.Background())
 	assert.NoError(t, err)
 	assert.Len(t, devices, 2)
 	assert.Contains(t, devices, "device1")
@@ -121,33 +126,23 @@ func TestNotificationStorage_GetDevices(t *testing.T) {
 }
 
 func TestDeleteAll(t *testing.T) {
-	_, storage := setupTestDB(t)
+	db, storage := setupTestDB(t)
 
 	// Create some test notifications
-	notifications := []models.Notification{
-		{
-			DeviceID: "test-device-1",
-			Title:    "Test Notification 1",
-			Message:  "Test Message 1",
-			Timestamp: time.Now(),
-		},
-		{
-			DeviceID: "test-device-2",
-			Title:    "Test Notification 2",
-			Message:  "Test Message 2",
-			Timestamp: time.Now(),
-		},
-	}
-
-	for _, n := range notifications {
-		err := storage.Create(&n)
+	ds := fixtures.Generate(fixtures.Options{Seed: 1, Days: 1, PerDay: 20})
+	for i := range ds.Notifications {
+		err := storage.Create(context.Background(), &ds.Notifications[i])
 		if err != nil {
 			t.Fatalf("Failed to create test notification: %v", err)
 		}
 	}
 
+	first := ds.Notifications[0].ID
+	assert.NoError(t, db.Create(&models.NotificationEvent{NotificationID: &first, Key: "k", DeviceID: "d", Type: models.EventPosted, Timestamp: time.Now()}).Error)
+	assert.NoError(t, db.Create(&models.Alert{Type: models.AlertNewContact, DeviceID: "d", PackageName: "com.whatsapp", NotificationID: first}).Error)
+
 	// Delete all notifications
-	err := storage.DeleteAll()
+	err := storage.DeleteAll(context.Background())
 	if err != nil {
 		t.Fatalf("Failed to delete all notifications: %v", err)
 	}
@@ -162,4 +157,173 @@ func TestDeleteAll(t *testing.T) {
 	if count != 0 {
 		t.Errorf("Expected 0 notifications, got %d", count)
 	}
-} 
\ No newline at end of file
+
+	// Nothing is left pointing at them
+	for _, model := range []any{&models.NotificationEvent{}, &models.Sender{}, &models.Alert{}} {
+		assert.NoError(t, db.Unscoped().Model(model).Count(&count).Error)
+		assert.Zero(t, count)
+	}
+}
+
+func TestNotificationStorage_Find(t *testing.T) {
+	_, storage := setupTestDB(t)
+	_ = createTestNotification(t, storage, "device1")
+
+	notification := &models.Notification{
+		Title:       "Test Title",
+		Message:     "Test Message",
+		Timestamp:   time.Now(),
+		PackageName: "com.test.app",
+		DeviceID:    "device1",
+		Extras: map[string]string{
+			models.ExtraCategory:  "msg",
+			models.ExtraChannelID: "chats",
+			models.ExtraPeople:    "Alice, Bob",
+			models.ExtraSubText:   "work",
+		},
+	}
+	assert.NoError(t, storage.Create(context.Background(), notification))
+
+	all, err := storage.Find(context.Background(), NotificationFilter{DeviceID: "device1"})
+	assert.NoError(t, err)
+	assert.Len(t, all, 2)
+
+	for _, filter := range []NotificationFilter{
+		{DeviceID: "device1", Category: "msg"},
+		{DeviceID: "device1", ChannelID: "chats"},
+		{DeviceID: "device1", SubText: "work"},
+		{DeviceID: "device1", Person: "Bob"},
+	} {
+		results, err := storage.Find(context.Background(), filter)
+		assert.NoError(t, err)
+		assert.Len(t, results, 1)
+		assert.Equal(t, notification.ID, results[0].ID)
+	}
+
+	results, err := storage.Search(context.Background(), "device1", "work")
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+}
+
+func TestNotificationStorage_Each(t *testing.T) {
+	_, storage := setupTestDB(t)
+	base := time.Now().Add(-time.Hour)
+	for i, n := range []models.Notification{
+		{Title: "Second", Message: "Meet at the park", PackageName: "com.whatsapp", DeviceID: "device1"},
+		{Title: "First", Message: "Hello", PackageName: "com.whatsapp", DeviceID: "device1"},
+		{Title: "Other device", Message: "Park?", PackageName: "com.example.chat", DeviceID: "device2"},
+	} {
+		n.Timestamp = base.Add(time.Duration(2-i) * time.Minute)
+		assert.NoError(t, storage.Create(context.Background(), &n))
+	}
+
+	titles := func(filter NotificationFilter) []string {
+		var titles []string
+		err := storage.Each(context.Background(), filter, func(n *models.Notification) error {
+			titles = append(titles, n.Title)
+			return nil
+		})
+		assert.NoError(t, err)
+		return titles
+	}
+
+	assert.Equal(t, []string{"Other device", "First", "Second"}, titles(NotificationFilter{}))
+	assert.Equal(t, []string{"First", "Second"}, titles(NotificationFilter{DeviceID: "device1"}))
+	assert.Equal(t, []string{"Other device"}, titles(NotificationFilter{PackageName: "com.example.chat"}))
+	assert.Equal(t, []string{"First"}, titles(NotificationFilter{End: base.Add(90 * time.Second), Start: base.Add(30 * time.Second)}))
+	assert.Equal(t, []string{"Other device", "Second"}, titles(NotificationFilter{Query: "park"}))
+
+	useTestKeyring(t, "1")
+	createMessage(t, storage, "Alice", "See you at the park")
+	assert.Equal(t, []string{"Other device", "Second", "Alice"}, titles(NotificationFilter{Query: "PARK"}))
+
+	stop := errors.New("stop")
+	assert.ErrorIs(t, storage.Each(context.Background(), NotificationFilter{}, func(*models.Notification) error { return stop }), stop)
+}
+
+func TestNotificationStorage_Metrics(t *testing.T) {
+	_, storage := setupTestDB(t)
+	ingested := metrics.NotificationsIngested.WithLabelValues("metrics-device", "com.test.app")
+	before := testutil.ToFloat64(ingested)
+
+	createTestNotification(t, storage, "metrics-device")
+	createTestNotification(t, storage, "metrics-device")
+	_, err := storage.GetDevices(context.Background())
+	assert.NoError(t, err)
+
+	assert.Equal(t, before+2, testutil.ToFloat64(ingested))
+	assert.Contains(t, collectLabels(t, "lileye_storage_query_duration_seconds", "method"), "GetDevices")
+}
+
+// collectLabels returns the values of a label across the series of a metric
+func collectLabels(t *testing.T, name, label string) []string {
+	families, err := metrics.Registry.Gather()
+	assert.NoError(t, err)
+
+	var values []string
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			for _, pair := range m.GetLabel() {
+				if pair.GetName() == label {
+					values = append(values, pair.GetValue())
+				}
+			}
+		}
+	}
+	return values
+}
+
+func TestCheckSchema(t *testing.T) {
+	db, _ := setupTestDB(t)
+	assert.NoError(t, CheckSchema(db))
+
+	assert.NoError(t, db.Migrator().DropColumn(&models.Notification{}, "channel_id"))
+	assert.EqualError(t, CheckSchema(db), "column notifications.channel_id is missing")
+
+	empty, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.EqualError(t, CheckSchema(empty), "table notifications is missing")
+}
+
+func TestNotificationStorage_Purge(t *testing.T) {
+	db, storage := setupTestDB(t)
+	now := time.Now()
+	for _, n := range []models.Notification{
+		{DeviceID: "device1", PackageName: "com.whatsapp", Timestamp: now.Add(-48 * time.Hour)},
+		{DeviceID: "device1", PackageName: "com.slack", Timestamp: now},
+		{DeviceID: "device2", PackageName: "com.whatsapp", Timestamp: now},
+	} {
+		assert.NoError(t, storage.Create(context.Background(), &n))
+	}
+	old := PurgeFilter{Before: now.Add(-24 * time.Hour)}
+
+	count, err := storage.CountPurge(context.Background(), old)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	deleted, err := storage.Purge(context.Background(), old)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	// Soft-deleted notifications are purged too, with their events
+	var slack, whatsapp models.Notification
+	assert.NoError(t, db.Where("package_name = ?", "com.slack").First(&slack).Error)
+	assert.NoError(t, db.Where("device_id = ?", "device2").First(&whatsapp).Error)
+	for _, id := range []uint{slack.ID, whatsapp.ID} {
+		assert.NoError(t, db.Create(&models.NotificationEvent{NotificationID: &id, Key: "k", DeviceID: "d", Type: models.EventPosted, Timestamp: now}).Error)
+	}
+	assert.NoError(t, db.Delete(&slack).Error)
+	deleted, err = storage.Purge(context.Background(), PurgeFilter{DeviceID: "device1"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	var events int64
+	assert.NoError(t, db.Unscoped().Model(&models.NotificationEvent{}).Count(&events).Error)
+	assert.Equal(t, int64(1), events)
+
+	deleted, err = storage.Purge(context.Background(), PurgeFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"errors"
+
+	"github.com/lileye/backend/internal/fieldcrypt"
+	"github.com/lileye/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// reencryptBatchSize is the number of rows rewritten per transaction
+const reencryptBatchSize = 500
+
+// Reencrypt rewrites the encrypted columns of every row, including deleted
+// ones, with the active key of the installed keyring and recomputes the
+// blind indexes. It is run after encryption is turned on, to encrypt
+// existing rows, and after a new key becomes active, so that the old key
+// can be removed. progress is called after each batch with the table and
+// the number of its rows rewritten so far. It returns the total number of
+// rows rewritten. The blind indexes of contact aliases are rebuilt last.
+func Reencrypt(db *gorm.DB, progress func(table string, done int64)) (int64, error) {
+	if !fieldcrypt.Enabled() {
+		return 0, errors.New("encryption is not configured")
+	}
+	if progress == nil {
+		progress = func(string, int64) {}
+	}
+
+	tables := []func() (int64, error){
+		func() (int64, error) {
+			return reencryptTable(db, "notifications", progress, updateColumns[models.Notification](
+				"title", "message", "from", "from_index", "conversation_title", "conversation_title_index",
+				"sub_text", "sub_text_index", "big_text", "people", "people_index", "extras"))
+		},
+		func() (int64, error) { return reencryptTable(db, "senders", progress, reencryptSender) },
+		func() (int64, error) {
+			return reencryptTable(db, "alerts", progress, updateColumns[models.Alert]("from"))
+		},
+		func() (int64, error) {
+			return reencryptTable(db, "contacts", progress, updateColumns[models.Contact]("name"))
+		},
+		func() (int64, error) {
+			return reencryptTable(db, "contact_aliases", progress, updateColumns[models.ContactAlias](
+				"name", "identity", "identity_index"))
+		},
+		func() (int64, error) {
+			return reencryptTable(db, "allowlist", progress, updateColumns[models.AllowlistEntry](
+				"identity", "identity_index"))
+		},
+	}
+	var total int64
+	for _, reencrypt := range tables {
+		done, err := reencrypt()
+		total += done
+		if err != nil {
+			return total, err
+		}
+	}
+
+	// The aliases are linked again under the new blind indexes
+	if err := db.Where("1 = 1").Delete(&models.AliasIndex{}).Error; err != nil {
+		return total, err
+	}
+	return total, indexAliases(db)
+}
+
+// reencryptTable loads every row of a table in batches and saves each one
+// with save inside a transaction per batch
+func reencryptTable[T any](db *gorm.DB, table string, progress func(string, int64), save func(tx *gorm.DB, row *T) error) (int64, error) {
+	var done int64
+	var batch []T
+	err := db.Unscoped().FindInBatches(&batch, reencryptBatchSize, func(_ *gorm.DB, _ int) error {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for i := range batch {
+				if err := save(tx, &batch[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		done += int64(len(batch))
+		progress(table, done)
+		return nil
+	}).Error
+	return done, err
+}
+
+// updateColumns saves the given columns of a row. Hooks run so that blind
+// indexes are recomputed.
+func updateColumns[T any](columns ...string) func(tx *gorm.DB, row *T) error {
+	return func(tx *gorm.DB, row *T) error {
+		return tx.Unscoped().Model(row).Select(columns).Updates(row).Error
+	}
+}
+
+// reencryptSender saves a sender with its new blind index. A sender seen
+// both before and after encryption was turned on has a row under each
+// index; the rows are merged, keeping the earliest first seen time.
+func reencryptSender(tx *gorm.DB, sender *models.Sender) error {
+	var existing models.Sender
+	err := tx.Unscoped().Where("device_id = ? AND package_name = ? AND from_index = ? AND id <> ?",
+		sender.DeviceID, sender.PackageName, fieldcrypt.BlindIndex(sender.From), sender.ID).
+		Limit(1).Find(&existing).Error
+	if err != nil {
+		return err
+	}
+	if existing.ID == 0 {
+		return updateColumns[models.Sender]("from", "from_index")(tx, sender)
+	}
+
+	if sender.FirstSeen.Before(existing.FirstSeen) {
+		err := tx.Unscoped().Model(&existing).Update("first_seen", sender.FirstSeen).Error
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Unscoped().Delete(sender).Error
+}
@@ -0,0 +1,246 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lileye/backend/internal/fieldcrypt"
+	"github.com/lileye/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func useTestKeyring(t *testing.T, active string) {
+	k, err := fieldcrypt.NewKeyring(map[string][]byte{
+		"1": bytes.Repeat([]byte{1}, fieldcrypt.KeySize),
+		"2": bytes.Repeat([]byte{2}, fieldcrypt.KeySize),
+	}, active, bytes.Repeat([]byte{9}, fieldcrypt.KeySize))
+	assert.NoError(t, err)
+	fieldcrypt.Use(k)
+	t.Cleanup(func() { fieldcrypt.Use(nil) })
+}
+
+func createMessage(t *testing.T, storage *NotificationStorage, from, message string) {
+	err := storage.Create(context.Background(), &models.Notification{
+		Title:       from,
+		Message:     message,
+		Timestamp:   time.Now(),
+		PackageName: "com.whatsapp",
+		From:        from,
+		DeviceID:    "device1",
+		Extras:      map[string]string{models.ExtraBigText: message + " (expanded)"},
+	})
+	assert.NoError(t, err)
+}
+
+// rawColumn returns the stored values of a column, bypassing the serializer
+func rawColumn(t *testing.T, db *gorm.DB, table, column string) []string {
+	var values []string
+	err := db.Table(table).Order("id").Pluck(column, &values).Error
+	assert.NoError(t, err)
+	return values
+}
+
+func TestEncryptedStorage(t *testing.T) {
+	db, storage := setupTestDB(t)
+	useTestKeyring(t, "1")
+
+	createMessage(t, storage, "Alice", "Meet at the park")
+	createMessage(t, storage, "Alice", "Bring snacks")
+	createMessage(t, storage, "Bob", "Homework?")
+
+	for _, column := range []string{"title", "message", "from", "big_text", "extras"} {
+		for _, value := range rawColumn(t, db, "notifications", column) {
+			assert.True(t, fieldcrypt.IsEncrypted(value), column)
+		}
+	}
+	for _, value := range rawColumn(t, db, "senders", "from") {
+		assert.True(t, fieldcrypt.IsEncrypted(value))
+	}
+
+	notifications, err := storage.GetByDeviceID(context.Background(), "device1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Meet at the park", notifications[0].Message)
+	assert.Equal(t, "Meet at the park (expanded)", notifications[0].BigText)
+
+	// Search runs on decrypted content
+	results, err := storage.Search(context.Background(), "device1", "PARK")
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+	results, err = storage.Search(context.Background(), "device1", "alice")
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+
+	// Threads and contacts match senders through the blind index
+	conversations := NewConversationStorage(db)
+	threads, err := conversations.GetConversations(context.Background(), "device1", "")
+	assert.NoError(t, err)
+	assert.Len(t, threads, 2)
+	thread, err := conversations.GetThread(context.Background(), "device1", "com.whatsapp", "Alice", 50, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), thread.Total)
+
+	contacts := NewContactStorage(db)
+	list, err := contacts.List(context.Background(), "")
+	assert.NoError(t, err)
+	activity, err := contacts.GetActivity(context.Background(), list[0].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Alice", list[0].Name)
+	assert.Equal(t, int64(2), activity[0].MessageCount)
+
+	// A repeated sender is not recorded twice
+	var senders int64
+	db.Model(&models.Sender{}).Count(&senders)
+	assert.Equal(t, int64(2), senders)
+
+	fieldcrypt.Use(nil)
+	_, err = storage.GetByDeviceID(context.Background(), "device1")
+	assert.ErrorIs(t, err, fieldcrypt.ErrNoKeyring)
+}
+
+func TestEncryptedLookups(t *testing.T) {
+	db, storage := setupTestDB(t)
+	useTestKeyring(t, "1")
+	ctx := context.Background()
+
+	alerts := NewAlertStorage(db)
+	assert.NoError(t, alerts.AddAllowlist(ctx, &models.AllowlistEntry{Identity: "Grandma"}))
+	assert.NoError(t, db.Create(&models.App{PackageName: "com.whatsapp", Name: "WhatsApp", Watched: true}).Error)
+	for _, from := range []string{"Grandma", "Alice", "Bob"} {
+		err := storage.Create(ctx, &models.Notification{
+			Title:       "Family",
+			Message:     "Dinner at 7",
+			Timestamp:   time.Now(),
+			PackageName: "com.whatsapp",
+			From:        from,
+			DeviceID:    "device1",
+			Extras: map[string]string{
+				models.ExtraConversationTitle: "Family",
+				models.ExtraSubText:           "3 new messages",
+				models.ExtraPeople:            "Grandma, Alice, Bob",
+			},
+		})
+		assert.NoError(t, err)
+	}
+
+	// Nothing a sender or conversation can be told by is left in plaintext
+	for _, column := range [][2]string{
+		{"notifications", "conversation_title"}, {"notifications", "sub_text"}, {"notifications", "people"},
+		{"contacts", "name"}, {"contact_aliases", "name"}, {"contact_aliases", "identity"}, {"allowlist", "identity"},
+	} {
+		values := rawColumn(t, db, column[0], column[1])
+		assert.NotEmpty(t, values, column)
+		for _, value := range values {
+			assert.True(t, fieldcrypt.IsEncrypted(value), column)
+		}
+	}
+	for _, value := range rawColumn(t, db, "notifications", "people_index") {
+		assert.NotContains(t, value, "Alice")
+	}
+
+	// and every lookup goes through the blind indexes
+	for _, filter := range []NotificationFilter{
+		{DeviceID: "device1", ConversationTitle: "Family"},
+		{DeviceID: "device1", SubText: "3 new messages"},
+		{DeviceID: "device1", Person: "Alice"},
+		{DeviceID: "device1", Person: " Bob "},
+	} {
+		results, err := storage.Find(ctx, filter)
+		assert.NoError(t, err)
+		assert.Len(t, results, 3, filter)
+	}
+	results, err := storage.Find(ctx, NotificationFilter{DeviceID: "device1", Person: "Ali"})
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+
+	conversations := NewConversationStorage(db)
+	threads, err := conversations.GetConversations(ctx, "device1", "")
+	assert.NoError(t, err)
+	assert.Len(t, threads, 1)
+	assert.Equal(t, "Family", threads[0].From)
+	thread, err := conversations.GetThread(ctx, "device1", "com.whatsapp", "Family", 50, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), thread.Total)
+
+	list, err := NewContactStorage(db).List(ctx, "")
+	assert.NoError(t, err)
+	assert.Len(t, list, 3)
+	assert.Equal(t, "Alice", list[0].Name)
+	assert.Equal(t, "alice", list[0].Aliases[0].Identity)
+
+	// The allowlisted sender raised no alert
+	raised, err := alerts.List(ctx, "", false)
+	assert.NoError(t, err)
+	assert.Len(t, raised, 2)
+	for _, alert := range raised {
+		assert.NotEqual(t, "Grandma", alert.From)
+	}
+	entries, err := alerts.ListAllowlist(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "grandma", entries[0].Identity)
+}
+
+func TestReencrypt(t *testing.T) {
+	db, storage := setupTestDB(t)
+	createMessage(t, storage, "Alice", "Stored before encryption")
+	assert.Equal(t, []string{"Stored before encryption"}, rawColumn(t, db, "notifications", "message"))
+
+	// Turning encryption on leaves existing rows readable until they are
+	// rewritten
+	useTestKeyring(t, "1")
+	createMessage(t, storage, "Alice", "Stored with key 1")
+	notifications, err := storage.GetByDeviceID(context.Background(), "device1")
+	assert.NoError(t, err)
+	assert.Len(t, notifications, 2)
+
+	var progress []string
+	rewritten, err := Reencrypt(db, func(table string, done int64) {
+		progress = append(progress, table)
+	})
+	assert.NoError(t, err)
+	// Two notifications and senders, then the contact and its alias
+	assert.Equal(t, int64(6), rewritten)
+	assert.Equal(t, []string{"notifications", "senders", "contacts", "contact_aliases"}, progress)
+
+	// The sender recorded under its plaintext index is merged into the one
+	// recorded after encryption was turned on
+	var senders []models.Sender
+	assert.NoError(t, db.Find(&senders).Error)
+	assert.Len(t, senders, 1)
+	for _, value := range rawColumn(t, db, "notifications", "message") {
+		assert.Equal(t, "1", fieldcrypt.KeyID(value))
+	}
+
+	// Both messages now share a thread, and belong to the same contact
+	thread, err := NewConversationStorage(db).GetThread(context.Background(), "device1", "com.whatsapp", "Alice", 50, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), thread.Total)
+	contacts := NewContactStorage(db)
+	list, err := contacts.List(context.Background(), "")
+	assert.NoError(t, err)
+	assert.Len(t, list, 1)
+	page, err := contacts.GetNotifications(context.Background(), list[0].ID, 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), page.Total)
+
+	// Rotating to key 2 rewrites everything with it
+	useTestKeyring(t, "2")
+	_, err = Reencrypt(db, nil)
+	assert.NoError(t, err)
+	for _, column := range [][2]string{
+		{"notifications", "title"}, {"contacts", "name"}, {"contact_aliases", "name"}, {"contact_aliases", "identity"},
+	} {
+		for _, value := range rawColumn(t, db, column[0], column[1]) {
+			assert.Equal(t, "2", fieldcrypt.KeyID(value), column)
+		}
+	}
+	notifications, err = storage.GetByDeviceID(context.Background(), "device1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Stored before encryption", notifications[0].Message)
+
+	fieldcrypt.Use(nil)
+	_, err = Reencrypt(db, nil)
+	assert.Error(t, err)
+}
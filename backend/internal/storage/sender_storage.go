@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/lileye/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SenderStorage handles database operations for first-seen senders
+type SenderStorage struct {
+	db *gorm.DB
+}
+
+// NewSenderStorage creates a new SenderStorage instance
+func NewSenderStorage(db *gorm.DB) *SenderStorage {
+	return &SenderStorage{db: db}
+}
+
+// Backfill records the senders, and their contacts, of notifications stored
+// without them, such as imported ones or those from before sender tracking
+// existed. No alerts are raised for them.
+func (s *SenderStorage) Backfill(ctx context.Context) error {
+	// "from" is copied as stored, which keeps it encrypted when it is
+	err := s.db.WithContext(ctx).Exec(`INSERT INTO senders (created_at, updated_at, device_id, package_name, "from", from_index, first_seen)
+		SELECT ?, ?, device_id, package_name, "from", from_index, MIN(timestamp)
+		FROM notifications
+		WHERE deleted_at IS NULL AND "from" <> ''
+		GROUP BY device_id, package_name, from_index
+		ON CONFLICT DO NOTHING`, time.Now(), time.Now()).Error
+	if err != nil {
+		return err
+	}
+	return indexAliases(s.db.WithContext(ctx))
+}
+
+// GetNew retrieves senders first seen since the given time, newest first,
+// optionally restricted to a device
+func (s *SenderStorage) GetNew(ctx context.Context, since time.Time, deviceID string) ([]models.Sender, error) {
+	query := s.db.WithContext(ctx).Where("first_seen >= ?", since)
+	if deviceID != "" {
+		query = query.Where("device_id = ?", deviceID)
+	}
+
+	var senders []models.Sender
+	if err := query.Order("first_seen desc").Find(&senders).Error; err != nil {
+		return nil, err
+	}
+
+	var apps []models.App
+	if err := s.db.WithContext(ctx).Find(&apps).Error; err != nil {
+		return nil, err
+	}
+	names := make(map[string]string, len(apps))
+	for _, app := range apps {
+		names[app.PackageName] = app.Name
+	}
+	for i := range senders {
+		senders[i].AppName = names[senders[i].PackageName]
+	}
+	return senders, nil
+}
+
+// recordSender records the sender of a newly stored notification and raises
+// a new contact alert if the sender has not been seen in the app on the
+// device before, the app is watched and the sender is not allowlisted
+func recordSender(tx *gorm.DB, notification *models.Notification) error {
+	if notification.From == "" {
+		return nil
+	}
+
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.Sender{
+		DeviceID:    notification.DeviceID,
+		PackageName: notification.PackageName,
+		From:        notification.From,
+		FirstSeen:   notification.Timestamp,
+	})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+
+	var watched int64
+	err := tx.Model(&models.App{}).
+		Where("package_name = ? AND watched = ?", notification.PackageName, true).
+		Count(&watched).Error
+	if err != nil || watched == 0 {
+		return err
+	}
+
+	allowed, err := isAllowlisted(tx, notification)
+	if err != nil || allowed {
+		return err
+	}
+
+	return tx.Create(&models.Alert{
+		Type:           models.AlertNewContact,
+		DeviceID:       notification.DeviceID,
+		PackageName:    notification.PackageName,
+		From:           notification.From,
+		NotificationID: notification.ID,
+	}).Error
+}
+
+// isAllowlisted reports whether the sender of a notification is on the
+// allowlist or is an alias of a trusted contact
+func isAllowlisted(tx *gorm.DB, notification *models.Notification) (bool, error) {
+	identity := models.NormalizeIdentity(notification.From)
+
+	var count int64
+	err := tx.Model(&models.AllowlistEntry{}).
+		Where("identity_index IN ?", blindIndexes(identity)).
+		Where("device_id = '' OR device_id = ?", notification.DeviceID).
+		Where("package_name = '' OR package_name = ?", notification.PackageName).
+		Count(&count).Error
+	if err != nil || count > 0 {
+		return count > 0, err
+	}
+
+	err = tx.Model(&models.ContactAlias{}).
+		Joins("JOIN contacts ON contacts.id = contact_aliases.contact_id AND contacts.deleted_at IS NULL").
+		Where("contact_aliases.identity_index IN ? AND contacts.status = ?", blindIndexes(identity), models.ContactTrusted).
+		Count(&count).Error
+	return count > 0, err
+}
@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lileye/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupSenderStorage(t *testing.T) (*NotificationStorage, *SenderStorage, *AlertStorage) {
+	db, notificationStorage := setupTestDB(t)
+	err := NewAppStorage(db, nil).Seed(context.Background(), models.DefaultApps)
+	assert.NoError(t, err)
+
+	return notificationStorage, NewSenderStorage(db), NewAlertStorage(db)
+}
+
+func TestNotificationStorage_CreateRaisesNewContactAlert(t *testing.T) {
+	notificationStorage, senders, alerts := setupSenderStorage(t)
+	now := time.Now()
+
+	createSenderNotification(t, notificationStorage, "device1", "com.whatsapp", "Stranger", now)
+	createSenderNotification(t, notificationStorage, "device1", "com.whatsapp", "Stranger", now)
+	// Same sender on another device or app is new there
+	createSenderNotification(t, notificationStorage, "device2", "com.whatsapp", "Stranger", now)
+	// Unwatched apps record the sender without an alert
+	createSenderNotification(t, notificationStorage, "device1", "com.google.android.gm", "boss@company.com", now)
+
+	raised, err := alerts.List(context.Background(), "", false)
+	assert.NoError(t, err)
+	assert.Len(t, raised, 2)
+	assert.Equal(t, models.AlertNewContact, raised[0].Type)
+	assert.Equal(t, "Stranger", raised[0].From)
+	assert.NotZero(t, raised[0].NotificationID)
+
+	seen, err := senders.GetNew(context.Background(), now.Add(-time.Hour), "device1")
+	assert.NoError(t, err)
+	assert.Len(t, seen, 2)
+	assert.Contains(t, []string{seen[0].AppName, seen[1].AppName}, "WhatsApp")
+}
+
+func TestNotificationStorage_CreateSuppressesKnownSenders(t *testing.T) {
+	notificationStorage, _, alerts := setupSenderStorage(t)
+	contacts := NewContactStorage(alerts.db)
+	now := time.Now()
+
+	assert.NoError(t, alerts.AddAllowlist(context.Background(), &models.AllowlistEntry{Identity: " Grandma "}))
+	assert.NoError(t, alerts.AddAllowlist(context.Background(), &models.AllowlistEntry{Identity: "Coach", DeviceID: "device2"}))
+
+	// A trusted contact known from one app is not new on another
+	createSenderNotification(t, notificationStorage, "device1", "com.google.android.gm", "Mum", now)
+	mum, err := contacts.List(context.Background(), "")
+	assert.NoError(t, err)
+	_, err = contacts.Update(context.Background(), mum[0].ID, "", models.ContactTrusted)
+	assert.NoError(t, err)
+
+	createSenderNotification(t, notificationStorage, "device1", "com.whatsapp", "grandma", now)
+	createSenderNotification(t, notificationStorage, "device1", "com.whatsapp", "Mum", now)
+	createSenderNotification(t, notificationStorage, "device1", "com.whatsapp", "Coach", now)
+
+	raised, err := alerts.List(context.Background(), "", false)
+	assert.NoError(t, err)
+	assert.Len(t, raised, 1)
+	assert.Equal(t, "Coach", raised[0].From)
+}
+
+func TestSenderStorage_Backfill(t *testing.T) {
+	notificationStorage, senders, alerts := setupSenderStorage(t)
+	now := time.Now()
+	createSenderNotification(t, notificationStorage, "device1", "com.whatsapp", "Alice", now)
+
+	// Simulate notifications stored before sender tracking
+	assert.NoError(t, senders.db.Exec("DELETE FROM senders").Error)
+	assert.NoError(t, senders.db.Exec("DELETE FROM alerts").Error)
+	assert.NoError(t, senders.db.Exec("DELETE FROM contact_alias_indexes").Error)
+	assert.NoError(t, senders.db.Exec("DELETE FROM contact_aliases").Error)
+	assert.NoError(t, senders.db.Exec("DELETE FROM contacts").Error)
+
+	assert.NoError(t, senders.Backfill(context.Background()))
+	assert.NoError(t, senders.Backfill(context.Background()))
+
+	contacts := NewContactStorage(senders.db)
+	list, err := contacts.List(context.Background(), "")
+	assert.NoError(t, err)
+	assert.Len(t, list, 1)
+	activity, err := contacts.GetActivity(context.Background(), list[0].ID)
+	assert.NoError(t, err)
+	assert.Len(t, activity, 1)
+
+	seen, err := senders.GetNew(context.Background(), now.Add(-time.Hour), "")
+	assert.NoError(t, err)
+	assert.Len(t, seen, 1)
+	assert.WithinDuration(t, now, seen[0].FirstSeen, time.Millisecond)
+
+	seen, err = senders.GetNew(context.Background(), now.Add(time.Hour), "")
+	assert.NoError(t, err)
+	assert.Empty(t, seen)
+
+	raised, err := alerts.List(context.Background(), "", false)
+	assert.NoError(t, err)
+	assert.Empty(t, raised)
+}
+
+func TestAlertStorage_AcknowledgeAndAllowlist(t *testing.T) {
+	notificationStorage, _, alerts := setupSenderStorage(t)
+	createSenderNotification(t, notificationStorage, "device1", "com.whatsapp", "Stranger", time.Now())
+
+	raised, err := alerts.List(context.Background(), "device1", true)
+	assert.NoError(t, err)
+	assert.Len(t, raised, 1)
+
+	assert.NoError(t, alerts.Acknowledge(context.Background(), raised[0].ID))
+	assert.Error(t, alerts.Acknowledge(context.Background(), 9999))
+
+	raised, err = alerts.List(context.Background(), "device1", true)
+	assert.NoError(t, err)
+	assert.Empty(t, raised)
+
+	entry := &models.AllowlistEntry{Identity: "Friend"}
+	assert.NoError(t, alerts.AddAllowlist(context.Background(), entry))
+	assert.Equal(t, "friend", entry.Identity)
+
+	entries, err := alerts.ListAllowlist(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	assert.NoError(t, alerts.DeleteAllowlist(context.Background(), entry.ID))
+	assert.Error(t, alerts.DeleteAllowlist(context.Background(), entry.ID))
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/lileye/backend/internal/metrics"
+	"github.com/lileye/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// StatsStorage summarises the contents of the database
+type StatsStorage struct {
+	db *gorm.DB
+}
+
+// NewStatsStorage creates a new StatsStorage instance
+func NewStatsStorage(db *gorm.DB) *StatsStorage {
+	return &StatsStorage{db: db}
+}
+
+// Get counts the stored notifications, devices, apps, senders, attachments
+// and open alerts and measures the database
+func (s *StatsStorage) Get(ctx context.Context) (*models.Stats, error) {
+	defer metrics.ObserveStorage("GetStats")()
+	stats := &models.Stats{}
+	counts := []struct {
+		count *int64
+		query *gorm.DB
+	}{
+		{&stats.Notifications, s.db.WithContext(ctx).Model(&models.Notification{})},
+		{&stats.Devices, s.db.WithContext(ctx).Model(&models.Notification{}).Distinct("device_id")},
+		{&stats.Apps, s.db.WithContext(ctx).Model(&models.Notification{}).Distinct("package_name")},
+		{&stats.Senders, s.db.WithContext(ctx).Model(&models.Sender{})},
+		{&stats.Attachments, s.db.WithContext(ctx).Model(&models.Attachment{})},
+		{&stats.OpenAlerts, s.db.WithContext(ctx).Model(&models.Alert{}).Where("acknowledged = ?", false)},
+	}
+	for _, c := range counts {
+		if err := c.query.Count(c.count).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	if stats.Notifications > 0 {
+		var oldest, newest models.Notification
+		if err := s.db.WithContext(ctx).Select("timestamp").Order("timestamp").First(&oldest).Error; err != nil {
+			return nil, err
+		}
+		if err := s.db.WithContext(ctx).Select("timestamp").Order("timestamp desc").First(&newest).Error; err != nil {
+			return nil, err
+		}
+		stats.Oldest, stats.Newest = timePtr(oldest.Timestamp), timePtr(newest.Timestamp)
+	}
+
+	var pageCount, pageSize int64
+	if err := s.db.WithContext(ctx).Raw("PRAGMA page_count").Scan(&pageCount).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).Raw("PRAGMA page_size").Scan(&pageSize).Error; err != nil {
+		return nil, err
+	}
+	stats.DatabaseBytes = pageCount * pageSize
+
+	var err error
+	stats.SchemaVersion, err = GetSchemaVersion(s.db.WithContext(ctx))
+	return stats, err
+}
+
+// Devices summarises the notifications of every device, by device ID
+func (s *StatsStorage) Devices(ctx context.Context) ([]models.DeviceStats, error) {
+	defer metrics.ObserveStorage("GetDeviceStats")()
+	var ids []string
+	if err := s.db.WithContext(ctx).Model(&models.Notification{}).Distinct().Order("device_id").Pluck("device_id", &ids).Error; err != nil {
+		return nil, err
+	}
+
+	devices := make([]models.DeviceStats, len(ids))
+	for i, id := range ids {
+		query := s.db.WithContext(ctx).Model(&models.Notification{}).Where("device_id = ?", id)
+		devices[i].DeviceID = id
+		if err := query.Count(&devices[i].Notifications).Error; err != nil {
+			return nil, err
+		}
+		var newest models.Notification
+		err := s.db.WithContext(ctx).Select("device_name", "timestamp").Where("device_id = ?", id).
+			Order("timestamp desc").First(&newest).Error
+		if err != nil {
+			return nil, err
+		}
+		devices[i].DeviceName, devices[i].LastSeen = newest.DeviceName, newest.Timestamp
+	}
+	return devices, nil
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
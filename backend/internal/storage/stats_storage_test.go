@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lileye/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsStorage(t *testing.T) {
+	db, notifications := setupTestDB(t)
+	stats := NewStatsStorage(db)
+
+	empty, err := stats.Get(context.Background())
+	assert.NoError(t, err)
+	assert.Zero(t, empty.Notifications)
+	assert.Nil(t, empty.Oldest)
+	assert.Positive(t, empty.DatabaseBytes)
+	assert.Equal(t, SchemaVersion, empty.SchemaVersion)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for i, device := range []string{"device1", "device1", "device2"} {
+		assert.NoError(t, notifications.Create(context.Background(), &models.Notification{
+			DeviceID: device, DeviceName: "Pixel " + device, PackageName: "com.whatsapp",
+			Timestamp: now.Add(time.Duration(i) * time.Hour),
+		}))
+	}
+
+	got, err := stats.Get(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), got.Notifications)
+	assert.Equal(t, int64(2), got.Devices)
+	assert.Equal(t, int64(1), got.Apps)
+	assert.True(t, got.Oldest.Equal(now))
+	assert.True(t, got.Newest.Equal(now.Add(2*time.Hour)))
+
+	devices, err := stats.Devices(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, devices, 2)
+	assert.Equal(t, "device1", devices[0].DeviceID)
+	assert.Equal(t, "Pixel device1", devices[0].DeviceName)
+	assert.Equal(t, int64(2), devices[0].Notifications)
+	assert.True(t, devices[0].LastSeen.Equal(now.Add(time.Hour)))
+}
@@ -0,0 +1,198 @@
+package throttle
+
+import (
+	"context"
+	"crypto/sha256"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lileye/backend/internal/models"
+)
+
+// Dedup remembers the notifications stored recently, so that an app
+// posting the same notification over and over, or a device sending it
+// again after a lost response, has it stored once. Two notifications are
+// the same when they come from the same device and app with the same key,
+// post time, title and message. A message repeated later, such as a second
+// "ok", is posted at another time and stored again.
+type Dedup struct {
+	window time.Duration
+	now    func() time.Time
+
+	mu     sync.Mutex
+	stored map[[sha256.Size]byte]*stored
+	swept  time.Time
+}
+
+// stored is a notification stored or being stored. While it is being
+// stored, pending is open and id is not known yet.
+type stored struct {
+	id      uint
+	at      time.Time
+	pending chan struct{}
+}
+
+// reservation is how long a notification being stored holds off its
+// repeats. A reservation neither stored nor forgotten by then, such as that
+// of a request that failed midway, is dropped.
+const reservation = 10 * time.Second
+
+// NewDedup creates a Dedup suppressing repeats for window after a
+// notification is first stored
+func NewDedup(window time.Duration) *Dedup {
+	return &Dedup{window: window, now: time.Now, stored: map[[sha256.Size]byte]*stored{}}
+}
+
+// Seen returns the ID of the stored notification n repeats, if any.
+// Otherwise n is reserved, and the caller must report with Stored or
+// Forget whether it was stored. A repeat of n arriving meanwhile waits for
+// that, until its reservation is dropped or ctx is done, so that two
+// requests at once do not both store it.
+func (d *Dedup) Seen(ctx context.Context, n *models.Notification) (uint, bool, error) {
+	key := fingerprint(n)
+	for {
+		now := d.now()
+		d.mu.Lock()
+		d.sweep(now)
+		s := d.live(key, now)
+		if s == nil {
+			d.reserve(key, now)
+			d.mu.Unlock()
+			return 0, false, nil
+		}
+		if s.pending == nil {
+			d.mu.Unlock()
+			return s.id, true, nil
+		}
+		pending, expiry := s.pending, s.at.Add(reservation).Sub(now)
+		d.mu.Unlock()
+
+		timer := time.NewTimer(expiry)
+		select {
+		case <-pending:
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return 0, false, ctx.Err()
+		}
+		timer.Stop()
+	}
+}
+
+// Fresh returns the notifications of a batch that repeat neither a stored
+// notification nor one earlier in the batch, and reserves them as Seen
+// does. A notification that another request is storing counts as a
+// repeat, so that Fresh never waits.
+func (d *Dedup) Fresh(notifications []models.Notification) []models.Notification {
+	now := d.now()
+	fresh := make([]models.Notification, 0, len(notifications))
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sweep(now)
+	for _, n := range notifications {
+		key := fingerprint(&n)
+		if d.live(key, now) != nil {
+			continue
+		}
+		d.reserve(key, now)
+		fresh = append(fresh, n)
+	}
+	return fresh
+}
+
+// Stored records the ID n was stored under. Repeats of it are suppressed
+// until the window has passed, even when they keep coming.
+func (d *Dedup) Stored(n *models.Notification) {
+	key := fingerprint(n)
+	now := d.now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s, ok := d.stored[key]
+	if !ok {
+		s = &stored{}
+		d.stored[key] = s
+	}
+	s.id = n.ID
+	s.at = now
+	s.release()
+}
+
+// Forget drops the reservation of n, which could not be stored, so that
+// its repeats are stored instead
+func (d *Dedup) Forget(n *models.Notification) {
+	key := fingerprint(n)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if s, ok := d.stored[key]; ok && s.pending != nil {
+		s.release()
+		delete(d.stored, key)
+	}
+}
+
+// live returns the notification stored or being stored under key, unless
+// its window or reservation has passed
+func (d *Dedup) live(key [sha256.Size]byte, now time.Time) *stored {
+	s, ok := d.stored[key]
+	if !ok || s.expired(now, d.window) {
+		return nil
+	}
+	return s
+}
+
+// reserve marks the notification under key as being stored, dropping what
+// was stored under it before
+func (d *Dedup) reserve(key [sha256.Size]byte, now time.Time) {
+	if s, ok := d.stored[key]; ok {
+		s.release()
+	}
+	d.stored[key] = &stored{at: now, pending: make(chan struct{})}
+}
+
+// expired reports whether s no longer holds off its repeats
+func (s *stored) expired(now time.Time, window time.Duration) bool {
+	if s.pending != nil {
+		return now.Sub(s.at) >= reservation
+	}
+	return now.Sub(s.at) >= window
+}
+
+// release wakes the repeats waiting for s to be stored
+func (s *stored) release() {
+	if s.pending != nil {
+		close(s.pending)
+		s.pending = nil
+	}
+}
+
+// sweep drops the notifications stored longer ago than the window, at most
+// once per window so that it stays cheap
+func (d *Dedup) sweep(now time.Time) {
+	if now.Sub(d.swept) < d.window {
+		return
+	}
+	d.swept = now
+	for k, s := range d.stored {
+		if s.expired(now, d.window) {
+			s.release()
+			delete(d.stored, k)
+		}
+	}
+}
+
+// fingerprint hashes what makes two notifications the same, so that long
+// messages take no more memory than short ones
+func fingerprint(n *models.Notification) [sha256.Size]byte {
+	h := sha256.New()
+	posted := strconv.FormatInt(n.Timestamp.UnixNano(), 10)
+	for _, s := range []string{n.DeviceID, n.PackageName, n.Key, posted, n.Title, n.Message} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	return sum
+}
@@ -0,0 +1,212 @@
+// Package throttle protects the server from floods: token-bucket rate
+// limits on requests, and suppression of notifications repeated by an app.
+package throttle
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rate is the refill rate and size of a token bucket
+type Rate struct {
+	// PerSecond is the number of tokens added every second
+	PerSecond float64
+	// Burst is the size of the bucket, the most tokens taken at once
+	Burst int
+}
+
+// ParseRate parses a rate written as <count>/<unit>:<burst>, such as
+// 10/s:100. The unit is s, m or h. Without a burst, the bucket holds one
+// unit's worth of tokens.
+func ParseRate(s string) (Rate, error) {
+	spec, burst, hasBurst := strings.Cut(s, ":")
+	count, unit, ok := strings.Cut(spec, "/")
+	if !ok {
+		return Rate{}, fmt.Errorf("rate %q: want <count>/<unit>[:<burst>]", s)
+	}
+	n, err := strconv.ParseFloat(count, 64)
+	if err != nil || n <= 0 {
+		return Rate{}, fmt.Errorf("rate %q: count must be a positive number", s)
+	}
+	var per time.Duration
+	switch unit {
+	case "s":
+		per = time.Second
+	case "m":
+		per = time.Minute
+	case "h":
+		per = time.Hour
+	default:
+		return Rate{}, fmt.Errorf("rate %q: unit must be s, m or h", s)
+	}
+	r := Rate{PerSecond: n / per.Seconds(), Burst: int(math.Ceil(n))}
+	if hasBurst {
+		if r.Burst, err = strconv.Atoi(burst); err != nil || r.Burst <= 0 {
+			return Rate{}, fmt.Errorf("rate %q: burst must be a positive integer", s)
+		}
+	}
+	return r, nil
+}
+
+// Limiter holds a token bucket per key, such as a client address. Buckets
+// start full, and are dropped once they have refilled.
+type Limiter struct {
+	rate Rate
+	now  func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	tokens float64
+	at     time.Time
+}
+
+// NewLimiter creates a Limiter of buckets of the given rate
+func NewLimiter(rate Rate) *Limiter {
+	return &Limiter{rate: rate, now: time.Now, buckets: map[string]*bucket{}}
+}
+
+// Allow takes n tokens from the bucket of key. When there are too few it
+// takes none, and returns how long until there are enough. Taking more
+// than the burst takes a full bucket, so large batches are slowed down
+// rather than refused for good.
+func (l *Limiter) Allow(key string, n int) (bool, time.Duration) {
+	return l.AllowAll(map[string]int{key: n})
+}
+
+// AllowAll takes tokens from the buckets of several keys, counts[key] from
+// each, as Allow does. It takes them only when every bucket has enough, and
+// otherwise returns how long until they all do.
+func (l *Limiter) AllowAll(counts map[string]int) (bool, time.Duration) {
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+	var wait float64
+	for key, n := range counts {
+		b, ok := l.buckets[key]
+		if !ok {
+			b = &bucket{tokens: float64(l.rate.Burst), at: now}
+			l.buckets[key] = b
+		}
+		b.tokens = math.Min(float64(l.rate.Burst), b.tokens+now.Sub(b.at).Seconds()*l.rate.PerSecond)
+		b.at = now
+		if want := l.want(n); b.tokens < want {
+			wait = math.Max(wait, (want-b.tokens)/l.rate.PerSecond)
+		}
+	}
+	if wait > 0 {
+		return false, time.Duration(wait * float64(time.Second))
+	}
+	for key, n := range counts {
+		l.buckets[key].tokens -= l.want(n)
+	}
+	return true, 0
+}
+
+// want is the number of tokens taken for n requests
+func (l *Limiter) want(n int) float64 {
+	return math.Min(float64(n), float64(l.rate.Burst))
+}
+
+// sweep drops the buckets that are full again, at most once per refill
+// period so that it stays cheap
+func (l *Limiter) sweep(now time.Time) {
+	refill := time.Duration(float64(l.rate.Burst) / l.rate.PerSecond * float64(time.Second))
+	if now.Sub(l.swept) < refill {
+		return
+	}
+	l.swept = now
+	for key, b := range l.buckets {
+		if now.Sub(b.at) >= refill {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Rule limits the requests to a route, per client address and per device
+type Rule struct {
+	// Method is an HTTP method, or * for any
+	Method string
+	// Path is a route such as /api/v1/notifications/:id. A trailing *
+	// matches any route starting with the rest.
+	Path string
+	// IP and Device are the rates per client address and per device, or
+	// nil when unlimited
+	IP, Device *Rate
+}
+
+// ParseRule parses a rule written as a method, a route and rates keyed by
+// ip or device, such as "POST /api/v1/notifications ip=20/s:100 device=10/s"
+func ParseRule(s string) (Rule, error) {
+	fields := strings.Fields(s)
+	if len(fields) < 3 {
+		return Rule{}, fmt.Errorf("rule %q: want <method> <route> ip=<rate> and/or device=<rate>", s)
+	}
+	r := Rule{Method: strings.ToUpper(fields[0]), Path: fields[1]}
+	if r.Method != "*" && !validMethod(r.Method) {
+		return Rule{}, fmt.Errorf("rule %q: unknown method %s", s, fields[0])
+	}
+	if !strings.HasPrefix(r.Path, "/") {
+		return Rule{}, fmt.Errorf("rule %q: the route must start with /", s)
+	}
+	for _, f := range fields[2:] {
+		key, value, _ := strings.Cut(f, "=")
+		rate, err := ParseRate(value)
+		if err != nil {
+			return Rule{}, fmt.Errorf("rule %q: %w", s, err)
+		}
+		switch key {
+		case "ip":
+			r.IP = &rate
+		case "device":
+			r.Device = &rate
+		default:
+			return Rule{}, fmt.Errorf("rule %q: limit %q must be keyed by ip or device", s, key)
+		}
+	}
+	return r, nil
+}
+
+func validMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// ParseRules parses rules, reporting the first invalid one
+func ParseRules(specs []string) ([]Rule, error) {
+	rules := make([]Rule, 0, len(specs))
+	for _, spec := range specs {
+		r, err := ParseRule(spec)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// Match reports whether the rule applies to a request of method to route,
+// the route pattern of the handler
+func (r Rule) Match(method, route string) bool {
+	if r.Method != "*" && r.Method != method {
+		return false
+	}
+	if prefix, ok := strings.CutSuffix(r.Path, "*"); ok {
+		return strings.HasPrefix(route, prefix)
+	}
+	return r.Path == route
+}
@@ -0,0 +1,274 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lileye/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// clock is a time that tests move by hand
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+func newClock() *clock                   { return &clock{t: time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)} }
+
+func TestParseRate(t *testing.T) {
+	r, err := ParseRate("10/s:100")
+	assert.NoError(t, err)
+	assert.Equal(t, Rate{PerSecond: 10, Burst: 100}, r)
+
+	r, err = ParseRate("120/m")
+	assert.NoError(t, err)
+	assert.Equal(t, Rate{PerSecond: 2, Burst: 120}, r)
+
+	for _, bad := range []string{"", "10", "10/d", "0/s", "-1/s", "x/s", "10/s:0", "10/s:x"} {
+		_, err := ParseRate(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestParseRule(t *testing.T) {
+	r, err := ParseRule("post /api/v1/notifications ip=20/s:100 device=10/s")
+	assert.NoError(t, err)
+	assert.Equal(t, "POST", r.Method)
+	assert.Equal(t, &Rate{PerSecond: 20, Burst: 100}, r.IP)
+	assert.Equal(t, &Rate{PerSecond: 10, Burst: 10}, r.Device)
+
+	r, err = ParseRule("* /api/v1/* ip=50/s")
+	assert.NoError(t, err)
+	assert.Nil(t, r.Device)
+
+	for _, bad := range []string{
+		"POST /api/v1/notifications",
+		"FETCH /api/v1/notifications ip=1/s",
+		"POST api/v1/notifications ip=1/s",
+		"POST /api/v1/notifications user=1/s",
+		"POST /api/v1/notifications ip=1/d",
+	} {
+		_, err := ParseRule(bad)
+		assert.Error(t, err, bad)
+	}
+
+	_, err = ParseRules([]string{"* /api/v1/* ip=1/s", "POST /x"})
+	assert.ErrorContains(t, err, `rule "POST /x"`)
+}
+
+func TestMatch(t *testing.T) {
+	exact := Rule{Method: "POST", Path: "/api/v1/notifications"}
+	assert.True(t, exact.Match("POST", "/api/v1/notifications"))
+	assert.False(t, exact.Match("GET", "/api/v1/notifications"))
+	assert.False(t, exact.Match("POST", "/api/v1/notifications/batch"))
+
+	prefix := Rule{Method: "*", Path: "/api/v1/*"}
+	assert.True(t, prefix.Match("GET", "/api/v1/devices"))
+	assert.True(t, prefix.Match("DELETE", "/api/v1/notifications/all"))
+	assert.False(t, prefix.Match("GET", "/healthz"))
+}
+
+func TestLimiter(t *testing.T) {
+	c := newClock()
+	l := NewLimiter(Rate{PerSecond: 2, Burst: 3})
+	l.now = c.now
+
+	// The bucket starts full
+	for i := 0; i < 3; i++ {
+		ok, _ := l.Allow("a", 1)
+		assert.True(t, ok)
+	}
+	ok, wait := l.Allow("a", 1)
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	// Other keys have their own bucket
+	ok, _ = l.Allow("b", 1)
+	assert.True(t, ok)
+
+	c.advance(500 * time.Millisecond)
+	ok, _ = l.Allow("a", 1)
+	assert.True(t, ok)
+
+	// A refused request takes nothing
+	ok, wait = l.Allow("a", 2)
+	assert.False(t, ok)
+	assert.Equal(t, time.Second, wait)
+	c.advance(time.Second)
+	ok, _ = l.Allow("a", 2)
+	assert.True(t, ok)
+
+	// More than the burst waits for a full bucket
+	c.advance(time.Minute)
+	ok, _ = l.Allow("a", 10)
+	assert.True(t, ok)
+	ok, wait = l.Allow("a", 10)
+	assert.False(t, ok)
+	assert.Equal(t, 1500*time.Millisecond, wait)
+
+	// Full buckets are dropped
+	c.advance(time.Minute)
+	l.Allow("c", 1)
+	assert.Len(t, l.buckets, 1)
+}
+
+func TestAllowAll(t *testing.T) {
+	l := NewLimiter(Rate{PerSecond: 1, Burst: 3})
+	l.now = newClock().now
+
+	ok, _ := l.Allow("b", 3)
+	assert.True(t, ok)
+
+	// A key over its limit refuses them all, and takes from none
+	ok, wait := l.AllowAll(map[string]int{"a": 2, "b": 1, "c": 1})
+	assert.False(t, ok)
+	assert.Equal(t, time.Second, wait)
+	ok, _ = l.Allow("a", 3)
+	assert.True(t, ok)
+	ok, _ = l.Allow("c", 3)
+	assert.True(t, ok)
+}
+
+func TestDedup(t *testing.T) {
+	c := newClock()
+	d := NewDedup(30 * time.Second)
+	d.now = c.now
+
+	posted := time.Date(2026, 10, 1, 11, 59, 58, 0, time.UTC)
+	n := models.Notification{DeviceID: "phone1", PackageName: "com.whatsapp", Key: "0|com.whatsapp|1", Timestamp: posted, Title: "Alice", Message: "Lunch?"}
+	_, ok, _ := d.Seen(context.Background(), &n)
+	assert.False(t, ok)
+
+	n.ID = 7
+	d.Stored(&n)
+	repeat := n
+	repeat.ID = 0
+	id, ok, _ := d.Seen(context.Background(), &repeat)
+	assert.True(t, ok)
+	assert.Equal(t, uint(7), id)
+
+	// Any difference in device, app, key, post time, title or message is
+	// another notification
+	for _, change := range []func(*models.Notification){
+		func(n *models.Notification) { n.Message = "Lunch!" },
+		func(n *models.Notification) { n.DeviceID = "phone2" },
+		func(n *models.Notification) { n.Key = "0|com.whatsapp|2" },
+		func(n *models.Notification) { n.Timestamp = posted.Add(time.Hour) },
+	} {
+		other := repeat
+		change(&other)
+		_, ok, _ = d.Seen(context.Background(), &other)
+		assert.False(t, ok)
+		d.Forget(&other)
+	}
+
+	// Repeats do not extend the window
+	c.advance(29 * time.Second)
+	_, ok, _ = d.Seen(context.Background(), &repeat)
+	assert.True(t, ok)
+	c.advance(time.Second)
+	_, ok, _ = d.Seen(context.Background(), &repeat)
+	assert.False(t, ok)
+
+	// A notification that could not be stored is not a repeat
+	d.Forget(&repeat)
+	_, ok, _ = d.Seen(context.Background(), &repeat)
+	assert.False(t, ok)
+}
+
+func TestSeenWaits(t *testing.T) {
+	d := NewDedup(time.Minute)
+	n := models.Notification{DeviceID: "phone1", PackageName: "com.whatsapp", Title: "Alice", Message: "Lunch?"}
+	_, ok, _ := d.Seen(context.Background(), &n)
+	assert.False(t, ok)
+
+	// A repeat arriving while n is being stored waits for its ID
+	ids := make(chan uint)
+	repeat := n
+	go func() {
+		id, ok, err := d.Seen(context.Background(), &repeat)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		ids <- id
+	}()
+	select {
+	case <-ids:
+		t.Fatal("the repeat did not wait")
+	case <-time.After(20 * time.Millisecond):
+	}
+	n.ID = 3
+	d.Stored(&n)
+	assert.Equal(t, uint(3), <-ids)
+}
+
+func TestSeenAbandoned(t *testing.T) {
+	c := newClock()
+	d := NewDedup(time.Minute)
+	d.now = c.now
+	n := models.Notification{DeviceID: "phone1", PackageName: "com.whatsapp", Title: "Alice", Message: "Lunch?"}
+	_, ok, _ := d.Seen(context.Background(), &n)
+	assert.False(t, ok)
+
+	// A repeat stops waiting when its request is done
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, _, err := d.Seen(ctx, &n)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// A reservation never stored nor forgotten is dropped
+	c.advance(reservation)
+	_, ok, err = d.Seen(context.Background(), &n)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestFresh(t *testing.T) {
+	c := newClock()
+	d := NewDedup(time.Minute)
+	d.now = c.now
+
+	stored := models.Notification{DeviceID: "phone1", PackageName: "com.whatsapp", Title: "Alice", Message: "Lunch?"}
+	stored.ID = 1
+	d.Stored(&stored)
+
+	later := c.t.Add(time.Second)
+	batch := []models.Notification{
+		{DeviceID: "phone1", PackageName: "com.whatsapp", Title: "Alice", Message: "Lunch?"},
+		{DeviceID: "phone1", PackageName: "com.whatsapp", Title: "Bob", Message: "Hi"},
+		{DeviceID: "phone1", PackageName: "com.whatsapp", Title: "Bob", Message: "Hi"},
+		{DeviceID: "phone1", PackageName: "com.whatsapp", Title: "Bob", Message: "Bye"},
+		{DeviceID: "phone1", PackageName: "com.whatsapp", Title: "Bob", Message: "Hi", Timestamp: later},
+	}
+	fresh := d.Fresh(batch)
+	assert.Len(t, fresh, 3)
+	assert.Equal(t, "Hi", fresh[0].Message)
+	assert.Equal(t, "Bye", fresh[1].Message)
+	assert.Equal(t, later, fresh[2].Timestamp)
+}
+
+func TestFreshConcurrent(t *testing.T) {
+	d := NewDedup(time.Minute)
+	x := models.Notification{DeviceID: "phone1", PackageName: "com.whatsapp", Title: "Alice", Message: "Lunch?"}
+	y := models.Notification{DeviceID: "phone1", PackageName: "com.whatsapp", Title: "Bob", Message: "Hi"}
+
+	// Batches holding the same notifications in another order neither wait
+	// for each other nor both store one
+	for i := 0; i < 100; i++ {
+		var wg sync.WaitGroup
+		fresh := make([][]models.Notification, 2)
+		for j, batch := range [][]models.Notification{{x, y}, {y, x}} {
+			wg.Add(1)
+			go func(j int, batch []models.Notification) {
+				defer wg.Done()
+				fresh[j] = d.Fresh(batch)
+			}(j, batch)
+		}
+		wg.Wait()
+		assert.Len(t, append(fresh[0], fresh[1]...), 2)
+		for _, n := range append(fresh[0], fresh[1]...) {
+			d.Forget(&n)
+		}
+	}
+}
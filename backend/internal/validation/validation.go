@@ -0,0 +1,159 @@
+// Package validation checks and normalizes the notifications devices send
+// before they are stored. Text is converted to Unicode NFC, invalid UTF-8
+// is replaced and control characters other than newlines and tabs are
+// dropped, so that text typed or encoded differently on two devices
+// compares equal in searches and sender matching.
+package validation
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/lileye/backend/internal/config"
+	"github.com/lileye/backend/internal/models"
+	"golang.org/x/text/unicode/norm"
+)
+
+// packageName matches Android package names: two or more dot-separated
+// segments that start with a letter
+var packageName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*(\.[A-Za-z][A-Za-z0-9_]*)+$`)
+
+// Validator checks notifications against the configured limits
+type Validator struct {
+	limits config.Validation
+	// now returns the server time that timestamps are compared to
+	now func() time.Time
+}
+
+// New creates a Validator enforcing limits
+func New(limits config.Validation) *Validator {
+	return &Validator{limits: limits, now: time.Now}
+}
+
+// Notification normalizes the text of n in place and returns its invalid
+// fields, if any
+func (v *Validator) Notification(n *models.Notification) []models.FieldError {
+	c := checker{}
+	v.check(&c, n, v.now())
+	return c.errs
+}
+
+// Notifications normalizes and checks a batch. The fields of invalid
+// notifications are named after their index, such as "[2].title".
+func (v *Validator) Notifications(notifications []models.Notification) []models.FieldError {
+	c := checker{}
+	now := v.now()
+	for i := range notifications {
+		c.prefix = fmt.Sprintf("[%d].", i)
+		v.check(&c, &notifications[i], now)
+	}
+	return c.errs
+}
+
+// MaxBody returns the size of the largest request body a notification or
+// a batch may be sent in
+func (v *Validator) MaxBody() int64 {
+	return v.limits.MaxBody
+}
+
+func (v *Validator) check(c *checker, n *models.Notification, now time.Time) {
+	l := v.limits
+	c.text("title", &n.Title, l.MaxTitle, true)
+	c.text("message", &n.Message, l.MaxMessage, true)
+	c.text("big_text", &n.BigText, l.MaxMessage, false)
+	c.text("from", &n.From, l.MaxField, false)
+	c.text("device_name", &n.DeviceName, l.MaxField, false)
+	c.text("conversation_title", &n.ConversationTitle, l.MaxField, false)
+	c.text("sub_text", &n.SubText, l.MaxField, false)
+	c.text("people", &n.People, l.MaxField, false)
+	c.id("device_id", &n.DeviceID, l.MaxField, true)
+	c.id("key", &n.Key, l.MaxField, false)
+	c.id("category", &n.Category, l.MaxField, false)
+	c.id("channel_id", &n.ChannelID, l.MaxField, false)
+	if c.id("package_name", &n.PackageName, l.MaxField, true) && !packageName.MatchString(n.PackageName) {
+		c.fail("package_name", "must be an Android package name such as com.example.app")
+	}
+
+	switch {
+	case n.Timestamp.IsZero():
+		c.fail("timestamp", "is required")
+	case n.Timestamp.After(now.Add(time.Duration(l.MaxFuture))):
+		c.fail("timestamp", "must not be more than %s ahead of the server time", time.Duration(l.MaxFuture))
+	case l.MaxPast > 0 && n.Timestamp.Before(now.Add(-time.Duration(l.MaxPast))):
+		c.fail("timestamp", "must not be more than %s before the server time", time.Duration(l.MaxPast))
+	}
+
+	if len(n.Extras) > l.MaxExtras {
+		c.fail("extras", "must hold at most %d extras", l.MaxExtras)
+		return
+	}
+	if n.Extras != nil {
+		extras := make(map[string]string, len(n.Extras))
+		for key, value := range n.Extras {
+			key = normalize(key)
+			if utf8.RuneCountInString(key) > l.MaxField {
+				c.fail("extras", "keys must be at most %d characters", l.MaxField)
+				continue
+			}
+			value = normalize(value)
+			c.length("extras."+key, value, l.MaxExtraValue)
+			extras[key] = value
+		}
+		n.Extras = extras
+	}
+}
+
+// checker collects the invalid fields of a request
+type checker struct {
+	// prefix is put before field names
+	prefix string
+	errs   []models.FieldError
+}
+
+func (c *checker) fail(field, format string, args ...any) {
+	c.errs = append(c.errs, models.FieldError{Field: c.prefix + field, Message: fmt.Sprintf(format, args...)})
+}
+
+// text normalizes free text and checks its length. It reports whether the
+// value is valid and not empty.
+func (c *checker) text(field string, value *string, max int, required bool) bool {
+	*value = normalize(*value)
+	if *value == "" {
+		if required {
+			c.fail(field, "is required")
+		}
+		return false
+	}
+	return c.length(field, *value, max)
+}
+
+// id is text for identifiers, which also lose surrounding spaces
+func (c *checker) id(field string, value *string, max int, required bool) bool {
+	*value = strings.TrimSpace(*value)
+	return c.text(field, value, max, required)
+}
+
+func (c *checker) length(field, value string, max int) bool {
+	if utf8.RuneCountInString(value) > max {
+		c.fail(field, "must be at most %d characters", max)
+		return false
+	}
+	return true
+}
+
+// normalize returns s in NFC with invalid UTF-8 replaced and control
+// characters other than newlines and tabs removed
+func normalize(s string) string {
+	s = strings.ToValidUTF8(s, string(utf8.RuneError))
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) && r != '\n' && r != '\t' {
+			return -1
+		}
+		return r
+	}, s)
+	return norm.NFC.String(s)
+}
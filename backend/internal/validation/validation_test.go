@@ -0,0 +1,133 @@
+package validation
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lileye/backend/internal/config"
+	"github.com/lileye/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+var now = time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func testValidator(limits config.Validation) *Validator {
+	v := New(limits)
+	v.now = func() time.Time { return now }
+	return v
+}
+
+func valid() models.Notification {
+	return models.Notification{
+		Title:       "Alice",
+		Message:     "Lunch?",
+		Timestamp:   now,
+		PackageName: "com.whatsapp",
+		DeviceID:    "phone1",
+	}
+}
+
+func fields(errs []models.FieldError) []string {
+	var names []string
+	for _, e := range errs {
+		names = append(names, e.Field)
+	}
+	return names
+}
+
+func TestNotification(t *testing.T) {
+	v := testValidator(config.Default().Validation)
+
+	n := valid()
+	assert.Empty(t, v.Notification(&n))
+
+	assert.ElementsMatch(t, []string{"title", "message", "timestamp", "package_name", "device_id"},
+		fields(v.Notification(&models.Notification{})))
+
+	for _, pkg := range []string{"whatsapp", "com.", "1com.app", "com.what app", "com..app"} {
+		n = valid()
+		n.PackageName = pkg
+		assert.Equal(t, []string{"package_name"}, fields(v.Notification(&n)), pkg)
+	}
+	n = valid()
+	n.PackageName = " com.example.chat_2 "
+	assert.Empty(t, v.Notification(&n))
+	assert.Equal(t, "com.example.chat_2", n.PackageName)
+}
+
+func TestLengths(t *testing.T) {
+	limits := config.Default().Validation
+	limits.MaxTitle = 5
+	limits.MaxField = 12
+	limits.MaxExtras = 2
+	limits.MaxExtraValue = 3
+	v := testValidator(limits)
+
+	// Characters are counted, not bytes
+	n := valid()
+	n.Title = "héllo"
+	assert.Empty(t, v.Notification(&n))
+	n.Title = "hello!"
+	n.From = "Alice Smith Jr"
+	errs := v.Notification(&n)
+	assert.Equal(t, []string{"title", "from"}, fields(errs))
+	assert.Equal(t, "must be at most 5 characters", errs[0].Message)
+
+	n = valid()
+	n.Extras = map[string]string{"a": "1", "b": "long"}
+	assert.Equal(t, []string{"extras.b"}, fields(v.Notification(&n)))
+	n.Extras = map[string]string{"a": "1", "b": "2", "c": "3"}
+	assert.Equal(t, []string{"extras"}, fields(v.Notification(&n)))
+}
+
+func TestTimestamp(t *testing.T) {
+	limits := config.Default().Validation
+	limits.MaxPast = config.Duration(24 * time.Hour)
+	v := testValidator(limits)
+
+	n := valid()
+	n.Timestamp = now.Add(5 * time.Minute)
+	assert.Empty(t, v.Notification(&n))
+	n.Timestamp = now.Add(11 * time.Minute)
+	errs := v.Notification(&n)
+	assert.Equal(t, []string{"timestamp"}, fields(errs))
+	assert.Contains(t, errs[0].Message, "ahead of the server time")
+
+	n.Timestamp = now.Add(-23 * time.Hour)
+	assert.Empty(t, v.Notification(&n))
+	n.Timestamp = now.Add(-25 * time.Hour)
+	assert.Equal(t, []string{"timestamp"}, fields(v.Notification(&n)))
+
+	// Without max_past, any age is accepted
+	v = testValidator(config.Default().Validation)
+	n.Timestamp = now.AddDate(-5, 0, 0)
+	assert.Empty(t, v.Notification(&n))
+}
+
+func TestNormalize(t *testing.T) {
+	v := testValidator(config.Default().Validation)
+
+	n := valid()
+	// "e" followed by a combining acute accent is composed into "é"
+	n.Title = "Rene\u0301e"
+	n.Message = "line\r\none\x00\ttab\xff"
+	n.Extras = map[string]string{"android.title\u0007": "Rene\u0301e"}
+	assert.Empty(t, v.Notification(&n))
+	assert.Equal(t, "Ren\u00e9e", n.Title)
+	assert.Equal(t, "line\none\ttab\ufffd", n.Message)
+	assert.Equal(t, map[string]string{"android.title": "Ren\u00e9e"}, n.Extras)
+
+	// Text made only of control characters is empty
+	n.Title = "\x00\x01"
+	assert.Equal(t, []string{"title"}, fields(v.Notification(&n)))
+}
+
+func TestNotifications(t *testing.T) {
+	v := testValidator(config.Default().Validation)
+
+	batch := []models.Notification{valid(), valid(), valid()}
+	batch[1].Title = strings.Repeat("x", 1001)
+	batch[2].DeviceID = ""
+	assert.Equal(t, []string{"[1].title", "[2].device_id"}, fields(v.Notifications(batch)))
+}
@@ -0,0 +1,48 @@
+// Package version holds build information embedded at link time, e.g.
+//
+//	go build -ldflags "-X github.com/lileye/backend/internal/version.Version=1.2.0 \
+//		-X github.com/lileye/backend/internal/version.Commit=$(git rev-parse HEAD) \
+//		-X github.com/lileye/backend/internal/version.BuildTime=$(date -u +%FT%TZ)"
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Set with -ldflags -X at build time
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildTime = ""
+)
+
+// Info describes the running build
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the build information. Commit and build time fall back to the
+// VCS stamp recorded by the Go toolchain when they were not set at link time.
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = setting.Value
+			case setting.Key == "vcs.time" && info.BuildTime == "":
+				info.BuildTime = setting.Value
+			}
+		}
+	}
+	return info
+}
@@ -35,7 +35,8 @@ echo -e "\033[0m"
 
 if [ "$confirm" = "YES" ]; then
     echo "Deleting all notifications..."
-    curl -X DELETE http://localhost:8080/api/notifications/all
+    # The admin CLI finds the server and key in LILEYE_URL and LILEYE_ADMIN_KEY
+    cd "$(dirname "$0")/.." && go run ./cmd/lileye purge -all -yes || exit 1
     echo "Done! All notifications have been deleted."
 else
     echo "Operation cancelled."
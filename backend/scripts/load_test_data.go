@@ -1,238 +1,433 @@
+// Command load_test_data sends conversation-shaped notification traffic,
+// generated by the fixtures package, to a running server, to fill it with
+// test data or to load and soak test it. Concurrent workers send requests
+// at a target rate, one notification at a time, in batches or over
+// WebSocket streams, and the latency percentiles and errors are reported at
+// the end.
+//
+//	go run ./scripts/load_test_data.go -rate 50 -workers 8 -duration 10m
+//
+// Requests beyond the rate limits of the server fail with HTTP 429; start
+// the server with -rate_limit.rules "" to load test past them.
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"math/rand"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/lileye/backend/internal/client"
+	"github.com/lileye/backend/internal/fixtures"
+	"github.com/lileye/backend/internal/models"
+	"golang.org/x/net/websocket"
 )
 
-type Notification struct {
-	Title       string    `json:"title"`
-	Message     string    `json:"message"`
-	Timestamp   time.Time `json:"timestamp"`
-	PackageName string    `json:"package_name"`
-	From        string    `json:"from"`
-	DeviceID    string    `json:"device_id"`
-}
+// Transports a notification can be sent over
+const (
+	transportSingle = "single"
+	transportBatch  = "batch"
+	// transportWebSocket sends each notification as a message of a stream
+	// that every worker keeps open
+	transportWebSocket = "websocket"
+)
 
-type AppInfo struct {
-	PackageName string
-	Name        string
-}
+// streamPath is the route of the notification stream
+const streamPath = "/api/v1/notifications/stream"
 
-var (
-	// Command line flags
-	daysBefore      = flag.Int("days-before", 14, "Number of days before today to generate notifications")
-	daysAfter       = flag.Int("days-after", 14, "Number of days after today to generate notifications")
-	minPerDay       = flag.Int("min-per-day", 2, "Minimum number of notifications per day")
-	maxPerDay       = flag.Int("max-per-day", 5, "Maximum number of notifications per day")
-	delayMs         = flag.Int("delay", 500, "Delay between notifications in milliseconds")
-	serverURL       = flag.String("server", "http://localhost:8080", "Server URL")
-	selectedDevices = flag.String("devices", "phone1,phone2,tablet1", "Comma-separated list of devices to generate notifications for")
+// options are the command line flags
+type options struct {
+	server    string
+	devices   []string
+	seed      int64
+	workers   int
+	rate      float64
+	duration  time.Duration
+	requests  int
+	transport string
+	batchSize int
+	timeout   time.Duration
+	progress  time.Duration
+}
 
-	// App categories
-	messagingApps = []AppInfo{
-		{"com.whatsapp", "WhatsApp"},
-		{"com.facebook.orca", "Messenger"},
-		{"com.telegram", "Telegram"},
-		{"com.snapchat.android", "Snapchat"},
-		{"com.instagram.android", "Instagram"},
+func parseFlags(args []string) (*options, error) {
+	fs := flag.NewFlagSet("load_test_data", flag.ContinueOnError)
+	opts := &options{}
+	var devices string
+	fs.StringVar(&opts.server, "server", "http://localhost:8080", "Server URL")
+	fs.StringVar(&devices, "devices", "phone1,phone2,tablet1", "Comma-separated list of devices to generate notifications for")
+	fs.Int64Var(&opts.seed, "seed", 1, "Seed of the generated traffic; the same seed sends the same notifications")
+	fs.IntVar(&opts.workers, "workers", 4, "Number of requests sent concurrently")
+	fs.Float64Var(&opts.rate, "rate", 10, "Target requests per second, arriving at random intervals; 0 sends as fast as the workers allow")
+	fs.DurationVar(&opts.duration, "duration", 30*time.Second, "How long to send for; 0 sends until -requests or an interrupt")
+	fs.IntVar(&opts.requests, "requests", 0, "Number of requests to send; 0 sends until -duration or an interrupt")
+	fs.StringVar(&opts.transport, "transport", transportSingle, "How notifications are sent: single (POST /api/v1/notifications), batch (POST /api/v1/notifications/batch) or websocket (GET "+streamPath+")")
+	fs.IntVar(&opts.batchSize, "batch-size", 50, "Notifications per request with -transport batch")
+	fs.DurationVar(&opts.timeout, "timeout", 10*time.Second, "Timeout of each request")
+	fs.DurationVar(&opts.progress, "progress", 10*time.Second, "How often progress is printed; 0 prints none")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
 	}
-
-	emailApps = []AppInfo{
-		{"com.google.android.gm", "Gmail"},
-		{"com.microsoft.office.outlook", "Outlook"},
-		{"com.yahoo.mobile.client.android.mail", "Yahoo Mail"},
+	for _, d := range strings.Split(devices, ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			opts.devices = append(opts.devices, d)
+		}
 	}
+	return opts, opts.validate()
+}
 
-	systemApps = []AppInfo{
-		{"com.android.systemui", "System"},
-		{"com.google.android.apps.nexuslauncher", "Launcher"},
-		{"com.android.settings", "Settings"},
+func (o *options) validate() error {
+	if o.server == "" {
+		return fmt.Errorf("server URL cannot be empty")
+	}
+	if _, err := client.New(o.server); err != nil {
+		return err
 	}
+	if len(o.devices) == 0 {
+		return fmt.Errorf("devices cannot be empty")
+	}
+	if o.workers < 1 {
+		return fmt.Errorf("workers must be at least 1")
+	}
+	if o.rate < 0 {
+		return fmt.Errorf("rate must be non-negative")
+	}
+	if o.duration < 0 || o.requests < 0 {
+		return fmt.Errorf("duration and requests must be non-negative")
+	}
+	switch o.transport {
+	case transportSingle, transportWebSocket:
+		o.batchSize = 1
+	case transportBatch:
+		if o.batchSize < 1 || o.batchSize > 500 {
+			return fmt.Errorf("batch-size must be between 1 and 500")
+		}
+	default:
+		return fmt.Errorf("transport must be %s, %s or %s", transportSingle, transportBatch, transportWebSocket)
+	}
+	return nil
+}
 
-	entertainmentApps = []AppInfo{
-		{"com.netflix.mediaclient", "Netflix"},
-		{"com.spotify.music", "Spotify"},
-		{"com.google.android.youtube", "YouTube"},
-		{"com.amazon.avod.thirdpartyclient", "Prime Video"},
+// sender posts notifications to the server
+type sender struct {
+	client    *client.Client
+	transport string
+	timeout   time.Duration
+	// stream configures the streams of the websocket transport
+	stream *websocket.Config
+}
+
+func newSender(opts *options) *sender {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = opts.workers
+	// The URL was checked by validate
+	c, _ := client.New(opts.server, client.WithHTTPClient(&http.Client{Transport: transport, Timeout: opts.timeout}))
+	s := &sender{client: c, transport: opts.transport, timeout: opts.timeout}
+
+	if opts.transport == transportWebSocket {
+		server, _ := url.Parse(strings.TrimSuffix(opts.server, "/"))
+		location := *server
+		location.Scheme = strings.Replace(server.Scheme, "http", "ws", 1)
+		location.Path += streamPath
+		// The server accepts streams from its own origin
+		s.stream = &websocket.Config{
+			Location: &location,
+			Origin:   server,
+			Version:  websocket.ProtocolVersionHybi13,
+			Dialer:   &net.Dialer{Timeout: opts.timeout},
+		}
 	}
+	return s
+}
 
-	// Sender names
-	messagingSenders = []string{"John", "Alice", "Bob", "Charlie", "Diana", "Emma"}
-	emailSenders    = []string{"boss@company.com", "hr@company.com", "team@project.com", "support@service.com"}
+// worker sends the requests of one worker
+type worker struct {
+	*sender
+	// conn is the stream of the websocket transport, opened on first use
+	// and again after an error
+	conn *websocket.Conn
+}
 
-	// Random source
-	rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
-)
+// send posts the notifications of one request
+func (w *worker) send(ctx context.Context, notifications []models.Notification) error {
+	var err error
+	switch w.transport {
+	case transportSingle:
+		_, err = w.client.CreateNotification(ctx, &notifications[0])
+	case transportBatch:
+		_, err = w.client.CreateNotifications(ctx, notifications)
+	case transportWebSocket:
+		err = w.sendStream(&notifications[0])
+	}
+	return err
+}
 
-func validateFlags() error {
-	if *daysBefore < 0 {
-		return fmt.Errorf("days-before must be non-negative")
+// sendStream sends a notification on the stream of the worker and waits
+// for its reply. Error replies are returned as the server would respond to
+// the same notification posted on its own.
+func (w *worker) sendStream(notification *models.Notification) error {
+	if w.conn == nil {
+		conn, err := websocket.DialConfig(w.stream)
+		if err != nil {
+			return err
+		}
+		w.conn = conn
 	}
-	if *daysAfter < 0 {
-		return fmt.Errorf("days-after must be non-negative")
+
+	var reply models.StreamReply
+	w.conn.SetDeadline(time.Now().Add(w.timeout))
+	err := websocket.JSON.Send(w.conn, notification)
+	if err == nil {
+		err = websocket.JSON.Receive(w.conn, &reply)
 	}
-	if *minPerDay < 1 {
-		return fmt.Errorf("min-per-day must be at least 1")
+	if err != nil {
+		w.close()
+		return err
 	}
-	if *maxPerDay < *minPerDay {
-		return fmt.Errorf("max-per-day must be greater than or equal to min-per-day")
+	if reply.Error != nil {
+		return &client.Error{
+			Method:     http.MethodGet,
+			Path:       streamPath,
+			StatusCode: reply.Status,
+			Status:     fmt.Sprintf("%d %s", reply.Status, http.StatusText(reply.Status)),
+			APIError:   *reply.Error,
+		}
 	}
-	if *delayMs < 0 {
-		return fmt.Errorf("delay must be non-negative")
+	return nil
+}
+
+// close closes the stream of the worker, if open
+func (w *worker) close() {
+	if w.conn != nil {
+		w.conn.Close()
+		w.conn = nil
 	}
-	if *serverURL == "" {
-		return fmt.Errorf("server URL cannot be empty")
+}
+
+// errorKind groups errors for the report, leaving out the URL and the
+// address of the connection
+func errorKind(err error) string {
+	var apiErr *client.Error
+	if errors.As(err, &apiErr) {
+		return fmt.Sprintf("HTTP %d %s", apiErr.StatusCode, http.StatusText(apiErr.StatusCode))
 	}
-	if *selectedDevices == "" {
-		return fmt.Errorf("devices cannot be empty")
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return "timeout"
 	}
-	return nil
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		err = ue.Err
+	}
+	msg := err.Error()
+	if i := strings.LastIndex(msg, ": "); i >= 0 {
+		msg = msg[i+2:]
+	}
+	return msg
 }
 
-func randomTime(date time.Time) time.Time {
-	hour := rnd.Intn(24)
-	minute := rnd.Intn(60)
-	second := rnd.Intn(60)
-	return time.Date(date.Year(), date.Month(), date.Day(), hour, minute, second, 0, time.UTC)
+// stats records the outcome of the requests of one worker
+type stats struct {
+	latencies     []time.Duration
+	notifications int
+	errors        map[string]int
 }
 
-func randomApp(apps []AppInfo) AppInfo {
-	return apps[rnd.Intn(len(apps))]
+// report summarises a run
+type report struct {
+	elapsed       time.Duration
+	requests      int
+	notifications int
+	failed        int
+	errors        map[string]int
+	latencies     []time.Duration
 }
 
-func randomSender(senders []string) string {
-	return senders[rnd.Intn(len(senders))]
+// counters are read by the progress printer while workers run
+type counters struct {
+	requests atomic.Int64
+	failed   atomic.Int64
 }
 
-func sendNotification(n Notification) error {
-	data, err := json.Marshal(n)
-	if err != nil {
-		return fmt.Errorf("error marshaling notification: %v", err)
+// run sends traffic until the duration or the number of requests is
+// reached, or ctx is cancelled
+func run(ctx context.Context, opts *options, out io.Writer) *report {
+	gen := fixtures.NewGenerator(opts.seed, fixtures.Devices(opts.devices...))
+	// Arrival times have their own source, so that timing does not change
+	// the notifications generated for a seed
+	arrivals := rand.New(rand.NewSource(opts.seed + 1))
+	s := newSender(opts)
+
+	if opts.duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.duration)
+		defer cancel()
 	}
 
-	url := fmt.Sprintf("%s/api/notifications", *serverURL)
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(data))
-	if err != nil {
-		return fmt.Errorf("error sending notification: %v", err)
+	jobs := make(chan []models.Notification, opts.workers)
+	go func() {
+		defer close(jobs)
+		next := time.Now()
+		for i := 0; opts.requests == 0 || i < opts.requests; i++ {
+			if opts.rate > 0 {
+				next = next.Add(time.Duration(arrivals.ExpFloat64() / opts.rate * float64(time.Second)))
+				timer := time.NewTimer(time.Until(next))
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return
+				case <-timer.C:
+				}
+			}
+			batch := make([]models.Notification, opts.batchSize)
+			for j := range batch {
+				batch[j] = gen.Next(time.Now().UTC())
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case jobs <- batch:
+			}
+		}
+	}()
+
+	var live counters
+	start := time.Now()
+	done := make(chan struct{})
+	if opts.progress > 0 {
+		go printProgress(out, opts.progress, start, &live, done)
 	}
-	defer resp.Body.Close()
 
-	// Read and discard response body
-	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
-		return fmt.Errorf("error reading response body: %v", err)
+	results := make([]stats, opts.workers)
+	var wg sync.WaitGroup
+	for w := range results {
+		wg.Add(1)
+		go func(st *stats) {
+			defer wg.Done()
+			st.errors = map[string]int{}
+			w := &worker{sender: s}
+			defer w.close()
+			for batch := range jobs {
+				sent := time.Now()
+				// Requests in flight finish even once the run is over
+				err := w.send(context.WithoutCancel(ctx), batch)
+				st.latencies = append(st.latencies, time.Since(sent))
+				live.requests.Add(1)
+				if err != nil {
+					st.errors[errorKind(err)]++
+					live.failed.Add(1)
+					continue
+				}
+				st.notifications += len(batch)
+			}
+		}(&results[w])
 	}
+	wg.Wait()
+	close(done)
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	r := &report{elapsed: time.Since(start), errors: map[string]int{}}
+	for _, st := range results {
+		r.requests += len(st.latencies)
+		r.notifications += st.notifications
+		r.latencies = append(r.latencies, st.latencies...)
+		for kind, n := range st.errors {
+			r.errors[kind] += n
+			r.failed += n
+		}
 	}
+	sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+	return r
+}
 
-	return nil
+func printProgress(out io.Writer, every time.Duration, start time.Time, live *counters, done <-chan struct{}) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			elapsed := time.Since(start)
+			requests := live.requests.Load()
+			fmt.Fprintf(out, "%s: %d requests, %d failed, %.1f requests/s\n",
+				elapsed.Round(time.Second), requests, live.failed.Load(), float64(requests)/elapsed.Seconds())
+		}
+	}
 }
 
-func generateNotifications() error {
-	now := time.Now().UTC()
-	startDate := now.AddDate(0, 0, -*daysBefore)
-	endDate := now.AddDate(0, 0, *daysAfter)
-
-	// Parse selected devices
-	devices := strings.Split(*selectedDevices, ",")
-	if len(devices) == 0 {
-		return fmt.Errorf("no devices specified")
-	}
-
-	for _, device := range devices {
-		fmt.Printf("Generating notifications for %s...\n", device)
-		
-		for date := startDate; date.Before(endDate); date = date.AddDate(0, 0, 1) {
-			// Generate random number of notifications for this day
-			numNotifications := rnd.Intn(*maxPerDay-*minPerDay+1) + *minPerDay
-			
-			for i := 0; i < numNotifications; i++ {
-				appCategory := rnd.Intn(4)
-				var notification Notification
-				
-				switch appCategory {
-				case 0: // Messaging apps
-					app := randomApp(messagingApps)
-					sender := randomSender(messagingSenders)
-					notification = Notification{
-						Title:       fmt.Sprintf("New message from %s", sender),
-						Message:     "Hey, how are you?",
-						Timestamp:   randomTime(date),
-						PackageName: app.PackageName,
-						From:        sender,
-						DeviceID:    device,
-					}
-					
-				case 1: // Email apps
-					app := randomApp(emailApps)
-					sender := randomSender(emailSenders)
-					notification = Notification{
-						Title:       fmt.Sprintf("New email from %s", sender),
-						Message:     "Important update about the project",
-						Timestamp:   randomTime(date),
-						PackageName: app.PackageName,
-						From:        sender,
-						DeviceID:    device,
-					}
-					
-				case 2: // System apps
-					app := randomApp(systemApps)
-					notification = Notification{
-						Title:       "System Update Available",
-						Message:     "A new system update is ready to install",
-						Timestamp:   randomTime(date),
-						PackageName: app.PackageName,
-						From:        "System",
-						DeviceID:    device,
-					}
-					
-				case 3: // Entertainment apps
-					app := randomApp(entertainmentApps)
-					notification = Notification{
-						Title:       "New content available",
-						Message:     "Check out the latest releases",
-						Timestamp:   randomTime(date),
-						PackageName: app.PackageName,
-						From:        app.Name,
-						DeviceID:    device,
-					}
-				}
+// percentile returns the p-th percentile of sorted latencies by the
+// nearest-rank method
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p/100*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
 
-				if err := sendNotification(notification); err != nil {
-					return fmt.Errorf("error sending notification: %v", err)
-				}
+func (r *report) print(out io.Writer, opts *options) {
+	rate := float64(r.requests) / r.elapsed.Seconds()
+	fmt.Fprintf(out, "\nSent %d requests with %d notifications in %s: %.1f requests/s",
+		r.requests, r.notifications, r.elapsed.Round(time.Millisecond), rate)
+	if opts.rate > 0 {
+		fmt.Fprintf(out, " (target %g)", opts.rate)
+	}
+	fmt.Fprintln(out)
+	if r.requests == 0 {
+		return
+	}
 
-				// Add a small delay between notifications
-				time.Sleep(time.Duration(*delayMs) * time.Millisecond)
-			}
-		}
+	fmt.Fprint(out, "Latency:")
+	for _, p := range []float64{50, 90, 95, 99} {
+		fmt.Fprintf(out, " p%g %s,", p, percentile(r.latencies, p).Round(10*time.Microsecond))
 	}
+	fmt.Fprintf(out, " max %s\n", r.latencies[len(r.latencies)-1].Round(10*time.Microsecond))
 
-	return nil
+	fmt.Fprintf(out, "Errors: %d (%.2f%%)\n", r.failed, 100*float64(r.failed)/float64(r.requests))
+	kinds := make([]string, 0, len(r.errors))
+	for kind := range r.errors {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool { return r.errors[kinds[i]] > r.errors[kinds[j]] })
+	for _, kind := range kinds {
+		fmt.Fprintf(out, "  %6d  %s\n", r.errors[kind], kind)
+	}
 }
 
 func main() {
-	flag.Parse()
-
-	if err := validateFlags(); err != nil {
+	opts, err := parseFlags(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
 		fmt.Printf("Error: %v\n", err)
-		os.Exit(1)
+		os.Exit(2)
 	}
 
-	if err := generateNotifications(); err != nil {
-		fmt.Printf("Error: %v\n", err)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	fmt.Printf("Sending to %s with %d workers (%s transport, seed %d)\n", opts.server, opts.workers, opts.transport, opts.seed)
+	r := run(ctx, opts, os.Stdout)
+	r.print(os.Stdout, opts)
+	if r.failed > 0 {
 		os.Exit(1)
 	}
-
-	fmt.Println("Test data generation complete!")
 }
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lileye/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+)
+
+func TestRun(t *testing.T) {
+	var notifications, requests atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/notifications/batch", r.URL.Path)
+		var batch []models.Notification
+		data, _ := io.ReadAll(r.Body)
+		assert.NoError(t, json.Unmarshal(data, &batch))
+		notifications.Add(int64(len(batch)))
+		if requests.Add(1)%5 == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		// The server returns the stored notifications
+		w.WriteHeader(http.StatusCreated)
+		w.Write(data)
+	}))
+	defer srv.Close()
+
+	opts := &options{server: srv.URL, devices: []string{"phone1"}, seed: 1, workers: 3,
+		requests: 20, transport: transportBatch, batchSize: 10, timeout: time.Second}
+	assert.NoError(t, opts.validate())
+	r := run(context.Background(), opts, io.Discard)
+
+	assert.Equal(t, 20, r.requests)
+	assert.Equal(t, int64(200), notifications.Load())
+	assert.Equal(t, 160, r.notifications)
+	assert.Equal(t, 4, r.failed)
+	assert.Equal(t, map[string]int{"HTTP 503 Service Unavailable": 4}, r.errors)
+	assert.Len(t, r.latencies, 20)
+}
+
+func TestRunWebSocket(t *testing.T) {
+	var notifications, streams atomic.Int64
+	srv := httptest.NewServer(websocket.Handler(func(conn *websocket.Conn) {
+		assert.Equal(t, streamPath, conn.Request().URL.Path)
+		streams.Add(1)
+		for {
+			var n models.Notification
+			if err := websocket.JSON.Receive(conn, &n); err != nil {
+				return
+			}
+			reply := models.StreamReply{Status: http.StatusCreated, Notification: &n}
+			if notifications.Add(1)%5 == 0 {
+				reply = models.StreamReply{Status: http.StatusTooManyRequests, Error: &models.APIError{Code: models.CodeRateLimited}}
+			}
+			websocket.JSON.Send(conn, reply)
+		}
+	}))
+	defer srv.Close()
+
+	opts := &options{server: srv.URL, devices: []string{"phone1"}, seed: 1, workers: 3,
+		requests: 20, transport: transportWebSocket, timeout: time.Second}
+	assert.NoError(t, opts.validate())
+	r := run(context.Background(), opts, io.Discard)
+
+	assert.Equal(t, 20, r.requests)
+	assert.Equal(t, int64(20), notifications.Load())
+	assert.Equal(t, 16, r.notifications)
+	assert.Equal(t, map[string]int{"HTTP 429 Too Many Requests": 4}, r.errors)
+	// Each worker keeps its stream open
+	assert.LessOrEqual(t, streams.Load(), int64(3))
+}
+
+func TestPercentile(t *testing.T) {
+	var sorted []time.Duration
+	for i := 1; i <= 100; i++ {
+		sorted = append(sorted, time.Duration(i)*time.Millisecond)
+	}
+	assert.Equal(t, 50*time.Millisecond, percentile(sorted, 50))
+	assert.Equal(t, 99*time.Millisecond, percentile(sorted, 99))
+	assert.Equal(t, 100*time.Millisecond, percentile(sorted, 100))
+	assert.Zero(t, percentile(nil, 50))
+}